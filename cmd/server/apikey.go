@@ -0,0 +1,44 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/november1306/go-vpn/internal/config"
+)
+
+// requireAPIKey guards client endpoints with the VPN_API_KEY bearer token when one is configured
+// Token pool tokens are accepted as well, since the operator already issued them to clients
+// Without a configured key requests pass through, leaving registration open
+func requireAPIKey(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if cfg.Server.APIKey == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || !validAPIToken(token) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeErrorJSON(w, http.StatusUnauthorized, "Invalid or missing API key")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// validAPIToken reports whether token is the API key or a token pool token
+// Every candidate is compared in constant time so response timing doesn't reveal valid tokens
+func validAPIToken(token string) bool {
+	valid := subtle.ConstantTimeCompare([]byte(token), []byte(cfg.Server.APIKey)) == 1
+
+	// Config.Validate already checked the format
+	tokenPools, _ := config.ParseTokenPools(cfg.Network.TokenPools)
+	for _, pool := range tokenPools {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(pool.Token)) == 1 {
+			valid = true
+		}
+	}
+	return valid
+}
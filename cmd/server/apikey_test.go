@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequireAPIKey(t *testing.T) {
+	previous := *cfg
+	t.Cleanup(func() { *cfg = previous })
+
+	handler := requireAPIKey(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name       string
+		apiKey     string
+		tokenPools string
+		header     string
+		want       int
+	}{
+		{"no key configured", "", "", "", http.StatusOK},
+		{"no key configured ignores header", "", "", "Bearer anything", http.StatusOK},
+		{"missing header", "secret", "", "", http.StatusUnauthorized},
+		{"wrong key", "secret", "", "Bearer wrong", http.StatusUnauthorized},
+		{"not a bearer token", "secret", "", "secret", http.StatusUnauthorized},
+		{"valid key", "secret", "", "Bearer secret", http.StatusOK},
+		{"token pool token", "secret", "poolA=10.1.0.0/24", "Bearer poolA", http.StatusOK},
+		{"unknown pool token", "secret", "poolA=10.1.0.0/24", "Bearer poolB", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg.Server.APIKey = tt.apiKey
+			cfg.Network.TokenPools = tt.tokenPools
+
+			req := httptest.NewRequest(http.MethodPost, "/api/register", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.want {
+				t.Errorf("Expected status %d, got %d", tt.want, rr.Code)
+			}
+			if rr.Code == http.StatusUnauthorized && rr.Header().Get("WWW-Authenticate") != "Bearer" {
+				t.Error("Expected WWW-Authenticate: Bearer on 401")
+			}
+		})
+	}
+}
+
+func TestRouterRequiresAPIKey(t *testing.T) {
+	previous := *cfg
+	t.Cleanup(func() { *cfg = previous })
+	cfg.Server.APIKey = "secret"
+
+	router := newRouter()
+	for _, path := range []string{"/api/register", "/api/unregister"} {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, path, nil))
+		if rr.Code != http.StatusUnauthorized {
+			t.Errorf("%s without API key: expected 401, got %d", path, rr.Code)
+		}
+	}
+
+	// Other endpoints stay open
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/health", nil))
+	if rr.Code == http.StatusUnauthorized {
+		t.Error("/health should not require the API key")
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// benchDeadline bounds one /api/bench transfer; the server-wide timeouts are too short for large ones
+const benchDeadline = 2 * time.Minute
+
+// BenchResponse reports an upload received by /api/bench
+type BenchResponse struct {
+	Bytes      int64  `json:"bytes"`
+	DurationMs int64  `json:"durationMs"` // Time the server spent reading the body
+	Timestamp  string `json:"timestamp"`
+}
+
+// handleBench serves throughput tests for 'vpn-cli bench'
+// GET ?bytes=N streams N bytes (0 is a latency probe); POST reads and discards the body
+func handleBench(w http.ResponseWriter, r *http.Request) {
+	if !cfg.Test.TestEndpoints {
+		writeErrorJSON(w, http.StatusNotFound, "Benchmark endpoint disabled (set VPN_TEST_ENDPOINTS=true)")
+		return
+	}
+
+	controller := http.NewResponseController(w)
+	controller.SetReadDeadline(time.Now().Add(benchDeadline))
+	controller.SetWriteDeadline(time.Now().Add(benchDeadline))
+
+	switch r.Method {
+	case http.MethodGet:
+		size, err := strconv.ParseInt(r.URL.Query().Get("bytes"), 10, 64)
+		if err != nil || size < 0 {
+			writeErrorJSON(w, http.StatusBadRequest, "Invalid bytes: "+r.URL.Query().Get("bytes"))
+			return
+		}
+		if size > cfg.Test.BenchMaxBytes {
+			writeErrorJSON(w, http.StatusBadRequest, fmt.Sprintf("bytes exceeds limit of %d", cfg.Test.BenchMaxBytes))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+		if _, err := io.CopyN(w, zeroReader{}, size); err != nil {
+			slog.Debug("Benchmark download interrupted", "error", err)
+		}
+
+	case http.MethodPost:
+		start := time.Now()
+		n, err := io.Copy(io.Discard, http.MaxBytesReader(w, r.Body, cfg.Test.BenchMaxBytes))
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				writeErrorJSON(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Upload exceeds limit of %d bytes", cfg.Test.BenchMaxBytes))
+				return
+			}
+			writeErrorJSON(w, http.StatusBadRequest, "Failed to read upload")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(BenchResponse{
+			Bytes:      n,
+			DurationMs: time.Since(start).Milliseconds(),
+			Timestamp:  responseTimestamp(),
+		})
+
+	default:
+		writeMethodNotAllowed(w, http.MethodGet, http.MethodPost)
+	}
+}
+
+// zeroReader is an endless source of zero bytes
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
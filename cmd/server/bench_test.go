@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandleBench(t *testing.T) {
+	startTestVPNServer(t) // Bench only answers clients inside the VPN network
+	router := newRouter()
+	saved := cfg.Test
+	t.Cleanup(func() { cfg.Test = saved })
+
+	tests := []struct {
+		name       string
+		enabled    bool
+		method     string
+		target     string
+		body       string
+		wantStatus int
+		wantBytes  int
+	}{
+		{name: "disabled", method: http.MethodGet, target: "/api/bench?bytes=10", wantStatus: http.StatusNotFound},
+		{name: "download", enabled: true, method: http.MethodGet, target: "/api/bench?bytes=4096", wantStatus: http.StatusOK, wantBytes: 4096},
+		{name: "latency probe", enabled: true, method: http.MethodGet, target: "/api/bench?bytes=0", wantStatus: http.StatusOK},
+		{name: "download over limit", enabled: true, method: http.MethodGet, target: "/api/bench?bytes=4097", wantStatus: http.StatusBadRequest},
+		{name: "invalid size", enabled: true, method: http.MethodGet, target: "/api/bench?bytes=-1", wantStatus: http.StatusBadRequest},
+		{name: "upload", enabled: true, method: http.MethodPost, target: "/api/bench", body: strings.Repeat("x", 1000), wantStatus: http.StatusOK},
+		{name: "upload over limit", enabled: true, method: http.MethodPost, target: "/api/bench", body: strings.Repeat("x", 4097), wantStatus: http.StatusRequestEntityTooLarge},
+		{name: "wrong method", enabled: true, method: http.MethodDelete, target: "/api/bench", wantStatus: http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg.Test.TestEndpoints = tt.enabled
+			cfg.Test.BenchMaxBytes = 4096
+
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			req.RemoteAddr = "10.0.0.2:40000"
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body.String())
+			}
+			if tt.method == http.MethodGet && tt.wantStatus == http.StatusOK && rec.Body.Len() != tt.wantBytes {
+				t.Errorf("Expected %d bytes, got %d", tt.wantBytes, rec.Body.Len())
+			}
+			if tt.method == http.MethodPost && tt.wantStatus == http.StatusOK && !strings.Contains(rec.Body.String(), `"bytes":1000`) {
+				t.Errorf("Expected upload size in response, got %s", rec.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// registrationRetryAfter is how long shed registrations are told to wait before retrying
+const registrationRetryAfter = time.Second
+
+// limitRegistrations refuses registrations beyond limit in flight with a 503 and Retry-After
+// Shedding keeps a burst from piling up goroutines behind the server lock and peer store;
+// a limit of 0 leaves next unbounded
+func limitRegistrations(limit int, next http.HandlerFunc) http.HandlerFunc {
+	if limit <= 0 {
+		return next
+	}
+
+	slots := make(chan struct{}, limit)
+	return func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case slots <- struct{}{}:
+			defer func() { <-slots }()
+			next(w, r)
+		default:
+			metrics.recordRegistrationFailure(errCodeBusy)
+			slog.Debug("Registration shed", "limit", limit, "remoteAddr", r.RemoteAddr)
+			w.Header().Set("Retry-After", strconv.Itoa(int(registrationRetryAfter.Seconds())))
+			writeErrorJSON(w, http.StatusServiceUnavailable, "Too many registrations in progress, retry shortly")
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestLimitRegistrations(t *testing.T) {
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	handler := limitRegistrations(1, func(w http.ResponseWriter, r *http.Request) {
+		entered <- struct{}{}
+		<-release
+		w.WriteHeader(http.StatusOK)
+	})
+
+	serve := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(http.MethodPost, "/api/register", nil))
+		return w
+	}
+
+	var wg sync.WaitGroup
+	var first *httptest.ResponseRecorder
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		first = serve()
+	}()
+	<-entered
+
+	shed := serve()
+	if shed.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 beyond the limit, got %d", shed.Code)
+	}
+	if shed.Header().Get("Retry-After") != "1" {
+		t.Errorf("Expected Retry-After 1, got %q", shed.Header().Get("Retry-After"))
+	}
+
+	close(release)
+	wg.Wait()
+	if first.Code != http.StatusOK {
+		t.Errorf("Expected in-flight registration to complete, got %d", first.Code)
+	}
+
+	// The slot is free again once the first registration finishes
+	go func() { <-entered }()
+	if w := serve(); w.Code != http.StatusOK {
+		t.Errorf("Expected registration after the burst to succeed, got %d", w.Code)
+	}
+}
+
+func TestLimitRegistrationsDisabled(t *testing.T) {
+	calls := 0
+	next := func(w http.ResponseWriter, r *http.Request) { calls++ }
+	handler := limitRegistrations(0, next)
+
+	for range 3 {
+		handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/register", nil))
+	}
+	if calls != 3 {
+		t.Errorf("Expected every request through without a limit, got %d", calls)
+	}
+}
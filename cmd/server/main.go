@@ -2,20 +2,26 @@ package main
 
 import (
 	"context"
+	"crypto/subtle"
 	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"log/slog"
 	"net/http"
+	"net/netip"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
 	"github.com/november1306/go-vpn/internal/config"
+	"github.com/november1306/go-vpn/internal/ipam"
 	"github.com/november1306/go-vpn/internal/server/vpnserver"
+	"github.com/november1306/go-vpn/internal/tcpshim"
 	"github.com/november1306/go-vpn/internal/version"
 	"github.com/november1306/go-vpn/internal/wireguard/keys"
 )
@@ -25,11 +31,20 @@ type RegisterRequest struct {
 }
 
 type RegisterResponse struct {
-	ServerPublicKey string `json:"serverPublicKey"`
-	ServerEndpoint  string `json:"serverEndpoint"`
-	ClientIP        string `json:"clientIP"`
-	Message         string `json:"message"`
-	Timestamp       string `json:"timestamp"`
+	ServerPublicKey     string   `json:"serverPublicKey"`
+	ServerEndpoint      string   `json:"serverEndpoint"`
+	ClientIP            string   `json:"clientIP"`             // Assigned address in CIDR form, e.g. 10.0.0.2/32
+	ClientAddress       string   `json:"clientAddress"`        // Assigned address without the prefix, e.g. 10.0.0.2
+	PersistentKeepalive int      `json:"persistentKeepalive"`  // Recommended keepalive in seconds (0 = off)
+	MTU                 int      `json:"mtu"`                  // Recommended tunnel MTU
+	NetworkCIDR         string   `json:"networkCIDR"`          // VPN subnet shared by all peers
+	Gateway             string   `json:"gateway"`              // Server address inside the VPN subnet
+	ServiceIPs          []string `json:"serviceIPs,omitempty"` // Addresses of services inside the VPN, e.g. DNS
+	TCPPort             int      `json:"tcpPort,omitempty"`    // TCP transport port on the endpoint host (omitted when disabled)
+	APIPort             int      `json:"apiPort"`              // Port the API listens on, reachable at the gateway over the tunnel
+	APITLS              bool     `json:"apiTLS"`               // API is served over HTTPS
+	Message             string   `json:"message"`
+	Timestamp           string   `json:"timestamp"`
 }
 
 type ErrorResponse struct {
@@ -37,12 +52,93 @@ type ErrorResponse struct {
 	Timestamp string `json:"timestamp"`
 }
 
+// PeerEnabledResponse confirms an admin enable/disable of a peer
+type PeerEnabledResponse struct {
+	PublicKey string `json:"publicKey"`
+	Enabled   bool   `json:"enabled"`
+	Timestamp string `json:"timestamp"`
+}
+
+// UnregisterRequest asks the server to drop a client's registration
+type UnregisterRequest struct {
+	ClientPublicKey string `json:"clientPublicKey"`
+	Timestamp       int64  `json:"timestamp"` // Unix seconds the proof was made at
+	Proof           string `json:"proof"`     // keys.ProveOwnership of the client key
+}
+
+// UnregisterResponse confirms a client removed its registration
+type UnregisterResponse struct {
+	PublicKey string `json:"publicKey"`
+	Message   string `json:"message"`
+	Timestamp string `json:"timestamp"`
+}
+
+// ReplaceKeyRequest asks the server to move a registration to a new client key
+type ReplaceKeyRequest struct {
+	OldPublicKey string `json:"oldPublicKey"`
+	NewPublicKey string `json:"newPublicKey"`
+	Timestamp    int64  `json:"timestamp"` // Unix seconds the proof was made at
+	Proof        string `json:"proof"`     // keys.ProveOwnership of the old key over both keys
+}
+
+// ReplaceKeyResponse confirms a key replacement and the IP the client keeps
+type ReplaceKeyResponse struct {
+	PublicKey string `json:"publicKey"`
+	ClientIP  string `json:"clientIP"`
+	Timestamp string `json:"timestamp"`
+}
+
+// ServiceDescriptor is returned from / so operators can see the server is up
+type ServiceDescriptor struct {
+	Name      string   `json:"name"`
+	Version   string   `json:"version"`
+	Endpoints []string `json:"endpoints"`
+}
+
+// serviceEndpoints lists the public routes advertised by the root descriptor
+var serviceEndpoints = []string{
+	"/api/register",
+	"/api/unregister",
+	"/api/peers/replace-key",
+	"/api/status",
+	"/api/network",
+	"/api/version",
+	"/api/vpn-test",
+	"/health",
+	"/metrics",
+}
+
+// ReconcileIPAMResponse reports allocator drift and whether it was repaired
+type ReconcileIPAMResponse struct {
+	Orphaned  []string `json:"orphaned"`  // Allocated IPs held by no registered peer
+	Untracked []string `json:"untracked"` // Peer IPs the allocator did not track
+	Fixed     bool     `json:"fixed"`
+	Timestamp string   `json:"timestamp"`
+}
+
+// NetworkResponse describes the client address pool, e.g. for split-tunnel routes to other peers
+// With several pools the CIDR, family and range fields are comma-separated and UsableCount is the total
+type NetworkResponse struct {
+	CIDR        string   `json:"cidr"`
+	Family      string   `json:"family"` // "ipv4" or "ipv6"
+	Gateway     string   `json:"gateway"`
+	Range       string   `json:"range"`
+	StartIP     string   `json:"startIP"`
+	EndIP       string   `json:"endIP"`
+	UsableCount int      `json:"usableCount"` // Addresses clients can be given
+	ServiceIPs  []string `json:"serviceIPs,omitempty"`
+	Timestamp   string   `json:"timestamp"`
+}
+
 type StatusResponse struct {
-	Status         string               `json:"status"`
-	ConnectedPeers int                  `json:"connectedPeers"`
-	Peers          []vpnserver.PeerInfo `json:"peers"`
-	ServerInfo     vpnserver.ServerInfo `json:"serverInfo"`
-	Timestamp      string               `json:"timestamp"`
+	Status               string               `json:"status"`
+	ConnectedPeers       int                  `json:"connectedPeers"`
+	Peers                []vpnserver.PeerInfo `json:"peers"`
+	ServerInfo           vpnserver.ServerInfo `json:"serverInfo"`
+	RegistrationFailures map[string]int64     `json:"registrationFailures"`
+	DeviceIPCErrors      map[string]int64     `json:"deviceIPCErrors,omitempty"` // Failed WireGuard device operations by type ("set", "get")
+	PeersUnsaved         bool                 `json:"peersUnsaved"`              // Peer changes are held in memory only because saving failed
+	Timestamp            string               `json:"timestamp"`
 }
 
 func writeErrorJSON(w http.ResponseWriter, status int, message string) {
@@ -50,72 +146,415 @@ func writeErrorJSON(w http.ResponseWriter, status int, message string) {
 	w.WriteHeader(status)
 	json.NewEncoder(w).Encode(ErrorResponse{
 		Error:     message,
-		Timestamp: time.Now().UTC().Format(time.RFC3339),
+		Timestamp: responseTimestamp(),
 	})
 }
 
+// writeMethodNotAllowed writes a JSON 405 with the Allow header set
+func writeMethodNotAllowed(w http.ResponseWriter, allowed ...string) {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	writeErrorJSON(w, http.StatusMethodNotAllowed, "Method not allowed")
+}
+
+// handleNotFound answers unmatched routes with a JSON 404 instead of Go's plain-text default
+func handleNotFound(w http.ResponseWriter, r *http.Request) {
+	writeErrorJSON(w, http.StatusNotFound, "Not found: "+r.URL.Path)
+}
+
 var vpnServer *vpnserver.VPNServer
 var cfg *config.Config
 
 func handleRegister(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		writeErrorJSON(w, http.StatusMethodNotAllowed, "Method not allowed")
+		metrics.recordRegistrationFailure(errCodeMethodNotAllowed)
+		writeMethodNotAllowed(w, http.MethodPost)
 		return
 	}
 
 	var req RegisterRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		metrics.recordRegistrationFailure(errCodeInvalidJSON)
 		writeErrorJSON(w, http.StatusBadRequest, "Invalid JSON")
 		return
 	}
 
+	req.ClientPublicKey = strings.TrimSpace(req.ClientPublicKey)
 	if req.ClientPublicKey == "" {
+		metrics.recordRegistrationFailure(errCodeMissingKey)
 		writeErrorJSON(w, http.StatusBadRequest, "clientPublicKey is required")
 		return
 	}
 
 	// Validate client public key format
 	if err := keys.ValidatePublicKey(req.ClientPublicKey); err != nil {
+		metrics.recordRegistrationFailure(errCodeInvalidKey)
 		writeErrorJSON(w, http.StatusBadRequest, "Invalid client public key format: "+err.Error())
 		return
 	}
 
-	// Add client to VPN server
-	clientIP := cfg.Network.ClientIPDemo // Use configured demo client IP
-	if err := vpnServer.AddClient(req.ClientPublicKey, clientIP); err != nil {
-		slog.Error("Failed to add client to VPN", "error", err)
-		writeErrorJSON(w, http.StatusInternalServerError, "Failed to add client to VPN: "+err.Error())
+	// Allocate an IP and add client to VPN server
+	// A bearer token selects the caller's reserved pool; without one the default pool is used
+	var token string
+	if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		token = bearer
+	}
+	registration, err := vpnServer.RegisterClientWithToken(req.ClientPublicKey, token)
+	if err != nil {
+		metrics.recordRegistrationFailure(registrationErrorCode(err))
+		switch {
+		case errors.Is(err, vpnserver.ErrServerPublicKey):
+			writeErrorJSON(w, http.StatusBadRequest, "Client public key must differ from the server's")
+		case errors.Is(err, ipam.ErrNoAvailableIPs):
+			slog.Warn("Registration refused: client IP pool exhausted", "peer", keys.ShortID(req.ClientPublicKey))
+			writeErrorJSON(w, http.StatusServiceUnavailable, "No client IPs available: the VPN address pool is exhausted")
+		default:
+			slog.Error("Failed to add client to VPN", "error", err)
+			writeErrorJSON(w, http.StatusInternalServerError, "Failed to add client to VPN: "+err.Error())
+		}
 		return
 	}
 
 	// Get server info for client
 	serverInfo, err := vpnServer.GetServerInfo()
 	if err != nil {
+		metrics.recordRegistrationFailure(errCodeInternal)
 		writeErrorJSON(w, http.StatusInternalServerError, "Failed to get server info")
 		return
 	}
 
-	slog.Info("Client registered successfully", "clientIP", clientIP)
+	// Audit record: the short ID correlates with other peer logs without exposing the key
+	slog.Info("Client registered successfully",
+		"peer", keys.ShortID(req.ClientPublicKey),
+		"clientIP", registration.ClientIP,
+		"remoteAddr", r.RemoteAddr,
+		"forwardedFor", firstHeaderValue(r, "X-Forwarded-For"))
 
 	// Return connection details
 	response := RegisterResponse{
-		ServerPublicKey: serverInfo.PublicKey,
-		ServerEndpoint:  serverInfo.Endpoint,
-		ClientIP:        clientIP + "/32",
-		Message:         "Registration successful - VPN tunnel established",
-		Timestamp:       time.Now().UTC().Format(time.RFC3339),
+		ServerPublicKey:     serverInfo.PublicKey,
+		ServerEndpoint:      publicEndpoint(serverInfo, r),
+		ClientIP:            registration.ClientIP,
+		ClientAddress:       hostAddress(registration.ClientIP),
+		PersistentKeepalive: cfg.Network.ClientKeepalive,
+		MTU:                 cfg.Network.ClientMTU,
+		NetworkCIDR:         registration.Network.CIDR,
+		Gateway:             registration.Network.Gateway,
+		ServiceIPs:          registration.Network.ServiceIPs,
+		TCPPort:             cfg.Server.TCPPort,
+		APIPort:             cfg.Server.APIPort,
+		APITLS:              cfg.Server.TLSEnabled,
+		Message:             cfg.Server.RegisterMessage,
+		Timestamp:           responseTimestamp(),
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
 
+// hostAddress strips the prefix length from a CIDR, returning other input unchanged
+func hostAddress(cidr string) string {
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		return cidr
+	}
+	return prefix.Addr().String()
+}
+
+// handleSetPeerEnabled suspends or resumes a registered peer without removing it
+func handleSetPeerEnabled(enabled bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeMethodNotAllowed(w, http.MethodPost)
+			return
+		}
+
+		var req RegisterRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeErrorJSON(w, http.StatusBadRequest, "Invalid JSON")
+			return
+		}
+
+		req.ClientPublicKey = strings.TrimSpace(req.ClientPublicKey)
+		if err := keys.ValidatePublicKey(req.ClientPublicKey); err != nil {
+			writeErrorJSON(w, http.StatusBadRequest, "Invalid client public key format: "+err.Error())
+			return
+		}
+
+		if err := vpnServer.SetPeerEnabled(req.ClientPublicKey, enabled); err != nil {
+			if errors.Is(err, vpnserver.ErrPeerNotFound) {
+				writeErrorJSON(w, http.StatusNotFound, "Peer not registered")
+				return
+			}
+			slog.Error("Failed to change peer state", "error", err)
+			writeErrorJSON(w, http.StatusInternalServerError, "Failed to change peer state: "+err.Error())
+			return
+		}
+
+		response := PeerEnabledResponse{
+			PublicKey: req.ClientPublicKey,
+			Enabled:   enabled,
+			Timestamp: responseTimestamp(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// handleUnregister removes a client's peer and returns its IP to the pool
+func handleUnregister(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	var req UnregisterRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErrorJSON(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	req.ClientPublicKey = strings.TrimSpace(req.ClientPublicKey)
+	if err := keys.ValidatePublicKey(req.ClientPublicKey); err != nil {
+		writeErrorJSON(w, http.StatusBadRequest, "Invalid client public key format: "+err.Error())
+		return
+	}
+
+	if err := vpnServer.VerifyKeyOwnership(req.ClientPublicKey, req.Proof, req.Timestamp, keys.ProofUnregister, req.ClientPublicKey); err != nil {
+		writeOwnershipError(w, err)
+		return
+	}
+
+	if err := vpnServer.RemoveClient(req.ClientPublicKey); err != nil {
+		switch {
+		case errors.Is(err, vpnserver.ErrPeerNotFound):
+			writeErrorJSON(w, http.StatusNotFound, "Peer not registered")
+		case errors.Is(err, vpnserver.ErrServerNotRunning):
+			writeErrorJSON(w, http.StatusServiceUnavailable, "VPN server not running")
+		default:
+			slog.Error("Failed to unregister client", "error", err)
+			writeErrorJSON(w, http.StatusInternalServerError, "Failed to unregister client: "+err.Error())
+		}
+		return
+	}
+
+	slog.Info("Client unregistered",
+		"peer", keys.ShortID(req.ClientPublicKey),
+		"remoteAddr", r.RemoteAddr,
+		"forwardedFor", firstHeaderValue(r, "X-Forwarded-For"))
+
+	response := UnregisterResponse{
+		PublicKey: req.ClientPublicKey,
+		Message:   "Client unregistered",
+		Timestamp: responseTimestamp(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// handleReplaceKey swaps a client's public key while keeping its assigned IP
+// The request must prove ownership of the old key, since peer keys are public
+func handleReplaceKey(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	var req ReplaceKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErrorJSON(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	req.OldPublicKey = strings.TrimSpace(req.OldPublicKey)
+	req.NewPublicKey = strings.TrimSpace(req.NewPublicKey)
+	if err := keys.ValidatePublicKey(req.OldPublicKey); err != nil {
+		writeErrorJSON(w, http.StatusBadRequest, "Invalid old public key format: "+err.Error())
+		return
+	}
+	if err := keys.ValidatePublicKey(req.NewPublicKey); err != nil {
+		writeErrorJSON(w, http.StatusBadRequest, "Invalid new public key format: "+err.Error())
+		return
+	}
+
+	if err := vpnServer.VerifyKeyOwnership(req.OldPublicKey, req.Proof, req.Timestamp, keys.ProofReplaceKey, req.OldPublicKey, req.NewPublicKey); err != nil {
+		writeOwnershipError(w, err)
+		return
+	}
+
+	clientIP, err := vpnServer.ReplacePeerKey(req.OldPublicKey, req.NewPublicKey)
+	if err != nil {
+		switch {
+		case errors.Is(err, vpnserver.ErrPeerNotFound):
+			writeErrorJSON(w, http.StatusNotFound, "Peer not registered")
+		case errors.Is(err, vpnserver.ErrPeerExists):
+			writeErrorJSON(w, http.StatusConflict, "New public key is already registered")
+		case errors.Is(err, vpnserver.ErrServerPublicKey):
+			writeErrorJSON(w, http.StatusBadRequest, "New public key must differ from the server's")
+		default:
+			slog.Error("Failed to replace peer key", "error", err)
+			writeErrorJSON(w, http.StatusInternalServerError, "Failed to replace peer key: "+err.Error())
+		}
+		return
+	}
+
+	response := ReplaceKeyResponse{
+		PublicKey: req.NewPublicKey,
+		ClientIP:  clientIP,
+		Timestamp: responseTimestamp(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// writeOwnershipError reports a failed key ownership check
+func writeOwnershipError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, vpnserver.ErrServerNotRunning):
+		writeErrorJSON(w, http.StatusServiceUnavailable, "VPN server not running")
+	case errors.Is(err, keys.ErrProofExpired):
+		writeErrorJSON(w, http.StatusForbidden, "Key ownership proof expired; check the client clock")
+	default:
+		writeErrorJSON(w, http.StatusForbidden, "Invalid key ownership proof")
+	}
+}
+
+// hasAdminToken reports whether r carries the configured admin bearer token
+func hasAdminToken(r *http.Request) bool {
+	if cfg.Server.AdminToken == "" {
+		return false
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(cfg.Server.AdminToken)) == 1
+}
+
+// requireAdminToken guards a handler with the configured admin bearer token
+// Without a configured token the endpoint is disabled rather than left open
+func requireAdminToken(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if cfg.Server.AdminToken == "" {
+			writeErrorJSON(w, http.StatusForbidden, "Admin API disabled: set VPN_ADMIN_TOKEN to enable it")
+			return
+		}
+
+		if !hasAdminToken(r) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeErrorJSON(w, http.StatusUnauthorized, "Invalid or missing admin token")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// handleUpdatePeer sets a peer's label and notes; omitted fields are left unchanged
+func handleUpdatePeer(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPatch {
+		writeMethodNotAllowed(w, http.MethodPatch)
+		return
+	}
+
+	publicKey := r.PathValue("pubkey")
+	if err := keys.ValidatePublicKey(publicKey); err != nil {
+		writeErrorJSON(w, http.StatusBadRequest, "Invalid public key format: "+err.Error())
+		return
+	}
+
+	var update vpnserver.PeerMetadata
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		writeErrorJSON(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	peer, err := vpnServer.PeerStore().UpdatePeerMetadata(publicKey, update)
+	switch {
+	case errors.Is(err, vpnserver.ErrPeerNotFound):
+		writeErrorJSON(w, http.StatusNotFound, "Peer not registered")
+		return
+	case errors.Is(err, vpnserver.ErrPeerMetadataTooLong):
+		writeErrorJSON(w, http.StatusBadRequest, err.Error())
+		return
+	case err != nil:
+		slog.Error("Failed to update peer metadata", "error", err)
+		writeErrorJSON(w, http.StatusInternalServerError, "Failed to update peer: "+err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(peer)
+}
+
+// handleReconcileIPAM reports drift between the IP allocator and the peer store
+// With ?fix=true the drift is repaired, releasing orphaned allocations
+func handleReconcileIPAM(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeMethodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	fix := false
+	if value := r.URL.Query().Get("fix"); value != "" {
+		var err error
+		if fix, err = strconv.ParseBool(value); err != nil {
+			writeErrorJSON(w, http.StatusBadRequest, "Invalid fix parameter: "+value)
+			return
+		}
+	}
+
+	drift, err := vpnServer.ReconcileIPAM(fix)
+	if err != nil {
+		slog.Error("Failed to reconcile IP allocator", "error", err)
+		writeErrorJSON(w, http.StatusInternalServerError, "Failed to reconcile IP allocator: "+err.Error())
+		return
+	}
+
+	response := ReconcileIPAMResponse{
+		Orphaned:  drift.Orphaned,
+		Untracked: drift.Untracked,
+		Fixed:     fix && !drift.Empty(),
+		Timestamp: responseTimestamp(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+const (
+	// defaultStatusWatchTimeout is how long ?watch=true waits for a peer event when no timeout is given
+	defaultStatusWatchTimeout = 30 * time.Second
+
+	// maxStatusWatchTimeout bounds how long a watcher can hold a connection open
+	maxStatusWatchTimeout = 2 * time.Minute
+)
+
+// handleStatus reports server and peer state
+// With ?watch=true it first waits for a peer event or ?timeout (default 30s), so dashboards can long-poll
 func handleStatus(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		writeErrorJSON(w, http.StatusMethodNotAllowed, "Method not allowed")
+		writeMethodNotAllowed(w, http.MethodGet)
 		return
 	}
 
+	if watch, _ := strconv.ParseBool(r.URL.Query().Get("watch")); watch {
+		timeout := defaultStatusWatchTimeout
+		if value := r.URL.Query().Get("timeout"); value != "" {
+			parsed, err := time.ParseDuration(value)
+			if err != nil || parsed <= 0 {
+				writeErrorJSON(w, http.StatusBadRequest, "Invalid timeout: "+value)
+				return
+			}
+			timeout = min(parsed, maxStatusWatchTimeout)
+		}
+
+		// The server-wide write timeout would cut the long poll short
+		http.NewResponseController(w).SetWriteDeadline(time.Now().Add(timeout + cfg.Timeouts.HTTPWrite))
+
+		if !waitForPeerEvent(r.Context(), timeout) {
+			return // Client went away; nobody to answer
+		}
+	}
+
 	peers, err := vpnServer.GetConnectedClients()
 	if err != nil {
 		writeErrorJSON(w, http.StatusInternalServerError, "Failed to get peer info")
@@ -133,34 +572,140 @@ func handleStatus(w http.ResponseWriter, r *http.Request) {
 		status = "stopped"
 	}
 
+	// Full peer keys identify registrations, so only admins see them
+	if !hasAdminToken(r) {
+		for i := range peers {
+			peers[i].PublicKey = keys.ShortID(peers[i].PublicKey)
+		}
+	}
+
 	response := StatusResponse{
-		Status:         status,
-		ConnectedPeers: len(peers),
-		Peers:          peers,
-		ServerInfo:     serverInfo,
-		Timestamp:      time.Now().UTC().Format(time.RFC3339),
+		Status:               status,
+		ConnectedPeers:       len(peers),
+		Peers:                peers,
+		ServerInfo:           serverInfo,
+		RegistrationFailures: metrics.RegistrationFailures(),
+		DeviceIPCErrors:      vpnServer.IPCErrors(),
+		PeersUnsaved:         vpnServer.PeerStore().Unsaved(),
+		Timestamp:            responseTimestamp(),
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
 
-// generateSelfSignedCert creates a simple self-signed certificate for HTTPS
-func generateSelfSignedCert() (tls.Certificate, error) {
-	// For demo purposes, we'll create a simple in-memory cert
-	// In production, this would use proper certificate management
-	return tls.Certificate{}, nil
+// waitForPeerEvent blocks until a peer event is published or timeout elapses
+// Returns false if ctx was cancelled first
+func waitForPeerEvent(ctx context.Context, timeout time.Duration) bool {
+	events := vpnServer.Subscribe()
+	defer vpnServer.Unsubscribe(events)
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-events:
+	case <-timer.C:
+	case <-ctx.Done():
+		return false
+	}
+	return true
+}
+
+// newRouter registers all HTTP routes
+// Unmatched paths fall through to handleRoot, which returns a JSON 404
+func newRouter() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", handleRoot)
+	mux.Handle("/api/register", requireAPIKey(limitRegistrations(cfg.Server.MaxRegistrations, handleRegister)))
+	mux.Handle("/api/unregister", requireAPIKey(http.HandlerFunc(handleUnregister)))
+	mux.HandleFunc("/api/peers/replace-key", handleReplaceKey)
+	mux.HandleFunc("/api/status", handleStatus)
+	mux.HandleFunc("/api/network", handleNetwork)
+	mux.HandleFunc("/api/admin/peers/enable", requireAdminToken(handleSetPeerEnabled(true)))
+	mux.HandleFunc("/api/admin/peers/disable", requireAdminToken(handleSetPeerEnabled(false)))
+	mux.HandleFunc("/api/admin/reconcile-ipam", requireAdminToken(handleReconcileIPAM))
+	mux.HandleFunc("/api/admin/peers/{pubkey...}", requireAdminToken(handleUpdatePeer)) // Keys may contain '/'
+	mux.HandleFunc("/api/version", handleVersion)
+	mux.HandleFunc("/health", handleHealth)
+	mux.HandleFunc("/metrics", handleMetrics)
+
+	// VPN test endpoint - only accessible through VPN network
+	mux.HandleFunc("/api/vpn-test", requireVPNSource(handleVPNTest))
+	mux.HandleFunc("/api/bench", requireVPNSource(handleBench)) // Disabled unless VPN_TEST_ENDPOINTS is set
+
+	return mux
+}
+
+// newTokenPoolAllocator combines the default allocator with one pool per API token
+// Pools are named by position, never by token, since names show up in logs and status output
+// Token pools hold released IPs for stickyTTL, like the default allocator
+func newTokenPoolAllocator(defaultAllocator *ipam.Allocator, tokenPools []config.TokenPool, stickyTTL time.Duration) (*ipam.MultiPoolAllocator, map[string]string, error) {
+	pools := []ipam.Pool{{Name: vpnserver.DefaultPool, Allocator: defaultAllocator}}
+	poolNames := make(map[string]string, len(tokenPools))
+
+	for i, tokenPool := range tokenPools {
+		prefix, err := netip.ParsePrefix(tokenPool.CIDR)
+		if err != nil {
+			return nil, nil, fmt.Errorf("token pool %d: %w", i+1, err)
+		}
+		// The first host is the server's address in the tenant subnet, as in the default pool
+		gateway := prefix.Masked().Addr().Next()
+		poolConfig := ipam.ConfigFromNetwork(prefix.Masked().String(), gateway.String())
+		poolConfig.StickyTTL = stickyTTL
+		allocator, err := ipam.NewAllocator(poolConfig)
+		if err != nil {
+			return nil, nil, fmt.Errorf("token pool %d: %w", i+1, err)
+		}
+
+		name := fmt.Sprintf("token-%d", i+1)
+		pools = append(pools, ipam.Pool{Name: name, Allocator: allocator})
+		poolNames[tokenPool.Token] = name
+	}
+
+	multiPool, err := ipam.NewMultiPoolAllocator(pools...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return multiPool, poolNames, nil
+}
+
+// addDemoPeer adds the hardcoded test peer, but only in demo mode
+// Reports whether a peer was added
+func addDemoPeer(server *vpnserver.VPNServer, testCfg config.TestConfig) (bool, error) {
+	if !testCfg.DemoMode || testCfg.PeerPublicKey == "" {
+		return false, nil
+	}
+
+	slog.Info("Adding hardcoded test peer", "peerIP", testCfg.PeerIP)
+	if err := server.AddClient(testCfg.PeerPublicKey, testCfg.PeerIP); err != nil {
+		return false, err
+	}
+	return true, nil
 }
 
 func main() {
-	fmt.Printf("go-vpn minimal server %s\n", version.Version)
-	fmt.Println("=== Demo 2: Railway deployment with hardcoded peer ===")
+	fmt.Printf("go-vpn minimal server %s\n", version.Get())
+
+	// Optional .env file fills in variables the real environment leaves unset
+	if envFile := os.Getenv(config.EnvFileVar); envFile != "" {
+		if err := config.LoadEnvFile(envFile); err != nil {
+			log.Fatalf("Failed to load env file: %v", err)
+		}
+		slog.Info("Loaded env file", "path", envFile)
+	}
 
 	// Load configuration
 	cfg = config.Load()
 	if err := cfg.Validate(); err != nil {
 		log.Fatalf("Invalid configuration: %v", err)
 	}
+	for _, warning := range cfg.Warnings() {
+		slog.Warn("Inconsistent network configuration", "detail", warning)
+	}
+	if cfg.Test.DemoMode {
+		fmt.Println("=== Demo 2: Railway deployment with hardcoded peer ===")
+	}
 	fmt.Printf("Configuration loaded - API port: %d, VPN port: %d\n", cfg.Server.APIPort, cfg.Server.VPNPort)
 
 	// Generate server key pair
@@ -171,20 +716,83 @@ func main() {
 
 	fmt.Printf("Server public key: %s\n", serverPublicKey)
 
-	// Initialize VPN server with persistent storage
-	dataDir := "data" // Create data directory for peer persistence
-	vpnServer, err = vpnserver.NewUserspaceVPNServer(dataDir)
+	// Initialize VPN server with persistent storage, unless peers re-register on every boot
+	if cfg.Server.PersistPeers {
+		// Config.Validate already accepted the policy
+		corruptPolicy, _ := vpnserver.ParseCorruptPolicy(cfg.Server.CorruptPeers)
+		dataDir := "data" // Create data directory for peer persistence
+		peerStore, err := vpnserver.NewPeerStoreWithPolicy(dataDir, corruptPolicy)
+		if err != nil {
+			log.Fatalf("Failed to create VPN server: %v", err)
+		}
+		vpnServer = vpnserver.NewVPNServerWithPeerStore(vpnserver.NewUserspaceBackend(), peerStore)
+	} else {
+		slog.Info("Peer persistence disabled - peers are kept in memory and must re-register after a restart")
+		vpnServer = vpnserver.NewVPNServerWithPeerStore(vpnserver.NewUserspaceBackend(), vpnserver.NewInMemoryPeerStore())
+	}
+
+	// Allocate client IPs from the configured IPAM range
+	ipamConfig := ipam.ConfigFromNetwork(cfg.Network.IPAMCIDR, cfg.Network.IPAMGateway)
+	ipamConfig.ServerIP = cfg.Network.ServerIP
+	ipamConfig.StickyTTL = cfg.Server.StickyIPTTL
+	// Config.Validate already checked the addresses
+	ipamConfig.ServiceIPs, _ = config.ParseServiceIPs(cfg.Network.ServiceIPs, cfg.Network.IPAMCIDR)
+	allocator, err := ipam.NewAllocator(ipamConfig)
+	if err != nil {
+		log.Fatalf("Failed to create IP allocator: %v", err)
+	}
+
+	// Config.Validate already checked the format
+	tokenPools, _ := config.ParseTokenPools(cfg.Network.TokenPools)
+	if len(tokenPools) == 0 {
+		vpnServer.SetAllocator(allocator)
+	} else {
+		multiPool, poolNames, err := newTokenPoolAllocator(allocator, tokenPools, cfg.Server.StickyIPTTL)
+		if err != nil {
+			log.Fatalf("Failed to create token pools: %v", err)
+		}
+		vpnServer.SetAllocator(multiPool)
+		vpnServer.SetTokenPools(poolNames)
+		slog.Info("Token pools enabled", "pools", len(tokenPools))
+	}
+
+	if cfg.Server.AllocationAudit != "" {
+		audit, err := vpnserver.OpenAllocationAudit(cfg.Server.AllocationAudit)
+		if err != nil {
+			log.Fatalf("Failed to open allocation audit log: %v", err)
+		}
+		defer audit.Close()
+		vpnServer.SetAllocationAudit(audit)
+		slog.Info("Allocation audit enabled", "destination", cfg.Server.AllocationAudit)
+	}
+
+	// Config.Validate already accepted the mode, so this only maps "off" to the zero value
+	sourceFilter, err := vpnserver.ParseSourceFilterMode(cfg.Server.SourceFilter)
 	if err != nil {
-		log.Fatalf("Failed to create VPN server: %v", err)
+		log.Fatalf("Invalid source filter: %v", err)
+	}
+
+	persistPolicy, err := vpnserver.ParsePersistPolicy(cfg.Server.PersistPolicy)
+	if err != nil {
+		log.Fatalf("Invalid persist policy: %v", err)
 	}
 
 	serverConfig := vpnserver.ServerConfig{
-		InterfaceName: cfg.Server.InterfaceName,
-		PrivateKey:    serverPrivateKey,
-		ListenPort:    cfg.Server.VPNPort,
-		ServerIP:      cfg.Network.ServerIP,
+		InterfaceName:        cfg.Server.InterfaceName,
+		PrivateKey:           serverPrivateKey,
+		ListenPort:           cfg.Server.VPNPort,
+		ListenAddr:           cfg.Server.ListenAddr,
+		ServerIP:             cfg.Network.ServerIP,
+		Fwmark:               cfg.Server.Fwmark,
+		MaxAllowedIPsPerPeer: cfg.Network.MaxAllowedIPs,
+		AllocationAttempts:   cfg.Network.AllocAttempts,
+		SourceFilter:         sourceFilter,
+		PeerActiveWindow:     cfg.Server.PeerActiveWindow,
+		PersistPolicy:        persistPolicy,
 	}
 
+	var tcpTransport *tcpshim.Server // Started with the VPN server when VPN_TCP_PORT is set
+
 	// Start VPN server
 	ctx := context.Background()
 	slog.Info("Starting VPN server", "interface", cfg.Server.InterfaceName, "port", cfg.Server.VPNPort)
@@ -201,28 +809,24 @@ func main() {
 	} else {
 		slog.Info("VPN server started successfully")
 
-		// Add hardcoded test peer if configured
-		if cfg.Test.PeerPublicKey != "" {
-			slog.Info("Adding hardcoded test peer", "peerIP", cfg.Test.PeerIP)
-			if err := vpnServer.AddClient(cfg.Test.PeerPublicKey, cfg.Test.PeerIP); err != nil {
-				slog.Error("Failed to add test peer", "error", err)
-			} else {
-				slog.Info("Test peer added successfully")
+		// Add hardcoded test peer in demo mode
+		if added, err := addDemoPeer(vpnServer, cfg.Test); err != nil {
+			slog.Error("Failed to add test peer", "error", err)
+		} else if added {
+			slog.Info("Test peer added successfully")
+		}
+
+		// Clients behind UDP-blocking networks reach WireGuard through the TCP relay
+		if cfg.Server.TCPPort > 0 {
+			tcpTransport, err = startTCPTransport(cfg.Server.TCPPort, cfg.Server.VPNPort)
+			if err != nil {
+				log.Fatalf("Failed to start TCP transport: %v", err)
 			}
 		}
 	}
 
-	// Set up HTTP server
-	mux := http.NewServeMux()
-	mux.HandleFunc("/api/register", handleRegister)
-	mux.HandleFunc("/api/status", handleStatus)
-	mux.HandleFunc("/health", handleHealth)
-
-	// VPN test endpoint - only accessible through VPN network
-	mux.HandleFunc("/api/vpn-test", handleVPNTest)
-
-	// Use mux directly without validation middleware
-	var handler http.Handler = mux
+	// Use router directly without validation middleware
+	handler := newRouter()
 
 	// Create HTTP server
 	httpServer := &http.Server{
@@ -234,11 +838,26 @@ func main() {
 		IdleTimeout:  cfg.Timeouts.HTTPIdle,
 	}
 
+	// Clients must skip verification (or pin the certificate) since it is self-signed and regenerated on restart
+	if cfg.Server.TLSEnabled {
+		cert, err := generateSelfSignedCert(cfg.Server.ListenAddr)
+		if err != nil {
+			log.Fatalf("Failed to generate TLS certificate: %v", err)
+		}
+		slog.Info("Generated self-signed TLS certificate", "sha256", certFingerprint(cert), "validUntil", cert.Leaf.NotAfter)
+		httpServer.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	}
+
 	// Start HTTP server in goroutine
 	go func() {
-		slog.Info("HTTP API server starting", "port", cfg.Server.APIPort)
-		// For demo, use HTTP. In production, use HTTPS with proper certificates
-		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		slog.Info("HTTP API server starting", "port", cfg.Server.APIPort, "tls", cfg.Server.TLSEnabled)
+		var err error
+		if cfg.Server.TLSEnabled {
+			err = httpServer.ListenAndServeTLS("", "") // Certificate comes from TLSConfig
+		} else {
+			err = httpServer.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
 			log.Fatalf("HTTP server failed to start: %v", err)
 		}
 	}()
@@ -262,6 +881,13 @@ func main() {
 		}
 	}
 
+	if tcpTransport != nil {
+		slog.Info("Stopping TCP transport")
+		if err := tcpTransport.Close(); err != nil {
+			slog.Error("Error stopping TCP transport", "error", err)
+		}
+	}
+
 	// Stop HTTP server
 	slog.Info("Stopping HTTP server")
 	if err := httpServer.Shutdown(shutdownCtx); err != nil {
@@ -271,17 +897,106 @@ func main() {
 	slog.Info("Server shutdown complete")
 }
 
+// startTCPTransport relays WireGuard packets framed over TCP to the local UDP port
+func startTCPTransport(tcpPort, vpnPort int) (*tcpshim.Server, error) {
+	server, err := tcpshim.Listen(fmt.Sprintf(":%d", tcpPort), fmt.Sprintf("127.0.0.1:%d", vpnPort))
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		slog.Info("TCP transport listening", "port", tcpPort)
+		if err := server.Serve(); err != nil {
+			slog.Error("TCP transport stopped", "error", err)
+		}
+	}()
+	return server, nil
+}
+
+// handleRoot returns a read-only service descriptor for the bare / path
+func handleRoot(w http.ResponseWriter, r *http.Request) {
+	// "/" is a catch-all pattern, so it doubles as the JSON not-found handler
+	if r.URL.Path != "/" {
+		handleNotFound(w, r)
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	response := ServiceDescriptor{
+		Name:      "go-vpn",
+		Version:   version.Version,
+		Endpoints: serviceEndpoints,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		slog.Error("Failed to encode service descriptor", "error", err)
+	}
+}
+
+// handleVersion reports the server's version and build metadata
+func handleVersion(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(version.Get())
+}
+
+// handleNetwork reports the subnet, gateway and capacity clients are allocated from
+func handleNetwork(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	if vpnServer == nil {
+		writeErrorJSON(w, http.StatusServiceUnavailable, "VPN server not running")
+		return
+	}
+	info, ok := vpnServer.NetworkInfo()
+	if !ok {
+		writeErrorJSON(w, http.StatusServiceUnavailable, "No address pool configured")
+		return
+	}
+
+	response := NetworkResponse{
+		CIDR:        info.CIDR,
+		Family:      info.Family,
+		Gateway:     info.Gateway,
+		Range:       info.Range,
+		StartIP:     info.StartIP,
+		EndIP:       info.EndIP,
+		UsableCount: info.UsableCount,
+		ServiceIPs:  info.ServiceIPs,
+		Timestamp:   responseTimestamp(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
 // handleHealth provides a health check endpoint that returns JSON
 func handleHealth(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		writeErrorJSON(w, http.StatusMethodNotAllowed, "Method not allowed")
+		writeMethodNotAllowed(w, http.MethodGet)
 		return
 	}
 
 	response := map[string]interface{}{
 		"status":    "ok",
 		"message":   "Server is running",
-		"timestamp": time.Now().UTC().Format(time.RFC3339),
+		"proxy":     observeProxy(r), // Lets operators check what their proxy forwards
+		"timestamp": responseTimestamp(),
+	}
+	if vpnServer != nil {
+		response["peers"] = vpnServer.PeerCount()
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -295,7 +1010,7 @@ func handleHealth(w http.ResponseWriter, r *http.Request) {
 // handleVPNTest provides a test endpoint to verify VPN tunneling
 func handleVPNTest(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		writeErrorJSON(w, http.StatusMethodNotAllowed, "Method not allowed")
+		writeMethodNotAllowed(w, http.MethodGet)
 		return
 	}
 
@@ -308,7 +1023,7 @@ func handleVPNTest(w http.ResponseWriter, r *http.Request) {
 	response := map[string]interface{}{
 		"message":    "VPN tunnel test successful!",
 		"clientIP":   clientIP,
-		"serverTime": time.Now().UTC().Format(time.RFC3339),
+		"serverTime": responseTimestamp(),
 		"via":        "VPN tunnel",
 		"note":       "If you can see this, your VPN tunnel is working",
 	}
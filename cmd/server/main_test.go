@@ -5,11 +5,13 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
 	"strings"
 	"testing"
 
 	"github.com/november1306/go-vpn/internal/config"
 	"github.com/november1306/go-vpn/internal/server/vpnserver"
+	"github.com/november1306/go-vpn/internal/version"
 	"github.com/november1306/go-vpn/internal/wireguard/keys"
 )
 
@@ -132,6 +134,28 @@ func TestHandleRegister(t *testing.T) {
 		}
 	})
 
+	t.Run("whitespace-only client public key", func(t *testing.T) {
+		jsonData, _ := json.Marshal(RegisterRequest{ClientPublicKey: "   \n"})
+		req := httptest.NewRequest(http.MethodPost, "/api/register", bytes.NewBuffer(jsonData))
+		req.Header.Set("Content-Type", "application/json")
+
+		rr := httptest.NewRecorder()
+		handleRegister(rr, req)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected status %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+
+		var errResp ErrorResponse
+		if err := json.NewDecoder(rr.Body).Decode(&errResp); err != nil {
+			t.Fatalf("Failed to decode error response: %v", err)
+		}
+
+		if !strings.Contains(errResp.Error, "clientPublicKey is required") {
+			t.Errorf("Expected 'clientPublicKey is required' error, got %s", errResp.Error)
+		}
+	})
+
 	t.Run("invalid client public key format", func(t *testing.T) {
 		reqBody := RegisterRequest{
 			ClientPublicKey: "invalid-key-format",
@@ -159,6 +183,137 @@ func TestHandleRegister(t *testing.T) {
 	})
 }
 
+func TestHandleVersion(t *testing.T) {
+	t.Run("build info", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/version", nil)
+		rr := httptest.NewRecorder()
+		handleVersion(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		var fields map[string]string
+		if err := json.NewDecoder(rr.Body).Decode(&fields); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		for _, key := range []string{"version", "commit", "buildDate"} {
+			if fields[key] == "" {
+				t.Errorf("Expected non-empty %q in %v", key, fields)
+			}
+		}
+		if fields["version"] != version.Version {
+			t.Errorf("Expected version %s, got %s", version.Version, fields["version"])
+		}
+	})
+
+	t.Run("wrong method", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/api/version", nil)
+		rr := httptest.NewRecorder()
+		handleVersion(rr, req)
+
+		if rr.Code != http.StatusMethodNotAllowed {
+			t.Errorf("Expected status %d, got %d", http.StatusMethodNotAllowed, rr.Code)
+		}
+	})
+}
+
+func TestHandleRoot(t *testing.T) {
+	t.Run("service descriptor", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		rr := httptest.NewRecorder()
+		handleRoot(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		var descriptor ServiceDescriptor
+		if err := json.NewDecoder(rr.Body).Decode(&descriptor); err != nil {
+			t.Fatalf("Failed to decode descriptor: %v", err)
+		}
+
+		if descriptor.Version != version.Version {
+			t.Errorf("Expected version %s, got %s", version.Version, descriptor.Version)
+		}
+
+		for _, endpoint := range []string{"/api/register", "/api/status", "/health"} {
+			found := false
+			for _, e := range descriptor.Endpoints {
+				if e == endpoint {
+					found = true
+				}
+			}
+			if !found {
+				t.Errorf("Expected endpoint %s in descriptor, got %v", endpoint, descriptor.Endpoints)
+			}
+		}
+	})
+
+	t.Run("unknown path", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/does-not-exist", nil)
+		rr := httptest.NewRecorder()
+		handleRoot(rr, req)
+
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("Expected status %d, got %d", http.StatusNotFound, rr.Code)
+		}
+	})
+
+	t.Run("invalid method", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		rr := httptest.NewRecorder()
+		handleRoot(rr, req)
+
+		if rr.Code != http.StatusMethodNotAllowed {
+			t.Errorf("Expected status %d, got %d", http.StatusMethodNotAllowed, rr.Code)
+		}
+	})
+}
+
+func TestRouterJSONErrors(t *testing.T) {
+	router := newRouter()
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		wantStatus int
+		wantAllow  string
+	}{
+		{name: "unknown path", method: http.MethodGet, path: "/api/does-not-exist", wantStatus: http.StatusNotFound},
+		{name: "unknown nested path", method: http.MethodPost, path: "/nope/at/all", wantStatus: http.StatusNotFound},
+		{name: "wrong method on status", method: http.MethodDelete, path: "/api/status", wantStatus: http.StatusMethodNotAllowed, wantAllow: http.MethodGet},
+		{name: "wrong method on register", method: http.MethodGet, path: "/api/register", wantStatus: http.StatusMethodNotAllowed, wantAllow: http.MethodPost},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d", tt.wantStatus, rr.Code)
+			}
+			if contentType := rr.Header().Get("Content-Type"); !strings.Contains(contentType, "application/json") {
+				t.Errorf("Expected JSON content type, got %s", contentType)
+			}
+			if tt.wantAllow != "" && rr.Header().Get("Allow") != tt.wantAllow {
+				t.Errorf("Expected Allow %q, got %q", tt.wantAllow, rr.Header().Get("Allow"))
+			}
+
+			var errResp ErrorResponse
+			if err := json.NewDecoder(rr.Body).Decode(&errResp); err != nil {
+				t.Fatalf("Failed to decode error response: %v", err)
+			}
+			if errResp.Error == "" || errResp.Timestamp == "" {
+				t.Errorf("Expected error and timestamp in response, got %+v", errResp)
+			}
+		})
+	}
+}
+
 func TestWriteErrorJSON(t *testing.T) {
 	rr := httptest.NewRecorder()
 	writeErrorJSON(rr, http.StatusBadRequest, "test error")
@@ -185,3 +340,96 @@ func TestWriteErrorJSON(t *testing.T) {
 		t.Error("Expected timestamp in error response")
 	}
 }
+
+func TestAddDemoPeer(t *testing.T) {
+	_, peerPubKey, err := keys.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("Failed to generate peer key: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		testCfg   config.TestConfig
+		wantAdded bool
+	}{
+		{
+			name:      "demo mode off skips configured peer",
+			testCfg:   config.TestConfig{DemoMode: false, PeerPublicKey: peerPubKey, PeerIP: "10.0.0.2"},
+			wantAdded: false,
+		},
+		{
+			name:      "demo mode on without peer key",
+			testCfg:   config.TestConfig{DemoMode: true, PeerIP: "10.0.0.2"},
+			wantAdded: false,
+		},
+		{
+			name:      "demo mode on adds peer",
+			testCfg:   config.TestConfig{DemoMode: true, PeerPublicKey: peerPubKey, PeerIP: "10.0.0.2"},
+			wantAdded: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, backend, _ := startTestVPNServer(t)
+
+			added, err := addDemoPeer(server, tt.testCfg)
+			if err != nil {
+				t.Fatalf("addDemoPeer failed: %v", err)
+			}
+			if added != tt.wantAdded {
+				t.Errorf("Expected added=%v, got %v", tt.wantAdded, added)
+			}
+
+			_, exists := server.PeerStore().GetPeer(peerPubKey)
+			if exists != tt.wantAdded {
+				t.Errorf("Expected peer registered=%v, got %v", tt.wantAdded, exists)
+			}
+			if _, live := backend.Peer(peerPubKey); live != tt.wantAdded {
+				t.Errorf("Expected backend peer present=%v, got %v", tt.wantAdded, live)
+			}
+		})
+	}
+}
+
+func TestHandleNetwork(t *testing.T) {
+	t.Run("reports the address pool", func(t *testing.T) {
+		startTestVPNServer(t)
+
+		rr := httptest.NewRecorder()
+		handleNetwork(rr, httptest.NewRequest(http.MethodGet, "/api/network", nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+		}
+
+		var resp NetworkResponse
+		if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		want := NetworkResponse{
+			CIDR:        "10.0.0.0/24",
+			Family:      "ipv4",
+			Gateway:     "10.0.0.1",
+			Range:       "10.0.0.2-10.0.0.254",
+			StartIP:     "10.0.0.2",
+			EndIP:       "10.0.0.254",
+			UsableCount: 253,
+			Timestamp:   resp.Timestamp,
+		}
+		if !reflect.DeepEqual(resp, want) {
+			t.Errorf("Got %+v, want %+v", resp, want)
+		}
+	})
+
+	t.Run("unavailable without a server", func(t *testing.T) {
+		previous := vpnServer
+		vpnServer = nil
+		defer func() { vpnServer = previous }()
+
+		rr := httptest.NewRecorder()
+		handleNetwork(rr, httptest.NewRequest(http.MethodGet, "/api/network", nil))
+		if rr.Code != http.StatusServiceUnavailable {
+			t.Errorf("Expected status 503, got %d", rr.Code)
+		}
+	})
+}
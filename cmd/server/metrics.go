@@ -0,0 +1,129 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/november1306/go-vpn/internal/ipam"
+	"github.com/november1306/go-vpn/internal/server/vpnserver"
+)
+
+// Registration failure reasons, used as metric labels
+const (
+	errCodeMethodNotAllowed = "method_not_allowed"
+	errCodeInvalidJSON      = "invalid_json"
+	errCodeMissingKey       = "missing_key"
+	errCodeInvalidKey       = "invalid_key"
+	errCodePoolExhausted    = "pool_exhausted"
+	errCodeServerNotRunning = "server_not_running"
+	errCodeNotPersisted     = "not_persisted"
+	errCodeContention       = "contention"
+	errCodeBusy             = "busy"
+	errCodeInternal         = "internal"
+)
+
+// serverMetrics holds in-process counters exposed via /metrics and /api/status
+type serverMetrics struct {
+	mu                   sync.Mutex
+	registrationFailures map[string]int64
+}
+
+func newServerMetrics() *serverMetrics {
+	return &serverMetrics{
+		registrationFailures: make(map[string]int64),
+	}
+}
+
+var metrics = newServerMetrics()
+
+// recordRegistrationFailure increments the failure counter for a reason
+func (m *serverMetrics) recordRegistrationFailure(reason string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.registrationFailures[reason]++
+}
+
+// RegistrationFailures returns a copy of the failure counters keyed by reason
+func (m *serverMetrics) RegistrationFailures() map[string]int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	result := make(map[string]int64, len(m.registrationFailures))
+	for reason, count := range m.registrationFailures {
+		result[reason] = count
+	}
+	return result
+}
+
+// registrationErrorCode maps a RegisterClient error to a failure reason
+func registrationErrorCode(err error) string {
+	switch {
+	case errors.Is(err, ipam.ErrNoAvailableIPs):
+		return errCodePoolExhausted
+	case errors.Is(err, vpnserver.ErrServerNotRunning):
+		return errCodeServerNotRunning
+	case errors.Is(err, vpnserver.ErrPeerNotPersisted):
+		return errCodeNotPersisted
+	case errors.Is(err, vpnserver.ErrAllocationContention):
+		return errCodeContention
+	case errors.Is(err, vpnserver.ErrServerPublicKey):
+		return errCodeInvalidKey
+	default:
+		return errCodeInternal
+	}
+}
+
+// deviceIPCErrors returns the VPN server's device IPC failure counts, or nil if it has none
+func deviceIPCErrors() map[string]int64 {
+	if vpnServer == nil {
+		return nil
+	}
+	return vpnServer.IPCErrors()
+}
+
+// handleMetrics exposes counters in the Prometheus text format
+func handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeMethodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	failures := metrics.RegistrationFailures()
+	reasons := make([]string, 0, len(failures))
+	for reason := range failures {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+
+	var b strings.Builder
+	b.WriteString("# HELP govpn_registration_failures_total Registration failures by reason.\n")
+	b.WriteString("# TYPE govpn_registration_failures_total counter\n")
+	for _, reason := range reasons {
+		fmt.Fprintf(&b, "govpn_registration_failures_total{reason=%q} %d\n", reason, failures[reason])
+	}
+
+	if vpnServer != nil {
+		b.WriteString("# HELP govpn_peers Peers configured on the WireGuard device.\n")
+		b.WriteString("# TYPE govpn_peers gauge\n")
+		fmt.Fprintf(&b, "govpn_peers %d\n", vpnServer.PeerCount())
+	}
+
+	if ipcErrors := deviceIPCErrors(); ipcErrors != nil {
+		b.WriteString("# HELP govpn_device_ipc_errors_total Failed WireGuard device operations by type (set = configure, get = query).\n")
+		b.WriteString("# TYPE govpn_device_ipc_errors_total counter\n")
+		for _, op := range []string{vpnserver.IPCOpGet, vpnserver.IPCOpSet} {
+			fmt.Fprintf(&b, "govpn_device_ipc_errors_total{op=%q} %d\n", op, ipcErrors[op])
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	if _, err := w.Write([]byte(b.String())); err != nil {
+		slog.Error("Failed to write metrics", "error", err)
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/november1306/go-vpn/internal/ipam"
+	"github.com/november1306/go-vpn/internal/server/vpnserver"
+	"github.com/november1306/go-vpn/internal/wireguard/keys"
+)
+
+// registerWithBody sends a raw register request through the handler
+func registerWithBody(method, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/api/register", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	handleRegister(rr, req)
+	return rr
+}
+
+// registerKeyBody returns a JSON register body for the given key
+func registerKeyBody(t *testing.T, key string) string {
+	t.Helper()
+	data, err := json.Marshal(RegisterRequest{ClientPublicKey: key})
+	if err != nil {
+		t.Fatalf("Failed to marshal request: %v", err)
+	}
+	return string(data)
+}
+
+func TestRegistrationFailureMetrics(t *testing.T) {
+	_, validKey, _ := keys.GenerateKeyPair()
+
+	tests := []struct {
+		name   string
+		method string
+		body   string
+		reason string
+	}{
+		{name: "wrong method", method: http.MethodGet, reason: errCodeMethodNotAllowed},
+		{name: "invalid JSON", method: http.MethodPost, body: "not json", reason: errCodeInvalidJSON},
+		{name: "missing key", method: http.MethodPost, body: registerKeyBody(t, ""), reason: errCodeMissingKey},
+		{name: "invalid key", method: http.MethodPost, body: registerKeyBody(t, "bad-key"), reason: errCodeInvalidKey},
+		{name: "server not running", method: http.MethodPost, body: registerKeyBody(t, validKey), reason: errCodeServerNotRunning},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := metrics.RegistrationFailures()
+
+			registerWithBody(tt.method, tt.body)
+
+			after := metrics.RegistrationFailures()
+			if after[tt.reason] != before[tt.reason]+1 {
+				t.Errorf("Expected %s counter to increment, before=%v after=%v", tt.reason, before, after)
+			}
+			for reason, count := range after {
+				if reason != tt.reason && count != before[reason] {
+					t.Errorf("Unexpected change to %s counter: %d -> %d", reason, before[reason], count)
+				}
+			}
+		})
+	}
+
+	t.Run("pool exhausted", func(t *testing.T) {
+		server, _, _ := startTestVPNServer(t)
+
+		// A /30 leaves room for just one client besides the gateway
+		allocator, err := ipam.NewAllocator(ipam.ConfigFromNetwork("10.0.0.0/30", "10.0.0.1"))
+		if err != nil {
+			t.Fatalf("Failed to create allocator: %v", err)
+		}
+		server.SetAllocator(allocator)
+
+		for i := 0; i < 1; i++ {
+			_, key, _ := keys.GenerateKeyPair()
+			if rr := registerWithBody(http.MethodPost, registerKeyBody(t, key)); rr.Code != http.StatusOK {
+				t.Fatalf("Registration %d failed with status %d", i+1, rr.Code)
+			}
+		}
+
+		before := metrics.RegistrationFailures()
+		_, key, _ := keys.GenerateKeyPair()
+		if rr := registerWithBody(http.MethodPost, registerKeyBody(t, key)); rr.Code != http.StatusServiceUnavailable {
+			t.Errorf("Expected 503 once the pool is exhausted, got %d", rr.Code)
+		}
+
+		after := metrics.RegistrationFailures()
+		if after[errCodePoolExhausted] != before[errCodePoolExhausted]+1 {
+			t.Errorf("Expected pool_exhausted counter to increment, before=%v after=%v", before, after)
+		}
+	})
+}
+
+func TestHandleMetrics(t *testing.T) {
+	registerWithBody(http.MethodPost, "not json")
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	rr := httptest.NewRecorder()
+	handleMetrics(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rr.Code)
+	}
+
+	body, _ := io.ReadAll(rr.Body)
+	if !bytes.Contains(body, []byte("# TYPE govpn_registration_failures_total counter")) {
+		t.Errorf("Expected metric type line, got:\n%s", body)
+	}
+	if !bytes.Contains(body, []byte(`govpn_registration_failures_total{reason="invalid_json"}`)) {
+		t.Errorf("Expected invalid_json series, got:\n%s", body)
+	}
+}
+
+func TestHandleMetricsDeviceIPCErrors(t *testing.T) {
+	previous := vpnServer
+	vpnServer = vpnserver.NewVPNServerWithPeerStore(vpnserver.NewUserspaceBackend(), vpnserver.NewInMemoryPeerStore())
+	defer func() { vpnServer = previous }()
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	rr := httptest.NewRecorder()
+	handleMetrics(rr, req)
+
+	body, _ := io.ReadAll(rr.Body)
+	for _, line := range []string{
+		"# TYPE govpn_device_ipc_errors_total counter",
+		`govpn_device_ipc_errors_total{op="get"} 0`,
+		`govpn_device_ipc_errors_total{op="set"} 0`,
+	} {
+		if !bytes.Contains(body, []byte(line)) {
+			t.Errorf("Expected %q in metrics, got:\n%s", line, body)
+		}
+	}
+}
+
+func TestHandleMetricsPeerCount(t *testing.T) {
+	startTestVPNServer(t)
+	_, key, _ := keys.GenerateKeyPair()
+	if rr := registerWithBody(http.MethodPost, registerKeyBody(t, key)); rr.Code != http.StatusOK {
+		t.Fatalf("Registration failed with status %d", rr.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	rr := httptest.NewRecorder()
+	handleMetrics(rr, req)
+
+	body, _ := io.ReadAll(rr.Body)
+	if !bytes.Contains(body, []byte("\ngovpn_peers 1\n")) {
+		t.Errorf("Expected govpn_peers 1, got:\n%s", body)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/november1306/go-vpn/internal/server/vpnserver"
+)
+
+// ProxyInfo reports the reverse proxy headers the server saw on a request
+// Operators compare it with their proxy settings, e.g. to confirm Railway forwards the scheme
+type ProxyInfo struct {
+	BehindProxy    bool   `json:"behindProxy"`
+	ForwardedFor   string `json:"forwardedFor,omitempty"`
+	ForwardedProto string `json:"forwardedProto,omitempty"`
+	ForwardedHost  string `json:"forwardedHost,omitempty"`
+	Scheme         string `json:"scheme"` // Scheme the client used, as far as the server can tell
+}
+
+// observeProxy reads the X-Forwarded-* headers of r
+func observeProxy(r *http.Request) ProxyInfo {
+	info := ProxyInfo{
+		ForwardedFor:   r.Header.Get("X-Forwarded-For"),
+		ForwardedProto: firstHeaderValue(r, "X-Forwarded-Proto"),
+		ForwardedHost:  firstHeaderValue(r, "X-Forwarded-Host"),
+	}
+	info.BehindProxy = info.ForwardedFor != "" || info.ForwardedProto != "" || info.ForwardedHost != ""
+
+	switch {
+	case info.ForwardedProto != "":
+		info.Scheme = strings.ToLower(info.ForwardedProto)
+	case r.TLS != nil:
+		info.Scheme = "https"
+	default:
+		info.Scheme = "http"
+	}
+	return info
+}
+
+// firstHeaderValue returns the first entry of a comma-separated header
+// Proxy chains append to X-Forwarded-*, so the first entry is the one nearest the client
+func firstHeaderValue(r *http.Request, name string) string {
+	value, _, _ := strings.Cut(r.Header.Get(name), ",")
+	return strings.TrimSpace(value)
+}
+
+// publicEndpoint returns the WireGuard endpoint for info, filling in the host of a port-only
+// endpoint when the request came through a proxy, using the public host the client addressed
+// WireGuard endpoints have no scheme, so X-Forwarded-Proto only signals that a proxy is present
+func publicEndpoint(info vpnserver.ServerInfo, r *http.Request) string {
+	if info.Host != "" {
+		return info.Endpoint()
+	}
+
+	proxy := observeProxy(r)
+	if !proxy.BehindProxy {
+		return info.Endpoint()
+	}
+
+	host := proxy.ForwardedHost
+	if host == "" {
+		host = r.Host
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	info.Host = strings.Trim(host, "[]")
+	return info.Endpoint()
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/november1306/go-vpn/internal/server/vpnserver"
+	"github.com/november1306/go-vpn/internal/wireguard/keys"
+)
+
+func TestPublicEndpoint(t *testing.T) {
+	portOnly := vpnserver.ServerInfo{Port: 51820}
+
+	tests := []struct {
+		name    string
+		host    string
+		headers map[string]string
+		info    vpnserver.ServerInfo
+		want    string
+	}{
+		{"direct request keeps port-only endpoint", "vpn.example.com:8443", nil, portOnly, ":51820"},
+		{"forwarded proto uses request host", "vpn.example.com", map[string]string{"X-Forwarded-Proto": "https"}, portOnly, "vpn.example.com:51820"},
+		{"forwarded for uses request host without API port", "vpn.example.com:8443", map[string]string{"X-Forwarded-For": "203.0.113.7"}, portOnly, "vpn.example.com:51820"},
+		{"forwarded host wins over request host", "internal:8080", map[string]string{"X-Forwarded-Host": "vpn.example.com, proxy.internal", "X-Forwarded-Proto": "https"}, portOnly, "vpn.example.com:51820"},
+		{"IPv6 host", "[2001:db8::1]:8443", map[string]string{"X-Forwarded-Proto": "https"}, portOnly, "[2001:db8::1]:51820"},
+		{"known host is left alone", "vpn.example.com", map[string]string{"X-Forwarded-Proto": "https"}, vpnserver.ServerInfo{Host: "203.0.113.1", Port: 51820}, "203.0.113.1:51820"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/register", nil)
+			req.Host = tt.host
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+
+			if got := publicEndpoint(tt.info, req); got != tt.want {
+				t.Errorf("publicEndpoint(%+v) = %q, want %q", tt.info, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestObserveProxy(t *testing.T) {
+	t.Run("no proxy", func(t *testing.T) {
+		info := observeProxy(httptest.NewRequest(http.MethodGet, "/health", nil))
+		if info.BehindProxy || info.Scheme != "http" {
+			t.Errorf("Unexpected proxy info: %+v", info)
+		}
+	})
+
+	t.Run("direct TLS", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/health", nil)
+		req.TLS = &tls.ConnectionState{}
+		if info := observeProxy(req); info.BehindProxy || info.Scheme != "https" {
+			t.Errorf("Unexpected proxy info: %+v", info)
+		}
+	})
+
+	t.Run("TLS-terminating proxy", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/health", nil)
+		req.Header.Set("X-Forwarded-For", "203.0.113.7, 10.1.0.1")
+		req.Header.Set("X-Forwarded-Proto", "HTTPS")
+		info := observeProxy(req)
+		if !info.BehindProxy || info.Scheme != "https" || info.ForwardedFor != "203.0.113.7, 10.1.0.1" {
+			t.Errorf("Unexpected proxy info: %+v", info)
+		}
+	})
+}
+
+func TestHealthReportsProxyHeaders(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/health", nil)
+	req.Header.Set("X-Forwarded-For", "203.0.113.7")
+	req.Header.Set("X-Forwarded-Proto", "https")
+	rec := httptest.NewRecorder()
+	handleHealth(rec, req)
+
+	var response struct {
+		Proxy ProxyInfo `json:"proxy"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode health response: %v", err)
+	}
+	if !response.Proxy.BehindProxy || response.Proxy.ForwardedFor != "203.0.113.7" || response.Proxy.Scheme != "https" {
+		t.Errorf("Unexpected proxy info: %+v", response.Proxy)
+	}
+}
+
+func TestRegisterBehindProxy(t *testing.T) {
+	startTestVPNServer(t)
+
+	_, clientPubKey, _ := keys.GenerateKeyPair()
+	body, _ := json.Marshal(RegisterRequest{ClientPublicKey: clientPubKey})
+	req := httptest.NewRequest(http.MethodPost, "/api/register", bytes.NewReader(body))
+	req.Host = "go-vpn.up.railway.app"
+	req.Header.Set("X-Forwarded-Proto", "https")
+	req.Header.Set("X-Forwarded-For", "203.0.113.7")
+	rec := httptest.NewRecorder()
+	handleRegister(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var response RegisterResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode register response: %v", err)
+	}
+	if response.ServerEndpoint != "go-vpn.up.railway.app:51820" {
+		t.Errorf("Expected endpoint go-vpn.up.railway.app:51820, got %s", response.ServerEndpoint)
+	}
+}
@@ -0,0 +1,1026 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/november1306/go-vpn/internal/ipam"
+	"github.com/november1306/go-vpn/internal/server/vpnserver"
+	"github.com/november1306/go-vpn/internal/server/vpnserver/vpnservertest"
+	"github.com/november1306/go-vpn/internal/wireguard/keys"
+)
+
+// startTestVPNServer swaps the global vpnServer for one backed by an in-memory
+// backend and peer store, restoring the original when the test finishes
+func startTestVPNServer(t *testing.T) (*vpnserver.VPNServer, *vpnservertest.Backend, string) {
+	t.Helper()
+
+	serverPrivKey, serverPubKey, err := keys.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("Failed to generate server keys: %v", err)
+	}
+
+	backend := vpnservertest.NewBackend()
+	server := vpnserver.NewVPNServerWithPeerStore(backend, vpnserver.NewInMemoryPeerStore())
+
+	allocator, err := ipam.NewAllocator(ipam.DefaultConfig())
+	if err != nil {
+		t.Fatalf("Failed to create allocator: %v", err)
+	}
+	server.SetAllocator(allocator)
+
+	ctx := context.Background()
+	if err := server.Start(ctx, vpnserver.ServerConfig{
+		InterfaceName: "wg-e2e",
+		PrivateKey:    serverPrivKey,
+		ListenPort:    51820,
+		ServerIP:      "10.0.0.1/24",
+	}); err != nil {
+		t.Fatalf("Failed to start VPN server: %v", err)
+	}
+
+	previous := vpnServer
+	vpnServer = server
+	t.Cleanup(func() {
+		server.Stop(ctx)
+		vpnServer = previous
+	})
+
+	return server, backend, serverPubKey
+}
+
+// postRegister sends a registration request for the given public key
+func postRegister(t *testing.T, url, clientPubKey string) RegisterResponse {
+	t.Helper()
+
+	jsonData, err := json.Marshal(RegisterRequest{ClientPublicKey: clientPubKey})
+	if err != nil {
+		t.Fatalf("Failed to marshal request: %v", err)
+	}
+
+	resp, err := http.Post(url+"/api/register", "application/json", bytes.NewBuffer(jsonData))
+	if err != nil {
+		t.Fatalf("Registration request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var errResp ErrorResponse
+		json.NewDecoder(resp.Body).Decode(&errResp)
+		t.Fatalf("Expected status 200, got %d: %s", resp.StatusCode, errResp.Error)
+	}
+
+	var registerResp RegisterResponse
+	if err := json.NewDecoder(resp.Body).Decode(&registerResp); err != nil {
+		t.Fatalf("Failed to decode register response: %v", err)
+	}
+	return registerResp
+}
+
+func TestRegisterEndToEnd(t *testing.T) {
+	server, backend, serverPubKey := startTestVPNServer(t)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/register", handleRegister)
+	httpServer := httptest.NewServer(mux)
+	defer httpServer.Close()
+
+	_, clientPubKey1, _ := keys.GenerateKeyPair()
+	_, clientPubKey2, _ := keys.GenerateKeyPair()
+
+	first := postRegister(t, httpServer.URL, clientPubKey1)
+
+	t.Run("response fields", func(t *testing.T) {
+		if first.ServerPublicKey != serverPubKey {
+			t.Errorf("Expected server public key %s, got %s", serverPubKey, first.ServerPublicKey)
+		}
+		if first.ServerEndpoint != ":51820" {
+			t.Errorf("Expected server endpoint :51820, got %s", first.ServerEndpoint)
+		}
+		if first.ClientIP != "10.0.0.2/32" {
+			t.Errorf("Expected client IP 10.0.0.2/32, got %s", first.ClientIP)
+		}
+		if first.PersistentKeepalive != 25 {
+			t.Errorf("Expected persistent keepalive 25, got %d", first.PersistentKeepalive)
+		}
+		if first.MTU != 1420 {
+			t.Errorf("Expected MTU 1420, got %d", first.MTU)
+		}
+		if first.NetworkCIDR != "10.0.0.0/24" || first.Gateway != "10.0.0.1" {
+			t.Errorf("Expected network 10.0.0.0/24 via 10.0.0.1, got %s via %s", first.NetworkCIDR, first.Gateway)
+		}
+		if first.TCPPort != cfg.Server.TCPPort {
+			t.Errorf("Expected TCP port %d, got %d", cfg.Server.TCPPort, first.TCPPort)
+		}
+		if first.APIPort != cfg.Server.APIPort || first.APITLS != cfg.Server.TLSEnabled {
+			t.Errorf("Expected API port %d (TLS %v), got %d (TLS %v)", cfg.Server.APIPort, cfg.Server.TLSEnabled, first.APIPort, first.APITLS)
+		}
+		if first.Message == "" || first.Timestamp == "" {
+			t.Error("Expected message and timestamp in response")
+		}
+	})
+
+	t.Run("peer stored and applied", func(t *testing.T) {
+		peer, exists := server.PeerStore().GetPeer(clientPubKey1)
+		if !exists {
+			t.Fatal("Registered peer not found in peer store")
+		}
+		if peer.AllowedIPs != first.ClientIP {
+			t.Errorf("Stored allowed IPs %s, want %s", peer.AllowedIPs, first.ClientIP)
+		}
+
+		allowedIPs, exists := backend.Peer(clientPubKey1)
+		if !exists || len(allowedIPs) != 1 || allowedIPs[0] != first.ClientIP {
+			t.Errorf("Backend peer allowed IPs %v, want [%s]", allowedIPs, first.ClientIP)
+		}
+	})
+
+	t.Run("second registration gets a different IP", func(t *testing.T) {
+		second := postRegister(t, httpServer.URL, clientPubKey2)
+		if second.ClientIP == first.ClientIP {
+			t.Errorf("Second client received duplicate IP %s", second.ClientIP)
+		}
+		if second.ClientIP != "10.0.0.3/32" {
+			t.Errorf("Expected second client IP 10.0.0.3/32, got %s", second.ClientIP)
+		}
+		if server.PeerStore().Count() != 2 {
+			t.Errorf("Expected 2 stored peers, got %d", server.PeerStore().Count())
+		}
+	})
+}
+
+func TestRegisterAllocatesSequentialIPs(t *testing.T) {
+	startTestVPNServer(t)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/register", handleRegister)
+	httpServer := httptest.NewServer(mux)
+	defer httpServer.Close()
+
+	for _, want := range []string{"10.0.0.2/32", "10.0.0.3/32", "10.0.0.4/32"} {
+		_, clientPubKey, _ := keys.GenerateKeyPair()
+		if got := postRegister(t, httpServer.URL, clientPubKey).ClientIP; got != want {
+			t.Errorf("Expected client IP %s, got %s", want, got)
+		}
+	}
+}
+
+func TestRegisterPoolExhausted(t *testing.T) {
+	server, _, _ := startTestVPNServer(t)
+
+	// A /30 leaves room for just one client besides the gateway
+	allocator, err := ipam.NewAllocator(ipam.ConfigFromNetwork("10.0.0.0/30", "10.0.0.1"))
+	if err != nil {
+		t.Fatalf("Failed to create allocator: %v", err)
+	}
+	server.SetAllocator(allocator)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/register", handleRegister)
+	httpServer := httptest.NewServer(mux)
+	defer httpServer.Close()
+
+	_, firstKey, _ := keys.GenerateKeyPair()
+	postRegister(t, httpServer.URL, firstKey)
+
+	_, secondKey, _ := keys.GenerateKeyPair()
+	jsonData, _ := json.Marshal(RegisterRequest{ClientPublicKey: secondKey})
+	resp, err := http.Post(httpServer.URL+"/api/register", "application/json", bytes.NewBuffer(jsonData))
+	if err != nil {
+		t.Fatalf("Registration request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("Expected status 503, got %d", resp.StatusCode)
+	}
+	var errResp ErrorResponse
+	if err := json.NewDecoder(resp.Body).Decode(&errResp); err != nil {
+		t.Fatalf("Failed to decode error response: %v", err)
+	}
+	if !strings.Contains(errResp.Error, "exhausted") {
+		t.Errorf("Expected a pool exhaustion message, got %q", errResp.Error)
+	}
+}
+
+func TestRegisterLogsAuditFields(t *testing.T) {
+	startTestVPNServer(t)
+
+	var logs bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&logs, nil)))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+
+	_, clientPubKey, err := keys.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("Failed to generate client key: %v", err)
+	}
+	jsonData, _ := json.Marshal(RegisterRequest{ClientPublicKey: clientPubKey})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/register", bytes.NewBuffer(jsonData))
+	req.RemoteAddr = "198.51.100.7:40000"
+	req.Header.Set("X-Forwarded-For", "203.0.113.5, 10.1.0.1")
+	rr := httptest.NewRecorder()
+	handleRegister(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var record map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+		var entry map[string]any
+		if err := json.Unmarshal([]byte(line), &entry); err == nil && entry["msg"] == "Client registered successfully" {
+			record = entry
+		}
+	}
+	if record == nil {
+		t.Fatalf("No registration record in logs:\n%s", logs.String())
+	}
+
+	want := map[string]any{
+		"level":        "INFO",
+		"peer":         keys.ShortID(clientPubKey),
+		"clientIP":     "10.0.0.2/32",
+		"remoteAddr":   "198.51.100.7:40000",
+		"forwardedFor": "203.0.113.5",
+	}
+	for field, value := range want {
+		if record[field] != value {
+			t.Errorf("Expected %s=%v, got %v", field, value, record[field])
+		}
+	}
+
+	if strings.Contains(logs.String(), clientPubKey) {
+		t.Error("Full public key must never be logged")
+	}
+}
+
+func TestSetPeerEnabledEndpoint(t *testing.T) {
+	server, backend, _ := startTestVPNServer(t)
+
+	previousToken := cfg.Server.AdminToken
+	cfg.Server.AdminToken = "admin-secret"
+	defer func() { cfg.Server.AdminToken = previousToken }()
+
+	httpServer := httptest.NewServer(newRouter())
+	defer httpServer.Close()
+
+	_, clientPubKey, _ := keys.GenerateKeyPair()
+	registered := postRegister(t, httpServer.URL, clientPubKey)
+
+	postWithToken := func(path, pubKey, token string) *http.Response {
+		t.Helper()
+		jsonData, _ := json.Marshal(RegisterRequest{ClientPublicKey: pubKey})
+		req, _ := http.NewRequest(http.MethodPost, httpServer.URL+path, bytes.NewBuffer(jsonData))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Request to %s failed: %v", path, err)
+		}
+		return resp
+	}
+	post := func(path, pubKey string) *http.Response {
+		t.Helper()
+		return postWithToken(path, pubKey, "admin-secret")
+	}
+
+	t.Run("requires token", func(t *testing.T) {
+		for _, path := range []string{"/api/admin/peers/disable", "/api/admin/peers/enable"} {
+			for _, token := range []string{"", "wrong"} {
+				resp := postWithToken(path, clientPubKey, token)
+				resp.Body.Close()
+				if resp.StatusCode != http.StatusUnauthorized {
+					t.Errorf("%s with token %q: expected status 401, got %d", path, token, resp.StatusCode)
+				}
+			}
+		}
+		if _, exists := backend.Peer(clientPubKey); !exists {
+			t.Error("Unauthorized requests must not disable the peer")
+		}
+	})
+
+	t.Run("disable", func(t *testing.T) {
+		resp := post("/api/admin/peers/disable", clientPubKey)
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+		}
+		var body PeerEnabledResponse
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if body.Enabled || body.PublicKey != clientPubKey {
+			t.Errorf("Unexpected response %+v", body)
+		}
+		if _, exists := backend.Peer(clientPubKey); exists {
+			t.Error("Disabled peer should be removed from backend")
+		}
+		if peer, exists := server.PeerStore().GetPeer(clientPubKey); !exists || peer.AllowedIPs != registered.ClientIP {
+			t.Error("Disabled peer should keep its registration and IP")
+		}
+	})
+
+	t.Run("enable", func(t *testing.T) {
+		resp := post("/api/admin/peers/enable", clientPubKey)
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+		}
+		if _, exists := backend.Peer(clientPubKey); !exists {
+			t.Error("Enabled peer should be back on the backend")
+		}
+	})
+
+	t.Run("unknown peer", func(t *testing.T) {
+		_, unknown, _ := keys.GenerateKeyPair()
+		resp := post("/api/admin/peers/disable", unknown)
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("Expected status 404, got %d", resp.StatusCode)
+		}
+	})
+}
+
+func TestReplaceKeyEndpoint(t *testing.T) {
+	server, backend, serverPubKey := startTestVPNServer(t)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/register", handleRegister)
+	mux.HandleFunc("/api/peers/replace-key", handleReplaceKey)
+	httpServer := httptest.NewServer(mux)
+	defer httpServer.Close()
+
+	oldPriv, oldKey, _ := keys.GenerateKeyPair()
+	newPriv, newKey, _ := keys.GenerateKeyPair()
+	registered := postRegister(t, httpServer.URL, oldKey)
+
+	send := func(req ReplaceKeyRequest) *http.Response {
+		t.Helper()
+		jsonData, _ := json.Marshal(req)
+		resp, err := http.Post(httpServer.URL+"/api/peers/replace-key", "application/json", bytes.NewBuffer(jsonData))
+		if err != nil {
+			t.Fatalf("Replace key request failed: %v", err)
+		}
+		return resp
+	}
+
+	// signed builds a request proving ownership of the old key with signerPriv
+	signed := func(signerPriv, oldPublicKey, newPublicKey string) ReplaceKeyRequest {
+		t.Helper()
+		timestamp := time.Now().Unix()
+		proof, err := keys.ProveOwnership(signerPriv, serverPubKey, timestamp, keys.ProofReplaceKey, oldPublicKey, newPublicKey)
+		if err != nil {
+			t.Fatalf("Failed to prove ownership: %v", err)
+		}
+		return ReplaceKeyRequest{OldPublicKey: oldPublicKey, NewPublicKey: newPublicKey, Timestamp: timestamp, Proof: proof}
+	}
+
+	t.Run("missing proof rejected", func(t *testing.T) {
+		resp := send(ReplaceKeyRequest{OldPublicKey: oldKey, NewPublicKey: newKey})
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusForbidden {
+			t.Errorf("Expected status 403, got %d", resp.StatusCode)
+		}
+	})
+
+	t.Run("proof from another key rejected", func(t *testing.T) {
+		attackerPriv, attackerKey, _ := keys.GenerateKeyPair()
+		resp := send(signed(attackerPriv, oldKey, attackerKey))
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusForbidden {
+			t.Errorf("Expected status 403, got %d", resp.StatusCode)
+		}
+		if _, exists := server.PeerStore().GetPeer(oldKey); !exists {
+			t.Error("Registration should be untouched by a forged request")
+		}
+	})
+
+	t.Run("replace keeps IP", func(t *testing.T) {
+		req := signed(oldPriv, oldKey, newKey)
+		resp := send(req)
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+		}
+		var body ReplaceKeyResponse
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if body.PublicKey != newKey || body.ClientIP != registered.ClientIP {
+			t.Errorf("Unexpected response %+v", body)
+		}
+		if _, exists := backend.Peer(oldKey); exists {
+			t.Error("Old key should be removed from backend")
+		}
+		if peer, exists := server.PeerStore().GetPeer(newKey); !exists || peer.AllowedIPs != registered.ClientIP {
+			t.Error("New key should own the original registration")
+		}
+
+		replayed := send(req)
+		replayed.Body.Close()
+		if replayed.StatusCode != http.StatusForbidden {
+			t.Errorf("Replayed request: expected status 403, got %d", replayed.StatusCode)
+		}
+	})
+
+	t.Run("old key no longer registered", func(t *testing.T) {
+		_, another, _ := keys.GenerateKeyPair()
+		resp := send(signed(oldPriv, oldKey, another))
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("Expected status 404, got %d", resp.StatusCode)
+		}
+	})
+
+	t.Run("new key already registered", func(t *testing.T) {
+		_, otherKey, _ := keys.GenerateKeyPair()
+		postRegister(t, httpServer.URL, otherKey)
+
+		resp := send(signed(newPriv, newKey, otherKey))
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusConflict {
+			t.Errorf("Expected status 409, got %d", resp.StatusCode)
+		}
+	})
+
+	t.Run("invalid key", func(t *testing.T) {
+		resp := send(ReplaceKeyRequest{OldPublicKey: newKey, NewPublicKey: "not-a-key"})
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected status 400, got %d", resp.StatusCode)
+		}
+	})
+}
+
+func TestUnregisterEndpoint(t *testing.T) {
+	server, backend, serverPubKey := startTestVPNServer(t)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/register", handleRegister)
+	mux.HandleFunc("/api/unregister", handleUnregister)
+	httpServer := httptest.NewServer(mux)
+	defer httpServer.Close()
+
+	clientPriv, clientKey, _ := keys.GenerateKeyPair()
+	registered := postRegister(t, httpServer.URL, clientKey)
+
+	send := func(req UnregisterRequest) *http.Response {
+		t.Helper()
+		jsonData, _ := json.Marshal(req)
+		resp, err := http.Post(httpServer.URL+"/api/unregister", "application/json", bytes.NewBuffer(jsonData))
+		if err != nil {
+			t.Fatalf("Unregister request failed: %v", err)
+		}
+		return resp
+	}
+
+	// signed builds a request for publicKey proven with signerPriv
+	// Each call backdates by a further second so repeated requests aren't rejected as replays
+	var signedCount int64
+	signed := func(signerPriv, publicKey string) UnregisterRequest {
+		t.Helper()
+		signedCount++
+		timestamp := time.Now().Unix() - signedCount
+		proof, err := keys.ProveOwnership(signerPriv, serverPubKey, timestamp, keys.ProofUnregister, publicKey)
+		if err != nil {
+			t.Fatalf("Failed to prove ownership: %v", err)
+		}
+		return UnregisterRequest{ClientPublicKey: publicKey, Timestamp: timestamp, Proof: proof}
+	}
+
+	t.Run("missing proof rejected", func(t *testing.T) {
+		resp := send(UnregisterRequest{ClientPublicKey: clientKey})
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusForbidden {
+			t.Errorf("Expected status 403, got %d", resp.StatusCode)
+		}
+	})
+
+	t.Run("proof from another key rejected", func(t *testing.T) {
+		attackerPriv, _, _ := keys.GenerateKeyPair()
+		resp := send(signed(attackerPriv, clientKey))
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusForbidden {
+			t.Errorf("Expected status 403, got %d", resp.StatusCode)
+		}
+		if _, exists := server.PeerStore().GetPeer(clientKey); !exists {
+			t.Error("Registration should be untouched by a forged request")
+		}
+	})
+
+	t.Run("unregister removes peer", func(t *testing.T) {
+		resp := send(signed(clientPriv, clientKey))
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+		}
+		var body UnregisterResponse
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if body.PublicKey != clientKey || body.Timestamp == "" {
+			t.Errorf("Unexpected response %+v", body)
+		}
+		if _, exists := backend.Peer(clientKey); exists {
+			t.Error("Peer should be removed from backend")
+		}
+		if _, exists := server.PeerStore().GetPeer(clientKey); exists {
+			t.Error("Peer should be removed from peer store")
+		}
+	})
+
+	t.Run("IP returned to pool", func(t *testing.T) {
+		_, nextKey, _ := keys.GenerateKeyPair()
+		if next := postRegister(t, httpServer.URL, nextKey); next.ClientIP != registered.ClientIP {
+			t.Errorf("Expected freed IP %s to be reused, got %s", registered.ClientIP, next.ClientIP)
+		}
+	})
+
+	t.Run("unknown peer", func(t *testing.T) {
+		resp := send(signed(clientPriv, clientKey))
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("Expected status 404, got %d", resp.StatusCode)
+		}
+	})
+
+	t.Run("invalid key", func(t *testing.T) {
+		resp := send(UnregisterRequest{ClientPublicKey: "not-a-key"})
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected status 400, got %d", resp.StatusCode)
+		}
+	})
+}
+
+func TestRegisterReportsNetwork(t *testing.T) {
+	server, _, _ := startTestVPNServer(t)
+
+	allocator, err := ipam.NewAllocator(ipam.ConfigFromNetwork("10.8.0.0/24", "10.8.0.1"))
+	if err != nil {
+		t.Fatalf("Failed to create allocator: %v", err)
+	}
+	server.SetAllocator(allocator)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/register", handleRegister)
+	httpServer := httptest.NewServer(mux)
+	defer httpServer.Close()
+
+	_, clientPubKey, _ := keys.GenerateKeyPair()
+	resp := postRegister(t, httpServer.URL, clientPubKey)
+
+	if resp.NetworkCIDR != "10.8.0.0/24" {
+		t.Errorf("Expected network CIDR 10.8.0.0/24, got %s", resp.NetworkCIDR)
+	}
+	if resp.Gateway != "10.8.0.1" {
+		t.Errorf("Expected gateway 10.8.0.1, got %s", resp.Gateway)
+	}
+	if resp.ClientIP != "10.8.0.2/32" {
+		t.Errorf("Expected client IP 10.8.0.2/32, got %s", resp.ClientIP)
+	}
+	if resp.ClientAddress != "10.8.0.2" {
+		t.Errorf("Expected client address 10.8.0.2, got %s", resp.ClientAddress)
+	}
+}
+
+func TestRegisterAdvertisesServiceIPs(t *testing.T) {
+	server, _, _ := startTestVPNServer(t)
+
+	ipamConfig := ipam.ConfigFromNetwork("10.8.0.0/24", "10.8.0.1")
+	ipamConfig.ServiceIPs = []string{"10.8.0.2", "10.8.0.53"}
+	allocator, err := ipam.NewAllocator(ipamConfig)
+	if err != nil {
+		t.Fatalf("Failed to create allocator: %v", err)
+	}
+	server.SetAllocator(allocator)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/register", handleRegister)
+	httpServer := httptest.NewServer(mux)
+	defer httpServer.Close()
+
+	_, clientPubKey, _ := keys.GenerateKeyPair()
+	resp := postRegister(t, httpServer.URL, clientPubKey)
+
+	if resp.ClientIP != "10.8.0.3/32" {
+		t.Errorf("Expected the first client after the service IP, got %s", resp.ClientIP)
+	}
+	if !slices.Equal(resp.ServiceIPs, []string{"10.8.0.2", "10.8.0.53"}) {
+		t.Errorf("Expected service IPs [10.8.0.2 10.8.0.53], got %v", resp.ServiceIPs)
+	}
+}
+
+func TestRegisterMessageConfigurable(t *testing.T) {
+	startTestVPNServer(t)
+
+	previous := cfg.Server.RegisterMessage
+	cfg.Server.RegisterMessage = "Welcome! Help: https://support.example.com/vpn"
+	defer func() { cfg.Server.RegisterMessage = previous }()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/register", handleRegister)
+	httpServer := httptest.NewServer(mux)
+	defer httpServer.Close()
+
+	_, clientPubKey, _ := keys.GenerateKeyPair()
+	resp := postRegister(t, httpServer.URL, clientPubKey)
+	if resp.Message != "Welcome! Help: https://support.example.com/vpn" {
+		t.Errorf("Expected configured message, got %q", resp.Message)
+	}
+}
+
+func TestReconcileIPAMEndpoint(t *testing.T) {
+	server, _, _ := startTestVPNServer(t)
+
+	allocator, err := ipam.NewAllocator(ipam.DefaultConfig())
+	if err != nil {
+		t.Fatalf("Failed to create allocator: %v", err)
+	}
+	server.SetAllocator(allocator)
+
+	previousToken := cfg.Server.AdminToken
+	cfg.Server.AdminToken = "admin-secret"
+	defer func() { cfg.Server.AdminToken = previousToken }()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/register", handleRegister)
+	mux.HandleFunc("/api/admin/reconcile-ipam", requireAdminToken(handleReconcileIPAM))
+	httpServer := httptest.NewServer(mux)
+	defer httpServer.Close()
+
+	// Seed drift: one registered peer, one allocation that never reached the store,
+	// and one stored peer the allocator never handed out
+	_, registeredKey, _ := keys.GenerateKeyPair()
+	registered := postRegister(t, httpServer.URL, registeredKey)
+	orphan, err := allocator.AllocateIP(server.PeerStore().AssignedIPs())
+	if err != nil {
+		t.Fatalf("Failed to seed orphaned allocation: %v", err)
+	}
+	_, untrackedKey, _ := keys.GenerateKeyPair()
+	if err := server.AddClient(untrackedKey, "10.0.0.50"); err != nil {
+		t.Fatalf("Failed to seed untracked peer: %v", err)
+	}
+
+	reconcile := func(query, token string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, httpServer.URL+"/api/admin/reconcile-ipam"+query, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Reconcile request failed: %v", err)
+		}
+		return resp
+	}
+	decode := func(resp *http.Response) ReconcileIPAMResponse {
+		t.Helper()
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+		}
+		var body ReconcileIPAMResponse
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return body
+	}
+
+	wantOrphan := strings.TrimSuffix(orphan, "/32")
+	assertDrift := func(body ReconcileIPAMResponse) {
+		t.Helper()
+		if len(body.Orphaned) != 1 || body.Orphaned[0] != wantOrphan {
+			t.Errorf("Expected orphaned [%s], got %v", wantOrphan, body.Orphaned)
+		}
+		if len(body.Untracked) != 1 || body.Untracked[0] != "10.0.0.50" {
+			t.Errorf("Expected untracked [10.0.0.50], got %v", body.Untracked)
+		}
+	}
+
+	t.Run("requires token", func(t *testing.T) {
+		for _, token := range []string{"", "wrong"} {
+			resp := reconcile("", token)
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusUnauthorized {
+				t.Errorf("Token %q: expected status 401, got %d", token, resp.StatusCode)
+			}
+		}
+	})
+
+	t.Run("report only", func(t *testing.T) {
+		body := decode(reconcile("", "admin-secret"))
+		assertDrift(body)
+		if body.Fixed {
+			t.Error("Report-only reconcile should not claim a fix")
+		}
+		if drift := allocator.Drift(server.PeerStore().AssignedIPs()); drift.Empty() {
+			t.Error("Report-only reconcile should leave the drift in place")
+		}
+	})
+
+	t.Run("fix", func(t *testing.T) {
+		body := decode(reconcile("?fix=true", "admin-secret"))
+		assertDrift(body)
+		if !body.Fixed {
+			t.Error("Expected fixed=true")
+		}
+
+		after := decode(reconcile("", "admin-secret"))
+		if len(after.Orphaned) != 0 || len(after.Untracked) != 0 {
+			t.Errorf("Expected no drift after fix, got %+v", after)
+		}
+		if peer, exists := server.PeerStore().GetPeer(registeredKey); !exists || peer.AllowedIPs != registered.ClientIP {
+			t.Error("Fix must not touch registered peers")
+		}
+	})
+
+	t.Run("invalid fix value", func(t *testing.T) {
+		resp := reconcile("?fix=maybe", "admin-secret")
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected status 400, got %d", resp.StatusCode)
+		}
+	})
+}
+
+func TestSetPeerEnabledDisabledWithoutToken(t *testing.T) {
+	previousToken := cfg.Server.AdminToken
+	cfg.Server.AdminToken = ""
+	defer func() { cfg.Server.AdminToken = previousToken }()
+
+	router := newRouter()
+	for _, path := range []string{"/api/admin/peers/enable", "/api/admin/peers/disable"} {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(`{"clientPublicKey":"x"}`))
+		req.Header.Set("Authorization", "Bearer anything")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusForbidden {
+			t.Errorf("%s: expected status 403 without a configured token, got %d", path, w.Code)
+		}
+	}
+}
+
+func TestReconcileIPAMDisabledWithoutToken(t *testing.T) {
+	previousToken := cfg.Server.AdminToken
+	cfg.Server.AdminToken = ""
+	defer func() { cfg.Server.AdminToken = previousToken }()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/admin/reconcile-ipam", nil)
+	req.Header.Set("Authorization", "Bearer anything")
+	w := httptest.NewRecorder()
+	requireAdminToken(handleReconcileIPAM)(w, req)
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 without a configured token, got %d", w.Code)
+	}
+}
+
+func TestStatusRedactsPeerKeys(t *testing.T) {
+	startTestVPNServer(t)
+
+	previousToken := cfg.Server.AdminToken
+	cfg.Server.AdminToken = "admin-secret"
+	defer func() { cfg.Server.AdminToken = previousToken }()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/register", handleRegister)
+	mux.HandleFunc("/api/status", handleStatus)
+	httpServer := httptest.NewServer(mux)
+	defer httpServer.Close()
+
+	_, clientPubKey, _ := keys.GenerateKeyPair()
+	postRegister(t, httpServer.URL, clientPubKey)
+
+	tests := []struct {
+		name  string
+		token string
+		want  string
+	}{
+		{"anonymous sees short IDs", "", keys.ShortID(clientPubKey)},
+		{"wrong token sees short IDs", "wrong", keys.ShortID(clientPubKey)},
+		{"admin sees full keys", "admin-secret", clientPubKey},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodGet, httpServer.URL+"/api/status", nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("Status request failed: %v", err)
+			}
+			defer resp.Body.Close()
+
+			var status StatusResponse
+			if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if len(status.Peers) != 1 || status.Peers[0].PublicKey != tt.want {
+				t.Errorf("Expected one peer with key %q, got %+v", tt.want, status.Peers)
+			}
+		})
+	}
+}
+
+func TestStatusWatch(t *testing.T) {
+	startTestVPNServer(t)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/register", handleRegister)
+	mux.HandleFunc("/api/status", handleStatus)
+	httpServer := httptest.NewServer(mux)
+	defer httpServer.Close()
+
+	getStatus := func(t *testing.T, query string) StatusResponse {
+		t.Helper()
+		resp, err := http.Get(httpServer.URL + "/api/status" + query)
+		if err != nil {
+			t.Errorf("Status request failed: %v", err)
+			return StatusResponse{}
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("Expected status 200, got %d", resp.StatusCode)
+		}
+		var status StatusResponse
+		json.NewDecoder(resp.Body).Decode(&status)
+		return status
+	}
+
+	t.Run("timeout returns current state", func(t *testing.T) {
+		start := time.Now()
+		status := getStatus(t, "?watch=true&timeout=50ms")
+		if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+			t.Errorf("Watch returned after %s, before the timeout", elapsed)
+		}
+		if status.Status != "running" || status.ConnectedPeers != 0 {
+			t.Errorf("Unexpected status %+v", status)
+		}
+	})
+
+	t.Run("event wakes waiter", func(t *testing.T) {
+		done := make(chan StatusResponse, 1)
+		go func() { done <- getStatus(t, "?watch=true&timeout=10s") }()
+
+		// Keep registering until the waiter is woken; the first may land before it subscribes
+		deadline := time.After(5 * time.Second)
+		for {
+			_, clientPubKey, _ := keys.GenerateKeyPair()
+			postRegister(t, httpServer.URL, clientPubKey)
+
+			select {
+			case status := <-done:
+				if status.ConnectedPeers == 0 {
+					t.Error("Expected the woken status to include the new peer")
+				}
+				return
+			case <-time.After(20 * time.Millisecond):
+			case <-deadline:
+				t.Fatal("Peer event did not wake the watcher")
+			}
+		}
+	})
+
+	t.Run("invalid timeout", func(t *testing.T) {
+		resp, err := http.Get(httpServer.URL + "/api/status?watch=true&timeout=soon")
+		if err != nil {
+			t.Fatalf("Status request failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected status 400, got %d", resp.StatusCode)
+		}
+	})
+}
+
+func TestWaitForPeerEventCancelled(t *testing.T) {
+	startTestVPNServer(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if waitForPeerEvent(ctx, time.Minute) {
+		t.Error("Expected a cancelled request to stop waiting")
+	}
+}
+
+func TestUpdatePeerEndpoint(t *testing.T) {
+	server, _, _ := startTestVPNServer(t)
+
+	previousToken := cfg.Server.AdminToken
+	cfg.Server.AdminToken = "admin-secret"
+	defer func() { cfg.Server.AdminToken = previousToken }()
+
+	httpServer := httptest.NewServer(newRouter())
+	defer httpServer.Close()
+
+	_, pubKey, _ := keys.GenerateKeyPair()
+	if err := server.AddClient(pubKey, "10.0.0.7"); err != nil {
+		t.Fatalf("AddClient failed: %v", err)
+	}
+
+	patch := func(key, body string) *http.Response {
+		t.Helper()
+		// Base64 keys may contain "//", which the mux would clean away unless escaped
+		req, _ := http.NewRequest(http.MethodPatch, httpServer.URL+"/api/admin/peers/"+url.PathEscape(key), strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer admin-secret")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("PATCH request failed: %v", err)
+		}
+		return resp
+	}
+
+	t.Run("updates label and notes", func(t *testing.T) {
+		resp := patch(pubKey, `{"label": "John's laptop", "notes": "approved 2024"}`)
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+		}
+
+		var peer vpnserver.PeerConfig
+		if err := json.NewDecoder(resp.Body).Decode(&peer); err != nil {
+			t.Fatalf("Failed to decode peer: %v", err)
+		}
+		if peer.PublicKey != pubKey || peer.Label != "John's laptop" || peer.Notes != "approved 2024" || peer.AllowedIPs != "10.0.0.7/32" {
+			t.Errorf("Unexpected peer in response: %+v", peer)
+		}
+
+		stored, _ := server.PeerStore().GetPeer(pubKey)
+		if stored.Label != "John's laptop" || stored.Notes != "approved 2024" {
+			t.Errorf("Update not persisted in store: %+v", stored)
+		}
+	})
+
+	t.Run("omitted fields are kept", func(t *testing.T) {
+		resp := patch(pubKey, `{"notes": ""}`)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+		}
+
+		stored, _ := server.PeerStore().GetPeer(pubKey)
+		if stored.Label != "John's laptop" || stored.Notes != "" {
+			t.Errorf("Expected label kept and notes cleared, got %+v", stored)
+		}
+	})
+
+	t.Run("unknown peer", func(t *testing.T) {
+		_, unknownKey, _ := keys.GenerateKeyPair()
+		resp := patch(unknownKey, `{"label": "ghost"}`)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("Expected status 404, got %d", resp.StatusCode)
+		}
+	})
+
+	t.Run("label too long", func(t *testing.T) {
+		resp := patch(pubKey, `{"label": "`+strings.Repeat("x", vpnserver.MaxPeerLabelLength+1)+`"}`)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected status 400, got %d", resp.StatusCode)
+		}
+	})
+
+	t.Run("requires PATCH", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, httpServer.URL+"/api/admin/peers/"+pubKey, nil)
+		req.Header.Set("Authorization", "Bearer admin-secret")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("GET request failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusMethodNotAllowed {
+			t.Errorf("Expected status 405, got %d", resp.StatusCode)
+		}
+	})
+}
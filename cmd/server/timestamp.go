@@ -0,0 +1,37 @@
+package main
+
+import (
+	"strconv"
+	"time"
+)
+
+// Response timestamp formats selectable with VPN_TIMESTAMP_FORMAT
+const (
+	timestampRFC3339   = "rfc3339"   // 2024-01-02T15:04:05+02:00 in the server's local zone (default)
+	timestampUTC       = "utc"       // 2024-01-02T13:04:05Z
+	timestampUnix      = "unix"      // Seconds since the epoch
+	timestampUnixMilli = "unixmilli" // Milliseconds since the epoch
+)
+
+// formatTimestamp renders t in one of the response timestamp formats, RFC 3339 for unknown ones
+func formatTimestamp(t time.Time, format string) string {
+	switch format {
+	case timestampUnix:
+		return strconv.FormatInt(t.Unix(), 10)
+	case timestampUnixMilli:
+		return strconv.FormatInt(t.UnixMilli(), 10)
+	case timestampUTC:
+		return t.UTC().Format(time.RFC3339)
+	default:
+		return t.Format(time.RFC3339)
+	}
+}
+
+// responseTimestamp returns the current time in the configured response timestamp format
+func responseTimestamp() string {
+	format := timestampRFC3339
+	if cfg != nil {
+		format = cfg.Server.TimestampFormat
+	}
+	return formatTimestamp(time.Now(), format)
+}
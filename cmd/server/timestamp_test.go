@@ -0,0 +1,30 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFormatTimestamp(t *testing.T) {
+	// 2023-11-14T22:13:20.123Z, given in another zone to check which formats keep it
+	fixed := time.UnixMilli(1700000000123).In(time.FixedZone("UTC+2", 2*60*60))
+
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{timestampRFC3339, "2023-11-15T00:13:20+02:00"},
+		{"", "2023-11-15T00:13:20+02:00"},
+		{timestampUTC, "2023-11-14T22:13:20Z"},
+		{timestampUnix, "1700000000"},
+		{timestampUnixMilli, "1700000000123"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			if got := formatTimestamp(fixed, tt.format); got != tt.want {
+				t.Errorf("formatTimestamp(%q) = %s, want %s", tt.format, got, tt.want)
+			}
+		})
+	}
+}
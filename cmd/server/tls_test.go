@@ -0,0 +1,96 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestGenerateSelfSignedCert(t *testing.T) {
+	tests := []struct {
+		name    string
+		host    string
+		wantIPs []string
+		wantDNS []string
+	}{
+		{"no host", "", []string{"127.0.0.1"}, []string{"localhost"}},
+		{"IP host", "203.0.113.10", []string{"127.0.0.1", "203.0.113.10"}, []string{"localhost"}},
+		{"DNS host", "vpn.example.com", []string{"127.0.0.1"}, []string{"localhost", "vpn.example.com"}},
+		{"loopback host", "127.0.0.1", []string{"127.0.0.1"}, []string{"localhost"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cert, err := generateSelfSignedCert(tt.host)
+			if err != nil {
+				t.Fatalf("generateSelfSignedCert failed: %v", err)
+			}
+
+			var ips []string
+			for _, ip := range cert.Leaf.IPAddresses {
+				ips = append(ips, ip.String())
+			}
+			if !slices.Equal(ips, tt.wantIPs) {
+				t.Errorf("IP SANs = %v, want %v", ips, tt.wantIPs)
+			}
+			if !slices.Equal(cert.Leaf.DNSNames, tt.wantDNS) {
+				t.Errorf("DNS SANs = %v, want %v", cert.Leaf.DNSNames, tt.wantDNS)
+			}
+			if validity := time.Until(cert.Leaf.NotAfter); validity < selfSignedValidity-time.Minute || validity > selfSignedValidity {
+				t.Errorf("Certificate expires in %s, want about %s", validity, selfSignedValidity)
+			}
+		})
+	}
+}
+
+func TestHealthOverTLS(t *testing.T) {
+	cert, err := generateSelfSignedCert("")
+	if err != nil {
+		t.Fatalf("generateSelfSignedCert failed: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", handleHealth)
+	server := httptest.NewUnstartedServer(mux)
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	server.StartTLS()
+	defer server.Close()
+
+	client := &http.Client{
+		Timeout:   5 * time.Second,
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}},
+	}
+	resp, err := client.Get(server.URL + "/health")
+	if err != nil {
+		t.Fatalf("Health request over TLS failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.TLS == nil {
+		t.Fatal("Expected a TLS connection")
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", resp.StatusCode)
+	}
+
+	// The served certificate is the generated one and is valid for the loopback address
+	served := resp.TLS.PeerCertificates[0]
+	if !served.Equal(cert.Leaf) {
+		t.Error("Server presented a different certificate")
+	}
+	if err := served.VerifyHostname(net.IPv4(127, 0, 0, 1).String()); err != nil {
+		t.Errorf("Certificate should cover 127.0.0.1: %v", err)
+	}
+
+	// The logged fingerprint is what clients pin, so it must match the served certificate
+	sum := sha256.Sum256(served.Raw)
+	if got := certFingerprint(cert); got != hex.EncodeToString(sum[:]) {
+		t.Errorf("certFingerprint() = %s, want the served certificate's %x", got, sum)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// requireVPNSource guards a handler that must only be reached through the tunnel
+// The check uses the connection's address, never X-Forwarded-For, which any client can set
+func requireVPNSource(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		source, err := netip.ParseAddrPort(r.RemoteAddr)
+		if err != nil || !inVPNNetwork(source.Addr().Unmap()) {
+			slog.Warn("Rejected internal API request from outside the VPN", "path", r.URL.Path, "remoteAddr", r.RemoteAddr)
+			writeErrorJSON(w, http.StatusForbidden, "Endpoint only reachable through the VPN")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// inVPNNetwork reports whether addr belongs to the server's VPN network or one of its address pools
+func inVPNNetwork(addr netip.Addr) bool {
+	for _, network := range vpnNetworks() {
+		if network.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// vpnNetworks returns the prefixes VPN clients send from: the server's network and every allocation pool
+func vpnNetworks() []netip.Prefix {
+	if vpnServer == nil {
+		return nil
+	}
+
+	var networks []netip.Prefix
+	if prefix, err := netip.ParsePrefix(vpnServer.GetConfig().ServerIP); err == nil {
+		networks = append(networks, prefix.Masked())
+	}
+	if info, ok := vpnServer.NetworkInfo(); ok {
+		for _, cidr := range strings.Split(info.CIDR, ",") {
+			if prefix, err := netip.ParsePrefix(strings.TrimSpace(cidr)); err == nil {
+				networks = append(networks, prefix.Masked())
+			}
+		}
+	}
+	return networks
+}
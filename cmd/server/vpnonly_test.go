@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequireVPNSource(t *testing.T) {
+	startTestVPNServer(t) // VPN network 10.0.0.0/24
+	router := newRouter()
+
+	saved := cfg.Test
+	t.Cleanup(func() { cfg.Test = saved })
+	cfg.Test.TestEndpoints = true // Otherwise /api/bench answers 404 even to VPN clients
+
+	paths := []string{"/api/vpn-test", "/api/bench?bytes=0"}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string]string
+		want       int
+	}{
+		{name: "VPN client", remoteAddr: "10.0.0.2:40000", want: http.StatusOK},
+		{name: "VPN client over IPv4-mapped IPv6", remoteAddr: "[::ffff:10.0.0.7]:40000", want: http.StatusOK},
+		{name: "public client", remoteAddr: "203.0.113.7:40000", want: http.StatusForbidden},
+		{name: "adjacent network", remoteAddr: "10.0.1.2:40000", want: http.StatusForbidden},
+		{name: "spoofed forwarded header", remoteAddr: "203.0.113.7:40000", headers: map[string]string{"X-Forwarded-For": "10.0.0.2"}, want: http.StatusForbidden},
+		{name: "unparseable remote address", remoteAddr: "pipe", want: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, path := range paths {
+				req := httptest.NewRequest(http.MethodGet, path, nil)
+				req.RemoteAddr = tt.remoteAddr
+				for name, value := range tt.headers {
+					req.Header.Set(name, value)
+				}
+				rr := httptest.NewRecorder()
+				router.ServeHTTP(rr, req)
+
+				if rr.Code != tt.want {
+					t.Errorf("%s: expected status %d, got %d: %s", path, tt.want, rr.Code, rr.Body.String())
+				}
+			}
+		})
+	}
+
+	t.Run("denied without a VPN server", func(t *testing.T) {
+		previous := vpnServer
+		vpnServer = nil
+		defer func() { vpnServer = previous }()
+
+		for _, path := range paths {
+			req := httptest.NewRequest(http.MethodGet, path, nil)
+			req.RemoteAddr = "10.0.0.2:40000"
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusForbidden {
+				t.Errorf("%s: expected status 403, got %d", path, rr.Code)
+			}
+		}
+	})
+}
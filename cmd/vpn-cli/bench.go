@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/november1306/go-vpn/internal/client/api"
+	"github.com/november1306/go-vpn/internal/client/config"
+	"github.com/spf13/cobra"
+)
+
+const (
+	defaultBenchSizeMiB = 10
+	maxBenchSizeMiB     = 1024
+	defaultBenchTimeout = 30 * time.Second
+	maxBenchTimeout     = 5 * time.Minute
+	defaultBenchPings   = 5
+
+	// defaultAPIPort is the server's default API port, for configs registered before the server reported it
+	defaultAPIPort = 8443
+)
+
+var benchCmd = &cobra.Command{
+	Use:   "bench",
+	Short: "Measure tunnel throughput and latency to the server",
+	Long: `Measure latency, download and upload throughput through the VPN tunnel.
+
+The server must have VPN_TEST_ENDPOINTS enabled. By default the test runs against the
+server's API at the VPN gateway address, so the tunnel must be connected.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		var opts benchOptions
+		serverFlag, _ := cmd.Flags().GetString("server")
+		sizeMiB, _ := cmd.Flags().GetInt("size")
+		opts.timeout, _ = cmd.Flags().GetDuration("timeout")
+		opts.pings, _ = cmd.Flags().GetInt("pings")
+
+		if sizeMiB < 1 || sizeMiB > maxBenchSizeMiB {
+			fmt.Fprintf(os.Stderr, "Error: --size must be between 1 and %d MiB\n", maxBenchSizeMiB)
+			os.Exit(1)
+		}
+		if opts.timeout <= 0 || opts.timeout > maxBenchTimeout {
+			fmt.Fprintf(os.Stderr, "Error: --timeout must be positive and at most %s\n", maxBenchTimeout)
+			os.Exit(1)
+		}
+		opts.size = int64(sizeMiB) << 20
+
+		serverURL, err := benchServerURL(serverFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		client, err := newAPIClient(serverURL)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if err := runBench(cmd.OutOrStdout(), client, opts); err != nil {
+			fmt.Fprintf(os.Stderr, "Benchmark failed: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+// benchOptions bounds one 'vpn-cli bench' run
+type benchOptions struct {
+	size    int64         // Bytes transferred in each direction
+	timeout time.Duration // Limit for each transfer
+	pings   int           // Latency probes before the transfers (0 skips them)
+}
+
+// benchServerURL returns the flag value, or the server API at the VPN gateway
+func benchServerURL(serverFlag string) (string, error) {
+	if serverFlag != "" {
+		return serverFlag, nil
+	}
+
+	clientConfig, err := config.Load()
+	if err != nil {
+		return "", fmt.Errorf("failed to load configuration: %w\nHint: Run 'vpn-cli register --server=<url>' first", err)
+	}
+	return gatewayAPIURL(clientConfig)
+}
+
+// gatewayAPIURL builds the server API URL at the VPN gateway from the port and scheme reported at registration
+// Used by the commands whose endpoints only answer clients inside the VPN (bench, test-vpn)
+func gatewayAPIURL(clientConfig *config.ClientConfig) (string, error) {
+	if clientConfig.Gateway == "" {
+		return "", fmt.Errorf("server did not report a gateway address; pass --server")
+	}
+
+	port := clientConfig.APIPort
+	if port == 0 {
+		port = defaultAPIPort
+	}
+	scheme := "http"
+	if clientConfig.APITLS {
+		scheme = "https"
+	}
+	return scheme + "://" + net.JoinHostPort(clientConfig.Gateway, strconv.Itoa(port)), nil
+}
+
+// mbps converts bytes transferred over elapsed into megabits per second
+func mbps(bytes int64, elapsed time.Duration) float64 {
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(bytes) * 8 / elapsed.Seconds() / 1e6
+}
+
+// runBench measures latency, then download and upload throughput
+func runBench(out io.Writer, client *api.Client, opts benchOptions) error {
+	fmt.Fprintf(out, "📏 Benchmarking with %.1f MiB in each direction\n", float64(opts.size)/(1<<20))
+
+	if opts.pings > 0 {
+		var total, best time.Duration
+		for i := 0; i < opts.pings; i++ {
+			elapsed, err := timeTransfer(opts.timeout, func(ctx context.Context) error {
+				_, err := client.BenchDownload(ctx, 0)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("latency probe failed (is the VPN connected and VPN_TEST_ENDPOINTS enabled?): %w", err)
+			}
+			total += elapsed
+			if best == 0 || elapsed < best {
+				best = elapsed
+			}
+		}
+		fmt.Fprintf(out, "📶 Latency: %s min, %s avg over %d requests\n",
+			best.Round(time.Microsecond*100), (total / time.Duration(opts.pings)).Round(time.Microsecond*100), opts.pings)
+	}
+
+	var received int64
+	elapsed, err := timeTransfer(opts.timeout, func(ctx context.Context) error {
+		var err error
+		received, err = client.BenchDownload(ctx, opts.size)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "⬇️  Download: %.2f Mbps (%d bytes in %s)\n", mbps(received, elapsed), received, elapsed.Round(time.Millisecond))
+
+	var sent int64
+	elapsed, err = timeTransfer(opts.timeout, func(ctx context.Context) error {
+		resp, err := client.BenchUpload(ctx, opts.size)
+		if err == nil {
+			sent = resp.Bytes
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "⬆️  Upload: %.2f Mbps (%d bytes in %s)\n", mbps(sent, elapsed), sent, elapsed.Round(time.Millisecond))
+	return nil
+}
+
+// timeTransfer runs transfer with a timeout and reports how long it took
+func timeTransfer(timeout time.Duration, transfer func(ctx context.Context) error) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := transfer(ctx)
+	return time.Since(start), err
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/november1306/go-vpn/internal/client/api"
+	"github.com/november1306/go-vpn/internal/client/config"
+)
+
+func TestMbps(t *testing.T) {
+	tests := []struct {
+		name    string
+		bytes   int64
+		elapsed time.Duration
+		want    float64
+	}{
+		{"one megabyte per second", 1_000_000, time.Second, 8},
+		{"10 MiB in 2s", 10 << 20, 2 * time.Second, 41.943040},
+		{"half second", 125_000, 500 * time.Millisecond, 2},
+		{"nothing transferred", 0, time.Second, 0},
+		{"no time elapsed", 1 << 20, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mbps(tt.bytes, tt.elapsed); math.Abs(got-tt.want) > 1e-6 {
+				t.Errorf("mbps(%d, %s) = %f, want %f", tt.bytes, tt.elapsed, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunBench(t *testing.T) {
+	var uploaded int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			size, _ := strconv.ParseInt(r.URL.Query().Get("bytes"), 10, 64)
+			w.Write(make([]byte, size))
+		case http.MethodPost:
+			uploaded, _ = io.Copy(io.Discard, r.Body)
+			w.Write([]byte(`{"bytes":` + strconv.FormatInt(uploaded, 10) + `}`))
+		}
+	}))
+	defer server.Close()
+
+	var out bytes.Buffer
+	opts := benchOptions{size: 64 << 10, timeout: 5 * time.Second, pings: 2}
+	if err := runBench(&out, api.NewClient(server.URL), opts); err != nil {
+		t.Fatalf("runBench failed: %v", err)
+	}
+
+	if uploaded != opts.size {
+		t.Errorf("Expected %d bytes uploaded, got %d", opts.size, uploaded)
+	}
+	for _, want := range []string{"Latency:", "over 2 requests", "Download:", "(65536 bytes", "Upload:"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected output to contain %q, got:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestGatewayAPIURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  config.ClientConfig
+		want    string
+		wantErr bool
+	}{
+		{"reported port", config.ClientConfig{Gateway: "10.0.0.1", APIPort: 9443}, "http://10.0.0.1:9443", false},
+		{"reported TLS", config.ClientConfig{Gateway: "10.0.0.1", APIPort: 9443, APITLS: true}, "https://10.0.0.1:9443", false},
+		{"older server", config.ClientConfig{Gateway: "10.0.0.1"}, "http://10.0.0.1:8443", false},
+		{"ipv6 gateway", config.ClientConfig{Gateway: "fd00::1", APIPort: 9443}, "http://[fd00::1]:9443", false},
+		{"no gateway", config.ClientConfig{APIPort: 9443}, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := gatewayAPIURL(&tt.config)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("gatewayAPIURL() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("gatewayAPIURL() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,16 +1,25 @@
 package main
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
 	"strings"
+	"syscall"
+	"text/tabwriter"
 	"time"
 
+	"github.com/november1306/go-vpn/internal/client/api"
 	"github.com/november1306/go-vpn/internal/client/config"
 	"github.com/november1306/go-vpn/internal/client/tunnel"
+	"github.com/november1306/go-vpn/internal/tcpshim"
 	"github.com/november1306/go-vpn/internal/version"
 	"github.com/november1306/go-vpn/internal/wireguard/keys"
 	"github.com/spf13/cobra"
@@ -26,25 +35,118 @@ var rootCmd = &cobra.Command{
 	},
 }
 
+// apiTLS holds the root --tls-fingerprint and --insecure-skip-verify flags for every API request
+var apiTLS api.TLSOptions
+
 var registerCmd = &cobra.Command{
 	Use:   "register",
 	Short: "Register with VPN server",
-	Long:  `Register this client with a VPN server by exchanging public keys.`,
+	Long: `Register this client with a VPN server by exchanging public keys.
+
+A new key pair is generated unless an existing private key is supplied with
+--private-key or --private-key-file, e.g. one exported from a hardware token.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		serverURL, _ := cmd.Flags().GetString("server")
-		if err := runRegister(serverURL); err != nil {
+		serverFlag, _ := cmd.Flags().GetString("server")
+		serverURL, err := resolveServerURL(serverFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			cmd.Usage()
+			os.Exit(1)
+		}
+		keyFlag, _ := cmd.Flags().GetString("private-key")
+		keyFile, _ := cmd.Flags().GetString("private-key-file")
+		privateKey, err := readPrivateKey(keyFlag, keyFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		apiKey, _ := cmd.Flags().GetString("api-key")
+		if err := runRegister(serverURL, privateKey, apiKey); err != nil {
 			fmt.Fprintf(os.Stderr, "Registration failed: %v\n", err)
 			os.Exit(1)
 		}
 	},
 }
 
+var renewKeysCmd = &cobra.Command{
+	Use:   "renew-keys",
+	Short: "Generate new client keys, keeping the current registration",
+	Long:  `Generate a new client key pair and swap it in on the server without changing the assigned VPN IP.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		serverFlag, _ := cmd.Flags().GetString("server")
+		serverURL, err := resolveServerURL(serverFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			cmd.Usage()
+			os.Exit(1)
+		}
+		if err := runRenewKeys(serverURL); err != nil {
+			fmt.Fprintf(os.Stderr, "Key renewal failed: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+var unregisterCmd = &cobra.Command{
+	Use:   "unregister",
+	Short: "Remove this client's registration from the VPN server",
+	Long:  `Remove this client's peer from the VPN server, freeing its VPN IP, and delete the saved configuration.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		serverFlag, _ := cmd.Flags().GetString("server")
+		serverURL, err := resolveServerURL(serverFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			cmd.Usage()
+			os.Exit(1)
+		}
+		apiKey, _ := cmd.Flags().GetString("api-key")
+		if err := runUnregister(serverURL, apiKey); err != nil {
+			fmt.Fprintf(os.Stderr, "Unregistration failed: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
 var connectCmd = &cobra.Command{
 	Use:   "connect",
 	Short: "Connect to VPN",
 	Long:  `Connect to the VPN using stored configuration.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		if err := runConnect(); err != nil {
+		native, _ := cmd.Flags().GetBool("native")
+		force, _ := cmd.Flags().GetBool("force")
+		autoReconnect, _ := cmd.Flags().GetBool("auto-reconnect")
+
+		// Flags override the server-recommended tunnel parameters for this connection only
+		var overrides tunnelOverrides
+		if cmd.Flags().Changed("keepalive") {
+			keepalive, _ := cmd.Flags().GetInt("keepalive")
+			overrides.keepalive = &keepalive
+		}
+		overrides.mtu, _ = cmd.Flags().GetInt("mtu")
+		overrides.autoMTU, _ = cmd.Flags().GetBool("auto-mtu")
+		overrides.listenPort, _ = cmd.Flags().GetInt("listen-port")
+		overrides.exclude, _ = cmd.Flags().GetStringArray("exclude")
+
+		verify := tunnel.DefaultVerifyOptions()
+		verify.HandshakeTimeout, _ = cmd.Flags().GetDuration("handshake-timeout")
+		verify.VerifyTimeout, _ = cmd.Flags().GetDuration("verify-timeout")
+
+		configSource, _ := cmd.Flags().GetString("config")
+
+		preferFamily, _ := cmd.Flags().GetString("prefer-family")
+		family, err := tunnel.ParseAddressFamily(preferFamily)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		var transport transportOptions
+		transport.kind, _ = cmd.Flags().GetString("transport")
+		transport.endpoint, _ = cmd.Flags().GetString("tcp-endpoint")
+
+		writeConfig, _ := cmd.Flags().GetString("write-config")
+
+		if err := runConnect(native, force, autoReconnect, configSource, family, overrides, verify, transport, writeConfig); err != nil {
 			fmt.Fprintf(os.Stderr, "Connection failed: %v\n", err)
 			os.Exit(1)
 		}
@@ -63,6 +165,241 @@ var disconnectCmd = &cobra.Command{
 	},
 }
 
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "Show past VPN connections",
+	Long:  `Show connect and disconnect events recorded by this client, with data transferred per session.`,
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		clearHistory, _ := cmd.Flags().GetBool("clear")
+
+		history, err := openHistory()
+		if err != nil {
+			return err
+		}
+		if clearHistory {
+			if err := history.Clear(); err != nil {
+				return err
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), "🧹 Connection history cleared")
+			return nil
+		}
+
+		entries, err := history.Entries()
+		if err != nil {
+			return err
+		}
+		return writeHistory(cmd.OutOrStdout(), entries)
+	},
+}
+
+// openHistory returns the connection history log in the config directory
+func openHistory() (*tunnel.History, error) {
+	historyPath, err := config.GetHistoryPath()
+	if err != nil {
+		return nil, err
+	}
+	return tunnel.NewHistory(historyPath), nil
+}
+
+// writeHistory prints history entries as a table, oldest first
+func writeHistory(out io.Writer, entries []tunnel.HistoryEntry) error {
+	if len(entries) == 0 {
+		_, err := fmt.Fprintln(out, "No connections recorded yet")
+		return err
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tEVENT\tSERVER\tCLIENT IP\tRECEIVED\tSENT")
+	for _, entry := range entries {
+		received, sent := "-", "-"
+		if entry.Event == tunnel.HistoryDisconnect {
+			received = fmt.Sprintf("%d", entry.BytesReceived)
+			sent = fmt.Sprintf("%d", entry.BytesSent)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			entry.Time.Local().Format("2006-01-02 15:04:05"), entry.Event, entry.Server, entry.ClientIP, received, sent)
+	}
+	return w.Flush()
+}
+
+var validateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Check the client configuration for errors",
+	Long:  `Check that the stored configuration has well-formed keys, a matching key pair and a parseable server endpoint, without connecting.`,
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		configPath, _ := cmd.Flags().GetString("config-path")
+		if configPath == "" {
+			var err error
+			if configPath, err = config.GetConfigPath(); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		if err := runValidate(cmd.OutOrStdout(), configPath); err != nil {
+			fmt.Fprintf(os.Stderr, "Validation failed: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+// configCheck is one named validation performed by 'vpn-cli validate'
+type configCheck struct {
+	name  string
+	check func(cfg *config.ClientConfig) error
+}
+
+// configChecks lists the validations in the order they are reported
+var configChecks = []configCheck{
+	{"client private key", func(cfg *config.ClientConfig) error {
+		return keys.ValidatePrivateKey(cfg.ClientPrivateKey)
+	}},
+	{"client public key", func(cfg *config.ClientConfig) error {
+		return keys.ValidatePublicKey(cfg.ClientPublicKey)
+	}},
+	{"key pair", func(cfg *config.ClientConfig) error {
+		derived, err := keys.PublicKeyFromPrivate(cfg.ClientPrivateKey)
+		if err != nil {
+			return fmt.Errorf("cannot derive public key: %w", err)
+		}
+		if derived != cfg.ClientPublicKey {
+			return fmt.Errorf("client public key does not match the private key")
+		}
+		return nil
+	}},
+	{"server public key", func(cfg *config.ClientConfig) error {
+		return keys.ValidatePublicKey(cfg.ServerPublicKey)
+	}},
+	{"server endpoint", func(cfg *config.ClientConfig) error {
+		return validateEndpoint(cfg.ServerEndpoint)
+	}},
+}
+
+// runValidate reports every check for the config at path, failing if any check fails
+func runValidate(out io.Writer, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config: %w", err)
+	}
+
+	// Decode without config.Validate so every problem is reported, not just the first
+	var clientConfig config.ClientConfig
+	if err := json.Unmarshal(data, &clientConfig); err != nil {
+		return fmt.Errorf("failed to parse config: %w", err)
+	}
+
+	fmt.Fprintf(out, "🔍 Validating %s\n", path)
+	failed := 0
+	for _, c := range configChecks {
+		if err := c.check(&clientConfig); err != nil {
+			fmt.Fprintf(out, "❌ %s: %v\n", c.name, err)
+			failed++
+			continue
+		}
+		fmt.Fprintf(out, "✅ %s\n", c.name)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d checks failed", failed, len(configChecks))
+	}
+	fmt.Fprintln(out, "🎉 Configuration is valid")
+	return nil
+}
+
+// validateEndpoint checks endpoint is host:port with a usable port
+// An empty host is allowed: the server advertises ":port" when it doesn't know its public address
+func validateEndpoint(endpoint string) error {
+	if endpoint == "" {
+		return fmt.Errorf("endpoint is empty")
+	}
+	_, port, err := net.SplitHostPort(endpoint)
+	if err != nil {
+		return fmt.Errorf("invalid endpoint %q: %w", endpoint, err)
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return fmt.Errorf("invalid port %q in endpoint %q", port, endpoint)
+	}
+	return nil
+}
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect the client configuration",
+}
+
+var configShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Print the client configuration with the private key redacted",
+	Long:  `Print the stored configuration as JSON for troubleshooting. The private key is replaced by a marker and its derived public key, so the output is safe to share.`,
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		configPath, _ := cmd.Flags().GetString("config-path")
+		if configPath == "" {
+			var err error
+			if configPath, err = config.GetConfigPath(); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		showPrivate, _ := cmd.Flags().GetBool("show-private")
+		if err := runConfigShow(cmd.OutOrStdout(), cmd.ErrOrStderr(), configPath, showPrivate); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+const (
+	redactedKey = "[redacted]"
+	missingKey  = "[missing]"
+)
+
+// shownConfig is the 'vpn-cli config show' view of a ClientConfig
+// Its ClientPrivateKey shadows the embedded one, so the real key is only printed when asked for
+type shownConfig struct {
+	*config.ClientConfig
+	ClientPrivateKey string `json:"clientPrivateKey"`
+	DerivedPublicKey string `json:"derivedPublicKey,omitempty"` // Public key of the stored private key
+}
+
+// redactConfig builds the view printed by 'vpn-cli config show'
+func redactConfig(cfg *config.ClientConfig, showPrivate bool) shownConfig {
+	shown := shownConfig{ClientConfig: cfg, ClientPrivateKey: redactedKey}
+	switch {
+	case cfg.ClientPrivateKey == "":
+		shown.ClientPrivateKey = missingKey
+	case showPrivate:
+		shown.ClientPrivateKey = cfg.ClientPrivateKey
+	}
+	if derived, err := keys.PublicKeyFromPrivate(cfg.ClientPrivateKey); err == nil {
+		shown.DerivedPublicKey = derived
+	}
+	return shown
+}
+
+// runConfigShow prints the config at path as JSON, warning on errOut when the private key is included
+func runConfigShow(out, errOut io.Writer, path string, showPrivate bool) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config: %w", err)
+	}
+
+	// Decode without config.Validate so broken configs can still be shared for troubleshooting
+	var clientConfig config.ClientConfig
+	if err := json.Unmarshal(data, &clientConfig); err != nil {
+		return fmt.Errorf("failed to parse config: %w", err)
+	}
+
+	if showPrivate {
+		fmt.Fprintln(errOut, "⚠️  Output includes your private key - anyone who sees it can impersonate this client")
+	}
+
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(redactConfig(&clientConfig, showPrivate))
+}
+
 var statusCmd = &cobra.Command{
 	Use:   "status",
 	Short: "Show VPN status",
@@ -87,101 +424,287 @@ var testVPNCmd = &cobra.Command{
 	},
 }
 
+var versionCmd = &cobra.Command{
+	Use:   "version",
+	Short: "Show version and build information",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		asJSON, _ := cmd.Flags().GetBool("json")
+		return writeVersion(cmd.OutOrStdout(), asJSON)
+	},
+}
+
+// writeVersion prints build information as text or JSON
+func writeVersion(out io.Writer, asJSON bool) error {
+	info := version.Get()
+	if asJSON {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(info)
+	}
+	_, err := fmt.Fprintf(out, "vpn-cli %s\n", info)
+	return err
+}
+
+var completionCmd = &cobra.Command{
+	Use:   "completion [bash|zsh|fish|powershell]",
+	Short: "Generate shell completion script",
+	Long: `Generate a shell completion script for vpn-cli.
+
+  bash:        source <(vpn-cli completion bash)
+  zsh:         vpn-cli completion zsh > "${fpath[1]}/_vpn-cli"
+  fish:        vpn-cli completion fish > ~/.config/fish/completions/vpn-cli.fish
+  powershell:  vpn-cli completion powershell | Out-String | Invoke-Expression`,
+	DisableFlagsInUseLine: true,
+	ValidArgs:             []string{"bash", "zsh", "fish", "powershell"},
+	Args:                  cobra.MatchAll(cobra.ExactArgs(1), cobra.OnlyValidArgs),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return writeCompletion(cmd.Root(), args[0], cmd.OutOrStdout())
+	},
+}
+
+// writeCompletion renders the completion script for the given shell
+func writeCompletion(root *cobra.Command, shell string, out io.Writer) error {
+	switch shell {
+	case "bash":
+		return root.GenBashCompletionV2(out, true)
+	case "zsh":
+		return root.GenZshCompletion(out)
+	case "fish":
+		return root.GenFishCompletion(out, true)
+	case "powershell":
+		return root.GenPowerShellCompletionWithDesc(out)
+	default:
+		return fmt.Errorf("unsupported shell %q", shell)
+	}
+}
+
+// completeServerURL suggests server URLs already known to this client
+func completeServerURL(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	var suggestions []string
+	if env := os.Getenv(config.ServerEnvVar); env != "" {
+		suggestions = append(suggestions, env)
+	}
+	if settings, err := config.LoadSettings(); err == nil && settings.DefaultServer != "" {
+		suggestions = append(suggestions, settings.DefaultServer)
+	}
+	return suggestions, cobra.ShellCompDirectiveNoFileComp
+}
+
 func init() {
 	// Add version flag to root command
 	rootCmd.Version = version.Version
 
+	// Replace cobra's implicit completion command with our own
+	rootCmd.CompletionOptions.DisableDefaultCmd = true
+	rootCmd.AddCommand(completionCmd)
+	rootCmd.AddCommand(versionCmd)
+	versionCmd.Flags().Bool("json", false, "Print build information as JSON")
+
+	// HTTPS options for servers with VPN_TLS_ENABLED, whose certificate is self-signed
+	rootCmd.PersistentFlags().StringVar(&apiTLS.Fingerprint, "tls-fingerprint", "", "Trust the server's HTTPS certificate with this SHA-256 fingerprint (hex, as logged at server startup)")
+	rootCmd.PersistentFlags().BoolVar(&apiTLS.InsecureSkipVerify, "insecure-skip-verify", false, "Accept any HTTPS certificate from the server (encrypts but does not authenticate it)")
+
 	// Add subcommands
 	rootCmd.AddCommand(registerCmd)
+	rootCmd.AddCommand(renewKeysCmd)
+	rootCmd.AddCommand(unregisterCmd)
 	rootCmd.AddCommand(connectCmd)
 	rootCmd.AddCommand(disconnectCmd)
 	rootCmd.AddCommand(statusCmd)
+	rootCmd.AddCommand(historyCmd)
+	rootCmd.AddCommand(validateCmd)
+	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configShowCmd)
 	rootCmd.AddCommand(testVPNCmd)
+	rootCmd.AddCommand(benchCmd)
 
 	// Add flags for register command
-	registerCmd.Flags().StringP("server", "s", "", "VPN server URL (required)")
-	registerCmd.MarkFlagRequired("server")
+	registerCmd.Flags().StringP("server", "s", "", "VPN server URL (default: $GOVPN_SERVER or stored default)")
+	registerCmd.RegisterFlagCompletionFunc("server", completeServerURL)
+	registerCmd.Flags().String("private-key", "", "Register this base64 private key instead of generating one (visible to other local users; prefer --private-key-file)")
+	registerCmd.Flags().String("private-key-file", "", "Read the private key to register from this file")
+	registerCmd.Flags().String("api-key", "", "API key for servers that require one (VPN_API_KEY) or a token pool token")
+
+	// Add flags for renew-keys command
+	renewKeysCmd.Flags().StringP("server", "s", "", "VPN server URL (default: $GOVPN_SERVER or stored default)")
+	renewKeysCmd.RegisterFlagCompletionFunc("server", completeServerURL)
+
+	// Add flags for unregister command
+	unregisterCmd.Flags().StringP("server", "s", "", "VPN server URL (default: $GOVPN_SERVER or stored default)")
+	unregisterCmd.RegisterFlagCompletionFunc("server", completeServerURL)
+	unregisterCmd.Flags().String("api-key", "", "API key for servers that require one (VPN_API_KEY)")
+
+	// Add flags for connect command
+	connectCmd.Flags().Bool("native", false, "Configure the interface natively instead of using wg-quick (Linux only)")
+	connectCmd.Flags().Bool("force", false, "Remove a leftover interface from a previous run before connecting")
+	connectCmd.Flags().Bool("auto-reconnect", false, "Stay in the foreground and re-establish the tunnel if its interface goes down or handshakes stop")
+	connectCmd.Flags().Int("keepalive", 0, "Override the persistent keepalive interval in seconds (0 disables)")
+	connectCmd.Flags().Int("mtu", 0, "Override the tunnel MTU")
+	connectCmd.Flags().Bool("auto-mtu", false, "Lower the tunnel MTU if the route to the server can't carry it")
+	connectCmd.Flags().StringArray("exclude", nil, "IPv4 CIDR to route outside the VPN via the current gateway (repeatable)")
+	connectCmd.Flags().Int("listen-port", 0, "Local UDP port for the tunnel (0 picks an ephemeral port)")
+	connectCmd.Flags().String("transport", transportUDP, "How to reach the server: udp, or tcp for networks that block UDP (needs the server's VPN_TCP_PORT)")
+	connectCmd.Flags().String("tcp-endpoint", "", "TCP transport address host:port (default: the server endpoint host and the TCP port it reported at registration)")
+	connectCmd.Flags().String("prefer-family", "", "Reach the server over IPv4 (4) or IPv6 (6) when its endpoint has both (default: resolver's choice)")
+	connectCmd.RegisterFlagCompletionFunc("prefer-family", cobra.FixedCompletions([]string{"4", "6"}, cobra.ShellCompDirectiveNoFileComp))
+	connectCmd.Flags().String("write-config", "", "Write the generated WireGuard config to this path for inspection instead of connecting")
+	connectCmd.Flags().String("config", "", "Read the client config from this file, or '-' for stdin, instead of the saved registration")
+	connectCmd.Flags().Duration("handshake-timeout", tunnel.DefaultHandshakeTimeout, "Maximum age of the last handshake for the tunnel to count as up")
+	historyCmd.Flags().Bool("clear", false, "Delete the recorded history")
+	benchCmd.Flags().StringP("server", "s", "", "Server API URL to benchmark (default: the API at the VPN gateway)")
+	benchCmd.Flags().Int("size", defaultBenchSizeMiB, fmt.Sprintf("MiB to transfer in each direction (max %d)", maxBenchSizeMiB))
+	benchCmd.Flags().Duration("timeout", defaultBenchTimeout, fmt.Sprintf("Limit for each transfer (max %s)", maxBenchTimeout))
+	benchCmd.Flags().Int("pings", defaultBenchPings, "Latency probes to send before the transfers (0 skips them)")
+	validateCmd.Flags().String("config-path", "", "Config file to check (default: the saved registration)")
+	configShowCmd.Flags().String("config-path", "", "Config file to show (default: the saved registration)")
+	configShowCmd.Flags().Bool("show-private", false, "Include the private key in the output (never share this)")
+
+	connectCmd.Flags().Duration("verify-timeout", tunnel.DefaultVerifyTimeout, "How long to wait for a handshake after connecting (0 skips verification)")
 }
 
-type RegisterRequest struct {
-	ClientPublicKey string `json:"clientPublicKey"`
+// newAPIClient creates an API client that verifies HTTPS servers per the root TLS flags
+func newAPIClient(serverURL string) (*api.Client, error) {
+	if apiTLS.Fingerprint != "" && apiTLS.InsecureSkipVerify {
+		return nil, fmt.Errorf("--tls-fingerprint and --insecure-skip-verify are mutually exclusive")
+	}
+	client := api.NewClient(serverURL)
+	if err := client.SetTLSOptions(apiTLS); err != nil {
+		return nil, err
+	}
+	return client, nil
 }
 
-type RegisterResponse struct {
-	ServerPublicKey string `json:"serverPublicKey"`
-	ServerEndpoint  string `json:"serverEndpoint"`
-	ClientIP        string `json:"clientIP"`
-	Message         string `json:"message"`
-	Timestamp       string `json:"timestamp"`
+// resolveServerURL applies flag > GOVPN_SERVER > stored default precedence
+func resolveServerURL(serverFlag string) (string, error) {
+	settings, err := config.LoadSettings()
+	if err != nil {
+		// A broken settings file shouldn't block an explicit flag or env value
+		settings = nil
+	}
+	return config.ResolveServer(serverFlag, settings)
 }
 
-func runRegister(serverURL string) error {
+// rememberDefaultServer stores the server URL as the default if none is set yet
+func rememberDefaultServer(serverURL string) {
+	settings, err := config.LoadSettings()
+	if err != nil || settings.DefaultServer != "" {
+		return
+	}
+
+	settings.DefaultServer = serverURL
+	if err := config.SaveSettings(settings); err != nil {
+		fmt.Printf("⚠️ Failed to store default server: %v\n", err)
+	}
+}
+
+// readPrivateKey returns the key given by --private-key or --private-key-file, or "" if neither is set
+func readPrivateKey(value, path string) (string, error) {
+	if value != "" && path != "" {
+		return "", fmt.Errorf("use either --private-key or --private-key-file, not both")
+	}
+	if path == "" {
+		return value, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read private key file: %w", err)
+	}
+	if strings.TrimSpace(string(data)) == "" {
+		return "", fmt.Errorf("private key file %s is empty", path)
+	}
+	return string(data), nil
+}
+
+// clientKeyPair returns the supplied private key with its public key, or a new pair if none is supplied
+func clientKeyPair(privateKey string) (string, string, error) {
+	if privateKey == "" {
+		fmt.Println("Generating client key pair...")
+		privKey, pubKey, err := keys.GenerateKeyPair()
+		if err != nil {
+			return "", "", fmt.Errorf("failed to generate client keys: %w", err)
+		}
+		return privKey, pubKey, nil
+	}
+
+	privateKey = strings.TrimSpace(privateKey)
+	if err := keys.ValidatePrivateKey(privateKey); err != nil {
+		return "", "", fmt.Errorf("invalid private key: %w", err)
+	}
+	pubKey, err := keys.PublicKeyFromPrivate(privateKey)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid private key: %w", err)
+	}
+	fmt.Println("Using supplied private key...")
+	return privateKey, pubKey, nil
+}
+
+// runRegister registers with the server, using privateKey if given or a new key pair otherwise
+// apiKey authenticates with servers that set VPN_API_KEY
+func runRegister(serverURL, privateKey, apiKey string) error {
 	fmt.Println("🔐 Client Registration Demo")
 
 	// Check if already registered
 	if config.Exists() {
 		fmt.Println("⚠️ Already registered. Use 'vpn-cli connect' to establish VPN tunnel.")
-		fmt.Println("   To re-register, first run: rm ~/.go-wire-vpn/config.json")
+		fmt.Println("   To re-register, first run: vpn-cli unregister")
 		return nil
 	}
 
-	// Generate client key pair
-	fmt.Println("Generating client key pair...")
-	clientPrivKey, clientPubKey, err := keys.GenerateKeyPair()
+	clientPrivKey, clientPubKey, err := clientKeyPair(privateKey)
 	if err != nil {
-		return fmt.Errorf("failed to generate client keys: %w", err)
+		return err
 	}
 
 	fmt.Printf("✅ Client Public Key: %s\n", clientPubKey)
 
-	// Prepare request
-	reqBody := RegisterRequest{
-		ClientPublicKey: clientPubKey,
-	}
-
-	jsonData, err := json.Marshal(reqBody)
-	if err != nil {
-		return fmt.Errorf("failed to marshal request: %w", err)
-	}
-
-	// Make HTTP request
+	// Register with server
 	fmt.Printf("📡 Registering with server: %s\n", serverURL)
-	resp, err := http.Post(serverURL+"/api/register", "application/json", bytes.NewBuffer(jsonData))
+	client, err := newAPIClient(serverURL)
 	if err != nil {
-		return fmt.Errorf("failed to connect to server: %w", err)
+		return err
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("server returned status %d", resp.StatusCode)
-	}
-
-	// Parse response
-	var registerResp RegisterResponse
-	if err := json.NewDecoder(resp.Body).Decode(&registerResp); err != nil {
-		return fmt.Errorf("failed to parse response: %w", err)
+	client.SetAPIKey(apiKey)
+	registerResp, err := client.Register(clientPubKey)
+	if err != nil {
+		return err
 	}
 
 	// Save client configuration (WireGuard best practice: persistent config only)
 	clientConfig := &config.ClientConfig{
-		ClientPrivateKey: clientPrivKey,
-		ClientPublicKey:  clientPubKey,
-		ServerPublicKey:  registerResp.ServerPublicKey,
-		ServerEndpoint:   registerResp.ServerEndpoint,
-		ClientIP:         registerResp.ClientIP,
-		RegisteredAt:     time.Now(),
+		ClientPrivateKey:    clientPrivKey,
+		ClientPublicKey:     clientPubKey,
+		ServerPublicKey:     registerResp.ServerPublicKey,
+		ServerEndpoint:      registerResp.ServerEndpoint,
+		ClientIP:            registerResp.ClientIP,
+		ClientAddress:       registerResp.ClientAddress,
+		NetworkCIDR:         registerResp.NetworkCIDR,
+		Gateway:             registerResp.Gateway,
+		PersistentKeepalive: registerResp.PersistentKeepalive,
+		MTU:                 registerResp.MTU,
+		TCPPort:             registerResp.TCPPort,
+		APIPort:             registerResp.APIPort,
+		APITLS:              registerResp.APITLS,
+		RegisteredAt:        time.Now(),
 	}
 
 	if err := config.Save(clientConfig); err != nil {
 		return fmt.Errorf("failed to save client configuration: %w", err)
 	}
 
+	// Later commands can omit --server
+	rememberDefaultServer(serverURL)
+
 	// Display results
 	fmt.Printf("✅ %s\n", registerResp.Message)
 	fmt.Printf("📋 Server Details:\n")
 	fmt.Printf("   Public Key: %s\n", registerResp.ServerPublicKey)
 	fmt.Printf("   Endpoint: %s\n", registerResp.ServerEndpoint)
-	fmt.Printf("   Your VPN IP: %s\n", registerResp.ClientIP)
+	fmt.Printf("   Your VPN IP: %s\n", clientConfig.Address())
+	if registerResp.NetworkCIDR != "" {
+		fmt.Printf("   VPN Network: %s (gateway %s)\n", registerResp.NetworkCIDR, registerResp.Gateway)
+	}
 	fmt.Printf("🕒 Timestamp: %s\n", registerResp.Timestamp)
 
 	fmt.Println("\n🎉 Registration complete! Configuration saved securely.")
@@ -190,18 +713,269 @@ func runRegister(serverURL string) error {
 	return nil
 }
 
-func runConnect() error {
-	// Load client configuration
-	clientConfig, err := config.Load()
+func runRenewKeys(serverURL string) error {
+	fmt.Println("🔐 Renewing client keys")
+
+	client, err := newAPIClient(serverURL)
 	if err != nil {
-		return fmt.Errorf("failed to load configuration: %w\nHint: Run 'vpn-cli register --server=<url>' first", err)
+		return err
+	}
+	renewed, err := renewKeys(client)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("✅ New Client Public Key: %s\n", renewed.ClientPublicKey)
+	fmt.Printf("   Your VPN IP: %s\n", renewed.Address())
+	fmt.Println("💡 Reconnect ('vpn-cli disconnect' then 'vpn-cli connect') to use the new keys")
+	return nil
+}
+
+// renewKeys replaces the stored key pair, keeping the old one if the server or the save fails
+func renewKeys(client *api.Client) (*config.ClientConfig, error) {
+	current, err := config.Load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load configuration: %w\nHint: Run 'vpn-cli register --server=<url>' first", err)
+	}
+
+	newPrivKey, newPubKey, err := keys.GenerateKeyPair()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate client keys: %w", err)
+	}
+
+	resp, err := client.ReplacePeerKey(current.ClientPrivateKey, current.ServerPublicKey, newPubKey)
+	if err != nil {
+		return nil, fmt.Errorf("server rejected key replacement, existing keys kept: %w", err)
+	}
+
+	renewed := *current
+	renewed.ClientPrivateKey = newPrivKey
+	renewed.ClientPublicKey = newPubKey
+	if resp.ClientIP != "" {
+		renewed.ClientIP = resp.ClientIP
+	}
+
+	if err := config.Save(&renewed); err != nil {
+		// The server already switched keys; switch it back so the saved config still works
+		if _, rollbackErr := client.ReplacePeerKey(newPrivKey, current.ServerPublicKey, current.ClientPublicKey); rollbackErr != nil {
+			return nil, fmt.Errorf("failed to save new keys: %w (restoring the old key on the server also failed: %v)", err, rollbackErr)
+		}
+		return nil, fmt.Errorf("failed to save new keys, old key restored on server: %w", err)
+	}
+
+	return &renewed, nil
+}
+
+func runUnregister(serverURL, apiKey string) error {
+	fmt.Println("🗑️  Unregistering client")
+
+	client, err := newAPIClient(serverURL)
+	if err != nil {
+		return err
+	}
+	client.SetAPIKey(apiKey)
+	if err := unregister(client); err != nil {
+		return err
+	}
+
+	fmt.Println("✅ Registration removed from server and local configuration deleted")
+	fmt.Println("💡 Run 'vpn-cli register' to register again")
+	return nil
+}
+
+// unregister removes the stored registration from the server, then deletes the saved config
+// A server that no longer knows the key (404) counts as success, since the config is unusable either way
+func unregister(client *api.Client) error {
+	current, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w\nHint: Nothing to unregister without a saved registration", err)
+	}
+
+	if err := client.Unregister(current.ClientPrivateKey, current.ServerPublicKey); err != nil {
+		var apiErr *api.APIError
+		if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+			return fmt.Errorf("server rejected unregistration, configuration kept: %w", err)
+		}
+		fmt.Println("⚠️ Server had no registration for this client")
+	}
+
+	if err := config.Delete(); err != nil {
+		return fmt.Errorf("unregistered on server but failed to delete configuration: %w", err)
+	}
+	return nil
+}
+
+// tunnelOverrides holds connect flags that take precedence over stored tunnel parameters
+type tunnelOverrides struct {
+	keepalive  *int
+	mtu        int
+	autoMTU    bool
+	listenPort int
+	exclude    []string // Added to the stored exclusions
+}
+
+const (
+	transportUDP = "udp"
+	transportTCP = "tcp"
+)
+
+// transportOptions selects how WireGuard packets travel to the server
+type transportOptions struct {
+	kind     string // transportUDP (default) or transportTCP
+	endpoint string // TCP transport address (default: the server endpoint)
+}
+
+// loadClientConfig reads the config from source ("-" for stdin, a file path) or the saved registration
+func loadClientConfig(source string, stdin io.Reader) (*config.ClientConfig, error) {
+	switch source {
+	case "":
+		clientConfig, err := config.Load()
+		if err != nil {
+			return nil, fmt.Errorf("failed to load configuration: %w\nHint: Run 'vpn-cli register --server=<url>' first", err)
+		}
+		return clientConfig, nil
+	case "-":
+		return config.Read(stdin)
+	default:
+		file, err := os.Open(source)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open config: %w", err)
+		}
+		defer file.Close()
+		return config.Read(file)
+	}
+}
+
+func runConnect(native, force, autoReconnect bool, configSource string, family tunnel.AddressFamily, overrides tunnelOverrides, verify tunnel.VerifyOptions, transport transportOptions, writeConfig string) error {
+	switch transport.kind {
+	case "", transportUDP, transportTCP:
+	default:
+		return fmt.Errorf("invalid transport %q (expected %s or %s)", transport.kind, transportUDP, transportTCP)
+	}
+
+	clientConfig, err := loadClientConfig(configSource, os.Stdin)
+	if err != nil {
+		return err
+	}
+
+	// Overrides are not saved, so the server recommendation applies next time
+	if overrides.keepalive != nil {
+		clientConfig.PersistentKeepalive = overrides.keepalive
+	}
+	if overrides.mtu > 0 {
+		clientConfig.MTU = overrides.mtu
+	}
+	if overrides.listenPort != 0 {
+		if overrides.listenPort < 0 || overrides.listenPort > 65535 {
+			return fmt.Errorf("invalid listen port: %d", overrides.listenPort)
+		}
+		clientConfig.ListenPort = overrides.listenPort
+	}
+	if len(overrides.exclude) > 0 {
+		if _, err := config.ParseExcludeRoutes(overrides.exclude); err != nil {
+			return fmt.Errorf("invalid --exclude: %w", err)
+		}
+		clientConfig.ExcludeRoutes = append(clientConfig.ExcludeRoutes, overrides.exclude...)
 	}
 
 	// Create tunnel manager
 	tm := tunnel.NewTunnelManager(clientConfig)
+	if native {
+		tm = tunnel.NewNativeTunnelManager(clientConfig)
+	}
+	tm.SetForce(force)
+	tm.SetVerifyOptions(verify)
+	tm.SetPreferFamily(family)
+	tm.SetAutoMTU(overrides.autoMTU)
+	if history, err := openHistory(); err == nil {
+		tm.SetHistory(history)
+	}
+
+	// Dry run: show exactly what would be applied, leaving the system untouched
+	if writeConfig != "" {
+		if err := tm.WriteConfig(writeConfig); err != nil {
+			return err
+		}
+		fmt.Printf("📝 WireGuard config written to %s (interface not brought up)\n", writeConfig)
+		return nil
+	}
+
+	if transport.kind == transportTCP {
+		if autoReconnect {
+			return fmt.Errorf("--auto-reconnect is not supported with the TCP transport")
+		}
+		return connectOverTCP(tm, clientConfig, transport.endpoint)
+	}
 
 	// Connect to VPN
-	return tm.Connect()
+	if err := tm.Connect(); err != nil {
+		return err
+	}
+	if !autoReconnect {
+		return nil
+	}
+	return watchTunnel(tm)
+}
+
+// watchTunnel keeps the tunnel up until interrupted and then disconnects
+func watchTunnel(tm *tunnel.TunnelManager) error {
+	fmt.Println("🔁 Auto-reconnect active - press Ctrl+C to disconnect")
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := tm.Watch(ctx, tunnel.DefaultWatchOptions()); err != nil {
+		return fmt.Errorf("interrupted while reconnecting: %w", err)
+	}
+	return tm.Disconnect()
+}
+
+// connectOverTCP points WireGuard at a local relay that carries its packets to the server over TCP
+// The relay lives in this process, so it keeps running until interrupted and then disconnects
+func connectOverTCP(tm *tunnel.TunnelManager, clientConfig *config.ClientConfig, endpoint string) error {
+	if endpoint == "" {
+		var err error
+		if endpoint, err = defaultTCPEndpoint(clientConfig); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("🔀 Using TCP transport via %s\n", endpoint)
+	relay, err := tcpshim.Dial(endpoint, tunnel.BypassFwmark)
+	if err != nil {
+		return fmt.Errorf("failed to start TCP transport: %w", err)
+	}
+	defer relay.Close()
+
+	// The tunnel manager holds this config, so the relay becomes its endpoint without being saved
+	clientConfig.ServerEndpoint = relay.LocalAddr()
+	if err := tm.Connect(); err != nil {
+		return err
+	}
+
+	fmt.Println("⏳ TCP transport active - press Ctrl+C to disconnect")
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	select {
+	case <-signals:
+	case <-relay.Done():
+		fmt.Println("⚠️  TCP transport connection lost")
+	}
+	return tm.Disconnect()
+}
+
+// defaultTCPEndpoint pairs the server endpoint's host with the TCP transport port from registration
+// The UDP endpoint's own port belongs to WireGuard, so there is no fallback when the port is unknown
+func defaultTCPEndpoint(clientConfig *config.ClientConfig) (string, error) {
+	if clientConfig.TCPPort == 0 {
+		return "", fmt.Errorf("server did not report a TCP transport port (VPN_TCP_PORT unset, or registered with an older server); pass --tcp-endpoint=host:port")
+	}
+	host, _, err := net.SplitHostPort(clientConfig.ServerEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid server endpoint %q: %w", clientConfig.ServerEndpoint, err)
+	}
+	return net.JoinHostPort(host, strconv.Itoa(clientConfig.TCPPort)), nil
 }
 
 func runDisconnect() error {
@@ -213,6 +987,9 @@ func runDisconnect() error {
 
 	// Create tunnel manager
 	tm := tunnel.NewTunnelManager(clientConfig)
+	if history, err := openHistory(); err == nil {
+		tm.SetHistory(history)
+	}
 
 	// Disconnect from VPN
 	return tm.Disconnect()
@@ -245,6 +1022,9 @@ func runStatus() error {
 		if status.LastConnected != nil {
 			fmt.Printf("Connected since: %s\n", status.LastConnected.Format("2006-01-02 15:04:05"))
 		}
+		if status.ListenPort > 0 {
+			fmt.Printf("Local port: %d/udp\n", status.ListenPort)
+		}
 		if status.BytesReceived > 0 || status.BytesSent > 0 {
 			fmt.Printf("Data transferred: ⬇️ %d bytes, ⬆️ %d bytes\n", status.BytesReceived, status.BytesSent)
 		}
@@ -278,43 +1058,33 @@ func runTestVPN() error {
 
 	fmt.Println("🧪 Testing VPN tunnel functionality...")
 
-	// Extract server endpoint info
-	serverEndpoint := clientConfig.ServerEndpoint
-	if strings.HasPrefix(serverEndpoint, ":") {
-		serverEndpoint = "localhost" + serverEndpoint
-	}
-
-	// Try to access the VPN test endpoint
-	testURL := "http://localhost:8443/api/vpn-test"
-	fmt.Printf("Testing VPN endpoint: %s\n", testURL)
-
-	resp, err := http.Get(testURL)
+	// The endpoint only answers clients inside the VPN, so reach the API at the gateway through the tunnel
+	testURL, err := gatewayAPIURL(clientConfig)
 	if err != nil {
-		return fmt.Errorf("VPN test failed - could not reach test endpoint: %w", err)
+		return err
 	}
-	defer resp.Body.Close()
+	fmt.Printf("Testing VPN endpoint: %s/api/vpn-test\n", testURL)
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("VPN test failed - server returned status %d", resp.StatusCode)
+	client, err := newAPIClient(testURL)
+	if err != nil {
+		return err
 	}
-
-	// Parse response
-	var testResp map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&testResp); err != nil {
-		return fmt.Errorf("failed to parse test response: %w", err)
+	testResp, err := client.VPNTest()
+	if err != nil {
+		return fmt.Errorf("VPN test failed - could not reach test endpoint: %w", err)
 	}
 
 	// Display results
 	fmt.Println("\n✅ VPN Test Results:")
-	fmt.Printf("   Message: %v\n", testResp["message"])
-	fmt.Printf("   Client IP seen by server: %v\n", testResp["clientIP"])
-	fmt.Printf("   Server time: %v\n", testResp["serverTime"])
-	fmt.Printf("   Via: %v\n", testResp["via"])
+	fmt.Printf("   Message: %s\n", testResp.Message)
+	fmt.Printf("   Client IP seen by server: %s\n", testResp.ClientIP)
+	fmt.Printf("   Server time: %s\n", testResp.ServerTime)
+	fmt.Printf("   Via: %s\n", testResp.Via)
 	fmt.Println()
 
 	// Additional diagnostics
 	fmt.Println("📊 VPN Tunnel Diagnostics:")
-	fmt.Printf("   Local VPN IP: %s\n", clientConfig.ClientIP)
+	fmt.Printf("   Local VPN IP: %s\n", clientConfig.Address())
 	fmt.Printf("   Server endpoint: %s\n", clientConfig.ServerEndpoint)
 	fmt.Printf("   Connection method: Userspace WireGuard\n")
 
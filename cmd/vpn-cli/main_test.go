@@ -0,0 +1,535 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/november1306/go-vpn/internal/client/api"
+	"github.com/november1306/go-vpn/internal/client/config"
+	"github.com/november1306/go-vpn/internal/wireguard/keys"
+	"github.com/spf13/cobra"
+)
+
+// saveTestConfig stores a registered client config under a temporary home directory
+func saveTestConfig(t *testing.T) *config.ClientConfig {
+	t.Helper()
+
+	cfg, _ := saveTestConfigWithServerKey(t)
+	return cfg
+}
+
+// saveTestConfigWithServerKey is saveTestConfig, also returning the server private key
+// the config was registered against so tests can verify ownership proofs
+func saveTestConfigWithServerKey(t *testing.T) (*config.ClientConfig, string) {
+	t.Helper()
+
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+
+	privKey, pubKey, err := keys.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("Failed to generate keys: %v", err)
+	}
+	serverPrivKey, serverPubKey, err := keys.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("Failed to generate server keys: %v", err)
+	}
+
+	cfg := &config.ClientConfig{
+		ClientPrivateKey: privKey,
+		ClientPublicKey:  pubKey,
+		ServerPublicKey:  serverPubKey,
+		ServerEndpoint:   "203.0.113.10:51820",
+		ClientIP:         "10.0.0.2/32",
+		RegisteredAt:     time.Now(),
+	}
+	if err := config.Save(cfg); err != nil {
+		t.Fatalf("Failed to save config: %v", err)
+	}
+	return cfg, serverPrivKey
+}
+
+func TestRenewKeys(t *testing.T) {
+	t.Run("success updates config", func(t *testing.T) {
+		original, serverPrivKey := saveTestConfigWithServerKey(t)
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var req api.ReplaceKeyRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Fatalf("Failed to decode request: %v", err)
+			}
+			if req.OldPublicKey != original.ClientPublicKey {
+				t.Errorf("Expected old key %s, got %s", original.ClientPublicKey, req.OldPublicKey)
+			}
+			if err := keys.VerifyOwnership(serverPrivKey, req.OldPublicKey, req.Proof, req.Timestamp, time.Now(),
+				keys.ProofReplaceKey, req.OldPublicKey, req.NewPublicKey); err != nil {
+				t.Errorf("Request should prove ownership of the old key: %v", err)
+			}
+			json.NewEncoder(w).Encode(api.ReplaceKeyResponse{PublicKey: req.NewPublicKey, ClientIP: "10.0.0.2/32"})
+		}))
+		defer server.Close()
+
+		renewed, err := renewKeys(api.NewClient(server.URL))
+		if err != nil {
+			t.Fatalf("renewKeys failed: %v", err)
+		}
+
+		loaded, err := config.Load()
+		if err != nil {
+			t.Fatalf("Failed to load config: %v", err)
+		}
+		if loaded.ClientPublicKey == original.ClientPublicKey || loaded.ClientPrivateKey == original.ClientPrivateKey {
+			t.Error("Expected stored keys to change")
+		}
+		if loaded.ClientPublicKey != renewed.ClientPublicKey {
+			t.Errorf("Stored public key %s, want %s", loaded.ClientPublicKey, renewed.ClientPublicKey)
+		}
+		if derived, err := keys.PublicKeyFromPrivate(loaded.ClientPrivateKey); err != nil || derived != loaded.ClientPublicKey {
+			t.Error("Stored private key does not match stored public key")
+		}
+		if loaded.ClientIP != original.ClientIP || loaded.ServerPublicKey != original.ServerPublicKey {
+			t.Errorf("Registration details should be preserved, got %+v", loaded)
+		}
+	})
+
+	t.Run("server rejection keeps config", func(t *testing.T) {
+		original := saveTestConfig(t)
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":"Peer not registered"}`))
+		}))
+		defer server.Close()
+
+		if _, err := renewKeys(api.NewClient(server.URL)); err == nil {
+			t.Fatal("Expected error when server rejects the swap")
+		}
+
+		loaded, err := config.Load()
+		if err != nil {
+			t.Fatalf("Failed to load config: %v", err)
+		}
+		if loaded.ClientPublicKey != original.ClientPublicKey || loaded.ClientPrivateKey != original.ClientPrivateKey {
+			t.Error("Config should be unchanged after a rejected swap")
+		}
+	})
+}
+
+func TestUnregister(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		wantErr    bool
+		wantConfig bool
+	}{
+		{"success deletes config", http.StatusOK, false, false},
+		{"unknown peer deletes config", http.StatusNotFound, false, false},
+		{"server failure keeps config", http.StatusInternalServerError, true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original, serverPrivKey := saveTestConfigWithServerKey(t)
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var req api.UnregisterRequest
+				if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+					t.Fatalf("Failed to decode request: %v", err)
+				}
+				if r.URL.Path != "/api/unregister" || req.ClientPublicKey != original.ClientPublicKey {
+					t.Errorf("Unexpected request to %s for key %s", r.URL.Path, req.ClientPublicKey)
+				}
+				if err := keys.VerifyOwnership(serverPrivKey, req.ClientPublicKey, req.Proof, req.Timestamp, time.Now(),
+					keys.ProofUnregister, req.ClientPublicKey); err != nil {
+					t.Errorf("Request should prove ownership of the client key: %v", err)
+				}
+				w.WriteHeader(tt.status)
+				w.Write([]byte(`{}`))
+			}))
+			defer server.Close()
+
+			err := unregister(api.NewClient(server.URL))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("unregister() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := config.Exists(); got != tt.wantConfig {
+				t.Errorf("Config exists = %v, want %v", got, tt.wantConfig)
+			}
+		})
+	}
+}
+
+func TestRegisterWithSuppliedKey(t *testing.T) {
+	isolateHome := func(t *testing.T) {
+		home := t.TempDir()
+		t.Setenv("HOME", home)
+		t.Setenv("USERPROFILE", home)
+	}
+
+	t.Run("registers the supplied key", func(t *testing.T) {
+		isolateHome(t)
+		privKey, pubKey, err := keys.GenerateKeyPair()
+		if err != nil {
+			t.Fatalf("Failed to generate keys: %v", err)
+		}
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var req api.RegisterRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Fatalf("Failed to decode request: %v", err)
+			}
+			if req.ClientPublicKey != pubKey {
+				t.Errorf("Expected public key %s, got %s", pubKey, req.ClientPublicKey)
+			}
+			if auth := r.Header.Get("Authorization"); auth != "Bearer api-secret" {
+				t.Errorf("Expected the API key as bearer token, got %q", auth)
+			}
+			json.NewEncoder(w).Encode(api.RegisterResponse{ServerPublicKey: pubKey, ServerEndpoint: "203.0.113.10:51820", ClientIP: "10.0.0.2/32", TCPPort: 8444, APIPort: 9443, APITLS: true})
+		}))
+		defer server.Close()
+
+		keyFile := filepath.Join(t.TempDir(), "client.key")
+		if err := os.WriteFile(keyFile, []byte(privKey+"\n"), 0600); err != nil {
+			t.Fatalf("Failed to write key file: %v", err)
+		}
+		supplied, err := readPrivateKey("", keyFile)
+		if err != nil {
+			t.Fatalf("readPrivateKey failed: %v", err)
+		}
+		if err := runRegister(server.URL, supplied, "api-secret"); err != nil {
+			t.Fatalf("runRegister failed: %v", err)
+		}
+
+		loaded, err := config.Load()
+		if err != nil {
+			t.Fatalf("Failed to load config: %v", err)
+		}
+		if loaded.ClientPrivateKey != privKey || loaded.ClientPublicKey != pubKey {
+			t.Errorf("Expected the supplied key pair to be stored, got %s / %s", loaded.ClientPrivateKey, loaded.ClientPublicKey)
+		}
+		if loaded.TCPPort != 8444 || loaded.APIPort != 9443 || !loaded.APITLS {
+			t.Errorf("Expected TCP port 8444 and HTTPS API port 9443 to be stored, got %d, %d (TLS %v)", loaded.TCPPort, loaded.APIPort, loaded.APITLS)
+		}
+	})
+
+	t.Run("invalid key is rejected before contacting the server", func(t *testing.T) {
+		isolateHome(t)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t.Error("Server should not be contacted with an invalid key")
+		}))
+		defer server.Close()
+
+		if err := runRegister(server.URL, "not-a-key", ""); err == nil || !strings.Contains(err.Error(), "invalid private key") {
+			t.Errorf("Expected invalid private key error, got %v", err)
+		}
+		if config.Exists() {
+			t.Error("No config should be saved for a rejected key")
+		}
+	})
+
+	t.Run("flag and file are exclusive", func(t *testing.T) {
+		if _, err := readPrivateKey("key", "key.file"); err == nil {
+			t.Error("Expected error when both --private-key and --private-key-file are set")
+		}
+	})
+
+	t.Run("empty key file", func(t *testing.T) {
+		keyFile := filepath.Join(t.TempDir(), "empty.key")
+		if err := os.WriteFile(keyFile, []byte("\n"), 0600); err != nil {
+			t.Fatalf("Failed to write key file: %v", err)
+		}
+		if _, err := readPrivateKey("", keyFile); err == nil {
+			t.Error("Expected error for an empty key file")
+		}
+	})
+}
+
+func TestDefaultTCPEndpoint(t *testing.T) {
+	tests := []struct {
+		name     string
+		endpoint string
+		tcpPort  int
+		want     string
+		wantErr  bool
+	}{
+		{"uses reported TCP port", "203.0.113.10:51820", 8444, "203.0.113.10:8444", false},
+		{"ipv6 endpoint", "[2001:db8::1]:51820", 8444, "[2001:db8::1]:8444", false},
+		{"port not reported", "203.0.113.10:51820", 0, "", true},
+		{"invalid endpoint", "203.0.113.10", 8444, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := defaultTCPEndpoint(&config.ClientConfig{ServerEndpoint: tt.endpoint, TCPPort: tt.tcpPort})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("defaultTCPEndpoint() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("defaultTCPEndpoint() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompletionCommand(t *testing.T) {
+	for _, shell := range []string{"bash", "zsh", "fish", "powershell"} {
+		t.Run(shell, func(t *testing.T) {
+			var out bytes.Buffer
+			rootCmd.SetOut(&out)
+			rootCmd.SetArgs([]string{"completion", shell})
+			defer rootCmd.SetOut(nil)
+			defer rootCmd.SetArgs(nil)
+
+			if err := rootCmd.Execute(); err != nil {
+				t.Fatalf("completion %s failed: %v", shell, err)
+			}
+			if !strings.Contains(out.String(), "vpn-cli") {
+				t.Errorf("Expected completion script mentioning vpn-cli, got %d bytes", out.Len())
+			}
+		})
+	}
+
+	t.Run("unknown shell", func(t *testing.T) {
+		rootCmd.SetOut(io.Discard)
+		rootCmd.SetErr(io.Discard)
+		rootCmd.SetArgs([]string{"completion", "tcsh"})
+		defer rootCmd.SetOut(nil)
+		defer rootCmd.SetErr(nil)
+		defer rootCmd.SetArgs(nil)
+
+		if err := rootCmd.Execute(); err == nil {
+			t.Error("Expected error for unsupported shell")
+		}
+	})
+}
+
+func TestCompleteServerURL(t *testing.T) {
+	saveTestConfig(t) // Isolates HOME
+	t.Setenv(config.ServerEnvVar, "https://env.example.com")
+	if err := config.SaveSettings(&config.Settings{DefaultServer: "https://stored.example.com"}); err != nil {
+		t.Fatalf("Failed to save settings: %v", err)
+	}
+
+	suggestions, directive := completeServerURL(registerCmd, nil, "")
+	if len(suggestions) != 2 || suggestions[0] != "https://env.example.com" || suggestions[1] != "https://stored.example.com" {
+		t.Errorf("Unexpected suggestions %v", suggestions)
+	}
+	if directive != cobra.ShellCompDirectiveNoFileComp {
+		t.Errorf("Expected no file completion, got %v", directive)
+	}
+}
+
+func TestLoadClientConfig(t *testing.T) {
+	saved := saveTestConfig(t)
+
+	privKey, _, _ := keys.GenerateKeyPair()
+	_, serverPubKey, _ := keys.GenerateKeyPair()
+	piped := `{"clientPrivateKey":"` + privKey + `","serverPublicKey":"` + serverPubKey +
+		`","serverEndpoint":"198.51.100.1:51820","clientIP":"10.0.0.9/32"}`
+
+	t.Run("saved registration", func(t *testing.T) {
+		cfg, err := loadClientConfig("", strings.NewReader(piped))
+		if err != nil {
+			t.Fatalf("loadClientConfig failed: %v", err)
+		}
+		if cfg.ClientPublicKey != saved.ClientPublicKey {
+			t.Error("Expected the saved config when no source is given")
+		}
+	})
+
+	t.Run("stdin", func(t *testing.T) {
+		cfg, err := loadClientConfig("-", strings.NewReader(piped))
+		if err != nil {
+			t.Fatalf("loadClientConfig failed: %v", err)
+		}
+		if cfg.ClientIP != "10.0.0.9/32" || cfg.ServerEndpoint != "198.51.100.1:51820" {
+			t.Errorf("Expected piped config, got %+v", cfg)
+		}
+	})
+
+	t.Run("incomplete stdin", func(t *testing.T) {
+		if _, err := loadClientConfig("-", strings.NewReader(`{"clientIP":"10.0.0.9/32"}`)); err == nil {
+			t.Error("Expected error for incomplete piped config")
+		}
+	})
+}
+
+func TestWriteVersionJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeVersion(&buf, true); err != nil {
+		t.Fatalf("writeVersion failed: %v", err)
+	}
+
+	var fields map[string]string
+	if err := json.Unmarshal(buf.Bytes(), &fields); err != nil {
+		t.Fatalf("Output is not JSON: %v\n%s", err, buf.String())
+	}
+	for _, key := range []string{"version", "commit", "buildDate"} {
+		if fields[key] == "" {
+			t.Errorf("Expected non-empty %q in %v", key, fields)
+		}
+	}
+}
+
+func TestRunValidate(t *testing.T) {
+	_, serverPubKey, _ := keys.GenerateKeyPair()
+	_, otherPubKey, _ := keys.GenerateKeyPair()
+
+	tests := []struct {
+		name       string
+		mutate     func(cfg *config.ClientConfig)
+		wantErr    bool
+		wantOutput string
+	}{
+		{"valid", func(cfg *config.ClientConfig) {}, false, "✅ key pair"},
+		{"mismatched keys", func(cfg *config.ClientConfig) { cfg.ClientPublicKey = otherPubKey }, true, "❌ key pair"},
+		{"bad endpoint", func(cfg *config.ClientConfig) { cfg.ServerEndpoint = "203.0.113.10" }, true, "❌ server endpoint"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := saveTestConfig(t)
+			cfg.ServerPublicKey = serverPubKey
+			tt.mutate(cfg)
+			if err := config.Save(cfg); err != nil {
+				t.Fatalf("Failed to save config: %v", err)
+			}
+			configPath, _ := config.GetConfigPath()
+
+			var out bytes.Buffer
+			err := runValidate(&out, configPath)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("runValidate error = %v, wantErr %v\n%s", err, tt.wantErr, out.String())
+			}
+			if !strings.Contains(out.String(), tt.wantOutput) {
+				t.Errorf("Expected output to contain %q, got:\n%s", tt.wantOutput, out.String())
+			}
+		})
+	}
+}
+
+func TestRunConfigShow(t *testing.T) {
+	cfg := saveTestConfig(t)
+	configPath, _ := config.GetConfigPath()
+
+	tests := []struct {
+		name        string
+		showPrivate bool
+		wantKey     string
+		wantWarning bool
+	}{
+		{"redacted by default", false, redactedKey, false},
+		{"show private", true, cfg.ClientPrivateKey, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out, errOut bytes.Buffer
+			if err := runConfigShow(&out, &errOut, configPath, tt.showPrivate); err != nil {
+				t.Fatalf("runConfigShow failed: %v", err)
+			}
+
+			var fields map[string]any
+			if err := json.Unmarshal(out.Bytes(), &fields); err != nil {
+				t.Fatalf("Output is not JSON: %v\n%s", err, out.String())
+			}
+			if fields["clientPrivateKey"] != tt.wantKey {
+				t.Errorf("Expected clientPrivateKey %q, got %v", tt.wantKey, fields["clientPrivateKey"])
+			}
+			if fields["derivedPublicKey"] != cfg.ClientPublicKey {
+				t.Errorf("Expected derivedPublicKey %q, got %v", cfg.ClientPublicKey, fields["derivedPublicKey"])
+			}
+			if fields["serverEndpoint"] != cfg.ServerEndpoint {
+				t.Errorf("Expected serverEndpoint %q, got %v", cfg.ServerEndpoint, fields["serverEndpoint"])
+			}
+			if !tt.showPrivate && strings.Contains(out.String(), cfg.ClientPrivateKey) {
+				t.Errorf("Private key leaked into redacted output:\n%s", out.String())
+			}
+			if gotWarning := errOut.Len() > 0; gotWarning != tt.wantWarning {
+				t.Errorf("Expected warning %v, got %q", tt.wantWarning, errOut.String())
+			}
+		})
+	}
+}
+
+func TestRedactConfigMissingKey(t *testing.T) {
+	shown := redactConfig(&config.ClientConfig{}, true)
+	if shown.ClientPrivateKey != missingKey {
+		t.Errorf("Expected %q for a missing key, got %q", missingKey, shown.ClientPrivateKey)
+	}
+	if shown.DerivedPublicKey != "" {
+		t.Errorf("Expected no derived key, got %q", shown.DerivedPublicKey)
+	}
+}
+
+func TestNewAPIClientTLS(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"message":"ok","clientIP":"10.0.0.2"}`))
+	}))
+	defer server.Close()
+
+	saved := apiTLS
+	t.Cleanup(func() { apiTLS = saved })
+
+	sum := sha256.Sum256(server.Certificate().Raw)
+	apiTLS = api.TLSOptions{Fingerprint: hex.EncodeToString(sum[:])}
+	client, err := newAPIClient(server.URL)
+	if err != nil {
+		t.Fatalf("newAPIClient failed: %v", err)
+	}
+	if _, err := client.VPNTest(); err != nil {
+		t.Errorf("Request with a pinned fingerprint failed: %v", err)
+	}
+
+	apiTLS = api.TLSOptions{Fingerprint: hex.EncodeToString(sum[:]), InsecureSkipVerify: true}
+	if _, err := newAPIClient(server.URL); err == nil {
+		t.Error("Expected an error when both TLS flags are set")
+	}
+}
+
+func TestRunTestVPNTargetsGateway(t *testing.T) {
+	cfg := saveTestConfig(t)
+
+	var gotPath string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		json.NewEncoder(w).Encode(api.VPNTestResponse{Message: "ok", ClientIP: "10.0.0.2"})
+	}))
+	defer server.Close()
+
+	// Stand in for the gateway with the test server's address and port
+	host, port, _ := net.SplitHostPort(strings.TrimPrefix(server.URL, "http://"))
+	cfg.Gateway = host
+	cfg.APIPort, _ = strconv.Atoi(port)
+	if err := config.Save(cfg); err != nil {
+		t.Fatalf("Failed to save config: %v", err)
+	}
+
+	if err := runTestVPN(); err != nil {
+		t.Fatalf("runTestVPN failed: %v", err)
+	}
+	if gotPath != "/api/vpn-test" {
+		t.Errorf("Expected a request to /api/vpn-test at the gateway, got %q", gotPath)
+	}
+
+	cfg.Gateway = ""
+	if err := config.Save(cfg); err != nil {
+		t.Fatalf("Failed to save config: %v", err)
+	}
+	if err := runTestVPN(); err == nil {
+		t.Error("Expected an error when the server reported no gateway")
+	}
+}
@@ -0,0 +1,393 @@
+// Package api provides a typed HTTP client for the go-vpn server API
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/november1306/go-vpn/internal/version"
+	"github.com/november1306/go-vpn/internal/wireguard/keys"
+)
+
+// DefaultTimeout bounds every request made by the client
+const DefaultTimeout = 10 * time.Second
+
+// RegisterRequest is the body sent to /api/register
+type RegisterRequest struct {
+	ClientPublicKey string `json:"clientPublicKey"`
+}
+
+// RegisterResponse is returned by a successful registration
+type RegisterResponse struct {
+	ServerPublicKey string `json:"serverPublicKey"`
+	ServerEndpoint  string `json:"serverEndpoint"`
+	ClientIP        string `json:"clientIP"`                // CIDR form, e.g. 10.0.0.2/32
+	ClientAddress   string `json:"clientAddress,omitempty"` // Bare address; empty when the server predates it
+	// Tunnel parameters recommended by the server; nil/zero when the server predates them
+	PersistentKeepalive *int     `json:"persistentKeepalive,omitempty"`
+	MTU                 int      `json:"mtu,omitempty"`
+	NetworkCIDR         string   `json:"networkCIDR,omitempty"`
+	Gateway             string   `json:"gateway,omitempty"`
+	ServiceIPs          []string `json:"serviceIPs,omitempty"` // Addresses of services inside the VPN, e.g. DNS
+	TCPPort             int      `json:"tcpPort,omitempty"`    // TCP transport port; zero when disabled or the server predates it
+	APIPort             int      `json:"apiPort,omitempty"`    // API listen port; zero when the server predates it
+	APITLS              bool     `json:"apiTLS,omitempty"`     // API is served over HTTPS
+	Message             string   `json:"message"`
+	Timestamp           string   `json:"timestamp"`
+}
+
+// UnregisterRequest is the body sent to /api/unregister
+type UnregisterRequest struct {
+	ClientPublicKey string `json:"clientPublicKey"`
+	Timestamp       int64  `json:"timestamp"` // Unix seconds the proof was made at
+	Proof           string `json:"proof"`     // keys.ProveOwnership of the client key
+}
+
+// ReplaceKeyRequest is the body sent to /api/peers/replace-key
+type ReplaceKeyRequest struct {
+	OldPublicKey string `json:"oldPublicKey"`
+	NewPublicKey string `json:"newPublicKey"`
+	Timestamp    int64  `json:"timestamp"` // Unix seconds the proof was made at
+	Proof        string `json:"proof"`     // keys.ProveOwnership of the old key over both keys
+}
+
+// ReplaceKeyResponse is returned by a successful key replacement
+type ReplaceKeyResponse struct {
+	PublicKey string `json:"publicKey"`
+	ClientIP  string `json:"clientIP"`
+	Timestamp string `json:"timestamp"`
+}
+
+// PeerInfo describes a peer as reported by /api/status
+type PeerInfo struct {
+	PublicKey         string
+	AllowedIPs        []string
+	Endpoint          string
+	EndpointChangedAt int64
+	LastSeen          int64
+	RxBytes           uint64
+	TxBytes           uint64
+	SourceViolations  int64
+	Active            bool
+}
+
+// ServerInfo describes the server as reported by /api/status
+type ServerInfo struct {
+	PublicKey string
+	Endpoint  string // Formatted host:port (":port" when the server doesn't know its public host)
+	Host      string // Empty when only the port is known or the server predates it
+	Port      int
+	ServerIP  string
+}
+
+// StatusResponse is returned by /api/status
+type StatusResponse struct {
+	Status               string           `json:"status"`
+	ConnectedPeers       int              `json:"connectedPeers"`
+	Peers                []PeerInfo       `json:"peers"`
+	ServerInfo           ServerInfo       `json:"serverInfo"`
+	RegistrationFailures map[string]int64 `json:"registrationFailures"`
+	Timestamp            string           `json:"timestamp"`
+}
+
+// VPNTestResponse is returned by /api/vpn-test
+type VPNTestResponse struct {
+	Message    string `json:"message"`
+	ClientIP   string `json:"clientIP"`
+	ServerTime string `json:"serverTime"`
+	Via        string `json:"via"`
+	Note       string `json:"note"`
+}
+
+// BenchResponse is returned by /api/bench for an upload
+type BenchResponse struct {
+	Bytes      int64  `json:"bytes"`
+	DurationMs int64  `json:"durationMs"`
+	Timestamp  string `json:"timestamp"`
+}
+
+// errorResponse mirrors the server's JSON error body
+type errorResponse struct {
+	Error     string `json:"error"`
+	Timestamp string `json:"timestamp"`
+}
+
+// APIError is returned when the server answers with a non-2xx status
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("server returned status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("server returned status %d: %s", e.StatusCode, e.Message)
+}
+
+// Client talks to a go-vpn server
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	userAgent  string
+	apiKey     string // Sent as a bearer token when set
+}
+
+// NewClient creates a client for the server at baseURL with default timeouts
+func NewClient(baseURL string) *Client {
+	return &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: &http.Client{Timeout: DefaultTimeout},
+		userAgent:  "go-vpn-cli/" + version.Version,
+	}
+}
+
+// TLSOptions controls how the client checks an HTTPS server's certificate
+// The server's self-signed certificate fails the default checks, so one of these is needed for VPN_TLS_ENABLED
+type TLSOptions struct {
+	Fingerprint        string // SHA-256 of the server certificate in hex (colons optional), as logged at server startup
+	InsecureSkipVerify bool   // Accept any certificate; the connection is encrypted but the server is not authenticated
+}
+
+// SetTLSOptions changes how the client verifies HTTPS servers
+// A fingerprint replaces CA and hostname checks, so the pinned certificate is accepted at any address
+func (c *Client) SetTLSOptions(opts TLSOptions) error {
+	if opts.Fingerprint == "" && !opts.InsecureSkipVerify {
+		return nil
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: true} // Replaced by the pin check below, or deliberately skipped
+	if opts.Fingerprint != "" {
+		want, err := parseFingerprint(opts.Fingerprint)
+		if err != nil {
+			return err
+		}
+		// VerifyConnection also runs on resumed sessions, unlike VerifyPeerCertificate
+		tlsConfig.VerifyConnection = func(state tls.ConnectionState) error {
+			if len(state.PeerCertificates) == 0 {
+				return fmt.Errorf("server presented no certificate")
+			}
+			got := sha256.Sum256(state.PeerCertificates[0].Raw)
+			if !bytes.Equal(got[:], want) {
+				return fmt.Errorf("server certificate fingerprint %s does not match the pinned %s", hex.EncodeToString(got[:]), hex.EncodeToString(want))
+			}
+			return nil
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	c.httpClient.Transport = transport
+	return nil
+}
+
+// parseFingerprint decodes a hex SHA-256 fingerprint, accepting the colon-separated form openssl prints
+func parseFingerprint(fingerprint string) ([]byte, error) {
+	decoded, err := hex.DecodeString(strings.ReplaceAll(strings.TrimSpace(fingerprint), ":", ""))
+	if err != nil || len(decoded) != sha256.Size {
+		return nil, fmt.Errorf("invalid certificate fingerprint %q: want %d hex-encoded SHA-256 bytes", fingerprint, sha256.Size)
+	}
+	return decoded, nil
+}
+
+// SetAPIKey makes the client authenticate with key, for servers that set VPN_API_KEY
+func (c *Client) SetAPIKey(key string) {
+	c.apiKey = key
+}
+
+// Register registers a client public key and returns the assigned tunnel settings
+func (c *Client) Register(publicKey string) (*RegisterResponse, error) {
+	var resp RegisterResponse
+	if err := c.do(http.MethodPost, "/api/register", RegisterRequest{ClientPublicKey: publicKey}, &resp); err != nil {
+		return nil, fmt.Errorf("register: %w", err)
+	}
+	return &resp, nil
+}
+
+// Unregister removes the registration for privateKey's public key
+// The request is signed with privateKey for the server holding serverPublicKey
+func (c *Client) Unregister(privateKey, serverPublicKey string) error {
+	publicKey, err := keys.PublicKeyFromPrivate(privateKey)
+	if err != nil {
+		return fmt.Errorf("unregister: %w", err)
+	}
+	timestamp := time.Now().Unix()
+	proof, err := keys.ProveOwnership(privateKey, serverPublicKey, timestamp, keys.ProofUnregister, publicKey)
+	if err != nil {
+		return fmt.Errorf("unregister: %w", err)
+	}
+
+	req := UnregisterRequest{ClientPublicKey: publicKey, Timestamp: timestamp, Proof: proof}
+	if err := c.do(http.MethodPost, "/api/unregister", req, nil); err != nil {
+		return fmt.Errorf("unregister: %w", err)
+	}
+	return nil
+}
+
+// ReplacePeerKey moves the registration for oldPrivateKey's public key to newKey, keeping the assigned IP
+// The request is signed with oldPrivateKey for the server holding serverPublicKey
+func (c *Client) ReplacePeerKey(oldPrivateKey, serverPublicKey, newKey string) (*ReplaceKeyResponse, error) {
+	oldKey, err := keys.PublicKeyFromPrivate(oldPrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("replace key: %w", err)
+	}
+	timestamp := time.Now().Unix()
+	proof, err := keys.ProveOwnership(oldPrivateKey, serverPublicKey, timestamp, keys.ProofReplaceKey, oldKey, newKey)
+	if err != nil {
+		return nil, fmt.Errorf("replace key: %w", err)
+	}
+
+	var resp ReplaceKeyResponse
+	req := ReplaceKeyRequest{OldPublicKey: oldKey, NewPublicKey: newKey, Timestamp: timestamp, Proof: proof}
+	if err := c.do(http.MethodPost, "/api/peers/replace-key", req, &resp); err != nil {
+		return nil, fmt.Errorf("replace key: %w", err)
+	}
+	return &resp, nil
+}
+
+// Status fetches the server status
+func (c *Client) Status() (*StatusResponse, error) {
+	var resp StatusResponse
+	if err := c.do(http.MethodGet, "/api/status", nil, &resp); err != nil {
+		return nil, fmt.Errorf("status: %w", err)
+	}
+	return &resp, nil
+}
+
+// VPNTest calls the tunnel-only test endpoint
+func (c *Client) VPNTest() (*VPNTestResponse, error) {
+	var resp VPNTestResponse
+	if err := c.do(http.MethodGet, "/api/vpn-test", nil, &resp); err != nil {
+		return nil, fmt.Errorf("vpn test: %w", err)
+	}
+	return &resp, nil
+}
+
+// BenchDownload fetches size bytes from /api/bench and returns how many arrived
+// Transfers are bounded by ctx instead of DefaultTimeout, which is too short for large sizes
+func (c *Client) BenchDownload(ctx context.Context, size int64) (int64, error) {
+	resp, err := c.stream(ctx, http.MethodGet, fmt.Sprintf("/api/bench?bytes=%d", size), nil)
+	if err != nil {
+		return 0, fmt.Errorf("bench download: %w", err)
+	}
+	defer resp.Body.Close()
+
+	n, err := io.Copy(io.Discard, resp.Body)
+	if err != nil {
+		return n, fmt.Errorf("bench download: %w", err)
+	}
+	return n, nil
+}
+
+// BenchUpload sends size bytes to /api/bench
+func (c *Client) BenchUpload(ctx context.Context, size int64) (*BenchResponse, error) {
+	body := io.LimitReader(zeroReader{}, size)
+	resp, err := c.stream(ctx, http.MethodPost, "/api/bench", body)
+	if err != nil {
+		return nil, fmt.Errorf("bench upload: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var result BenchResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("bench upload: failed to parse response: %w", err)
+	}
+	return &result, nil
+}
+
+// stream sends a raw request bounded only by ctx, returning the open response on a 2xx status
+func (c *Client) stream(ctx context.Context, method, path string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("User-Agent", c.userAgent)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/octet-stream")
+	}
+
+	client := *c.httpClient
+	client.Timeout = 0
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to server: %w", err)
+	}
+	if err := statusError(resp); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	return resp, nil
+}
+
+// zeroReader is an endless source of zero bytes for uploads
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+// do sends a JSON request and decodes a JSON response into out when non-nil
+func (c *Client) do(method, path string, body, out interface{}) error {
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request: %w", err)
+		}
+		reqBody = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, c.baseURL+path, reqBody)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("User-Agent", c.userAgent)
+	req.Header.Set("Accept", "application/json")
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to connect to server: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if err := statusError(resp); err != nil {
+		return err
+	}
+
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	return nil
+}
+
+// statusError returns an *APIError for a non-2xx response, with the server's message if it sent one
+func statusError(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+		return nil
+	}
+	apiErr := &APIError{StatusCode: resp.StatusCode}
+	var errResp errorResponse
+	if err := json.NewDecoder(resp.Body).Decode(&errResp); err == nil {
+		apiErr.Message = errResp.Error
+	}
+	return apiErr
+}
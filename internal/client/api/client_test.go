@@ -0,0 +1,285 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/november1306/go-vpn/internal/version"
+	"github.com/november1306/go-vpn/internal/wireguard/keys"
+)
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func TestRegister(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost || r.URL.Path != "/api/register" {
+				t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+			}
+			if ua := r.Header.Get("User-Agent"); ua != "go-vpn-cli/"+version.Version {
+				t.Errorf("Unexpected User-Agent %q", ua)
+			}
+			if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+				t.Errorf("Unexpected Content-Type %q", ct)
+			}
+
+			var req RegisterRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Fatalf("Failed to decode request: %v", err)
+			}
+			if req.ClientPublicKey != "client-key" {
+				t.Errorf("Unexpected client key %q", req.ClientPublicKey)
+			}
+
+			keepalive := 15
+			writeJSON(w, http.StatusOK, RegisterResponse{
+				ServerPublicKey:     "server-key",
+				ServerEndpoint:      ":51820",
+				ClientIP:            "10.0.0.2/32",
+				ClientAddress:       "10.0.0.2",
+				PersistentKeepalive: &keepalive,
+				MTU:                 1380,
+			})
+		}))
+		defer server.Close()
+
+		resp, err := NewClient(server.URL + "/").Register("client-key")
+		if err != nil {
+			t.Fatalf("Register failed: %v", err)
+		}
+		if resp.ServerPublicKey != "server-key" || resp.ClientIP != "10.0.0.2/32" || resp.ClientAddress != "10.0.0.2" {
+			t.Errorf("Unexpected response %+v", resp)
+		}
+		if resp.PersistentKeepalive == nil || *resp.PersistentKeepalive != 15 || resp.MTU != 1380 {
+			t.Errorf("Expected keepalive 15 and MTU 1380, got %v and %d", resp.PersistentKeepalive, resp.MTU)
+		}
+	})
+
+	t.Run("server without tunnel parameters", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"serverPublicKey":"server-key","serverEndpoint":":51820","clientIP":"10.0.0.2/32"}`))
+		}))
+		defer server.Close()
+
+		resp, err := NewClient(server.URL).Register("client-key")
+		if err != nil {
+			t.Fatalf("Register failed: %v", err)
+		}
+		if resp.PersistentKeepalive != nil || resp.MTU != 0 {
+			t.Errorf("Expected no tunnel parameters, got %v and %d", resp.PersistentKeepalive, resp.MTU)
+		}
+	})
+
+	t.Run("error response", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "Invalid client public key format"})
+		}))
+		defer server.Close()
+
+		_, err := NewClient(server.URL).Register("bad")
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) {
+			t.Fatalf("Expected APIError, got %v", err)
+		}
+		if apiErr.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected status 400, got %d", apiErr.StatusCode)
+		}
+		if !strings.Contains(err.Error(), "Invalid client public key format") {
+			t.Errorf("Expected server message in error, got %v", err)
+		}
+	})
+
+	t.Run("non-JSON error body", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "bad gateway", http.StatusBadGateway)
+		}))
+		defer server.Close()
+
+		_, err := NewClient(server.URL).Register("key")
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadGateway {
+			t.Fatalf("Expected 502 APIError, got %v", err)
+		}
+	})
+}
+
+func TestUnregister(t *testing.T) {
+	serverPriv, serverPub, _ := keys.GenerateKeyPair()
+	clientPriv, clientPub, _ := keys.GenerateKeyPair()
+
+	t.Run("success", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost || r.URL.Path != "/api/unregister" {
+				t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+			}
+			var req UnregisterRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Fatalf("Failed to decode request: %v", err)
+			}
+			if req.ClientPublicKey != clientPub {
+				t.Errorf("Expected key %s, got %s", clientPub, req.ClientPublicKey)
+			}
+			if err := keys.VerifyOwnership(serverPriv, clientPub, req.Proof, req.Timestamp, time.Now(), keys.ProofUnregister, clientPub); err != nil {
+				t.Errorf("Request should prove ownership of the client key: %v", err)
+			}
+			writeJSON(w, http.StatusOK, map[string]string{"message": "ok"})
+		}))
+		defer server.Close()
+
+		if err := NewClient(server.URL).Unregister(clientPriv, serverPub); err != nil {
+			t.Errorf("Unregister failed: %v", err)
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, http.StatusNotFound, errorResponse{Error: "peer not registered"})
+		}))
+		defer server.Close()
+
+		err := NewClient(server.URL).Unregister(clientPriv, serverPub)
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+			t.Errorf("Expected 404 APIError, got %v", err)
+		}
+	})
+
+	t.Run("invalid key", func(t *testing.T) {
+		if err := NewClient("http://127.0.0.1:0").Unregister("not-a-key", serverPub); err == nil {
+			t.Error("Expected an error for an invalid private key")
+		}
+	})
+}
+
+func TestAPIKey(t *testing.T) {
+	var got []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = append(got, r.Header.Get("Authorization"))
+		writeJSON(w, http.StatusOK, map[string]string{"message": "ok"})
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL)
+	client.Status()
+	client.SetAPIKey("secret")
+	client.Status()
+
+	if len(got) != 2 || got[0] != "" || got[1] != "Bearer secret" {
+		t.Errorf("Expected no header and then the bearer key, got %q", got)
+	}
+}
+
+func TestStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Path != "/api/status" {
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		writeJSON(w, http.StatusOK, StatusResponse{
+			Status:         "running",
+			ConnectedPeers: 1,
+			Peers:          []PeerInfo{{PublicKey: "peer", AllowedIPs: []string{"10.0.0.2/32"}}},
+			ServerInfo:     ServerInfo{PublicKey: "server-key", Endpoint: ":51820"},
+		})
+	}))
+	defer server.Close()
+
+	status, err := NewClient(server.URL).Status()
+	if err != nil {
+		t.Fatalf("Status failed: %v", err)
+	}
+	if status.Status != "running" || status.ConnectedPeers != 1 || len(status.Peers) != 1 {
+		t.Errorf("Unexpected status %+v", status)
+	}
+	if status.ServerInfo.PublicKey != "server-key" {
+		t.Errorf("Unexpected server info %+v", status.ServerInfo)
+	}
+}
+
+func TestClientTimeout(t *testing.T) {
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	defer server.Close()
+	defer close(done)
+
+	client := NewClient(server.URL)
+	client.httpClient.Timeout = 50 * time.Millisecond
+
+	if _, err := client.Status(); err == nil {
+		t.Error("Expected timeout error")
+	}
+}
+
+func TestTLSOptions(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/bench":
+			w.Write(make([]byte, 16))
+		default:
+			writeJSON(w, http.StatusOK, StatusResponse{Status: "running"})
+		}
+	}))
+	server.Config.ErrorLog = log.New(io.Discard, "", 0) // Rejected handshakes are expected here
+	server.StartTLS()
+	defer server.Close()
+
+	sum := sha256.Sum256(server.Certificate().Raw)
+	fingerprint := hex.EncodeToString(sum[:])
+	colonForm := strings.ReplaceAll(fmt.Sprintf("% X", sum[:]), " ", ":") // As openssl prints it
+	wrong := strings.Repeat("00", sha256.Size)
+
+	tests := []struct {
+		name    string
+		opts    TLSOptions
+		wantErr bool
+	}{
+		{"default verification rejects self-signed", TLSOptions{}, true},
+		{"insecure skip verify", TLSOptions{InsecureSkipVerify: true}, false},
+		{"pinned fingerprint", TLSOptions{Fingerprint: fingerprint}, false},
+		{"pinned fingerprint with colons", TLSOptions{Fingerprint: colonForm}, false},
+		{"wrong fingerprint", TLSOptions{Fingerprint: wrong}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := NewClient(server.URL)
+			if err := client.SetTLSOptions(tt.opts); err != nil {
+				t.Fatalf("SetTLSOptions failed: %v", err)
+			}
+
+			_, err := client.Status()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Status() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			// Streaming requests copy the HTTP client, so they must keep the TLS settings
+			if _, err := client.BenchDownload(context.Background(), 16); (err != nil) != tt.wantErr {
+				t.Errorf("BenchDownload() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	t.Run("invalid fingerprint", func(t *testing.T) {
+		for _, fp := range []string{"zz", fingerprint[:10]} {
+			if err := NewClient(server.URL).SetTLSOptions(TLSOptions{Fingerprint: fp}); err == nil {
+				t.Errorf("Expected an error for fingerprint %q", fp)
+			}
+		}
+	})
+}
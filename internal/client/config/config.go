@@ -2,11 +2,16 @@ package config
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net/netip"
 	"os"
 	"path/filepath"
 	"runtime"
 	"time"
+
+	"github.com/november1306/go-vpn/internal/wireguard/keys"
 )
 
 // ClientConfig represents the client-side VPN configuration
@@ -19,7 +24,29 @@ type ClientConfig struct {
 	// Server connection details
 	ServerPublicKey string `json:"serverPublicKey"`
 	ServerEndpoint  string `json:"serverEndpoint"`
-	ClientIP        string `json:"clientIP"`
+	ClientIP        string `json:"clientIP"`                // CIDR form used for the interface config
+	ClientAddress   string `json:"clientAddress,omitempty"` // Bare address for display and ping targets
+
+	// VPN subnet and server address within it (empty if the server didn't report them)
+	NetworkCIDR string `json:"networkCIDR,omitempty"`
+	Gateway     string `json:"gateway,omitempty"`
+
+	// TCP transport port on the server endpoint's host (0 = not offered by the server)
+	TCPPort int `json:"tcpPort,omitempty"`
+
+	// API listener as reached at the gateway over the tunnel (0 = unknown, assume the default)
+	APIPort int  `json:"apiPort,omitempty"`
+	APITLS  bool `json:"apiTLS,omitempty"`
+
+	// Tunnel parameters recommended by the server (nil/zero means use the default)
+	PersistentKeepalive *int `json:"persistentKeepalive,omitempty"`
+	MTU                 int  `json:"mtu,omitempty"`
+
+	// Local UDP port for the tunnel (0 = ephemeral); a client-side choice, never sent by the server
+	ListenPort int `json:"listenPort,omitempty"`
+
+	// IPv4 CIDRs routed via the original gateway instead of the tunnel (LAN, corporate DNS)
+	ExcludeRoutes []string `json:"excludeRoutes,omitempty"`
 
 	// Registration metadata
 	RegisteredAt time.Time `json:"registeredAt"`
@@ -28,8 +55,42 @@ type ClientConfig struct {
 const (
 	configDirName  = ".go-wire-vpn"
 	configFileName = "config.json"
+
+	// DefaultPersistentKeepalive is used when the server didn't recommend a keepalive
+	DefaultPersistentKeepalive = 25
+
+	// DefaultMTU is used when the server didn't recommend an MTU
+	DefaultMTU = 1420
 )
 
+// Keepalive returns the persistent keepalive interval in seconds (0 disables it)
+func (c *ClientConfig) Keepalive() int {
+	if c.PersistentKeepalive == nil {
+		return DefaultPersistentKeepalive
+	}
+	return *c.PersistentKeepalive
+}
+
+// TunnelMTU returns the MTU to use for the tunnel interface
+func (c *ClientConfig) TunnelMTU() int {
+	if c.MTU <= 0 {
+		return DefaultMTU
+	}
+	return c.MTU
+}
+
+// Address returns the bare client VPN address
+// Configs saved before the server reported clientAddress fall back to parsing ClientIP
+func (c *ClientConfig) Address() string {
+	if c.ClientAddress != "" {
+		return c.ClientAddress
+	}
+	if prefix, err := netip.ParsePrefix(c.ClientIP); err == nil {
+		return prefix.Addr().String()
+	}
+	return c.ClientIP
+}
+
 // GetConfigPath returns the path to the client configuration file
 func GetConfigPath() (string, error) {
 	homeDir, err := os.UserHomeDir()
@@ -66,6 +127,81 @@ func Load() (*ClientConfig, error) {
 	return &config, nil
 }
 
+// Read decodes a client configuration from r and checks it is complete
+// Used for configs injected at runtime (e.g. piped from a secret manager) that never touch disk
+func Read(r io.Reader) (*ClientConfig, error) {
+	var config ClientConfig
+	if err := json.NewDecoder(r).Decode(&config); err != nil {
+		return nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// Validate checks that the fields needed to bring up a tunnel are present and well formed
+// A missing client public key is derived from the private key
+func (c *ClientConfig) Validate() error {
+	var errs []error
+
+	required := []struct {
+		name  string
+		value string
+	}{
+		{"clientPrivateKey", c.ClientPrivateKey},
+		{"serverPublicKey", c.ServerPublicKey},
+		{"serverEndpoint", c.ServerEndpoint},
+		{"clientIP", c.ClientIP},
+	}
+	for _, field := range required {
+		if field.value == "" {
+			errs = append(errs, fmt.Errorf("%s is required", field.name))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("incomplete client config: %w", errors.Join(errs...))
+	}
+
+	derived, err := keys.PublicKeyFromPrivate(c.ClientPrivateKey)
+	if err != nil {
+		return fmt.Errorf("invalid clientPrivateKey: %w", err)
+	}
+	if c.ClientPublicKey == "" {
+		c.ClientPublicKey = derived
+	} else if c.ClientPublicKey != derived {
+		return fmt.Errorf("clientPublicKey does not match clientPrivateKey")
+	}
+
+	if err := keys.ValidatePublicKey(c.ServerPublicKey); err != nil {
+		return fmt.Errorf("invalid serverPublicKey: %w", err)
+	}
+	if c.ListenPort < 0 || c.ListenPort > 65535 {
+		return fmt.Errorf("invalid listenPort: %d", c.ListenPort)
+	}
+	if _, err := ParseExcludeRoutes(c.ExcludeRoutes); err != nil {
+		return fmt.Errorf("invalid excludeRoutes: %w", err)
+	}
+	return nil
+}
+
+// ParseExcludeRoutes parses tunnel exclusions; only IPv4 is supported since they use the IPv4 default gateway
+func ParseExcludeRoutes(cidrs []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q: %w", cidr, err)
+		}
+		if !prefix.Addr().Is4() {
+			return nil, fmt.Errorf("CIDR %q is not IPv4", cidr)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
 // Save writes the client configuration to disk with secure permissions
 func Save(config *ClientConfig) error {
 	configPath, err := GetConfigPath()
@@ -94,20 +230,42 @@ func Save(config *ClientConfig) error {
 }
 
 // writeConfigFile writes the config data with appropriate security permissions
+// The data goes to a temp file that is renamed over path, so readers never see a partial write
 func writeConfigFile(path string, data []byte) error {
+	tempPath := path + ".tmp"
+
 	// Create file with restrictive permissions (0600 on Unix)
-	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	file, err := os.OpenFile(tempPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
 	if err != nil {
 		return err
 	}
-	defer file.Close()
 
 	if _, err := file.Write(data); err != nil {
+		file.Close()
+		os.Remove(tempPath)
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		os.Remove(tempPath)
+		return err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(tempPath)
 		return err
 	}
 
 	// Apply platform-specific security settings
-	return applySecurityPermissions(path)
+	if err := applySecurityPermissions(tempPath); err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+
+	if err := os.Rename(tempPath, path); err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+	return nil
 }
 
 // applySecurityPermissions applies platform-specific security settings
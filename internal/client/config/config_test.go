@@ -1,9 +1,11 @@
 package config
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"testing"
 	"time"
 
@@ -94,6 +96,124 @@ func TestConfigRoundTrip(t *testing.T) {
 	}
 }
 
+func TestTunnelParameters(t *testing.T) {
+	zero := 0
+	fifteen := 15
+
+	tests := []struct {
+		name          string
+		config        ClientConfig
+		wantKeepalive int
+		wantMTU       int
+	}{
+		{name: "defaults", config: ClientConfig{}, wantKeepalive: 25, wantMTU: 1420},
+		{name: "server recommended", config: ClientConfig{PersistentKeepalive: &fifteen, MTU: 1380}, wantKeepalive: 15, wantMTU: 1380},
+		{name: "keepalive disabled", config: ClientConfig{PersistentKeepalive: &zero}, wantKeepalive: 0, wantMTU: 1420},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.config.Keepalive(); got != tt.wantKeepalive {
+				t.Errorf("Keepalive() = %d, want %d", got, tt.wantKeepalive)
+			}
+			if got := tt.config.TunnelMTU(); got != tt.wantMTU {
+				t.Errorf("TunnelMTU() = %d, want %d", got, tt.wantMTU)
+			}
+		})
+	}
+}
+
+func TestAddress(t *testing.T) {
+	tests := []struct {
+		name   string
+		config ClientConfig
+		want   string
+	}{
+		{"reported by server", ClientConfig{ClientIP: "10.0.0.2/32", ClientAddress: "10.0.0.2"}, "10.0.0.2"},
+		{"derived from CIDR", ClientConfig{ClientIP: "10.0.0.7/32"}, "10.0.0.7"},
+		{"IPv6", ClientConfig{ClientIP: "fd00::2/128"}, "fd00::2"},
+		{"bare client IP", ClientConfig{ClientIP: "10.0.0.9"}, "10.0.0.9"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.config.Address(); got != tt.want {
+				t.Errorf("Address() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRead(t *testing.T) {
+	clientPrivKey, clientPubKey, _ := keys.GenerateKeyPair()
+	_, serverPubKey, _ := keys.GenerateKeyPair()
+
+	valid := fmt.Sprintf(`{"clientPrivateKey":%q,"serverPublicKey":%q,"serverEndpoint":"vpn.example.com:51820","clientIP":"10.0.0.2/32","mtu":1380}`,
+		clientPrivKey, serverPubKey)
+
+	t.Run("valid config", func(t *testing.T) {
+		cfg, err := Read(strings.NewReader(valid))
+		if err != nil {
+			t.Fatalf("Read failed: %v", err)
+		}
+		if cfg.ClientPublicKey != clientPubKey {
+			t.Errorf("Expected derived public key %s, got %s", clientPubKey, cfg.ClientPublicKey)
+		}
+		if cfg.ServerEndpoint != "vpn.example.com:51820" || cfg.TunnelMTU() != 1380 {
+			t.Errorf("Unexpected config %+v", cfg)
+		}
+	})
+
+	tests := []struct {
+		name    string
+		input   string
+		wantErr string
+	}{
+		{
+			name:    "missing fields",
+			input:   fmt.Sprintf(`{"clientPrivateKey":%q}`, clientPrivKey),
+			wantErr: "serverPublicKey is required",
+		},
+		{
+			name:    "empty object",
+			input:   `{}`,
+			wantErr: "clientPrivateKey is required",
+		},
+		{
+			name: "mismatched public key",
+			input: fmt.Sprintf(`{"clientPrivateKey":%q,"clientPublicKey":%q,"serverPublicKey":%q,"serverEndpoint":"vpn.example.com:51820","clientIP":"10.0.0.2/32"}`,
+				clientPrivKey, serverPubKey, serverPubKey),
+			wantErr: "does not match",
+		},
+		{
+			name: "invalid server key",
+			input: fmt.Sprintf(`{"clientPrivateKey":%q,"serverPublicKey":"short","serverEndpoint":"vpn.example.com:51820","clientIP":"10.0.0.2/32"}`,
+				clientPrivKey),
+			wantErr: "invalid serverPublicKey",
+		},
+		{
+			name: "IPv6 exclusion",
+			input: fmt.Sprintf(`{"clientPrivateKey":%q,"serverPublicKey":%q,"serverEndpoint":"vpn.example.com:51820","clientIP":"10.0.0.2/32","excludeRoutes":["fd00::/8"]}`,
+				clientPrivKey, serverPubKey),
+			wantErr: "invalid excludeRoutes",
+		},
+		{
+			name:    "not JSON",
+			input:   `client_private_key=abc`,
+			wantErr: "failed to parse config",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Read(strings.NewReader(tt.input))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
 func TestConfigFilePermissions(t *testing.T) {
 	if runtime.GOOS == "windows" {
 		t.Skip("Skipping permission test on Windows")
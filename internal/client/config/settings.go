@@ -0,0 +1,104 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const (
+	settingsFileName = "settings.json"
+	historyFileName  = "history.jsonl"
+
+	// ServerEnvVar overrides the stored default server when --server is omitted
+	ServerEnvVar = "GOVPN_SERVER"
+)
+
+// Settings holds CLI preferences that are not part of a VPN registration
+type Settings struct {
+	// DefaultServer is used by commands when --server is not given
+	DefaultServer string `json:"defaultServer,omitempty"`
+}
+
+// GetSettingsPath returns the path to the CLI settings file
+func GetSettingsPath() (string, error) {
+	configPath, err := GetConfigPath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(configPath), settingsFileName), nil
+}
+
+// GetHistoryPath returns the path to the connection history log
+func GetHistoryPath() (string, error) {
+	configPath, err := GetConfigPath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(configPath), historyFileName), nil
+}
+
+// LoadSettings reads the CLI settings, returning empty settings if none are stored
+func LoadSettings() (*Settings, error) {
+	settingsPath, err := GetSettingsPath()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(settingsPath)
+	if os.IsNotExist(err) {
+		return &Settings{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read settings file: %w", err)
+	}
+
+	var settings Settings
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return nil, fmt.Errorf("failed to parse settings file: %w", err)
+	}
+
+	return &settings, nil
+}
+
+// SaveSettings writes the CLI settings to disk
+func SaveSettings(settings *Settings) error {
+	settingsPath, err := GetSettingsPath()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(settingsPath), 0700); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal settings: %w", err)
+	}
+
+	if err := writeConfigFile(settingsPath, data); err != nil {
+		return fmt.Errorf("failed to write settings file: %w", err)
+	}
+
+	return nil
+}
+
+// ResolveServer picks the server URL with precedence: flag > GOVPN_SERVER > stored default
+// Returns an error matching cobra's required-flag message if nothing resolves
+func ResolveServer(flagValue string, settings *Settings) (string, error) {
+	if flagValue != "" {
+		return flagValue, nil
+	}
+
+	if envValue := os.Getenv(ServerEnvVar); envValue != "" {
+		return envValue, nil
+	}
+
+	if settings != nil && settings.DefaultServer != "" {
+		return settings.DefaultServer, nil
+	}
+
+	return "", fmt.Errorf(`required flag(s) "server" not set`)
+}
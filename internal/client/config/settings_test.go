@@ -0,0 +1,68 @@
+package config
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestResolveServer(t *testing.T) {
+	stored := &Settings{DefaultServer: "https://stored.example.com"}
+
+	tests := []struct {
+		name     string
+		flag     string
+		env      string
+		settings *Settings
+		want     string
+		wantErr  bool
+	}{
+		{name: "flag wins over env and stored", flag: "https://flag.example.com", env: "https://env.example.com", settings: stored, want: "https://flag.example.com"},
+		{name: "env wins over stored", env: "https://env.example.com", settings: stored, want: "https://env.example.com"},
+		{name: "stored default", settings: stored, want: "https://stored.example.com"},
+		{name: "nothing resolves", settings: &Settings{}, wantErr: true},
+		{name: "nil settings", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(ServerEnvVar, tt.env)
+
+			got, err := ResolveServer(tt.flag, tt.settings)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ResolveServer() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ResolveServer() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSettingsRoundTrip(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("HOME", tempDir)
+	if runtime.GOOS == "windows" {
+		t.Setenv("USERPROFILE", tempDir)
+	}
+
+	settings, err := LoadSettings()
+	if err != nil {
+		t.Fatalf("LoadSettings() with no file failed: %v", err)
+	}
+	if settings.DefaultServer != "" {
+		t.Errorf("Expected empty default server, got %q", settings.DefaultServer)
+	}
+
+	settings.DefaultServer = "https://vpn.example.com"
+	if err := SaveSettings(settings); err != nil {
+		t.Fatalf("SaveSettings() failed: %v", err)
+	}
+
+	loaded, err := LoadSettings()
+	if err != nil {
+		t.Fatalf("LoadSettings() failed: %v", err)
+	}
+	if loaded.DefaultServer != "https://vpn.example.com" {
+		t.Errorf("DefaultServer = %q, want https://vpn.example.com", loaded.DefaultServer)
+	}
+}
@@ -0,0 +1,130 @@
+package tunnel
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"time"
+)
+
+// AddressFamily selects which IP version to reach the server over
+type AddressFamily int
+
+const (
+	FamilyAny  AddressFamily = 0 // Let the OS resolver choose
+	FamilyIPv4 AddressFamily = 4
+	FamilyIPv6 AddressFamily = 6
+)
+
+// endpointLookupTimeout bounds DNS resolution of the server endpoint
+const endpointLookupTimeout = 5 * time.Second
+
+// ParseAddressFamily parses a --prefer-family value ("", "4" or "6")
+func ParseAddressFamily(value string) (AddressFamily, error) {
+	switch value {
+	case "":
+		return FamilyAny, nil
+	case "4":
+		return FamilyIPv4, nil
+	case "6":
+		return FamilyIPv6, nil
+	default:
+		return FamilyAny, fmt.Errorf("invalid address family %q (want 4 or 6)", value)
+	}
+}
+
+func (f AddressFamily) String() string {
+	switch f {
+	case FamilyIPv4:
+		return "IPv4"
+	case FamilyIPv6:
+		return "IPv6"
+	default:
+		return "any"
+	}
+}
+
+// matches reports whether addr belongs to this family
+func (f AddressFamily) matches(addr netip.Addr) bool {
+	switch f {
+	case FamilyIPv4:
+		return addr.Unmap().Is4()
+	case FamilyIPv6:
+		return addr.Is6() && !addr.Is4In6()
+	default:
+		return true
+	}
+}
+
+// hostLookup resolves a hostname to its addresses
+type hostLookup func(host string) ([]netip.Addr, error)
+
+// resolveHost looks up host with the system resolver
+func resolveHost(host string) ([]netip.Addr, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), endpointLookupTimeout)
+	defer cancel()
+	return net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+}
+
+// selectEndpoint rewrites endpoint to an address of the requested family
+// Hostnames are resolved and the first matching address is used; IP literals must already match
+func selectEndpoint(endpoint string, family AddressFamily, lookup hostLookup) (string, error) {
+	if family == FamilyAny {
+		return endpoint, nil
+	}
+
+	host, port, err := net.SplitHostPort(endpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid server endpoint %q: %w", endpoint, err)
+	}
+
+	// The server advertises ":port" when it doesn't know its public address
+	if host == "" {
+		if family == FamilyIPv6 {
+			return net.JoinHostPort("::1", port), nil
+		}
+		return net.JoinHostPort("127.0.0.1", port), nil
+	}
+
+	if addr, err := netip.ParseAddr(host); err == nil {
+		if !family.matches(addr) {
+			return "", fmt.Errorf("server endpoint %s is not %s", endpoint, family)
+		}
+		return endpoint, nil
+	}
+
+	addrs, err := lookup(host)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve server endpoint %s: %w", host, err)
+	}
+	for _, addr := range addrs {
+		if family.matches(addr) {
+			return net.JoinHostPort(addr.Unmap().String(), port), nil
+		}
+	}
+	return "", fmt.Errorf("server endpoint %s has no %s address", host, family)
+}
+
+// SetPreferFamily makes Connect reach the server over the given IP version
+func (tm *TunnelManager) SetPreferFamily(family AddressFamily) {
+	tm.preferFamily = family
+}
+
+// applyPreferFamily pins the server endpoint to the preferred family before bring-up
+// The stored config is copied, never modified, so the preference isn't persisted
+func (tm *TunnelManager) applyPreferFamily() error {
+	if tm.preferFamily == FamilyAny {
+		return nil
+	}
+
+	endpoint, err := selectEndpoint(tm.config.ServerEndpoint, tm.preferFamily, resolveHost)
+	if err != nil {
+		return err
+	}
+
+	pinned := *tm.config
+	pinned.ServerEndpoint = endpoint
+	tm.config = &pinned
+	return nil
+}
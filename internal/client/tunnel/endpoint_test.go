@@ -0,0 +1,64 @@
+package tunnel
+
+import (
+	"errors"
+	"net/netip"
+	"testing"
+)
+
+func TestSelectEndpoint(t *testing.T) {
+	dualStack := func(host string) ([]netip.Addr, error) {
+		switch host {
+		case "vpn.example.com":
+			return []netip.Addr{netip.MustParseAddr("2001:db8::10"), netip.MustParseAddr("203.0.113.10")}, nil
+		case "v4only.example.com":
+			return []netip.Addr{netip.MustParseAddr("::ffff:203.0.113.20")}, nil
+		default:
+			return nil, errors.New("no such host")
+		}
+	}
+
+	tests := []struct {
+		name     string
+		endpoint string
+		family   AddressFamily
+		want     string
+		wantErr  bool
+	}{
+		{name: "any keeps hostname", endpoint: "vpn.example.com:51820", family: FamilyAny, want: "vpn.example.com:51820"},
+		{name: "dual stack prefers IPv4", endpoint: "vpn.example.com:51820", family: FamilyIPv4, want: "203.0.113.10:51820"},
+		{name: "dual stack prefers IPv6", endpoint: "vpn.example.com:51820", family: FamilyIPv6, want: "[2001:db8::10]:51820"},
+		{name: "mapped IPv4 counts as IPv4", endpoint: "v4only.example.com:51820", family: FamilyIPv4, want: "203.0.113.20:51820"},
+		{name: "no IPv6 address", endpoint: "v4only.example.com:51820", family: FamilyIPv6, wantErr: true},
+		{name: "IPv4 literal matches", endpoint: "203.0.113.10:51820", family: FamilyIPv4, want: "203.0.113.10:51820"},
+		{name: "IPv4 literal wrong family", endpoint: "203.0.113.10:51820", family: FamilyIPv6, wantErr: true},
+		{name: "IPv6 literal matches", endpoint: "[2001:db8::10]:51820", family: FamilyIPv6, want: "[2001:db8::10]:51820"},
+		{name: "missing host IPv4", endpoint: ":51820", family: FamilyIPv4, want: "127.0.0.1:51820"},
+		{name: "missing host IPv6", endpoint: ":51820", family: FamilyIPv6, want: "[::1]:51820"},
+		{name: "lookup failure", endpoint: "unknown.example.com:51820", family: FamilyIPv4, wantErr: true},
+		{name: "missing port", endpoint: "vpn.example.com", family: FamilyIPv4, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := selectEndpoint(tt.endpoint, tt.family, dualStack)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("selectEndpoint() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("selectEndpoint() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseAddressFamily(t *testing.T) {
+	for value, want := range map[string]AddressFamily{"": FamilyAny, "4": FamilyIPv4, "6": FamilyIPv6} {
+		if got, err := ParseAddressFamily(value); err != nil || got != want {
+			t.Errorf("ParseAddressFamily(%q) = %v, %v; want %v", value, got, err, want)
+		}
+	}
+	if _, err := ParseAddressFamily("ipv4"); err == nil {
+		t.Error("Expected error for invalid family")
+	}
+}
@@ -0,0 +1,109 @@
+package tunnel
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/november1306/go-vpn/internal/client/config"
+)
+
+// bypassRoute sends one excluded destination via the gateway that was default before the tunnel
+type bypassRoute struct {
+	prefix  netip.Prefix
+	gateway netip.Addr
+}
+
+// addArgs is the route.exe invocation installing the route
+func (r bypassRoute) addArgs() []string {
+	return append([]string{"add"}, r.routeArgs()...)
+}
+
+// deleteArgs is the route.exe invocation removing the route
+func (r bypassRoute) deleteArgs() []string {
+	return append([]string{"delete"}, r.routeArgs()...)
+}
+
+func (r bypassRoute) routeArgs() []string {
+	mask := net.CIDRMask(r.prefix.Bits(), 32)
+	return []string{r.prefix.Addr().String(), "mask", net.IP(mask).String(), r.gateway.String()}
+}
+
+// bypassRoutes builds a route per excluded CIDR via gateway
+func bypassRoutes(excludes []string, gateway netip.Addr) ([]bypassRoute, error) {
+	prefixes, err := config.ParseExcludeRoutes(excludes)
+	if err != nil {
+		return nil, err
+	}
+
+	routes := make([]bypassRoute, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		routes = append(routes, bypassRoute{prefix: prefix, gateway: gateway})
+	}
+	return routes, nil
+}
+
+// parseDefaultGateway extracts the lowest-metric IPv4 default gateway from `route print 0.0.0.0`
+// Active routes are listed as: destination, netmask, gateway, interface, metric
+func parseDefaultGateway(routePrint string) (netip.Addr, error) {
+	var best netip.Addr
+	bestMetric := -1
+
+	for _, line := range strings.Split(routePrint, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 5 || fields[0] != "0.0.0.0" || fields[1] != "0.0.0.0" {
+			continue
+		}
+		gateway, err := netip.ParseAddr(fields[2])
+		if err != nil || !gateway.Is4() {
+			continue // "On-link" or a persistent route without a gateway
+		}
+		metric, err := strconv.Atoi(fields[4])
+		if err != nil {
+			continue
+		}
+		if bestMetric < 0 || metric < bestMetric {
+			best, bestMetric = gateway, metric
+		}
+	}
+
+	if bestMetric < 0 {
+		return netip.Addr{}, fmt.Errorf("no IPv4 default gateway in routing table")
+	}
+	return best, nil
+}
+
+// addBypassRoutes routes the configured exclusions via currentGateway, keeping them off the tunnel
+// Routes that were added are recorded so teardown removes exactly those
+func (tm *TunnelManager) addBypassRoutes(currentGateway netip.Addr) error {
+	routes, err := bypassRoutes(tm.config.ExcludeRoutes, currentGateway)
+	if err != nil {
+		return err
+	}
+
+	for _, route := range routes {
+		if output, err := exec.Command("route", route.addArgs()...).CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to add bypass route for %s: %w\nOutput: %s", route.prefix, err, string(output))
+		}
+		tm.bypass = append(tm.bypass, route)
+		fmt.Printf("↪️  %s bypasses the VPN via %s\n", route.prefix, currentGateway)
+	}
+	return nil
+}
+
+// deleteBypassRoutes removes the routes added by addBypassRoutes, attempting each one
+func (tm *TunnelManager) deleteBypassRoutes() []teardownStep {
+	var steps []teardownStep
+	for _, route := range tm.bypass {
+		output, err := exec.Command("route", route.deleteArgs()...).CombinedOutput()
+		if err != nil {
+			err = fmt.Errorf("%w\nOutput: %s", err, string(output))
+		}
+		steps = append(steps, teardownStep{Name: "delete bypass route " + route.prefix.String(), Err: err})
+	}
+	tm.bypass = nil
+	return steps
+}
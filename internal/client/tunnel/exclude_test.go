@@ -0,0 +1,93 @@
+package tunnel
+
+import (
+	"net/netip"
+	"reflect"
+	"testing"
+)
+
+const routePrintOutput = `===========================================================================
+Interface List
+ 12...00 15 5d 01 02 03 ......Intel(R) Ethernet Connection
+===========================================================================
+
+IPv4 Route Table
+===========================================================================
+Active Routes:
+Network Destination        Netmask          Gateway       Interface  Metric
+          0.0.0.0          0.0.0.0      10.20.0.1      10.20.0.57     50
+          0.0.0.0          0.0.0.0    192.168.1.1   192.168.1.100     25
+===========================================================================
+Persistent Routes:
+  Network Address          Netmask  Gateway Address  Metric
+          0.0.0.0          0.0.0.0    192.168.1.254  Default
+===========================================================================
+`
+
+func TestParseDefaultGateway(t *testing.T) {
+	gateway, err := parseDefaultGateway(routePrintOutput)
+	if err != nil {
+		t.Fatalf("parseDefaultGateway failed: %v", err)
+	}
+	if want := netip.MustParseAddr("192.168.1.1"); gateway != want {
+		t.Errorf("Expected lowest-metric gateway %s, got %s", want, gateway)
+	}
+
+	if _, err := parseDefaultGateway("Active Routes:\n  None\n"); err == nil {
+		t.Error("Expected error without a default route")
+	}
+}
+
+func TestBypassRouteCommands(t *testing.T) {
+	gateway := netip.MustParseAddr("192.168.1.1")
+
+	tests := []struct {
+		name       string
+		excludes   []string
+		wantAdd    [][]string
+		wantDelete [][]string
+		wantErr    bool
+	}{
+		{
+			name:     "LAN and single host",
+			excludes: []string{"192.168.1.0/24", "10.1.2.3/32"},
+			wantAdd: [][]string{
+				{"add", "192.168.1.0", "mask", "255.255.255.0", "192.168.1.1"},
+				{"add", "10.1.2.3", "mask", "255.255.255.255", "192.168.1.1"},
+			},
+			wantDelete: [][]string{
+				{"delete", "192.168.1.0", "mask", "255.255.255.0", "192.168.1.1"},
+				{"delete", "10.1.2.3", "mask", "255.255.255.255", "192.168.1.1"},
+			},
+		},
+		{
+			name:       "host bits are masked off",
+			excludes:   []string{"172.16.5.9/12"},
+			wantAdd:    [][]string{{"add", "172.16.0.0", "mask", "255.240.0.0", "192.168.1.1"}},
+			wantDelete: [][]string{{"delete", "172.16.0.0", "mask", "255.240.0.0", "192.168.1.1"}},
+		},
+		{name: "invalid CIDR", excludes: []string{"192.168.1.0"}, wantErr: true},
+		{name: "IPv6", excludes: []string{"fd00::/8"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			routes, err := bypassRoutes(tt.excludes, gateway)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("bypassRoutes() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			var gotAdd, gotDelete [][]string
+			for _, route := range routes {
+				gotAdd = append(gotAdd, route.addArgs())
+				gotDelete = append(gotDelete, route.deleteArgs())
+			}
+			if !reflect.DeepEqual(gotAdd, tt.wantAdd) {
+				t.Errorf("add commands = %v, want %v", gotAdd, tt.wantAdd)
+			}
+			if !reflect.DeepEqual(gotDelete, tt.wantDelete) {
+				t.Errorf("delete commands = %v, want %v", gotDelete, tt.wantDelete)
+			}
+		})
+	}
+}
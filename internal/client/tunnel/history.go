@@ -0,0 +1,165 @@
+package tunnel
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// DefaultHistoryMaxBytes is the size at which the history log is rotated
+const DefaultHistoryMaxBytes = 256 * 1024
+
+// HistoryEvent is the kind of tunnel change recorded in the history log
+type HistoryEvent string
+
+const (
+	HistoryConnect    HistoryEvent = "connect"
+	HistoryDisconnect HistoryEvent = "disconnect"
+)
+
+// HistoryEntry is one line of the history log
+type HistoryEntry struct {
+	Time     time.Time    `json:"time"`
+	Event    HistoryEvent `json:"event"`
+	Server   string       `json:"server"`
+	ClientIP string       `json:"clientIP,omitempty"`
+
+	// Transfer totals for the session, recorded on disconnect
+	BytesReceived uint64 `json:"bytesReceived,omitempty"`
+	BytesSent     uint64 `json:"bytesSent,omitempty"`
+}
+
+// History is an append-only JSON Lines log of tunnel connections
+// When the file would exceed maxBytes it is moved to <path>.1, keeping one old generation
+type History struct {
+	path     string
+	maxBytes int64
+}
+
+// NewHistory returns a history log stored at path
+func NewHistory(path string) *History {
+	return &History{path: path, maxBytes: DefaultHistoryMaxBytes}
+}
+
+// Append writes an entry, rotating the log first if it is full
+func (h *History) Append(entry HistoryEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal history entry: %w", err)
+	}
+	line = append(line, '\n')
+
+	if err := os.MkdirAll(filepath.Dir(h.path), 0700); err != nil {
+		return fmt.Errorf("failed to create history directory: %w", err)
+	}
+
+	if info, err := os.Stat(h.path); err == nil && info.Size()+int64(len(line)) > h.maxBytes {
+		if err := os.Rename(h.path, h.rotatedPath()); err != nil {
+			return fmt.Errorf("failed to rotate history: %w", err)
+		}
+	}
+
+	file, err := os.OpenFile(h.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open history: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(line); err != nil {
+		return fmt.Errorf("failed to write history: %w", err)
+	}
+	return nil
+}
+
+// Entries returns all recorded entries, oldest first, including the rotated generation
+func (h *History) Entries() ([]HistoryEntry, error) {
+	var entries []HistoryEntry
+	for _, path := range []string{h.rotatedPath(), h.path} {
+		file, err := os.Open(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to open history: %w", err)
+		}
+
+		parsed, err := ParseHistory(file)
+		file.Close()
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, parsed...)
+	}
+	return entries, nil
+}
+
+// Clear removes the history log and its rotated generation
+func (h *History) Clear() error {
+	for _, path := range []string{h.path, h.rotatedPath()} {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to clear history: %w", err)
+		}
+	}
+	return nil
+}
+
+func (h *History) rotatedPath() string {
+	return h.path + ".1"
+}
+
+// ParseHistory decodes a JSON Lines history log
+// Lines that fail to parse (e.g. a write cut short by a crash) are skipped
+func ParseHistory(r io.Reader) ([]HistoryEntry, error) {
+	var entries []HistoryEntry
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+
+		var entry HistoryEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read history: %w", err)
+	}
+
+	return entries, nil
+}
+
+// SetHistory records connects and disconnects to h (nil disables recording)
+func (tm *TunnelManager) SetHistory(h *History) {
+	tm.history = h
+}
+
+// recordHistory appends a history entry; failures never affect the tunnel
+func (tm *TunnelManager) recordHistory(event HistoryEvent, stats *InterfaceStats) {
+	if tm.history == nil {
+		return
+	}
+
+	entry := HistoryEntry{
+		Time:     time.Now().UTC(),
+		Event:    event,
+		Server:   tm.config.ServerEndpoint,
+		ClientIP: tm.config.ClientIP,
+	}
+	if stats != nil {
+		entry.BytesReceived = stats.BytesReceived
+		entry.BytesSent = stats.BytesSent
+	}
+
+	if err := tm.history.Append(entry); err != nil {
+		fmt.Printf("Warning: failed to record connection history: %v\n", err)
+	}
+}
@@ -0,0 +1,138 @@
+package tunnel
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/november1306/go-vpn/internal/client/config"
+)
+
+func TestHistoryAppendAndEntries(t *testing.T) {
+	history := NewHistory(filepath.Join(t.TempDir(), "nested", "history.jsonl"))
+
+	entries, err := history.Entries()
+	if err != nil {
+		t.Fatalf("Entries on missing log failed: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("Expected no entries, got %d", len(entries))
+	}
+
+	connectedAt := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	want := []HistoryEntry{
+		{Time: connectedAt, Event: HistoryConnect, Server: "vpn.example.com:51820", ClientIP: "10.0.0.2"},
+		{Time: connectedAt.Add(time.Hour), Event: HistoryDisconnect, Server: "vpn.example.com:51820", ClientIP: "10.0.0.2", BytesReceived: 2048, BytesSent: 1024},
+	}
+	for _, entry := range want {
+		if err := history.Append(entry); err != nil {
+			t.Fatalf("Append failed: %v", err)
+		}
+	}
+
+	got, err := history.Entries()
+	if err != nil {
+		t.Fatalf("Entries failed: %v", err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Expected %d entries, got %d", len(want), len(got))
+	}
+	for i := range want {
+		if !got[i].Time.Equal(want[i].Time) || got[i].Event != want[i].Event || got[i].Server != want[i].Server ||
+			got[i].BytesReceived != want[i].BytesReceived || got[i].BytesSent != want[i].BytesSent {
+			t.Errorf("Entry %d: expected %+v, got %+v", i, want[i], got[i])
+		}
+	}
+}
+
+func TestParseHistory(t *testing.T) {
+	input := `{"time":"2025-01-02T03:04:05Z","event":"connect","server":"a:51820"}
+
+{"time":"2025-01-02T04:04:05Z","event":"disconnect","server":"a:51820","bytesReceived":10,"bytesSent":20}
+{"time":"2025-01-02T05:0`
+
+	entries, err := ParseHistory(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ParseHistory failed: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 entries (truncated line skipped), got %d", len(entries))
+	}
+	if entries[1].Event != HistoryDisconnect || entries[1].BytesReceived != 10 || entries[1].BytesSent != 20 {
+		t.Errorf("Unexpected disconnect entry: %+v", entries[1])
+	}
+}
+
+func TestHistoryRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	history := NewHistory(path)
+	history.maxBytes = 300
+
+	for i := 0; i < 10; i++ {
+		if err := history.Append(HistoryEntry{Time: time.Now(), Event: HistoryConnect, Server: "vpn.example.com:51820"}); err != nil {
+			t.Fatalf("Append %d failed: %v", i, err)
+		}
+	}
+
+	for _, p := range []string{path, path + ".1"} {
+		info, err := os.Stat(p)
+		if err != nil {
+			t.Fatalf("Expected %s to exist: %v", p, err)
+		}
+		if info.Size() > history.maxBytes {
+			t.Errorf("%s is %d bytes, exceeding limit %d", p, info.Size(), history.maxBytes)
+		}
+	}
+
+	entries, err := history.Entries()
+	if err != nil {
+		t.Fatalf("Entries failed: %v", err)
+	}
+	if len(entries) == 0 || len(entries) >= 10 {
+		t.Errorf("Expected rotation to drop the oldest entries, got %d", len(entries))
+	}
+
+	if err := history.Clear(); err != nil {
+		t.Fatalf("Clear failed: %v", err)
+	}
+	if entries, _ := history.Entries(); len(entries) != 0 {
+		t.Errorf("Expected empty history after Clear, got %d entries", len(entries))
+	}
+}
+
+func TestRecordHistory(t *testing.T) {
+	history := NewHistory(filepath.Join(t.TempDir(), "history.jsonl"))
+	tm := NewTunnelManager(&config.ClientConfig{ServerEndpoint: "vpn.example.com:51820", ClientIP: "10.0.0.2"})
+
+	tm.recordHistory(HistoryConnect, nil) // No history set: nothing recorded
+
+	tm.SetHistory(history)
+	tm.recordHistory(HistoryDisconnect, &InterfaceStats{BytesReceived: 5, BytesSent: 7})
+
+	entries, err := history.Entries()
+	if err != nil {
+		t.Fatalf("Entries failed: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("Expected 1 entry, got %d", len(entries))
+	}
+	entry := entries[0]
+	if entry.Event != HistoryDisconnect || entry.Server != "vpn.example.com:51820" || entry.ClientIP != "10.0.0.2" ||
+		entry.BytesReceived != 5 || entry.BytesSent != 7 {
+		t.Errorf("Unexpected entry: %+v", entry)
+	}
+}
+
+func TestParseTransferStats(t *testing.T) {
+	ipc := "private_key=abcd\npublic_key=1111\nrx_bytes=100\ntx_bytes=200\npublic_key=2222\nrx_bytes=1\ntx_bytes=2\n"
+	if stats := parseIpcTransfer(ipc); stats.BytesReceived != 101 || stats.BytesSent != 202 {
+		t.Errorf("parseIpcTransfer: got %+v", stats)
+	}
+
+	output := "key1=\t300\t400\nkey2=\t5\t6\ngarbage\n"
+	if stats := parseTransfer(output); stats.BytesReceived != 305 || stats.BytesSent != 406 {
+		t.Errorf("parseTransfer: got %+v", stats)
+	}
+}
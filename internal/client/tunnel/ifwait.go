@@ -0,0 +1,47 @@
+package tunnel
+
+import (
+	"fmt"
+	"net"
+	"time"
+)
+
+const (
+	// interfaceWaitTimeout bounds how long routing setup waits for a new device's interface
+	interfaceWaitTimeout = 5 * time.Second
+
+	// interfacePollInterval is how often the interface list is re-read while waiting
+	interfacePollInterval = 50 * time.Millisecond
+)
+
+// interfaceLister returns the system's network interfaces
+type interfaceLister func() ([]net.Interface, error)
+
+// waitForInterface waits for the OS to register the interface of a device that was just created
+// TUN creation returns before the adapter is visible on some systems, so looking it up at once races
+func waitForInterface(name string, timeout time.Duration) (net.Interface, error) {
+	return pollInterface(name, timeout, net.Interfaces)
+}
+
+// pollInterface polls list until an interface called name appears or timeout elapses
+func pollInterface(name string, timeout time.Duration, list interfaceLister) (net.Interface, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		ifaces, err := list()
+		if err == nil {
+			for _, iface := range ifaces {
+				if iface.Name == name {
+					return iface, nil
+				}
+			}
+		}
+
+		if time.Now().After(deadline) {
+			if err != nil {
+				return net.Interface{}, fmt.Errorf("interface %s not found after %s: %w", name, timeout, err)
+			}
+			return net.Interface{}, fmt.Errorf("interface %s not found after %s", name, timeout)
+		}
+		time.Sleep(interfacePollInterval)
+	}
+}
@@ -0,0 +1,61 @@
+package tunnel
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// delayedLister reports the interface only once appearAfter has elapsed since its first call
+func delayedLister(name string, appearAfter time.Duration) interfaceLister {
+	var start time.Time
+	return func() ([]net.Interface, error) {
+		if start.IsZero() {
+			start = time.Now()
+		}
+		ifaces := []net.Interface{{Index: 1, Name: "lo"}}
+		if time.Since(start) >= appearAfter {
+			ifaces = append(ifaces, net.Interface{Index: 7, Name: name})
+		}
+		return ifaces, nil
+	}
+}
+
+func TestPollInterface(t *testing.T) {
+	t.Run("appears after a delay", func(t *testing.T) {
+		iface, err := pollInterface("wg0", time.Second, delayedLister("wg0", 120*time.Millisecond))
+		if err != nil {
+			t.Fatalf("pollInterface failed: %v", err)
+		}
+		if iface.Index != 7 {
+			t.Errorf("Expected interface index 7, got %d", iface.Index)
+		}
+	})
+
+	t.Run("already present", func(t *testing.T) {
+		start := time.Now()
+		if _, err := pollInterface("wg0", time.Second, delayedLister("wg0", 0)); err != nil {
+			t.Fatalf("pollInterface failed: %v", err)
+		}
+		if elapsed := time.Since(start); elapsed >= interfacePollInterval {
+			t.Errorf("Expected no polling for a present interface, took %v", elapsed)
+		}
+	})
+
+	t.Run("times out", func(t *testing.T) {
+		_, err := pollInterface("wg0", 100*time.Millisecond, delayedLister("wg0", time.Hour))
+		if err == nil || !strings.Contains(err.Error(), "wg0 not found") {
+			t.Errorf("Expected timeout error naming the interface, got %v", err)
+		}
+	})
+
+	t.Run("lister error is reported on timeout", func(t *testing.T) {
+		errList := errors.New("netlink unavailable")
+		_, err := pollInterface("wg0", 0, func() ([]net.Interface, error) { return nil, errList })
+		if !errors.Is(err, errList) {
+			t.Errorf("Expected lister error wrapped, got %v", err)
+		}
+	})
+}
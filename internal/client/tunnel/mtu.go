@@ -0,0 +1,71 @@
+package tunnel
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+
+	"github.com/november1306/go-vpn/internal/wireguard"
+)
+
+// SetAutoMTU makes Connect lower the tunnel MTU when the route to the server can't carry it
+func (tm *TunnelManager) SetAutoMTU(auto bool) {
+	tm.autoMTU = auto
+}
+
+// checkPathMTU warns when encrypted packets at the tunnel MTU won't fit the link towards the server
+// With auto MTU enabled the MTU is lowered for this connection only; the stored config is untouched
+func (tm *TunnelManager) checkPathMTU() {
+	remote, ok := endpointAddr(tm.config.ServerEndpoint, resolveHost)
+	if !ok {
+		return
+	}
+
+	check, err := wireguard.CheckRouteMTU(tm.config.TunnelMTU(), remote)
+	if err != nil || !check.TooLarge() {
+		return
+	}
+
+	fmt.Printf("⚠️  Tunnel MTU %d is too large for %s (MTU %d): packets over %s need %d bytes of overhead\n",
+		check.TunnelMTU, check.Interface, check.LinkMTU, outerFamily(check), wireguard.Overhead(check.IPv6))
+
+	safe := check.SafeMTU()
+	if safe < wireguard.MinMTU {
+		fmt.Printf("⚠️  The link can't carry a usable tunnel MTU; expect stalled connections\n")
+		return
+	}
+	if !tm.autoMTU {
+		fmt.Printf("💡 Connections may stall after the handshake; reconnect with --mtu %d or --auto-mtu\n", safe)
+		return
+	}
+
+	fmt.Printf("📏 Lowering tunnel MTU to %d for this connection\n", safe)
+	lowered := *tm.config
+	lowered.MTU = safe
+	tm.config = &lowered
+}
+
+// endpointAddr returns the address the tunnel will reach the server on, if it can be determined
+func endpointAddr(endpoint string, lookup hostLookup) (netip.Addr, bool) {
+	host, _, err := net.SplitHostPort(endpoint)
+	if err != nil || host == "" {
+		return netip.Addr{}, false
+	}
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return addr, true
+	}
+
+	addrs, err := lookup(host)
+	if err != nil || len(addrs) == 0 {
+		return netip.Addr{}, false
+	}
+	return addrs[0], true
+}
+
+// outerFamily names the IP version carrying the encrypted packets
+func outerFamily(check wireguard.MTUCheck) AddressFamily {
+	if check.IPv6 {
+		return FamilyIPv6
+	}
+	return FamilyIPv4
+}
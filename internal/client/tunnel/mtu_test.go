@@ -0,0 +1,41 @@
+package tunnel
+
+import (
+	"errors"
+	"net/netip"
+	"testing"
+)
+
+func TestEndpointAddr(t *testing.T) {
+	lookup := func(host string) ([]netip.Addr, error) {
+		if host == "vpn.example.com" {
+			return []netip.Addr{netip.MustParseAddr("2001:db8::10")}, nil
+		}
+		return nil, errors.New("no such host")
+	}
+
+	tests := []struct {
+		endpoint string
+		want     string
+		wantOK   bool
+	}{
+		{"203.0.113.10:51820", "203.0.113.10", true},
+		{"[2001:db8::1]:51820", "2001:db8::1", true},
+		{"vpn.example.com:51820", "2001:db8::10", true},
+		{"unknown.example.com:51820", "", false},
+		{":51820", "", false},
+		{"no-port", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.endpoint, func(t *testing.T) {
+			addr, ok := endpointAddr(tt.endpoint, lookup)
+			if ok != tt.wantOK {
+				t.Fatalf("endpointAddr(%q) ok = %v, want %v", tt.endpoint, ok, tt.wantOK)
+			}
+			if ok && addr.String() != tt.want {
+				t.Errorf("endpointAddr(%q) = %s, want %s", tt.endpoint, addr, tt.want)
+			}
+		})
+	}
+}
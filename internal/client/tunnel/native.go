@@ -0,0 +1,168 @@
+package tunnel
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/november1306/go-vpn/internal/client/config"
+	"github.com/november1306/go-vpn/internal/wireguard"
+)
+
+const (
+	// defaultInterfaceName is the name of the client WireGuard interface
+	defaultInterfaceName = "wg-go-vpn"
+
+	// nativeFwmark marks the device's own encrypted UDP traffic so it bypasses
+	// the tunnel routing table (same value wg-quick uses by default)
+	nativeFwmark = 51820
+
+	// nativeRouteTable is the policy routing table holding the tunnel default route
+	nativeRouteTable = 51820
+)
+
+// BypassFwmark marks sockets that must reach the server outside the tunnel, such as
+// the TCP transport; both wg-quick and native mode exempt this mark from the tunnel route
+const BypassFwmark = nativeFwmark
+
+// NativeTunnel brings a WireGuard interface up and down without the wg-quick binary.
+// It creates the userspace device, applies the IPC config, assigns the address and
+// installs routes itself, so it works on minimal containers without wireguard-tools.
+type NativeTunnel struct {
+	interfaceName string
+	device        *wireguard.WireGuardDevice
+	routes        routeManager // Policy routing cleanup (overridable in tests)
+}
+
+// NewNativeTunnel creates a native tunnel for the given interface name
+func NewNativeTunnel(interfaceName string) *NativeTunnel {
+	return &NativeTunnel{
+		interfaceName: interfaceName,
+		routes:        systemRoutes{},
+	}
+}
+
+// BringUp creates the userspace device and configures addressing and routing
+// Equivalent to `wg-quick up` for the generated client configuration
+func (nt *NativeTunnel) BringUp(cfg *config.ClientConfig) error {
+	if nt.device != nil {
+		return fmt.Errorf("interface %s is already up", nt.interfaceName)
+	}
+
+	ipcConfig, err := buildIPCConfig(cfg, nativeFwmark)
+	if err != nil {
+		return fmt.Errorf("failed to generate WireGuard config: %w", err)
+	}
+
+	address, err := parseInterfaceAddress(cfg.ClientIP)
+	if err != nil {
+		return err
+	}
+
+	device, err := wireguard.NewWireGuardDeviceWithMTU(nt.interfaceName, cfg.TunnelMTU())
+	if err != nil {
+		return fmt.Errorf("failed to create WireGuard device: %w", err)
+	}
+
+	if err := device.IpcSet(ipcConfig); err != nil {
+		device.Stop()
+		return fmt.Errorf("failed to configure WireGuard device: %w", err)
+	}
+
+	if err := device.Start(); err != nil {
+		device.Stop()
+		return fmt.Errorf("failed to start WireGuard device: %w", err)
+	}
+
+	nt.device = device
+
+	if err := configureNativeNetwork(nt.interfaceName, address); err != nil {
+		nt.BringDown()
+		return fmt.Errorf("failed to configure interface network: %w", err)
+	}
+
+	return nil
+}
+
+// BringDown removes routing rules and stops the userspace device
+// Safe to call when the interface is only partially configured
+func (nt *NativeTunnel) BringDown() error {
+	return teardownError(nt.teardown())
+}
+
+// teardown attempts every cleanup step, reporting each one's outcome
+func (nt *NativeTunnel) teardown() []teardownStep {
+	var steps []teardownStep
+
+	// Routing rules outlive the device, so always attempt to clean them up
+	for _, route := range nt.routes.Routes() {
+		steps = append(steps, teardownStep{Name: "delete " + route, Err: nt.routes.DeleteRoute(route)})
+	}
+
+	if nt.device != nil {
+		err := nt.device.Stop()
+		if err == nil {
+			nt.device = nil
+		}
+		steps = append(steps, teardownStep{Name: "stop WireGuard device", Err: err})
+	}
+
+	return steps
+}
+
+// buildIPCConfig translates the client configuration into WireGuard UAPI format
+// A non-zero fwmark is emitted so the device's own traffic can bypass the tunnel
+func buildIPCConfig(cfg *config.ClientConfig, fwmark int) (string, error) {
+	// Convert base64 keys to hex for IPC
+	clientPrivKeyHex, err := base64ToHex(cfg.ClientPrivateKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to convert client private key to hex: %w", err)
+	}
+
+	serverPubKeyHex, err := base64ToHex(cfg.ServerPublicKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to convert server public key to hex: %w", err)
+	}
+
+	// WireGuard IPC format - device settings must precede the first peer
+	ipc := fmt.Sprintf("private_key=%s\n", clientPrivKeyHex)
+	if fwmark != 0 {
+		ipc += fmt.Sprintf("fwmark=%d\n", fwmark)
+	}
+	if cfg.ListenPort > 0 {
+		ipc += fmt.Sprintf("listen_port=%d\n", cfg.ListenPort)
+	}
+
+	// Add peer configuration
+	ipc += fmt.Sprintf("public_key=%s\n", serverPubKeyHex)
+
+	// Fix endpoint if it's missing hostname (server returns :51820, we need 127.0.0.1:51820)
+	endpoint := cfg.ServerEndpoint
+	if strings.HasPrefix(endpoint, ":") {
+		endpoint = "127.0.0.1" + endpoint
+	}
+	ipc += fmt.Sprintf("endpoint=%s\n", endpoint)
+	ipc += "allowed_ip=0.0.0.0/0\n"
+	if keepalive := cfg.Keepalive(); keepalive > 0 {
+		ipc += fmt.Sprintf("persistent_keepalive_interval=%d\n", keepalive)
+	}
+
+	return ipc, nil
+}
+
+// parseInterfaceAddress parses the client VPN address, defaulting to a /32 host prefix
+func parseInterfaceAddress(clientIP string) (*net.IPNet, error) {
+	if !strings.Contains(clientIP, "/") {
+		clientIP += "/32"
+	}
+
+	ip, ipNet, err := net.ParseCIDR(clientIP)
+	if err != nil {
+		return nil, fmt.Errorf("invalid client IP %q: %w", clientIP, err)
+	}
+	if ip.To4() == nil {
+		return nil, fmt.Errorf("client IP %s is not IPv4", ip)
+	}
+
+	return &net.IPNet{IP: ip.To4(), Mask: ipNet.Mask}, nil
+}
@@ -0,0 +1,239 @@
+//go:build linux
+
+package tunnel
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// configureNativeNetwork brings the link up, assigns the address and installs
+// wg-quick style policy routing using rtnetlink (no external binaries required)
+func configureNativeNetwork(interfaceName string, address *net.IPNet) error {
+	iface, err := waitForInterface(interfaceName, interfaceWaitTimeout)
+	if err != nil {
+		return err
+	}
+	index := uint32(iface.Index)
+
+	// ip link set <name> up
+	if err := netlinkExec(unix.RTM_NEWLINK, 0, encodeIfInfomsg(index, unix.IFF_UP, unix.IFF_UP)); err != nil {
+		return fmt.Errorf("failed to bring link up: %w", err)
+	}
+
+	// ip -4 address add <address> dev <name>
+	ones, _ := address.Mask.Size()
+	addrMsg := encodeIfAddrmsg(uint8(ones), index)
+	if err := netlinkExec(unix.RTM_NEWADDR, unix.NLM_F_CREATE|unix.NLM_F_EXCL, addrMsg,
+		encodeAttr(unix.IFA_LOCAL, address.IP),
+		encodeAttr(unix.IFA_ADDRESS, address.IP)); err != nil {
+		return fmt.Errorf("failed to assign address %s: %w", address, err)
+	}
+
+	// ip -4 route add 0.0.0.0/0 dev <name> table 51820
+	routeMsg := encodeRtMsg(0, unix.RTPROT_BOOT, unix.RT_SCOPE_LINK, unix.RTN_UNICAST, 0)
+	if err := netlinkExec(unix.RTM_NEWROUTE, unix.NLM_F_CREATE|unix.NLM_F_EXCL, routeMsg,
+		encodeUint32Attr(unix.RTA_TABLE, nativeRouteTable),
+		encodeUint32Attr(unix.RTA_OIF, index)); err != nil {
+		return fmt.Errorf("failed to install tunnel route: %w", err)
+	}
+
+	// ip -4 rule add not fwmark 51820 table 51820
+	// ip -4 rule add table main suppress_prefixlength 0
+	for i, rule := range nativeRules() {
+		if err := netlinkExec(unix.RTM_NEWRULE, unix.NLM_F_CREATE|unix.NLM_F_EXCL, rule.header, rule.attrs...); err != nil {
+			return fmt.Errorf("failed to install routing rule %d: %w", i+1, err)
+		}
+	}
+
+	return nil
+}
+
+// cleanupNativeNetwork removes the policy routing rules installed on bring-up
+// Addresses and routes disappear together with the TUN device itself
+func cleanupNativeNetwork() error {
+	var routes systemRoutes
+	var errs []error
+	for _, route := range routes.Routes() {
+		if err := routes.DeleteRoute(route); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// systemRoutes deletes the native policy rules through rtnetlink
+type systemRoutes struct{}
+
+func (systemRoutes) Routes() []string {
+	var names []string
+	for _, rule := range nativeRules() {
+		names = append(names, rule.name)
+	}
+	return names
+}
+
+func (systemRoutes) DeleteRoute(route string) error {
+	for _, rule := range nativeRules() {
+		if rule.name != route {
+			continue
+		}
+		err := netlinkExec(unix.RTM_DELRULE, 0, rule.header, rule.attrs...)
+		if err != nil && !errors.Is(err, unix.ENOENT) {
+			return err
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown route %q", route)
+}
+
+// netlinkRule is a fib rule message header with its attributes
+type netlinkRule struct {
+	name   string // ip-rule style description, used in teardown reports
+	header []byte
+	attrs  [][]byte
+}
+
+// nativeRules returns the two policy rules that send all unmarked traffic through the tunnel
+func nativeRules() []netlinkRule {
+	return []netlinkRule{
+		{
+			name: "rule not fwmark 51820 table 51820",
+			// fib_rule_hdr shares the rtmsg layout: action sits in the type byte
+			header: encodeRtMsg(0, 0, 0, unix.FR_ACT_TO_TBL, unix.FIB_RULE_INVERT),
+			attrs: [][]byte{
+				encodeUint32Attr(unix.FRA_FWMARK, nativeFwmark),
+				encodeUint32Attr(unix.FRA_TABLE, nativeRouteTable),
+			},
+		},
+		{
+			name:   "rule table main suppress_prefixlength 0",
+			header: encodeRtMsg(0, 0, 0, unix.FR_ACT_TO_TBL, 0),
+			attrs: [][]byte{
+				encodeUint32Attr(unix.FRA_TABLE, unix.RT_TABLE_MAIN),
+				encodeUint32Attr(unix.FRA_SUPPRESS_PREFIXLEN, 0),
+			},
+		},
+	}
+}
+
+// netlinkExec sends a single rtnetlink request and waits for its acknowledgement
+func netlinkExec(msgType uint16, flags uint16, header []byte, attrs ...[]byte) error {
+	fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_RAW|unix.SOCK_CLOEXEC, unix.NETLINK_ROUTE)
+	if err != nil {
+		return fmt.Errorf("failed to open netlink socket: %w", err)
+	}
+	defer unix.Close(fd)
+
+	if err := unix.Bind(fd, &unix.SockaddrNetlink{Family: unix.AF_NETLINK}); err != nil {
+		return fmt.Errorf("failed to bind netlink socket: %w", err)
+	}
+
+	payload := append([]byte{}, header...)
+	for _, attr := range attrs {
+		payload = append(payload, attr...)
+	}
+
+	msg := make([]byte, unix.NLMSG_HDRLEN, unix.NLMSG_HDRLEN+len(payload))
+	binary.NativeEndian.PutUint32(msg[0:4], uint32(unix.NLMSG_HDRLEN+len(payload)))
+	binary.NativeEndian.PutUint16(msg[4:6], msgType)
+	binary.NativeEndian.PutUint16(msg[6:8], unix.NLM_F_REQUEST|unix.NLM_F_ACK|flags)
+	binary.NativeEndian.PutUint32(msg[8:12], 1) // sequence number
+	msg = append(msg, payload...)
+
+	if err := unix.Sendto(fd, msg, 0, &unix.SockaddrNetlink{Family: unix.AF_NETLINK}); err != nil {
+		return fmt.Errorf("failed to send netlink request: %w", err)
+	}
+
+	buf := make([]byte, unix.Getpagesize())
+	n, _, err := unix.Recvfrom(fd, buf, 0)
+	if err != nil {
+		return fmt.Errorf("failed to receive netlink response: %w", err)
+	}
+
+	replies, err := syscall.ParseNetlinkMessage(buf[:n])
+	if err != nil {
+		return fmt.Errorf("failed to parse netlink response: %w", err)
+	}
+
+	for _, reply := range replies {
+		if reply.Header.Type != unix.NLMSG_ERROR || len(reply.Data) < 4 {
+			continue
+		}
+		if errno := int32(binary.NativeEndian.Uint32(reply.Data[0:4])); errno != 0 {
+			return syscall.Errno(-errno)
+		}
+	}
+
+	return nil
+}
+
+// encodeIfInfomsg builds a struct ifinfomsg for link changes
+func encodeIfInfomsg(index, flags, change uint32) []byte {
+	b := make([]byte, unix.SizeofIfInfomsg)
+	b[0] = unix.AF_UNSPEC
+	binary.NativeEndian.PutUint32(b[4:8], index)
+	binary.NativeEndian.PutUint32(b[8:12], flags)
+	binary.NativeEndian.PutUint32(b[12:16], change)
+	return b
+}
+
+// encodeIfAddrmsg builds a struct ifaddrmsg for an IPv4 address
+func encodeIfAddrmsg(prefixLen uint8, index uint32) []byte {
+	b := make([]byte, unix.SizeofIfAddrmsg)
+	b[0] = unix.AF_INET
+	b[1] = prefixLen
+	b[3] = unix.RT_SCOPE_UNIVERSE
+	binary.NativeEndian.PutUint32(b[4:8], index)
+	return b
+}
+
+// encodeRtMsg builds a struct rtmsg (also used for fib_rule_hdr) for IPv4
+func encodeRtMsg(dstLen, protocol, scope, msgType uint8, flags uint32) []byte {
+	b := make([]byte, unix.SizeofRtMsg)
+	b[0] = unix.AF_INET
+	b[1] = dstLen
+	b[5] = protocol
+	b[6] = scope
+	b[7] = msgType
+	binary.NativeEndian.PutUint32(b[8:12], flags)
+	return b
+}
+
+// encodeAttr builds a 4-byte aligned rtattr
+func encodeAttr(attrType uint16, data []byte) []byte {
+	length := unix.SizeofRtAttr + len(data)
+	b := make([]byte, (length+unix.RTA_ALIGNTO-1) & ^(unix.RTA_ALIGNTO-1))
+	binary.NativeEndian.PutUint16(b[0:2], uint16(length))
+	binary.NativeEndian.PutUint16(b[2:4], attrType)
+	copy(b[unix.SizeofRtAttr:], data)
+	return b
+}
+
+// encodeUint32Attr builds an rtattr carrying a single uint32
+func encodeUint32Attr(attrType uint16, value uint32) []byte {
+	data := make([]byte, 4)
+	binary.NativeEndian.PutUint32(data, value)
+	return encodeAttr(attrType, data)
+}
+
+// removeStaleInterface deletes a leftover link and the policy rules that point at it
+// Deleting the link also drops its addresses and the routes in the tunnel table
+func removeStaleInterface(interfaceName string) error {
+	iface, err := net.InterfaceByName(interfaceName)
+	if err != nil {
+		return fmt.Errorf("interface %s not found: %w", interfaceName, err)
+	}
+
+	// ip link delete <name>
+	if err := netlinkExec(unix.RTM_DELLINK, 0, encodeIfInfomsg(uint32(iface.Index), 0, 0)); err != nil {
+		return fmt.Errorf("failed to delete link: %w", err)
+	}
+
+	return cleanupNativeNetwork()
+}
@@ -0,0 +1,32 @@
+//go:build !linux
+
+package tunnel
+
+import (
+	"fmt"
+	"net"
+)
+
+// configureNativeNetwork is only implemented on Linux (rtnetlink)
+func configureNativeNetwork(interfaceName string, address *net.IPNet) error {
+	return fmt.Errorf("native interface configuration is only supported on Linux")
+}
+
+// cleanupNativeNetwork is a no-op on platforms without native configuration
+func cleanupNativeNetwork() error {
+	return nil
+}
+
+// systemRoutes has nothing to delete on platforms without native configuration
+type systemRoutes struct{}
+
+func (systemRoutes) Routes() []string { return nil }
+
+func (systemRoutes) DeleteRoute(route string) error {
+	return fmt.Errorf("unknown route %q", route)
+}
+
+// removeStaleInterface is only implemented on Linux (rtnetlink)
+func removeStaleInterface(interfaceName string) error {
+	return fmt.Errorf("automatic cleanup is only supported on Linux; remove %s manually", interfaceName)
+}
@@ -0,0 +1,209 @@
+package tunnel
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/november1306/go-vpn/internal/client/config"
+	"github.com/november1306/go-vpn/internal/wireguard/keys"
+)
+
+func newTestClientConfig(t *testing.T) *config.ClientConfig {
+	t.Helper()
+
+	clientPrivKey, clientPubKey, err := keys.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("Failed to generate client keys: %v", err)
+	}
+	_, serverPubKey, err := keys.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("Failed to generate server keys: %v", err)
+	}
+
+	return &config.ClientConfig{
+		ClientPrivateKey: clientPrivKey,
+		ClientPublicKey:  clientPubKey,
+		ServerPublicKey:  serverPubKey,
+		ServerEndpoint:   "203.0.113.10:51820",
+		ClientIP:         "10.0.0.2/32",
+	}
+}
+
+func keyToHex(t *testing.T, b64Key string) string {
+	t.Helper()
+	keyBytes, err := base64.StdEncoding.DecodeString(b64Key)
+	if err != nil {
+		t.Fatalf("Failed to decode key: %v", err)
+	}
+	return hex.EncodeToString(keyBytes)
+}
+
+func TestBuildIPCConfig(t *testing.T) {
+	cfg := newTestClientConfig(t)
+
+	t.Run("without fwmark", func(t *testing.T) {
+		ipc, err := buildIPCConfig(cfg, 0)
+		if err != nil {
+			t.Fatalf("buildIPCConfig failed: %v", err)
+		}
+
+		expected := "private_key=" + keyToHex(t, cfg.ClientPrivateKey) + "\n" +
+			"public_key=" + keyToHex(t, cfg.ServerPublicKey) + "\n" +
+			"endpoint=203.0.113.10:51820\n" +
+			"allowed_ip=0.0.0.0/0\n" +
+			"persistent_keepalive_interval=25\n"
+		if ipc != expected {
+			t.Errorf("Unexpected IPC config:\nexpected: %q\ngot:      %q", expected, ipc)
+		}
+	})
+
+	t.Run("server recommended keepalive", func(t *testing.T) {
+		keepaliveCfg := *cfg
+		keepalive := 15
+		keepaliveCfg.PersistentKeepalive = &keepalive
+
+		ipc, err := buildIPCConfig(&keepaliveCfg, 0)
+		if err != nil {
+			t.Fatalf("buildIPCConfig failed: %v", err)
+		}
+		if !strings.Contains(ipc, "persistent_keepalive_interval=15\n") {
+			t.Errorf("Expected keepalive of 15, got %q", ipc)
+		}
+	})
+
+	t.Run("keepalive disabled", func(t *testing.T) {
+		keepaliveCfg := *cfg
+		disabled := 0
+		keepaliveCfg.PersistentKeepalive = &disabled
+
+		ipc, err := buildIPCConfig(&keepaliveCfg, 0)
+		if err != nil {
+			t.Fatalf("buildIPCConfig failed: %v", err)
+		}
+		if strings.Contains(ipc, "persistent_keepalive_interval") {
+			t.Errorf("Expected no keepalive line, got %q", ipc)
+		}
+	})
+
+	t.Run("configured listen port", func(t *testing.T) {
+		portCfg := *cfg
+		portCfg.ListenPort = 51999
+
+		ipc, err := buildIPCConfig(&portCfg, 0)
+		if err != nil {
+			t.Fatalf("buildIPCConfig failed: %v", err)
+		}
+
+		portIdx := strings.Index(ipc, "listen_port=51999\n")
+		if portIdx == -1 {
+			t.Fatalf("Expected listen_port line in IPC config, got %q", ipc)
+		}
+		if portIdx > strings.Index(ipc, "public_key=") {
+			t.Error("listen_port must be set before the first public_key line")
+		}
+	})
+
+	t.Run("ephemeral listen port omitted", func(t *testing.T) {
+		ipc, err := buildIPCConfig(cfg, 0)
+		if err != nil {
+			t.Fatalf("buildIPCConfig failed: %v", err)
+		}
+		if strings.Contains(ipc, "listen_port") {
+			t.Errorf("Expected no listen_port line for port 0, got %q", ipc)
+		}
+	})
+
+	t.Run("fwmark precedes peer section", func(t *testing.T) {
+		ipc, err := buildIPCConfig(cfg, nativeFwmark)
+		if err != nil {
+			t.Fatalf("buildIPCConfig failed: %v", err)
+		}
+
+		fwmarkIdx := strings.Index(ipc, "fwmark=51820\n")
+		peerIdx := strings.Index(ipc, "public_key=")
+		if fwmarkIdx == -1 {
+			t.Fatalf("Expected fwmark line in IPC config, got %q", ipc)
+		}
+		if fwmarkIdx > peerIdx {
+			t.Error("fwmark must be set before the first public_key line")
+		}
+	})
+
+	t.Run("endpoint without host defaults to loopback", func(t *testing.T) {
+		localCfg := *cfg
+		localCfg.ServerEndpoint = ":51820"
+
+		ipc, err := buildIPCConfig(&localCfg, 0)
+		if err != nil {
+			t.Fatalf("buildIPCConfig failed: %v", err)
+		}
+		if !strings.Contains(ipc, "endpoint=127.0.0.1:51820\n") {
+			t.Errorf("Expected loopback endpoint, got %q", ipc)
+		}
+	})
+
+	t.Run("invalid keys", func(t *testing.T) {
+		badCfg := *cfg
+		badCfg.ServerPublicKey = "not-base64!"
+
+		if _, err := buildIPCConfig(&badCfg, 0); err == nil {
+			t.Error("Expected error for invalid server public key")
+		}
+	})
+}
+
+func TestParseInterfaceAddress(t *testing.T) {
+	tests := []struct {
+		name     string
+		clientIP string
+		want     string
+		wantErr  bool
+	}{
+		{name: "cidr", clientIP: "10.0.0.2/32", want: "10.0.0.2/32"},
+		{name: "bare ip", clientIP: "10.0.0.3", want: "10.0.0.3/32"},
+		{name: "subnet prefix keeps host", clientIP: "10.0.0.4/24", want: "10.0.0.4/24"},
+		{name: "invalid", clientIP: "not-an-ip", wantErr: true},
+		{name: "ipv6", clientIP: "fd00::2/128", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			address, err := parseInterfaceAddress(tt.clientIP)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseInterfaceAddress() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && address.String() != tt.want {
+				t.Errorf("parseInterfaceAddress() = %s, want %s", address, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseIpcListenPort(t *testing.T) {
+	port, err := parseIpcListenPort("private_key=aa\nlisten_port=43210\npublic_key=bb\n")
+	if err != nil {
+		t.Fatalf("parseIpcListenPort failed: %v", err)
+	}
+	if port != 43210 {
+		t.Errorf("Expected port 43210, got %d", port)
+	}
+
+	if _, err := parseIpcListenPort("private_key=aa\n"); err == nil {
+		t.Error("Expected error when listen_port is missing")
+	}
+}
+
+func TestGenerateWireGuardConfigListenPort(t *testing.T) {
+	cfg := newTestClientConfig(t)
+	cfg.ListenPort = 51999
+
+	wgConfig, err := NewTunnelManager(cfg).generateWireGuardConfig()
+	if err != nil {
+		t.Fatalf("generateWireGuardConfig failed: %v", err)
+	}
+	if !strings.Contains(wgConfig, "ListenPort = 51999\n") {
+		t.Errorf("Expected ListenPort in wg-quick config, got:\n%s", wgConfig)
+	}
+}
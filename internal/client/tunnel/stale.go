@@ -0,0 +1,51 @@
+package tunnel
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/november1306/go-vpn/internal/wireguard"
+)
+
+// staleAction is what Connect should do about a pre-existing interface
+type staleAction int
+
+const (
+	staleNone    staleAction = iota // No leftover interface, proceed normally
+	staleRefuse                     // Leftover interface found and --force not given
+	staleCleanup                    // Leftover interface found, tear it down first
+)
+
+// decideStaleAction chooses how to handle a leftover interface from a crashed client
+func decideStaleAction(exists, force bool) staleAction {
+	switch {
+	case !exists:
+		return staleNone
+	case force:
+		return staleCleanup
+	default:
+		return staleRefuse
+	}
+}
+
+// interfaceExists reports whether a network interface with this name is present
+func interfaceExists(name string) bool {
+	return errors.Is(wireguard.CheckInterfaceFree(name, net.Interfaces), wireguard.ErrInterfaceExists)
+}
+
+// prepareInterface handles an interface left behind by a previous vpn-cli run
+// Without force it refuses to continue; with force it removes the interface and its routes
+func (tm *TunnelManager) prepareInterface(name string) error {
+	switch decideStaleAction(tm.interfaceExists(name), tm.force) {
+	case staleRefuse:
+		return fmt.Errorf("%w: %s, likely left over from a previous vpn-cli run or owned by another running client\n"+
+			"Hint: run 'vpn-cli disconnect', or 'vpn-cli connect --force' to remove it and reconnect", wireguard.ErrInterfaceExists, name)
+	case staleCleanup:
+		fmt.Printf("🧹 Removing stale interface %s...\n", name)
+		if err := removeStaleInterface(name); err != nil {
+			return fmt.Errorf("failed to remove stale interface %s: %w", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package tunnel
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/november1306/go-vpn/internal/wireguard"
+)
+
+func TestDecideStaleAction(t *testing.T) {
+	tests := []struct {
+		name   string
+		exists bool
+		force  bool
+		want   staleAction
+	}{
+		{name: "no interface", exists: false, force: false, want: staleNone},
+		{name: "no interface with force", exists: false, force: true, want: staleNone},
+		{name: "stale interface", exists: true, force: false, want: staleRefuse},
+		{name: "stale interface with force", exists: true, force: true, want: staleCleanup},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := decideStaleAction(tt.exists, tt.force); got != tt.want {
+				t.Errorf("decideStaleAction(%v, %v) = %v, want %v", tt.exists, tt.force, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrepareInterface(t *testing.T) {
+	tm := NewTunnelManager(newTestClientConfig(t))
+
+	t.Run("no stale interface", func(t *testing.T) {
+		tm.interfaceExists = func(string) bool { return false }
+		if err := tm.prepareInterface(defaultInterfaceName); err != nil {
+			t.Errorf("Expected no error without a stale interface, got %v", err)
+		}
+	})
+
+	t.Run("stale interface without force", func(t *testing.T) {
+		var looked string
+		tm.interfaceExists = func(name string) bool {
+			looked = name
+			return true
+		}
+
+		err := tm.prepareInterface(defaultInterfaceName)
+		if !errors.Is(err, wireguard.ErrInterfaceExists) || !strings.Contains(err.Error(), "--force") {
+			t.Errorf("Expected ErrInterfaceExists with --force guidance, got %v", err)
+		}
+		if looked != defaultInterfaceName {
+			t.Errorf("Looked up interface %q, want %q", looked, defaultInterfaceName)
+		}
+	})
+}
+
+func TestInterfaceExists(t *testing.T) {
+	if interfaceExists("go-vpn-missing0") {
+		t.Error("Expected nonexistent interface to be reported missing")
+	}
+}
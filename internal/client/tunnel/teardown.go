@@ -0,0 +1,71 @@
+package tunnel
+
+import (
+	"errors"
+	"fmt"
+)
+
+// teardownStep is the outcome of one independently attempted teardown action
+type teardownStep struct {
+	Name string
+	Err  error
+}
+
+// routeManager removes the routing entries installed for the tunnel
+// Each entry is deleted on its own so one failure doesn't leave the rest behind
+type routeManager interface {
+	// Routes names the entries installed on bring-up, in deletion order
+	Routes() []string
+
+	// DeleteRoute removes one entry; an entry that is already gone is not an error
+	DeleteRoute(route string) error
+}
+
+// teardownError joins the failed steps into one error, nil if every step succeeded
+func teardownError(steps []teardownStep) error {
+	var errs []error
+	for _, step := range steps {
+		if step.Err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", step.Name, step.Err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// bringUpMethod records which mechanism created the interface
+type bringUpMethod int
+
+const (
+	bringUpNone      bringUpMethod = iota // Nothing brought up by this manager
+	bringUpWGQuick                        // wg-quick up
+	bringUpNative                         // In-process device configured over rtnetlink
+	bringUpUserspace                      // In-process device on Windows
+)
+
+// teardownMethod picks how to tear the interface down: the method that brought it up,
+// or, for a tunnel this manager didn't create, whatever owns it now
+func (tm *TunnelManager) teardownMethod() bringUpMethod {
+	if tm.upMethod != bringUpNone {
+		return tm.upMethod
+	}
+
+	// An in-process device dies with the process that created it, leaving only its routes
+	switch {
+	case tm.wgDevice != nil:
+		return bringUpUserspace
+	case tm.native != nil:
+		return bringUpNative
+	}
+	if _, err := tm.lookPath("wg-quick"); err == nil {
+		return bringUpWGQuick
+	}
+	return bringUpNone
+}
+
+// teardownLink removes an interface without a known owner by deleting the link itself
+func (tm *TunnelManager) teardownLink() []teardownStep {
+	if !tm.interfaceExists(defaultInterfaceName) {
+		return nil
+	}
+	return []teardownStep{{Name: "delete interface", Err: removeStaleInterface(defaultInterfaceName)}}
+}
@@ -0,0 +1,154 @@
+package tunnel
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/november1306/go-vpn/internal/client/config"
+)
+
+// fakeRoutes is a routeManager whose deletions fail for the routes listed in failures
+type fakeRoutes struct {
+	routes   []string
+	failures map[string]error
+	deleted  []string
+}
+
+func (fr *fakeRoutes) Routes() []string { return fr.routes }
+
+func (fr *fakeRoutes) DeleteRoute(route string) error {
+	fr.deleted = append(fr.deleted, route)
+	return fr.failures[route]
+}
+
+func newTeardownTestManager(routes *fakeRoutes) *TunnelManager {
+	tm := NewTunnelManager(&config.ClientConfig{ServerEndpoint: "203.0.113.10:51820", ClientIP: "10.0.0.2/32"})
+	tm.native = &NativeTunnel{interfaceName: defaultInterfaceName, routes: routes}
+	tm.connected = true
+	return tm
+}
+
+func TestDisconnectAggregatesTeardownFailures(t *testing.T) {
+	errBusy := errors.New("device or resource busy")
+	errPerm := errors.New("operation not permitted")
+	routes := &fakeRoutes{
+		routes: []string{"rule one", "rule two", "rule three"},
+		failures: map[string]error{
+			"rule one":   errBusy,
+			"rule three": errPerm,
+		},
+	}
+	tm := newTeardownTestManager(routes)
+
+	err := tm.Disconnect()
+	if err == nil {
+		t.Fatal("Expected error when route deletions fail")
+	}
+
+	// Every step is attempted even after the first failure
+	if len(routes.deleted) != 3 {
+		t.Errorf("Expected all 3 routes attempted, got %v", routes.deleted)
+	}
+	if !errors.Is(err, errBusy) || !errors.Is(err, errPerm) {
+		t.Errorf("Expected both failures in aggregated error, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "rule one") || !strings.Contains(err.Error(), "rule three") {
+		t.Errorf("Expected failed steps named in error, got %v", err)
+	}
+	if strings.Contains(err.Error(), "rule two") {
+		t.Errorf("Successful step should not be reported, got %v", err)
+	}
+
+	if tm.connected {
+		t.Error("Tunnel should be marked disconnected even when cleanup partially fails")
+	}
+}
+
+func TestDisconnectSucceedsWhenAllStepsSucceed(t *testing.T) {
+	routes := &fakeRoutes{routes: []string{"rule one", "rule two"}}
+	tm := newTeardownTestManager(routes)
+
+	if err := tm.Disconnect(); err != nil {
+		t.Fatalf("Disconnect failed: %v", err)
+	}
+	if len(routes.deleted) != 2 {
+		t.Errorf("Expected 2 routes deleted, got %v", routes.deleted)
+	}
+}
+
+func TestTeardownError(t *testing.T) {
+	if err := teardownError(nil); err != nil {
+		t.Errorf("Expected nil for no steps, got %v", err)
+	}
+
+	err := teardownError([]teardownStep{
+		{Name: "stop WireGuard device"},
+		{Name: "delete rule", Err: errors.New("boom")},
+	})
+	if err == nil || err.Error() != "delete rule: boom" {
+		t.Errorf("Unexpected aggregated error: %v", err)
+	}
+}
+
+func TestTeardownMethod(t *testing.T) {
+	found := func(string) (string, error) { return "/usr/bin/wg-quick", nil }
+	missing := func(name string) (string, error) { return "", errors.New(name + " not found") }
+
+	tests := []struct {
+		name     string
+		upMethod bringUpMethod
+		native   bool
+		lookPath func(string) (string, error)
+		want     bringUpMethod
+	}{
+		{"brought up natively", bringUpNative, true, found, bringUpNative},
+		{"brought up with wg-quick", bringUpWGQuick, false, found, bringUpWGQuick},
+		{"wg-quick up even with native available", bringUpWGQuick, true, found, bringUpWGQuick},
+		{"unknown owner in native mode", bringUpNone, true, found, bringUpNative},
+		{"unknown owner with wg-quick installed", bringUpNone, false, found, bringUpWGQuick},
+		{"unknown owner without wg-quick", bringUpNone, false, missing, bringUpNone},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tm := NewTunnelManager(&config.ClientConfig{})
+			if tt.native {
+				tm.native = &NativeTunnel{interfaceName: defaultInterfaceName, routes: &fakeRoutes{}}
+			}
+			tm.upMethod = tt.upMethod
+			tm.lookPath = tt.lookPath
+
+			if got := tm.teardownMethod(); got != tt.want {
+				t.Errorf("teardownMethod() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTeardownFollowsBringUpMethod(t *testing.T) {
+	t.Run("native", func(t *testing.T) {
+		routes := &fakeRoutes{routes: []string{"rule one"}}
+		tm := newTeardownTestManager(routes)
+		tm.upMethod = bringUpNative
+		tm.lookPath = func(string) (string, error) { t.Fatal("wg-quick looked up for a native tunnel"); return "", nil }
+
+		steps := tm.teardownSteps()
+		if len(steps) != 1 || steps[0].Name != "delete rule one" {
+			t.Errorf("Expected native route teardown, got %+v", steps)
+		}
+		if tm.upMethod != bringUpNone {
+			t.Errorf("Expected bring-up method reset after teardown, got %v", tm.upMethod)
+		}
+	})
+
+	t.Run("without an owner", func(t *testing.T) {
+		tm := NewTunnelManager(&config.ClientConfig{})
+		tm.lookPath = func(name string) (string, error) { return "", errors.New(name + " not found") }
+		tm.interfaceExists = func(string) bool { return false }
+
+		if steps := tm.teardownSteps(); len(steps) != 0 {
+			t.Errorf("Expected nothing to tear down, got %+v", steps)
+		}
+	})
+}
@@ -7,10 +7,12 @@ import (
 	"os"
 	"os/exec"
 	"runtime"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/november1306/go-vpn/internal/client/config"
+	"github.com/november1306/go-vpn/internal/logging"
 	"github.com/november1306/go-vpn/internal/wireguard"
 )
 
@@ -19,14 +21,50 @@ import (
 type TunnelManager struct {
 	config    *config.ClientConfig
 	wgDevice  *wireguard.WireGuardDevice // For Windows userspace implementation
+	native    *NativeTunnel              // Native Linux bring-up instead of wg-quick (optional)
 	connected bool                       // Runtime state only - not persisted
+	upMethod  bringUpMethod              // How this manager created the interface, so teardown can mirror it
+	bypass    []bypassRoute              // Excluded destinations routed around the tunnel
+
+	lookPath func(string) (string, error) // Executable lookup (overridable in tests)
+
+	force           bool              // Remove a stale interface on connect instead of failing
+	interfaceExists func(string) bool // Interface lookup (overridable in tests)
+
+	verify          VerifyOptions             // Handshake thresholds used to confirm the tunnel works
+	latestHandshake func() (time.Time, error) // Handshake lookup (overridable in tests)
+
+	preferFamily AddressFamily // IP version used to reach the server (FamilyAny = resolver's choice)
+	autoMTU      bool          // Lower the tunnel MTU when the route to the server can't carry it
+
+	history *History // Connection log (optional)
+
+	statsLog logging.RateLimiter // Limits stats warnings when status is polled in a loop
 }
 
 // NewTunnelManager creates a new tunnel manager
 func NewTunnelManager(cfg *config.ClientConfig) *TunnelManager {
-	return &TunnelManager{
-		config: cfg,
+	tm := &TunnelManager{
+		config:          cfg,
+		interfaceExists: interfaceExists,
+		verify:          DefaultVerifyOptions(),
+		lookPath:        exec.LookPath,
 	}
+	tm.latestHandshake = tm.readLatestHandshake
+	return tm
+}
+
+// NewNativeTunnelManager creates a tunnel manager that configures the interface
+// natively on Linux instead of shelling out to wg-quick
+func NewNativeTunnelManager(cfg *config.ClientConfig) *TunnelManager {
+	tm := NewTunnelManager(cfg)
+	tm.native = NewNativeTunnel(defaultInterfaceName)
+	return tm
+}
+
+// SetForce makes Connect tear down a leftover interface instead of refusing to connect
+func (tm *TunnelManager) SetForce(force bool) {
+	tm.force = force
 }
 
 // Connect establishes the VPN tunnel
@@ -37,17 +75,44 @@ func (tm *TunnelManager) Connect() error {
 
 	fmt.Println("🔗 Establishing VPN tunnel...")
 
+	// A crashed client can leave the interface and its routes behind
+	if err := tm.prepareInterface(defaultInterfaceName); err != nil {
+		return err
+	}
+
+	if err := tm.applyPreferFamily(); err != nil {
+		return err
+	}
+	tm.checkPathMTU()
+
 	// Set up WireGuard interface
 	if err := tm.setupWireGuardInterface(); err != nil {
 		return fmt.Errorf("failed to setup WireGuard interface: %w", err)
 	}
 
+	// An interface that is up proves nothing until the server answers a handshake
+	if tm.verify.VerifyTimeout > 0 {
+		if tm.config.Keepalive() == 0 {
+			fmt.Println("⚠️ Persistent keepalive is disabled, skipping handshake verification")
+		} else {
+			fmt.Println("🤝 Waiting for handshake with server...")
+			if err := tm.verifyConnection(); err != nil {
+				// Full-tunnel routes without a working peer would cut off all traffic
+				if teardownErr := tm.teardownWireGuardInterface(); teardownErr != nil {
+					fmt.Printf("Warning: %v\n", teardownErr)
+				}
+				return fmt.Errorf("tunnel verification failed: %w", err)
+			}
+		}
+	}
+
 	// Update runtime state (no persistence - WireGuard manages connection)
 	tm.connected = true
+	tm.recordHistory(HistoryConnect, nil)
 
 	fmt.Printf("✅ VPN tunnel established\n")
 	fmt.Printf("📍 Your traffic is now routed through: %s\n", tm.config.ServerEndpoint)
-	fmt.Printf("🔒 Your VPN IP: %s\n", tm.config.ClientIP)
+	fmt.Printf("🔒 Your VPN IP: %s\n", tm.config.Address())
 
 	return nil
 }
@@ -60,14 +125,32 @@ func (tm *TunnelManager) Disconnect() error {
 
 	fmt.Println("🔌 Disconnecting VPN tunnel...")
 
-	// Tear down WireGuard interface (best effort)
-	if err := tm.teardownWireGuardInterface(); err != nil {
-		fmt.Printf("Warning: %v\n", err)
-		// Don't return error - continue with state cleanup
+	// Counters are lost with the interface, so read them first
+	var stats *InterfaceStats
+	if tm.history != nil {
+		var err error
+		if stats, err = tm.getInterfaceStats(); err != nil {
+			fmt.Printf("Warning: Failed to get interface stats: %v\n", err)
+		}
+	}
+
+	// Tear down WireGuard interface, attempting every step even if one fails
+	steps := tm.teardownSteps()
+	for _, step := range steps {
+		if step.Err != nil {
+			fmt.Printf("⚠️  Failed to %s: %v\n", step.Name, step.Err)
+		}
 	}
 
 	// Update runtime state only
 	tm.connected = false
+	tm.recordHistory(HistoryDisconnect, stats)
+
+	// Scripts need to know if routing state may have been left behind
+	if err := teardownError(steps); err != nil {
+		fmt.Println("⚠️  VPN tunnel closed with errors - some routing state may remain")
+		return fmt.Errorf("disconnect incomplete: %w", err)
+	}
 
 	fmt.Println("✅ VPN tunnel closed")
 	fmt.Println("📍 Traffic restored to direct routing")
@@ -108,11 +191,17 @@ func (tm *TunnelManager) GetStatus() (*TunnelStatus, error) {
 		stats, err := tm.getInterfaceStats()
 		if err != nil {
 			// Don't fail on stats error, just log it
-			fmt.Printf("Warning: Failed to get interface stats: %v\n", err)
+			if _, ok := tm.statsLog.Allow("interface-stats"); ok {
+				fmt.Printf("Warning: Failed to get interface stats: %v\n", err)
+			}
 		} else {
 			status.BytesReceived = stats.BytesReceived
 			status.BytesSent = stats.BytesSent
 		}
+
+		if port, err := tm.LocalListenPort(); err == nil {
+			status.ListenPort = port
+		}
 	}
 
 	return status, nil
@@ -127,6 +216,7 @@ type TunnelStatus struct {
 	LastConnected  *time.Time `json:"lastConnected,omitempty"`
 	BytesReceived  uint64     `json:"bytesReceived"`
 	BytesSent      uint64     `json:"bytesSent"`
+	ListenPort     int        `json:"listenPort,omitempty"` // Local UDP port actually bound
 }
 
 // InterfaceStats represents network interface statistics
@@ -137,33 +227,7 @@ type InterfaceStats struct {
 
 // generateWireGuardIPC creates WireGuard IPC configuration for userspace device
 func (tm *TunnelManager) generateWireGuardIPC() (string, error) {
-	// Convert base64 keys to hex for IPC
-	clientPrivKeyHex, err := base64ToHex(tm.config.ClientPrivateKey)
-	if err != nil {
-		return "", fmt.Errorf("failed to convert client private key to hex: %w", err)
-	}
-
-	serverPubKeyHex, err := base64ToHex(tm.config.ServerPublicKey)
-	if err != nil {
-		return "", fmt.Errorf("failed to convert server public key to hex: %w", err)
-	}
-
-	// WireGuard IPC format - hex encoded keys
-	config := fmt.Sprintf("private_key=%s\n", clientPrivKeyHex)
-
-	// Add peer configuration
-	config += fmt.Sprintf("public_key=%s\n", serverPubKeyHex)
-
-	// Fix endpoint if it's missing hostname (server returns :51820, we need 127.0.0.1:51820)
-	endpoint := tm.config.ServerEndpoint
-	if strings.HasPrefix(endpoint, ":") {
-		endpoint = "127.0.0.1" + endpoint
-	}
-	config += fmt.Sprintf("endpoint=%s\n", endpoint)
-	config += "allowed_ip=0.0.0.0/0\n"
-	config += "persistent_keepalive_interval=25\n"
-
-	return config, nil
+	return buildIPCConfig(tm.config, 0)
 }
 
 // base64ToHex converts a base64-encoded key to hex encoding
@@ -199,22 +263,64 @@ func (tm *TunnelManager) generateWireGuardConfig() (string, error) {
 		return "", fmt.Errorf("invalid server endpoint format: %s", tm.config.ServerEndpoint)
 	}
 
+	// Without ListenPort wg-quick binds an ephemeral port
+	listenPort := ""
+	if tm.config.ListenPort > 0 {
+		listenPort = fmt.Sprintf("ListenPort = %d\n", tm.config.ListenPort)
+	}
+
 	// Build WireGuard configuration
 	config := fmt.Sprintf(`[Interface]
 PrivateKey = %s
 Address = %s
 DNS = 8.8.8.8
-
+MTU = %d
+%s
 [Peer]
 PublicKey = %s
 Endpoint = %s
 AllowedIPs = 0.0.0.0/0
-PersistentKeepalive = 25
-`, tm.config.ClientPrivateKey, tm.config.ClientIP, tm.config.ServerPublicKey, tm.config.ServerEndpoint)
+PersistentKeepalive = %d
+`, tm.config.ClientPrivateKey, tm.config.ClientIP, tm.config.TunnelMTU(), listenPort, tm.config.ServerPublicKey, tm.config.ServerEndpoint, tm.config.Keepalive())
 
 	return config, nil
 }
 
+// WriteConfig writes the configuration Connect would apply to path without bringing anything up
+// It holds the private key, so the file is always left with 0600 permissions
+func (tm *TunnelManager) WriteConfig(path string) error {
+	if err := tm.applyPreferFamily(); err != nil {
+		return err
+	}
+
+	wgConfig, err := tm.renderConfig()
+	if err != nil {
+		return fmt.Errorf("failed to generate WireGuard config: %w", err)
+	}
+
+	if err := os.WriteFile(path, []byte(wgConfig), 0600); err != nil {
+		return fmt.Errorf("failed to write WireGuard config: %w", err)
+	}
+	// WriteFile keeps the mode of an existing file, which may be readable by others
+	if err := os.Chmod(path, 0600); err != nil {
+		return fmt.Errorf("failed to restrict WireGuard config permissions: %w", err)
+	}
+	return nil
+}
+
+// renderConfig generates the config in the format the platform's setup path applies:
+// UAPI text for the userspace device (Windows, native mode), wg-quick syntax otherwise
+func (tm *TunnelManager) renderConfig() (string, error) {
+	switch {
+	case runtime.GOOS == "windows":
+		return tm.generateWireGuardIPC()
+	case tm.native != nil:
+		return buildIPCConfig(tm.config, nativeFwmark)
+	default:
+		return tm.generateWireGuardConfig()
+	}
+}
+
 // setupWireGuardInterface sets up the WireGuard interface
 func (tm *TunnelManager) setupWireGuardInterface() error {
 	if runtime.GOOS == "windows" {
@@ -225,22 +331,36 @@ func (tm *TunnelManager) setupWireGuardInterface() error {
 
 // teardownWireGuardInterface tears down the WireGuard interface
 func (tm *TunnelManager) teardownWireGuardInterface() error {
-	if runtime.GOOS == "windows" {
+	return teardownError(tm.teardownSteps())
+}
+
+// teardownSteps tears down the interface the way it was brought up, attempting every step even after a failure
+func (tm *TunnelManager) teardownSteps() []teardownStep {
+	method := tm.teardownMethod()
+	tm.upMethod = bringUpNone
+
+	switch method {
+	case bringUpUserspace:
 		return tm.teardownWireGuardWindows()
+	case bringUpNative:
+		return tm.native.teardown()
+	case bringUpWGQuick:
+		return tm.teardownWGQuick()
+	default:
+		return tm.teardownLink()
 	}
-	return tm.teardownWireGuardUnix()
 }
 
 // setupWireGuardWindows sets up WireGuard on Windows using userspace implementation
 func (tm *TunnelManager) setupWireGuardWindows() error {
-	interfaceName := "wg-go-vpn"
+	interfaceName := defaultInterfaceName
 
 	// Check for admin privileges first
 	fmt.Println("⚠️  Note: Administrator privileges required for TUN interface creation on Windows")
 
 	// Create WireGuard device
 	fmt.Printf("Creating WireGuard interface '%s'...\n", interfaceName)
-	wgDevice, err := wireguard.NewWireGuardDevice(interfaceName)
+	wgDevice, err := wireguard.NewWireGuardDeviceWithMTU(interfaceName, tm.config.TunnelMTU())
 	if err != nil {
 		if strings.Contains(err.Error(), "Access is denied") {
 			return fmt.Errorf("failed to create WireGuard device: %w\n\n💡 Solution: Run the CLI as Administrator (right-click -> 'Run as administrator')", err)
@@ -282,32 +402,44 @@ func (tm *TunnelManager) setupWireGuardWindows() error {
 		return fmt.Errorf("failed to configure VPN routing: %w", err)
 	}
 
+	tm.upMethod = bringUpUserspace
 	fmt.Println("WireGuard interface started successfully")
-	fmt.Printf("✅ Userspace WireGuard tunnel active with IP: %s\n", tm.config.ClientIP)
+	fmt.Printf("✅ Userspace WireGuard tunnel active with IP: %s\n", tm.config.Address())
 	fmt.Println("🌐 All traffic now routing through VPN")
 	return nil
 }
 
 // teardownWireGuardWindows tears down WireGuard on Windows
-func (tm *TunnelManager) teardownWireGuardWindows() error {
+func (tm *TunnelManager) teardownWireGuardWindows() []teardownStep {
+	steps := tm.deleteBypassRoutes()
+
 	// Stop the userspace WireGuard device
-	if tm.wgDevice != nil {
-		fmt.Println("Stopping WireGuard interface...")
-		if err := tm.wgDevice.Stop(); err != nil {
-			fmt.Printf("Warning: failed to stop WireGuard device: %v\n", err)
-		}
-		tm.wgDevice = nil
-		fmt.Println("WireGuard userspace device stopped")
-	} else {
+	if tm.wgDevice == nil {
 		fmt.Println("No active WireGuard device to stop")
+		return steps
 	}
 
-	return nil
+	fmt.Println("Stopping WireGuard interface...")
+	err := tm.wgDevice.Stop()
+	tm.wgDevice = nil
+	return append(steps, teardownStep{Name: "stop WireGuard device", Err: err})
 }
 
 // setupWireGuardUnix sets up WireGuard on Unix systems
 func (tm *TunnelManager) setupWireGuardUnix() error {
-	interfaceName := "wg-go-vpn"
+	if len(tm.config.ExcludeRoutes) > 0 {
+		fmt.Println("⚠️  Excluded routes are only applied on Windows; they will go through the VPN")
+	}
+
+	if tm.native != nil {
+		if err := tm.native.BringUp(tm.config); err != nil {
+			return err
+		}
+		tm.upMethod = bringUpNative
+		return nil
+	}
+
+	interfaceName := defaultInterfaceName
 
 	// Create WireGuard configuration file
 	wgConfig, err := tm.generateWireGuardConfig()
@@ -329,21 +461,19 @@ func (tm *TunnelManager) setupWireGuardUnix() error {
 		return fmt.Errorf("failed to bring up WireGuard interface: %w\nOutput: %s", err, string(output))
 	}
 
+	tm.upMethod = bringUpWGQuick
 	return nil
 }
 
-// teardownWireGuardUnix tears down WireGuard on Unix systems
-func (tm *TunnelManager) teardownWireGuardUnix() error {
-	interfaceName := "wg-go-vpn"
-
-	// Use wg-quick to bring down the interface
-	cmd := exec.Command("wg-quick", "down", interfaceName)
+// teardownWGQuick brings down an interface created by wg-quick up (it removes its own routes)
+func (tm *TunnelManager) teardownWGQuick() []teardownStep {
+	cmd := exec.Command("wg-quick", "down", defaultInterfaceName)
 	output, err := cmd.CombinedOutput()
 	if err != nil {
-		return fmt.Errorf("failed to bring down WireGuard interface: %w\nOutput: %s", err, string(output))
+		err = fmt.Errorf("%w\nOutput: %s", err, string(output))
 	}
 
-	return nil
+	return []teardownStep{{Name: "wg-quick down", Err: err}}
 }
 
 // detectActiveConnection attempts to detect if there's an active VPN connection
@@ -415,6 +545,16 @@ func (tm *TunnelManager) configureFullTrafficRouting() error {
 
 	fmt.Printf("Current routing table:\n%s\n", string(output))
 
+	if len(tm.config.ExcludeRoutes) > 0 {
+		currentGateway, err := parseDefaultGateway(string(output))
+		if err != nil {
+			return fmt.Errorf("failed to find the gateway for excluded routes: %w", err)
+		}
+		if err := tm.addBypassRoutes(currentGateway); err != nil {
+			return err
+		}
+	}
+
 	// For now, show what would be configured rather than actually changing routes
 	// This prevents breaking the user's internet connection during testing
 	fmt.Println("⚠️  Full routing configuration would:")
@@ -435,12 +575,108 @@ func (tm *TunnelManager) configureUnixVPNRouting() error {
 	return nil
 }
 
-// getInterfaceStats retrieves interface statistics
+// getInterfaceStats retrieves transfer totals across all peers of the interface
 func (tm *TunnelManager) getInterfaceStats() (*InterfaceStats, error) {
-	// This would query the WireGuard interface for statistics
-	// For now, return placeholder data
-	return &InterfaceStats{
-		BytesReceived: 0,
-		BytesSent:     0,
-	}, nil
+	switch {
+	case tm.wgDevice != nil:
+		ipc, err := tm.wgDevice.IpcGet()
+		if err != nil {
+			return nil, err
+		}
+		return parseIpcTransfer(ipc), nil
+	case tm.native != nil && tm.native.device != nil:
+		ipc, err := tm.native.device.IpcGet()
+		if err != nil {
+			return nil, err
+		}
+		return parseIpcTransfer(ipc), nil
+	default:
+		// wg-quick path: ask wireguard-tools
+		output, err := exec.Command("wg", "show", defaultInterfaceName, "transfer").Output()
+		if err != nil {
+			return nil, fmt.Errorf("wg show failed: %w", err)
+		}
+		return parseTransfer(string(output)), nil
+	}
+}
+
+// LocalListenPort returns the UDP port the tunnel is bound to, which differs from
+// the configured port when that was 0 (ephemeral)
+func (tm *TunnelManager) LocalListenPort() (int, error) {
+	switch {
+	case tm.wgDevice != nil:
+		ipc, err := tm.wgDevice.IpcGet()
+		if err != nil {
+			return 0, err
+		}
+		return parseIpcListenPort(ipc)
+	case tm.native != nil && tm.native.device != nil:
+		ipc, err := tm.native.device.IpcGet()
+		if err != nil {
+			return 0, err
+		}
+		return parseIpcListenPort(ipc)
+	default:
+		// wg-quick path: ask wireguard-tools
+		output, err := exec.Command("wg", "show", defaultInterfaceName, "listen-port").Output()
+		if err != nil {
+			return 0, fmt.Errorf("wg show failed: %w", err)
+		}
+		port, err := strconv.Atoi(strings.TrimSpace(string(output)))
+		if err != nil {
+			return 0, fmt.Errorf("unexpected listen-port output %q", output)
+		}
+		return port, nil
+	}
+}
+
+// parseIpcListenPort extracts listen_port from UAPI get output
+func parseIpcListenPort(ipc string) (int, error) {
+	for _, line := range strings.Split(ipc, "\n") {
+		if value, ok := strings.CutPrefix(line, "listen_port="); ok {
+			return strconv.Atoi(value)
+		}
+	}
+	return 0, fmt.Errorf("listen_port not reported by device")
+}
+
+// parseIpcTransfer sums rx_bytes/tx_bytes over all peers in UAPI get output
+func parseIpcTransfer(ipc string) *InterfaceStats {
+	stats := &InterfaceStats{}
+	for _, line := range strings.Split(ipc, "\n") {
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		n, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			continue
+		}
+		switch key {
+		case "rx_bytes":
+			stats.BytesReceived += n
+		case "tx_bytes":
+			stats.BytesSent += n
+		}
+	}
+	return stats
+}
+
+// parseTransfer parses `wg show <iface> transfer` output (public key, rx bytes, tx bytes)
+func parseTransfer(output string) *InterfaceStats {
+	stats := &InterfaceStats{}
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			continue
+		}
+		rx, rxErr := strconv.ParseUint(fields[1], 10, 64)
+		tx, txErr := strconv.ParseUint(fields[2], 10, 64)
+		if rxErr != nil || txErr != nil {
+			continue
+		}
+		stats.BytesReceived += rx
+		stats.BytesSent += tx
+	}
+	return stats
 }
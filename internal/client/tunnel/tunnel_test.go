@@ -0,0 +1,82 @@
+package tunnel
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestWriteConfig(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes are not enforced on Windows")
+	}
+
+	cfg := newTestClientConfig(t)
+
+	t.Run("wg-quick format", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "wg-go-vpn.conf")
+		if err := NewTunnelManager(cfg).WriteConfig(path); err != nil {
+			t.Fatalf("WriteConfig failed: %v", err)
+		}
+
+		assertMode(t, path, 0600)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("Failed to read config: %v", err)
+		}
+		for _, want := range []string{
+			"PrivateKey = " + cfg.ClientPrivateKey,
+			"Address = 10.0.0.2/32",
+			"PublicKey = " + cfg.ServerPublicKey,
+			"Endpoint = 203.0.113.10:51820",
+			"AllowedIPs = 0.0.0.0/0",
+		} {
+			if !strings.Contains(string(data), want) {
+				t.Errorf("Config missing %q:\n%s", want, data)
+			}
+		}
+	})
+
+	t.Run("native mode writes UAPI text", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "wg-go-vpn.ipc")
+		if err := NewNativeTunnelManager(cfg).WriteConfig(path); err != nil {
+			t.Fatalf("WriteConfig failed: %v", err)
+		}
+
+		expected, err := buildIPCConfig(cfg, nativeFwmark)
+		if err != nil {
+			t.Fatalf("buildIPCConfig failed: %v", err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("Failed to read config: %v", err)
+		}
+		if string(data) != expected {
+			t.Errorf("Unexpected config:\nexpected: %q\ngot:      %q", expected, data)
+		}
+	})
+
+	t.Run("tightens an existing file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "wg-go-vpn.conf")
+		if err := os.WriteFile(path, []byte("old"), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+		if err := NewTunnelManager(cfg).WriteConfig(path); err != nil {
+			t.Fatalf("WriteConfig failed: %v", err)
+		}
+		assertMode(t, path, 0600)
+	})
+}
+
+func assertMode(t *testing.T, path string, want os.FileMode) {
+	t.Helper()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Failed to stat %s: %v", path, err)
+	}
+	if got := info.Mode().Perm(); got != want {
+		t.Errorf("Expected mode %o, got %o", want, got)
+	}
+}
@@ -0,0 +1,168 @@
+package tunnel
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultHandshakeTimeout is the oldest handshake still treated as a live session
+	// WireGuard rejects session keys older than 180 seconds
+	DefaultHandshakeTimeout = 180 * time.Second
+
+	// DefaultVerifyTimeout is how long Connect waits for the first handshake
+	DefaultVerifyTimeout = 15 * time.Second
+
+	// verifyPollInterval is how often the handshake time is re-read while verifying
+	verifyPollInterval = 250 * time.Millisecond
+)
+
+// ErrNoHandshake is returned when the server never completes a handshake during verification
+var ErrNoHandshake = errors.New("no handshake with server")
+
+// VerifyOptions controls how Connect confirms the tunnel is actually working
+type VerifyOptions struct {
+	HandshakeTimeout time.Duration // Maximum age of the last handshake for the tunnel to count as up
+	VerifyTimeout    time.Duration // How long to wait for a handshake (0 skips verification)
+}
+
+// DefaultVerifyOptions returns the thresholds used when none are configured
+func DefaultVerifyOptions() VerifyOptions {
+	return VerifyOptions{
+		HandshakeTimeout: DefaultHandshakeTimeout,
+		VerifyTimeout:    DefaultVerifyTimeout,
+	}
+}
+
+// handshakeState classifies the last handshake reported by the device
+type handshakeState int
+
+const (
+	handshakeNone  handshakeState = iota // No handshake has completed yet
+	handshakeStale                       // Last handshake is older than the threshold
+	handshakeFresh                       // Handshake is recent enough to trust the session
+)
+
+// evaluateHandshake decides whether the last handshake proves the tunnel is up
+func evaluateHandshake(lastHandshake, now time.Time, maxAge time.Duration) handshakeState {
+	if lastHandshake.IsZero() {
+		return handshakeNone
+	}
+	if now.Sub(lastHandshake) > maxAge {
+		return handshakeStale
+	}
+	return handshakeFresh
+}
+
+// SetVerifyOptions overrides the handshake verification thresholds used by Connect
+func (tm *TunnelManager) SetVerifyOptions(opts VerifyOptions) {
+	tm.verify = opts
+}
+
+// verifyConnection polls the device until a fresh handshake is seen or the verify timeout passes
+func (tm *TunnelManager) verifyConnection() error {
+	opts := tm.verify
+	deadline := time.Now().Add(opts.VerifyTimeout)
+
+	for {
+		lastHandshake, err := tm.latestHandshake()
+		if err != nil {
+			return fmt.Errorf("failed to read handshake time: %w", err)
+		}
+
+		// A stale handshake is replaced by a new one if the server is reachable, so keep waiting
+		now := time.Now()
+		if evaluateHandshake(lastHandshake, now, opts.HandshakeTimeout) == handshakeFresh {
+			return nil
+		}
+
+		if now.After(deadline) {
+			return fmt.Errorf("%w within %s (is %s reachable over UDP?)", ErrNoHandshake, opts.VerifyTimeout, tm.config.ServerEndpoint)
+		}
+		time.Sleep(verifyPollInterval)
+	}
+}
+
+// readLatestHandshake returns the most recent handshake time of the tunnel's peer
+func (tm *TunnelManager) readLatestHandshake() (time.Time, error) {
+	switch {
+	case tm.wgDevice != nil:
+		ipc, err := tm.wgDevice.IpcGet()
+		if err != nil {
+			return time.Time{}, err
+		}
+		return parseIpcHandshake(ipc), nil
+	case tm.native != nil && tm.native.device != nil:
+		ipc, err := tm.native.device.IpcGet()
+		if err != nil {
+			return time.Time{}, err
+		}
+		return parseIpcHandshake(ipc), nil
+	default:
+		// wg-quick path: ask wireguard-tools
+		output, err := exec.Command("wg", "show", defaultInterfaceName, "latest-handshakes").Output()
+		if err != nil {
+			return time.Time{}, fmt.Errorf("wg show failed: %w", err)
+		}
+		return parseLatestHandshakes(string(output)), nil
+	}
+}
+
+// parseIpcHandshake extracts the newest peer handshake from UAPI get output
+func parseIpcHandshake(ipc string) time.Time {
+	var latest time.Time
+	var sec, nsec int64
+
+	flush := func() {
+		if sec == 0 && nsec == 0 {
+			return
+		}
+		if t := time.Unix(sec, nsec); t.After(latest) {
+			latest = t
+		}
+		sec, nsec = 0, 0
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(ipc))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "public_key":
+			flush() // Start of the next peer
+		case "last_handshake_time_sec":
+			sec, _ = strconv.ParseInt(value, 10, 64)
+		case "last_handshake_time_nsec":
+			nsec, _ = strconv.ParseInt(value, 10, 64)
+		}
+	}
+	flush()
+
+	return latest
+}
+
+// parseLatestHandshakes parses `wg show <iface> latest-handshakes` output (public key, tab, unix seconds)
+func parseLatestHandshakes(output string) time.Time {
+	var latest time.Time
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		sec, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil || sec == 0 {
+			continue
+		}
+		if t := time.Unix(sec, 0); t.After(latest) {
+			latest = t
+		}
+	}
+	return latest
+}
@@ -0,0 +1,112 @@
+package tunnel
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/november1306/go-vpn/internal/client/config"
+)
+
+func TestEvaluateHandshake(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+
+	tests := []struct {
+		name          string
+		lastHandshake time.Time
+		maxAge        time.Duration
+		want          handshakeState
+	}{
+		{name: "never", lastHandshake: time.Time{}, maxAge: DefaultHandshakeTimeout, want: handshakeNone},
+		{name: "just now", lastHandshake: now, maxAge: DefaultHandshakeTimeout, want: handshakeFresh},
+		{name: "within default", lastHandshake: now.Add(-2 * time.Minute), maxAge: DefaultHandshakeTimeout, want: handshakeFresh},
+		{name: "older than default", lastHandshake: now.Add(-4 * time.Minute), maxAge: DefaultHandshakeTimeout, want: handshakeStale},
+		{name: "at threshold", lastHandshake: now.Add(-30 * time.Second), maxAge: 30 * time.Second, want: handshakeFresh},
+		{name: "tight threshold", lastHandshake: now.Add(-31 * time.Second), maxAge: 30 * time.Second, want: handshakeStale},
+		{name: "relaxed threshold", lastHandshake: now.Add(-10 * time.Minute), maxAge: 15 * time.Minute, want: handshakeFresh},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := evaluateHandshake(tt.lastHandshake, now, tt.maxAge); got != tt.want {
+				t.Errorf("evaluateHandshake() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseIpcHandshake(t *testing.T) {
+	ipc := "private_key=aa\nlisten_port=51820\n" +
+		"public_key=bb\nlast_handshake_time_sec=0\nlast_handshake_time_nsec=0\n" +
+		"public_key=cc\nlast_handshake_time_sec=1700000000\nlast_handshake_time_nsec=500\n" +
+		"public_key=dd\nlast_handshake_time_sec=1600000000\nlast_handshake_time_nsec=0\n" +
+		"errno=0\n"
+
+	if got, want := parseIpcHandshake(ipc), time.Unix(1700000000, 500); !got.Equal(want) {
+		t.Errorf("parseIpcHandshake() = %v, want %v", got, want)
+	}
+	if got := parseIpcHandshake("private_key=aa\npublic_key=bb\nlast_handshake_time_sec=0\n"); !got.IsZero() {
+		t.Errorf("Expected zero time without handshakes, got %v", got)
+	}
+}
+
+func TestParseLatestHandshakes(t *testing.T) {
+	output := "peerA=\t1700000000\npeerB=\t0\n"
+	if got, want := parseLatestHandshakes(output), time.Unix(1700000000, 0); !got.Equal(want) {
+		t.Errorf("parseLatestHandshakes() = %v, want %v", got, want)
+	}
+	if got := parseLatestHandshakes("peerA=\t0\n"); !got.IsZero() {
+		t.Errorf("Expected zero time without handshakes, got %v", got)
+	}
+}
+
+func TestVerifyConnection(t *testing.T) {
+	newManager := func(handshakes func() (time.Time, error), opts VerifyOptions) *TunnelManager {
+		tm := NewTunnelManager(&config.ClientConfig{ServerEndpoint: "203.0.113.10:51820"})
+		tm.latestHandshake = handshakes
+		tm.SetVerifyOptions(opts)
+		return tm
+	}
+	opts := VerifyOptions{HandshakeTimeout: time.Minute, VerifyTimeout: 2 * time.Second}
+
+	t.Run("handshake arrives", func(t *testing.T) {
+		polls := 0
+		tm := newManager(func() (time.Time, error) {
+			polls++
+			if polls < 3 {
+				return time.Time{}, nil
+			}
+			return time.Now(), nil
+		}, opts)
+
+		if err := tm.verifyConnection(); err != nil {
+			t.Errorf("Expected verification to succeed, got %v", err)
+		}
+	})
+
+	t.Run("no handshake", func(t *testing.T) {
+		tm := newManager(func() (time.Time, error) { return time.Time{}, nil },
+			VerifyOptions{HandshakeTimeout: time.Minute, VerifyTimeout: 300 * time.Millisecond})
+
+		if err := tm.verifyConnection(); !errors.Is(err, ErrNoHandshake) {
+			t.Errorf("Expected ErrNoHandshake, got %v", err)
+		}
+	})
+
+	t.Run("stale handshake is not enough", func(t *testing.T) {
+		tm := newManager(func() (time.Time, error) { return time.Now().Add(-2 * time.Minute), nil },
+			VerifyOptions{HandshakeTimeout: time.Minute, VerifyTimeout: 300 * time.Millisecond})
+
+		if err := tm.verifyConnection(); !errors.Is(err, ErrNoHandshake) {
+			t.Errorf("Expected ErrNoHandshake, got %v", err)
+		}
+	})
+
+	t.Run("read error", func(t *testing.T) {
+		tm := newManager(func() (time.Time, error) { return time.Time{}, errors.New("device gone") }, opts)
+
+		if err := tm.verifyConnection(); err == nil || errors.Is(err, ErrNoHandshake) {
+			t.Errorf("Expected read error, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,148 @@
+package tunnel
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const (
+	// DefaultWatchInterval is how often the auto-reconnect watcher checks the tunnel
+	DefaultWatchInterval = 10 * time.Second
+
+	// DefaultReconnectBackoff is the wait after the first failed reconnect; it doubles per failure
+	DefaultReconnectBackoff = 2 * time.Second
+
+	// DefaultMaxReconnectBackoff caps the wait between reconnect attempts
+	DefaultMaxReconnectBackoff = 2 * time.Minute
+)
+
+// WatchOptions controls how the auto-reconnect watcher checks and restores the tunnel
+type WatchOptions struct {
+	Interval   time.Duration // Time between health checks
+	Backoff    time.Duration // Wait after the first failed reconnect
+	MaxBackoff time.Duration // Longest wait between reconnect attempts
+}
+
+// DefaultWatchOptions returns the watcher timings used when none are configured
+func DefaultWatchOptions() WatchOptions {
+	return WatchOptions{
+		Interval:   DefaultWatchInterval,
+		Backoff:    DefaultReconnectBackoff,
+		MaxBackoff: DefaultMaxReconnectBackoff,
+	}
+}
+
+// watchAction is what the watcher does after a health check
+type watchAction int
+
+const (
+	watchKeep           watchAction = iota // Tunnel looks healthy
+	watchInterfaceDown                     // Interface is gone or its device can't be read
+	watchStaleHandshake                    // Server stopped answering handshakes
+)
+
+func (a watchAction) String() string {
+	switch a {
+	case watchInterfaceDown:
+		return "tunnel interface is down"
+	case watchStaleHandshake:
+		return "no recent handshake with server"
+	default:
+		return "tunnel healthy"
+	}
+}
+
+// decideWatchAction classifies the tunnel from the interface state and last handshake
+// Without keepalive an idle tunnel stops handshaking, so only the interface is checked
+func decideWatchAction(interfaceUp bool, lastHandshake, now time.Time, maxAge time.Duration, keepalive bool) watchAction {
+	if !interfaceUp {
+		return watchInterfaceDown
+	}
+	if keepalive && evaluateHandshake(lastHandshake, now, maxAge) != handshakeFresh {
+		return watchStaleHandshake
+	}
+	return watchKeep
+}
+
+// reconnectBackoff returns the wait after the given number of consecutive failed reconnects
+func reconnectBackoff(failures int, opts WatchOptions) time.Duration {
+	delay := opts.Backoff
+	for i := 1; i < failures && delay < opts.MaxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, opts.MaxBackoff)
+}
+
+// checkTunnel reads the interface and handshake state and decides whether to reconnect
+func (tm *TunnelManager) checkTunnel(now time.Time) watchAction {
+	if !tm.interfaceExists(defaultInterfaceName) {
+		return watchInterfaceDown
+	}
+	lastHandshake, err := tm.latestHandshake()
+	if err != nil {
+		return watchInterfaceDown
+	}
+	return decideWatchAction(true, lastHandshake, now, tm.verify.HandshakeTimeout, tm.config.Keepalive() > 0)
+}
+
+// Watch keeps a connected tunnel up until ctx is cancelled, tearing it down and
+// re-establishing it with backoff when the interface disappears or handshakes go stale
+// Returns the last reconnect error if ctx is cancelled while the tunnel is down
+func (tm *TunnelManager) Watch(ctx context.Context, opts WatchOptions) error {
+	return tm.watch(ctx, opts, tm.reconnect)
+}
+
+func (tm *TunnelManager) watch(ctx context.Context, opts WatchOptions, reconnect func() error) error {
+	ticker := time.NewTicker(opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		action := tm.checkTunnel(time.Now())
+		if action == watchKeep {
+			continue
+		}
+
+		fmt.Printf("⚠️  %s, reconnecting...\n", action)
+		for failures := 1; ; failures++ {
+			err := reconnect()
+			if err == nil {
+				fmt.Println("🔁 VPN tunnel re-established")
+				break
+			}
+
+			delay := reconnectBackoff(failures, opts)
+			fmt.Printf("⚠️  Reconnect failed: %v (retrying in %s)\n", err, delay)
+			select {
+			case <-ctx.Done():
+				return err
+			case <-time.After(delay):
+			}
+		}
+	}
+}
+
+// reconnect tears down what is left of the tunnel and brings it up again
+// Leftovers of the failed tunnel are removed as with --force
+func (tm *TunnelManager) reconnect() error {
+	if tm.connected {
+		for _, step := range tm.teardownSteps() {
+			if step.Err != nil {
+				fmt.Printf("⚠️  Failed to %s: %v\n", step.Name, step.Err)
+			}
+		}
+		tm.connected = false
+		tm.recordHistory(HistoryDisconnect, nil)
+	}
+
+	force := tm.force
+	tm.force = true
+	defer func() { tm.force = force }()
+	return tm.Connect()
+}
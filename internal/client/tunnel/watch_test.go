@@ -0,0 +1,119 @@
+package tunnel
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDecideWatchAction(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	maxAge := DefaultHandshakeTimeout
+
+	tests := []struct {
+		name          string
+		interfaceUp   bool
+		lastHandshake time.Time
+		keepalive     bool
+		want          watchAction
+	}{
+		{name: "healthy", interfaceUp: true, lastHandshake: now.Add(-time.Minute), keepalive: true, want: watchKeep},
+		{name: "interface down", interfaceUp: false, lastHandshake: now, keepalive: true, want: watchInterfaceDown},
+		{name: "stale handshake", interfaceUp: true, lastHandshake: now.Add(-5 * time.Minute), keepalive: true, want: watchStaleHandshake},
+		{name: "handshake never completed", interfaceUp: true, keepalive: true, want: watchStaleHandshake},
+		{name: "idle tunnel without keepalive", interfaceUp: true, lastHandshake: now.Add(-time.Hour), keepalive: false, want: watchKeep},
+		{name: "interface down without keepalive", interfaceUp: false, keepalive: false, want: watchInterfaceDown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := decideWatchAction(tt.interfaceUp, tt.lastHandshake, now, maxAge, tt.keepalive); got != tt.want {
+				t.Errorf("decideWatchAction() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReconnectBackoff(t *testing.T) {
+	opts := WatchOptions{Backoff: 2 * time.Second, MaxBackoff: 10 * time.Second}
+
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{1, 2 * time.Second},
+		{2, 4 * time.Second},
+		{3, 8 * time.Second},
+		{4, 10 * time.Second},
+		{50, 10 * time.Second},
+	}
+
+	for _, tt := range tests {
+		if got := reconnectBackoff(tt.failures, opts); got != tt.want {
+			t.Errorf("reconnectBackoff(%d) = %s, want %s", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestWatchReconnects(t *testing.T) {
+	opts := WatchOptions{Interval: 10 * time.Millisecond, Backoff: 10 * time.Millisecond, MaxBackoff: 20 * time.Millisecond}
+
+	t.Run("interface down triggers reconnect", func(t *testing.T) {
+		tm := NewTunnelManager(newTestClientConfig(t))
+		up := false
+		tm.interfaceExists = func(string) bool { return up }
+		tm.latestHandshake = func() (time.Time, error) { return time.Now(), nil }
+
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+
+		attempts := 0
+		err := tm.watch(ctx, opts, func() error {
+			attempts++
+			if attempts < 3 {
+				return errors.New("server unreachable")
+			}
+			up = true
+			cancel()
+			return nil
+		})
+		if err != nil {
+			t.Errorf("Expected nil once the tunnel is back, got %v", err)
+		}
+		if attempts != 3 {
+			t.Errorf("Expected 3 reconnect attempts, got %d", attempts)
+		}
+	})
+
+	t.Run("healthy tunnel is left alone", func(t *testing.T) {
+		tm := NewTunnelManager(newTestClientConfig(t))
+		tm.interfaceExists = func(string) bool { return true }
+		tm.latestHandshake = func() (time.Time, error) { return time.Now(), nil }
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		err := tm.watch(ctx, opts, func() error {
+			t.Error("Healthy tunnel should not be reconnected")
+			return nil
+		})
+		if err != nil {
+			t.Errorf("Expected nil, got %v", err)
+		}
+	})
+
+	t.Run("cancelled while down", func(t *testing.T) {
+		tm := NewTunnelManager(newTestClientConfig(t))
+		tm.interfaceExists = func(string) bool { return true }
+		tm.latestHandshake = func() (time.Time, error) { return time.Now().Add(-time.Hour), nil }
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		unreachable := errors.New("server unreachable")
+		if err := tm.watch(ctx, opts, func() error { return unreachable }); !errors.Is(err, unreachable) {
+			t.Errorf("Expected the last reconnect error, got %v", err)
+		}
+	})
+}
@@ -1,7 +1,9 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"net/netip"
 	"os"
 	"strconv"
 	"time"
@@ -19,15 +21,49 @@ type Config struct {
 type ServerConfig struct {
 	APIPort       int    `json:"apiPort"`       // HTTP API port (default: 8443)
 	VPNPort       int    `json:"vpnPort"`       // WireGuard UDP port (default: 51820)
+	ListenAddr    string `json:"listenAddr"`    // Address advertised as the WireGuard endpoint host; must be local (default: unset, any)
+	TCPPort       int    `json:"tcpPort"`       // TCP transport port for clients on UDP-blocking networks (default: 0, disabled)
+	TLSEnabled    bool   `json:"tlsEnabled"`    // Serve the HTTP API over HTTPS with a self-signed certificate generated at startup (default: false); its SAN is ListenAddr, so clients using a DNS name must pin it
 	InterfaceName string `json:"interfaceName"` // WireGuard interface name (default: "wg0")
+	Fwmark        int    `json:"fwmark"`        // Firewall mark for WireGuard packets (default: 0, disabled)
+	SourceFilter  string `json:"sourceFilter"`  // Ingress source IP checks: "off", "count" or "drop" (default: "off")
+
+	PeerActiveWindow time.Duration `json:"peerActiveWindow"` // Last-handshake age at which a peer stops counting as active (default: 3m)
+	StickyIPTTL      time.Duration `json:"stickyIPTTL"`      // How long a removed peer's IP is held for it to reclaim on re-registration (default: 0, reused immediately)
+
+	AdminToken string `json:"-"` // Bearer token for protected admin endpoints, never serialized (default: unset, endpoints disabled)
+	APIKey     string `json:"-"` // Bearer token clients need to register and unregister, never serialized (default: unset, open registration)
+
+	RegisterMessage string `json:"registerMessage"` // Text returned to clients on successful registration (default: DefaultRegisterMessage)
+
+	AllocationAudit string `json:"allocationAudit"` // Allocation audit log destination: "stderr" or a file path (default: unset, disabled)
+
+	PersistPolicy string `json:"persistPolicy"` // On peer store save failure: "memory" keeps the peer unsaved, "strict" fails registration (default: "memory")
+	PersistPeers  bool   `json:"persistPeers"`  // Save peers to data/peers.json; off for stateless deployments where peers re-register (default: true)
+	CorruptPeers  string `json:"corruptPeers"`  // Unparseable peers.json at startup: "recover" backs it up and starts empty, "strict" refuses to start (default: "recover")
+
+	TimestampFormat string `json:"timestampFormat"` // Timestamps in API responses: "rfc3339" (local time), "utc", "unix" or "unixmilli" (default: "rfc3339")
+
+	MaxRegistrations int `json:"maxRegistrations"` // Registrations handled at once; more are refused with 503, 0 disables the limit (default: 32)
 }
 
+// DefaultRegisterMessage is returned to newly registered clients unless VPN_REGISTER_MESSAGE overrides it
+const DefaultRegisterMessage = "Registration successful - VPN tunnel established"
+
 // NetworkConfig contains VPN network settings
 type NetworkConfig struct {
-	ServerIP     string `json:"serverIP"`     // VPN server IP with CIDR (default: "10.0.0.1/24")
-	IPAMCIDR     string `json:"ipamCIDR"`     // IP allocation range (default: "10.0.0.0/24")
-	IPAMGateway  string `json:"ipamGateway"`  // Gateway IP (default: "10.0.0.1")
-	ClientIPDemo string `json:"clientIPDemo"` // Demo client IP for registration (default: "10.0.0.100")
+	ServerIP      string `json:"serverIP"`      // VPN server IP with CIDR (default: "10.0.0.1/24")
+	IPAMCIDR      string `json:"ipamCIDR"`      // IP allocation range (default: ServerIP's network)
+	IPAMGateway   string `json:"ipamGateway"`   // Gateway IP (default: ServerIP's address)
+	ClientIPDemo  string `json:"clientIPDemo"`  // Demo client IP for registration (default: "10.0.0.100")
+	MaxAllowedIPs int    `json:"maxAllowedIPs"` // Maximum allowed IPs per peer (default: 16)
+	AllocAttempts int    `json:"allocAttempts"` // Allocations per registration when they collide with other writers, 0 uses the default (default: 3)
+	TokenPools    string `json:"-"`             // token=CIDR pairs giving API tokens their own pools, never serialized (default: unset)
+	ServiceIPs    string `json:"serviceIPs"`    // Comma-separated addresses of in-VPN services kept out of allocation and advertised to clients (default: unset)
+
+	// Tunnel parameters recommended to clients at registration
+	ClientKeepalive int `json:"clientKeepalive"` // Persistent keepalive in seconds, 0 disables (default: 25)
+	ClientMTU       int `json:"clientMTU"`       // Client tunnel MTU, 0 leaves it to the client (default: 1420)
 }
 
 // TimeoutConfig contains timeout settings
@@ -41,24 +77,52 @@ type TimeoutConfig struct {
 
 // TestConfig contains test-specific settings
 type TestConfig struct {
+	DemoMode      bool   `json:"demoMode"`      // Print the demo banner and add the hardcoded test peer (default: false)
 	PeerPublicKey string `json:"peerPublicKey"` // Hardcoded test peer public key
 	PeerIP        string `json:"peerIP"`        // Hardcoded test peer IP (default: "10.0.0.2")
 	InterfaceName string `json:"interfaceName"` // Test interface name (default: "wg-test")
+
+	TestEndpoints bool  `json:"testEndpoints"` // Serve load-generating test endpoints such as /api/bench (default: false)
+	BenchMaxBytes int64 `json:"benchMaxBytes"` // Largest transfer /api/bench streams or accepts (default: 100 MiB)
 }
 
 // Load creates a Config with values from environment variables and defaults
 func Load() *Config {
-	return &Config{
+	config := &Config{
 		Server: ServerConfig{
 			APIPort:       getEnvInt("PORT", getEnvInt("VPN_API_PORT", 8443)),
 			VPNPort:       getEnvInt("VPN_LISTEN_PORT", 51820),
+			ListenAddr:    getEnvString("VPN_LISTEN_ADDR", ""),
+			TCPPort:       getEnvInt("VPN_TCP_PORT", 0),
+			TLSEnabled:    getEnvBool("VPN_TLS_ENABLED", false),
 			InterfaceName: getEnvString("VPN_INTERFACE", "wg0"),
+			Fwmark:        getEnvInt("VPN_FWMARK", 0),
+			SourceFilter:  getEnvString("VPN_SOURCE_FILTER", "off"),
+
+			PeerActiveWindow: getEnvDuration("VPN_PEER_ACTIVE_WINDOW", 3*time.Minute),
+			StickyIPTTL:      getEnvDuration("VPN_STICKY_IP_TTL", 0),
+			AdminToken:       getEnvString("VPN_ADMIN_TOKEN", ""),
+			APIKey:           getEnvString("VPN_API_KEY", ""),
+			RegisterMessage:  getEnvString("VPN_REGISTER_MESSAGE", DefaultRegisterMessage),
+			AllocationAudit:  getEnvString("VPN_ALLOCATION_AUDIT", ""),
+			PersistPolicy:    getEnvString("VPN_PERSIST_POLICY", "memory"),
+			PersistPeers:     getEnvBool("VPN_PERSIST_PEERS", true),
+			CorruptPeers:     getEnvString("VPN_CORRUPT_PEERS", "recover"),
+			TimestampFormat:  getEnvString("VPN_TIMESTAMP_FORMAT", "rfc3339"),
+			MaxRegistrations: getEnvInt("VPN_MAX_REGISTRATIONS", 32),
 		},
 		Network: NetworkConfig{
-			ServerIP:     getEnvString("VPN_SERVER_IP", "10.0.0.1/24"),
-			IPAMCIDR:     getEnvString("VPN_IPAM_CIDR", "10.0.0.0/24"),
-			IPAMGateway:  getEnvString("VPN_IPAM_GATEWAY", "10.0.0.1"),
-			ClientIPDemo: getEnvString("VPN_CLIENT_IP_DEMO", "10.0.0.100"),
+			ServerIP:      getEnvString("VPN_SERVER_IP", "10.0.0.1/24"),
+			IPAMCIDR:      getEnvString("VPN_IPAM_CIDR", ""),
+			IPAMGateway:   getEnvString("VPN_IPAM_GATEWAY", ""),
+			ClientIPDemo:  getEnvString("VPN_CLIENT_IP_DEMO", "10.0.0.100"),
+			MaxAllowedIPs: getEnvInt("VPN_MAX_ALLOWED_IPS", 16),
+			AllocAttempts: getEnvInt("VPN_ALLOC_ATTEMPTS", 3),
+			TokenPools:    getEnvString("VPN_TOKEN_POOLS", ""),
+			ServiceIPs:    getEnvString("VPN_SERVICE_IPS", ""),
+
+			ClientKeepalive: getEnvInt("VPN_KEEPALIVE", 25),
+			ClientMTU:       getEnvInt("VPN_CLIENT_MTU", 1420),
 		},
 		Timeouts: TimeoutConfig{
 			HTTPRead:    getEnvDuration("VPN_HTTP_READ_TIMEOUT", 15*time.Second),
@@ -68,51 +132,164 @@ func Load() *Config {
 			TestContext: getEnvDuration("VPN_TEST_CONTEXT_TIMEOUT", 30*time.Second),
 		},
 		Test: TestConfig{
+			DemoMode:      getEnvBool("VPN_DEMO_MODE", false),
 			PeerPublicKey: getEnvString("VPN_TEST_PEER_PUBKEY", ""),
 			PeerIP:        getEnvString("VPN_TEST_PEER_IP", "10.0.0.2"),
 			InterfaceName: getEnvString("VPN_TEST_INTERFACE", "wg-test"),
+			TestEndpoints: getEnvBool("VPN_TEST_ENDPOINTS", false),
+			BenchMaxBytes: int64(getEnvInt("VPN_BENCH_MAX_BYTES", 100<<20)),
 		},
 	}
+	config.Network.deriveIPAMDefaults()
+	return config
+}
+
+// deriveIPAMDefaults fills unset IPAM fields from ServerIP so operators configure one thing
+// ServerIP "10.0.0.1/24" yields IPAM CIDR "10.0.0.0/24" and gateway "10.0.0.1"
+func (n *NetworkConfig) deriveIPAMDefaults() {
+	prefix, err := netip.ParsePrefix(n.ServerIP)
+	if err != nil {
+		return // Validate reports the bad server IP
+	}
+	if n.IPAMCIDR == "" {
+		n.IPAMCIDR = prefix.Masked().String()
+	}
+	if n.IPAMGateway == "" {
+		n.IPAMGateway = prefix.Addr().String()
+	}
+}
+
+// Warnings reports settings that are valid individually but disagree with each other
+// They don't stop the server, so callers should log them
+func (c *Config) Warnings() []string {
+	var warnings []string
+
+	server, serverErr := netip.ParsePrefix(c.Network.ServerIP)
+	ipamCIDR, cidrErr := netip.ParsePrefix(c.Network.IPAMCIDR)
+	gateway, gatewayErr := netip.ParseAddr(c.Network.IPAMGateway)
+
+	if serverErr == nil && cidrErr == nil {
+		if !ipamCIDR.Contains(server.Addr()) {
+			warnings = append(warnings, fmt.Sprintf("server IP %s is outside IPAM CIDR %s", c.Network.ServerIP, c.Network.IPAMCIDR))
+		} else if server.Bits() != ipamCIDR.Bits() {
+			warnings = append(warnings, fmt.Sprintf("server IP %s and IPAM CIDR %s use different prefix lengths; clients may be unreachable", c.Network.ServerIP, c.Network.IPAMCIDR))
+		}
+	}
+	if serverErr == nil && gatewayErr == nil && gateway != server.Addr() {
+		warnings = append(warnings, fmt.Sprintf("IPAM gateway %s differs from server IP %s", c.Network.IPAMGateway, server.Addr()))
+	}
+
+	return warnings
 }
 
 // Validate checks if the configuration is valid
+// All failures are collected so a single run reports every problem
 func (c *Config) Validate() error {
+	var errs []error
+
 	// Validate ports
 	if c.Server.APIPort <= 0 || c.Server.APIPort > 65535 {
-		return fmt.Errorf("invalid API port: %d", c.Server.APIPort)
+		errs = append(errs, fmt.Errorf("invalid API port: %d", c.Server.APIPort))
 	}
 	if c.Server.VPNPort <= 0 || c.Server.VPNPort > 65535 {
-		return fmt.Errorf("invalid VPN port: %d", c.Server.VPNPort)
+		errs = append(errs, fmt.Errorf("invalid VPN port: %d", c.Server.VPNPort))
+	}
+	if c.Server.TCPPort < 0 || c.Server.TCPPort > 65535 {
+		errs = append(errs, fmt.Errorf("invalid TCP transport port: %d", c.Server.TCPPort))
 	}
 
 	// Validate interface names
 	if c.Server.InterfaceName == "" {
-		return fmt.Errorf("interface name cannot be empty")
+		errs = append(errs, fmt.Errorf("interface name cannot be empty"))
+	}
+	if c.Test.TestEndpoints && c.Test.BenchMaxBytes <= 0 {
+		errs = append(errs, fmt.Errorf("invalid bench max bytes: %d", c.Test.BenchMaxBytes))
+	}
+	if c.Server.ListenAddr != "" {
+		if _, err := netip.ParseAddr(c.Server.ListenAddr); err != nil {
+			errs = append(errs, fmt.Errorf("invalid listen address %q: %w", c.Server.ListenAddr, err))
+		}
+	}
+	if c.Server.Fwmark < 0 {
+		errs = append(errs, fmt.Errorf("invalid fwmark: %d", c.Server.Fwmark))
+	}
+	if c.Server.PeerActiveWindow < 0 {
+		errs = append(errs, fmt.Errorf("peer active window cannot be negative: %s", c.Server.PeerActiveWindow))
+	}
+	if c.Server.StickyIPTTL < 0 {
+		errs = append(errs, fmt.Errorf("sticky IP TTL cannot be negative: %s", c.Server.StickyIPTTL))
+	}
+	switch c.Server.SourceFilter {
+	case "", "off", "count", "drop":
+	default:
+		errs = append(errs, fmt.Errorf("invalid source filter mode: %q", c.Server.SourceFilter))
+	}
+	switch c.Server.PersistPolicy {
+	case "", "memory", "strict":
+	default:
+		errs = append(errs, fmt.Errorf("invalid persist policy: %q", c.Server.PersistPolicy))
+	}
+	switch c.Server.CorruptPeers {
+	case "", "recover", "strict":
+	default:
+		errs = append(errs, fmt.Errorf("invalid corrupt peers policy: %q", c.Server.CorruptPeers))
+	}
+	switch c.Server.TimestampFormat {
+	case "", "rfc3339", "utc", "unix", "unixmilli":
+	default:
+		errs = append(errs, fmt.Errorf("invalid timestamp format: %q", c.Server.TimestampFormat))
 	}
 
 	// Validate network settings
 	if c.Network.ServerIP == "" {
-		return fmt.Errorf("server IP cannot be empty")
+		errs = append(errs, fmt.Errorf("server IP cannot be empty"))
 	}
 	if c.Network.IPAMCIDR == "" {
-		return fmt.Errorf("IPAM CIDR cannot be empty")
+		errs = append(errs, fmt.Errorf("IPAM CIDR cannot be empty"))
+	} else if _, err := netip.ParsePrefix(c.Network.IPAMCIDR); err != nil {
+		errs = append(errs, fmt.Errorf("invalid IPAM CIDR: %q", c.Network.IPAMCIDR))
 	}
 	if c.Network.IPAMGateway == "" {
-		return fmt.Errorf("IPAM gateway cannot be empty")
+		errs = append(errs, fmt.Errorf("IPAM gateway cannot be empty"))
+	} else if _, err := netip.ParseAddr(c.Network.IPAMGateway); err != nil {
+		errs = append(errs, fmt.Errorf("invalid IPAM gateway: %q", c.Network.IPAMGateway))
+	}
+	if _, err := ParseTokenPools(c.Network.TokenPools); err != nil {
+		errs = append(errs, fmt.Errorf("invalid VPN_TOKEN_POOLS: %w", err))
+	}
+	if c.Network.ServiceIPs != "" {
+		if _, err := ParseServiceIPs(c.Network.ServiceIPs, c.Network.IPAMCIDR); err != nil {
+			errs = append(errs, fmt.Errorf("invalid VPN_SERVICE_IPS: %w", err))
+		}
+	}
+	if c.Server.MaxRegistrations < 0 {
+		errs = append(errs, fmt.Errorf("max concurrent registrations cannot be negative: %d", c.Server.MaxRegistrations))
+	}
+	if c.Network.MaxAllowedIPs < 0 {
+		errs = append(errs, fmt.Errorf("max allowed IPs per peer cannot be negative: %d", c.Network.MaxAllowedIPs))
+	}
+	if c.Network.AllocAttempts < 0 {
+		errs = append(errs, fmt.Errorf("allocation attempts cannot be negative: %d", c.Network.AllocAttempts))
+	}
+	if c.Network.ClientKeepalive < 0 || c.Network.ClientKeepalive > 65535 {
+		errs = append(errs, fmt.Errorf("invalid client keepalive: %d", c.Network.ClientKeepalive))
+	}
+	if c.Network.ClientMTU != 0 && (c.Network.ClientMTU < 576 || c.Network.ClientMTU > 65535) {
+		errs = append(errs, fmt.Errorf("invalid client MTU: %d", c.Network.ClientMTU))
 	}
 
 	// Validate timeouts
 	if c.Timeouts.HTTPRead <= 0 {
-		return fmt.Errorf("HTTP read timeout must be positive")
+		errs = append(errs, fmt.Errorf("HTTP read timeout must be positive"))
 	}
 	if c.Timeouts.HTTPWrite <= 0 {
-		return fmt.Errorf("HTTP write timeout must be positive")
+		errs = append(errs, fmt.Errorf("HTTP write timeout must be positive"))
 	}
 	if c.Timeouts.Shutdown <= 0 {
-		return fmt.Errorf("shutdown timeout must be positive")
+		errs = append(errs, fmt.Errorf("shutdown timeout must be positive"))
 	}
 
-	return nil
+	return errors.Join(errs...)
 }
 
 // getEnvString returns environment variable value or default
@@ -133,6 +310,16 @@ func getEnvInt(key string, defaultVal int) int {
 	return defaultVal
 }
 
+// getEnvBool returns environment variable as bool or default
+func getEnvBool(key string, defaultVal bool) bool {
+	if val := os.Getenv(key); val != "" {
+		if boolVal, err := strconv.ParseBool(val); err == nil {
+			return boolVal
+		}
+	}
+	return defaultVal
+}
+
 // getEnvDuration returns environment variable as duration or default
 func getEnvDuration(key string, defaultVal time.Duration) time.Duration {
 	if val := os.Getenv(key); val != "" {
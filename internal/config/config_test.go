@@ -2,6 +2,7 @@ package config
 
 import (
 	"os"
+	"strings"
 	"testing"
 	"time"
 )
@@ -31,6 +32,42 @@ func TestLoad(t *testing.T) {
 	if config.Network.IPAMGateway != "10.0.0.1" {
 		t.Errorf("Expected IPAM gateway 10.0.0.1, got %s", config.Network.IPAMGateway)
 	}
+	if config.Network.MaxAllowedIPs != 16 {
+		t.Errorf("Expected max allowed IPs 16, got %d", config.Network.MaxAllowedIPs)
+	}
+	if !config.Server.PersistPeers {
+		t.Error("Expected peer persistence enabled by default")
+	}
+	if config.Network.ClientKeepalive != 25 {
+		t.Errorf("Expected client keepalive 25, got %d", config.Network.ClientKeepalive)
+	}
+	if config.Test.DemoMode {
+		t.Error("Expected demo mode off by default")
+	}
+	if config.Server.SourceFilter != "off" {
+		t.Errorf("Expected source filter off, got %q", config.Server.SourceFilter)
+	}
+	if config.Server.TimestampFormat != "rfc3339" {
+		t.Errorf("Expected timestamp format rfc3339, got %q", config.Server.TimestampFormat)
+	}
+	if config.Server.CorruptPeers != "recover" {
+		t.Errorf("Expected corrupt peers policy recover, got %q", config.Server.CorruptPeers)
+	}
+	if config.Server.MaxRegistrations != 32 {
+		t.Errorf("Expected max registrations 32, got %d", config.Server.MaxRegistrations)
+	}
+	if config.Server.PeerActiveWindow != 3*time.Minute {
+		t.Errorf("Expected peer active window 3m, got %s", config.Server.PeerActiveWindow)
+	}
+	if config.Server.StickyIPTTL != 0 {
+		t.Errorf("Expected sticky IP TTL disabled, got %s", config.Server.StickyIPTTL)
+	}
+	if config.Server.RegisterMessage != DefaultRegisterMessage {
+		t.Errorf("Expected default register message, got %q", config.Server.RegisterMessage)
+	}
+	if config.Network.ClientMTU != 1420 {
+		t.Errorf("Expected client MTU 1420, got %d", config.Network.ClientMTU)
+	}
 
 	// Verify timeout defaults
 	if config.Timeouts.HTTPRead != 15*time.Second {
@@ -57,6 +94,12 @@ func TestLoadWithEnvironmentVariables(t *testing.T) {
 	os.Setenv("VPN_SERVER_IP", "192.168.1.1/24")
 	os.Setenv("VPN_HTTP_READ_TIMEOUT", "30s")
 	os.Setenv("VPN_TEST_PEER_IP", "192.168.1.10")
+	os.Setenv("VPN_KEEPALIVE", "0")
+	os.Setenv("VPN_CLIENT_MTU", "1380")
+	os.Setenv("VPN_DEMO_MODE", "true")
+	os.Setenv("VPN_SOURCE_FILTER", "drop")
+	os.Setenv("VPN_PERSIST_PEERS", "false")
+	os.Setenv("VPN_STICKY_IP_TTL", "10m")
 
 	defer func() {
 		// Clean up environment variables
@@ -66,6 +109,12 @@ func TestLoadWithEnvironmentVariables(t *testing.T) {
 		os.Unsetenv("VPN_SERVER_IP")
 		os.Unsetenv("VPN_HTTP_READ_TIMEOUT")
 		os.Unsetenv("VPN_TEST_PEER_IP")
+		os.Unsetenv("VPN_KEEPALIVE")
+		os.Unsetenv("VPN_CLIENT_MTU")
+		os.Unsetenv("VPN_DEMO_MODE")
+		os.Unsetenv("VPN_SOURCE_FILTER")
+		os.Unsetenv("VPN_PERSIST_PEERS")
+		os.Unsetenv("VPN_STICKY_IP_TTL")
 	}()
 
 	config := Load()
@@ -83,12 +132,33 @@ func TestLoadWithEnvironmentVariables(t *testing.T) {
 	if config.Network.ServerIP != "192.168.1.1/24" {
 		t.Errorf("Expected server IP 192.168.1.1/24, got %s", config.Network.ServerIP)
 	}
+	if config.Network.IPAMCIDR != "192.168.1.0/24" || config.Network.IPAMGateway != "192.168.1.1" {
+		t.Errorf("Expected IPAM derived from server IP, got %s gateway %s", config.Network.IPAMCIDR, config.Network.IPAMGateway)
+	}
+	if config.Server.PersistPeers {
+		t.Error("Expected peer persistence disabled by VPN_PERSIST_PEERS")
+	}
+	if !config.Test.DemoMode {
+		t.Error("Expected demo mode enabled by VPN_DEMO_MODE")
+	}
+	if config.Server.SourceFilter != "drop" {
+		t.Errorf("Expected source filter drop, got %q", config.Server.SourceFilter)
+	}
 	if config.Timeouts.HTTPRead != 30*time.Second {
 		t.Errorf("Expected HTTP read timeout 30s, got %v", config.Timeouts.HTTPRead)
 	}
 	if config.Test.PeerIP != "192.168.1.10" {
 		t.Errorf("Expected test peer IP 192.168.1.10, got %s", config.Test.PeerIP)
 	}
+	if config.Network.ClientKeepalive != 0 {
+		t.Errorf("Expected client keepalive 0, got %d", config.Network.ClientKeepalive)
+	}
+	if config.Network.ClientMTU != 1380 {
+		t.Errorf("Expected client MTU 1380, got %d", config.Network.ClientMTU)
+	}
+	if config.Server.StickyIPTTL != 10*time.Minute {
+		t.Errorf("Expected sticky IP TTL 10m, got %s", config.Server.StickyIPTTL)
+	}
 }
 
 func TestValidate(t *testing.T) {
@@ -146,6 +216,116 @@ func TestValidate(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "negative max allowed IPs",
+			config: Config{
+				Server: ServerConfig{APIPort: 8443, VPNPort: 51820, InterfaceName: "wg0"},
+				Network: NetworkConfig{
+					ServerIP: "10.0.0.1/24", IPAMCIDR: "10.0.0.0/24", IPAMGateway: "10.0.0.1", MaxAllowedIPs: -1,
+				},
+				Timeouts: TimeoutConfig{HTTPRead: 15 * time.Second, HTTPWrite: 15 * time.Second, Shutdown: 10 * time.Second},
+			},
+			wantErr: true,
+		},
+		{
+			name: "negative client keepalive",
+			config: Config{
+				Server: ServerConfig{APIPort: 8443, VPNPort: 51820, InterfaceName: "wg0"},
+				Network: NetworkConfig{
+					ServerIP: "10.0.0.1/24", IPAMCIDR: "10.0.0.0/24", IPAMGateway: "10.0.0.1", ClientKeepalive: -1,
+				},
+				Timeouts: TimeoutConfig{HTTPRead: 15 * time.Second, HTTPWrite: 15 * time.Second, Shutdown: 10 * time.Second},
+			},
+			wantErr: true,
+		},
+		{
+			name: "client MTU too small",
+			config: Config{
+				Server: ServerConfig{APIPort: 8443, VPNPort: 51820, InterfaceName: "wg0"},
+				Network: NetworkConfig{
+					ServerIP: "10.0.0.1/24", IPAMCIDR: "10.0.0.0/24", IPAMGateway: "10.0.0.1", ClientMTU: 500,
+				},
+				Timeouts: TimeoutConfig{HTTPRead: 15 * time.Second, HTTPWrite: 15 * time.Second, Shutdown: 10 * time.Second},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid TCP transport port",
+			config: Config{
+				Server: ServerConfig{APIPort: 8443, VPNPort: 51820, InterfaceName: "wg0", TCPPort: 70000},
+				Network: NetworkConfig{
+					ServerIP: "10.0.0.1/24", IPAMCIDR: "10.0.0.0/24", IPAMGateway: "10.0.0.1",
+				},
+				Timeouts: TimeoutConfig{HTTPRead: 15 * time.Second, HTTPWrite: 15 * time.Second, Shutdown: 10 * time.Second},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid source filter",
+			config: Config{
+				Server: ServerConfig{APIPort: 8443, VPNPort: 51820, InterfaceName: "wg0", SourceFilter: "block"},
+				Network: NetworkConfig{
+					ServerIP: "10.0.0.1/24", IPAMCIDR: "10.0.0.0/24", IPAMGateway: "10.0.0.1",
+				},
+				Timeouts: TimeoutConfig{HTTPRead: 15 * time.Second, HTTPWrite: 15 * time.Second, Shutdown: 10 * time.Second},
+			},
+			wantErr: true,
+		},
+		{
+			name: "utc timestamp format",
+			config: Config{
+				Server: ServerConfig{APIPort: 8443, VPNPort: 51820, InterfaceName: "wg0", TimestampFormat: "utc"},
+				Network: NetworkConfig{
+					ServerIP: "10.0.0.1/24", IPAMCIDR: "10.0.0.0/24", IPAMGateway: "10.0.0.1",
+				},
+				Timeouts: TimeoutConfig{HTTPRead: 15 * time.Second, HTTPWrite: 15 * time.Second, Shutdown: 10 * time.Second},
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid timestamp format",
+			config: Config{
+				Server: ServerConfig{APIPort: 8443, VPNPort: 51820, InterfaceName: "wg0", TimestampFormat: "iso"},
+				Network: NetworkConfig{
+					ServerIP: "10.0.0.1/24", IPAMCIDR: "10.0.0.0/24", IPAMGateway: "10.0.0.1",
+				},
+				Timeouts: TimeoutConfig{HTTPRead: 15 * time.Second, HTTPWrite: 15 * time.Second, Shutdown: 10 * time.Second},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid corrupt peers policy",
+			config: Config{
+				Server: ServerConfig{APIPort: 8443, VPNPort: 51820, InterfaceName: "wg0", CorruptPeers: "ignore"},
+				Network: NetworkConfig{
+					ServerIP: "10.0.0.1/24", IPAMCIDR: "10.0.0.0/24", IPAMGateway: "10.0.0.1",
+				},
+				Timeouts: TimeoutConfig{HTTPRead: 15 * time.Second, HTTPWrite: 15 * time.Second, Shutdown: 10 * time.Second},
+			},
+			wantErr: true,
+		},
+		{
+			name: "negative sticky IP TTL",
+			config: Config{
+				Server: ServerConfig{APIPort: 8443, VPNPort: 51820, InterfaceName: "wg0", StickyIPTTL: -time.Minute},
+				Network: NetworkConfig{
+					ServerIP: "10.0.0.1/24", IPAMCIDR: "10.0.0.0/24", IPAMGateway: "10.0.0.1",
+				},
+				Timeouts: TimeoutConfig{HTTPRead: 15 * time.Second, HTTPWrite: 15 * time.Second, Shutdown: 10 * time.Second},
+			},
+			wantErr: true,
+		},
+		{
+			name: "negative registration limit",
+			config: Config{
+				Server: ServerConfig{APIPort: 8443, VPNPort: 51820, InterfaceName: "wg0", MaxRegistrations: -1},
+				Network: NetworkConfig{
+					ServerIP: "10.0.0.1/24", IPAMCIDR: "10.0.0.0/24", IPAMGateway: "10.0.0.1",
+				},
+				Timeouts: TimeoutConfig{HTTPRead: 15 * time.Second, HTTPWrite: 15 * time.Second, Shutdown: 10 * time.Second},
+			},
+			wantErr: true,
+		},
 		{
 			name: "zero timeout",
 			config: Config{
@@ -169,6 +349,88 @@ func TestValidate(t *testing.T) {
 	}
 }
 
+func TestValidateReportsAllErrors(t *testing.T) {
+	config := Config{
+		Server:   ServerConfig{APIPort: 0, VPNPort: 70000, InterfaceName: ""},
+		Network:  NetworkConfig{ServerIP: "10.0.0.1/24", IPAMCIDR: "", IPAMGateway: "10.0.0.1"},
+		Timeouts: TimeoutConfig{HTTPRead: 15 * time.Second, HTTPWrite: 0, Shutdown: 10 * time.Second},
+	}
+
+	err := config.Validate()
+	if err == nil {
+		t.Fatal("Expected validation errors")
+	}
+
+	want := []string{
+		"invalid API port: 0",
+		"invalid VPN port: 70000",
+		"interface name cannot be empty",
+		"IPAM CIDR cannot be empty",
+		"HTTP write timeout must be positive",
+	}
+	for _, msg := range want {
+		if !strings.Contains(err.Error(), msg) {
+			t.Errorf("Expected %q in validation error, got:\n%v", msg, err)
+		}
+	}
+
+	if got := strings.Count(err.Error(), "\n") + 1; got != len(want) {
+		t.Errorf("Expected %d errors, got %d:\n%v", len(want), got, err)
+	}
+}
+
+func TestDeriveIPAMDefaults(t *testing.T) {
+	tests := []struct {
+		name        string
+		network     NetworkConfig
+		wantCIDR    string
+		wantGateway string
+	}{
+		{"derived from server IP", NetworkConfig{ServerIP: "10.8.0.1/16"}, "10.8.0.0/16", "10.8.0.1"},
+		{"explicit values kept", NetworkConfig{ServerIP: "10.8.0.1/16", IPAMCIDR: "10.8.1.0/24", IPAMGateway: "10.8.1.1"}, "10.8.1.0/24", "10.8.1.1"},
+		{"only gateway derived", NetworkConfig{ServerIP: "10.8.0.1/24", IPAMCIDR: "10.8.0.0/24"}, "10.8.0.0/24", "10.8.0.1"},
+		{"invalid server IP left for Validate", NetworkConfig{ServerIP: "not-an-ip"}, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			network := tt.network
+			network.deriveIPAMDefaults()
+			if network.IPAMCIDR != tt.wantCIDR || network.IPAMGateway != tt.wantGateway {
+				t.Errorf("Got CIDR %q gateway %q, want %q and %q", network.IPAMCIDR, network.IPAMGateway, tt.wantCIDR, tt.wantGateway)
+			}
+		})
+	}
+}
+
+func TestWarnings(t *testing.T) {
+	tests := []struct {
+		name    string
+		network NetworkConfig
+		want    []string
+	}{
+		{"consistent", NetworkConfig{ServerIP: "10.0.0.1/24", IPAMCIDR: "10.0.0.0/24", IPAMGateway: "10.0.0.1"}, nil},
+		{"prefix mismatch", NetworkConfig{ServerIP: "10.0.0.1/24", IPAMCIDR: "10.0.0.0/16", IPAMGateway: "10.0.0.1"}, []string{"different prefix lengths"}},
+		{"server outside IPAM", NetworkConfig{ServerIP: "10.1.0.1/24", IPAMCIDR: "10.0.0.0/24", IPAMGateway: "10.0.0.1"}, []string{"outside IPAM CIDR", "differs from server IP"}},
+		{"gateway mismatch", NetworkConfig{ServerIP: "10.0.0.1/24", IPAMCIDR: "10.0.0.0/24", IPAMGateway: "10.0.0.254"}, []string{"differs from server IP"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := Config{Network: tt.network}
+			warnings := config.Warnings()
+			if len(warnings) != len(tt.want) {
+				t.Fatalf("Expected %d warnings, got %v", len(tt.want), warnings)
+			}
+			for i, want := range tt.want {
+				if !strings.Contains(warnings[i], want) {
+					t.Errorf("Warning %d = %q, want it to mention %q", i, warnings[i], want)
+				}
+			}
+		})
+	}
+}
+
 func TestGetEnvHelpers(t *testing.T) {
 	// Test getEnvString
 	os.Setenv("TEST_STRING", "test_value")
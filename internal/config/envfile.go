@@ -0,0 +1,135 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// EnvFileVar names the variable holding an optional .env file path, read before Load
+const EnvFileVar = "VPN_ENV_FILE"
+
+// LoadEnvFile sets variables from a .env file without overriding ones already in the environment
+// Real environment variables win so a deployment can always override the file
+func LoadEnvFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open env file: %w", err)
+	}
+	defer file.Close()
+
+	vars, err := ParseEnvFile(file)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	for key, value := range vars {
+		if _, set := os.LookupEnv(key); set {
+			continue
+		}
+		if err := os.Setenv(key, value); err != nil {
+			return fmt.Errorf("failed to set %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// ParseEnvFile reads KEY=VALUE lines in the style of config/server.env.example
+// Blank lines and # comments are skipped, an "export " prefix is allowed, and values may be
+// double-quoted (with Go escapes), single-quoted (literal) or bare with a trailing " # comment"
+func ParseEnvFile(r io.Reader) (map[string]string, error) {
+	vars := make(map[string]string)
+
+	scanner := bufio.NewScanner(r)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		key, value, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok || !isEnvKey(key) {
+			return nil, fmt.Errorf("line %d: expected KEY=VALUE", lineNum)
+		}
+
+		value, err := parseEnvValue(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNum, err)
+		}
+		vars[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read env file: %w", err)
+	}
+
+	return vars, nil
+}
+
+// parseEnvValue unquotes a value or strips the inline comment from a bare one
+func parseEnvValue(value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+
+	if quote := value[0]; quote == '"' || quote == '\'' {
+		end := closingQuote(value)
+		if end < 0 {
+			return "", fmt.Errorf("unterminated %c quote", quote)
+		}
+		if rest := strings.TrimSpace(value[end+1:]); rest != "" && !strings.HasPrefix(rest, "#") {
+			return "", fmt.Errorf("unexpected text after quoted value: %q", rest)
+		}
+
+		quoted := value[:end+1]
+		if quote == '\'' {
+			return quoted[1:end], nil
+		}
+		unquoted, err := strconv.Unquote(quoted)
+		if err != nil {
+			return "", fmt.Errorf("invalid quoted value %s: %w", quoted, err)
+		}
+		return unquoted, nil
+	}
+
+	// A bare value ends at the first " #", matching shell comment rules
+	if i := strings.Index(value, " #"); i >= 0 {
+		value = value[:i]
+	}
+	if i := strings.Index(value, "\t#"); i >= 0 {
+		value = value[:i]
+	}
+	return strings.TrimSpace(value), nil
+}
+
+// closingQuote returns the index of the quote closing value[0], or -1
+// Backslash escapes only apply inside double quotes
+func closingQuote(value string) int {
+	quote := value[0]
+	for i := 1; i < len(value); i++ {
+		switch {
+		case value[i] == '\\' && quote == '"':
+			i++
+		case value[i] == quote:
+			return i
+		}
+	}
+	return -1
+}
+
+// isEnvKey reports whether key is a portable environment variable name
+func isEnvKey(key string) bool {
+	if key == "" || (key[0] >= '0' && key[0] <= '9') {
+		return false
+	}
+	for _, c := range key {
+		if c != '_' && (c < 'A' || c > 'Z') && (c < 'a' || c > 'z') && (c < '0' || c > '9') {
+			return false
+		}
+	}
+	return true
+}
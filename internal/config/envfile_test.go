@@ -0,0 +1,97 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseEnvFile(t *testing.T) {
+	input := `# GoWire VPN Server Configuration
+
+VPN_LISTEN_PORT=51820
+  VPN_API_PORT = 8443
+export VPN_INTERFACE=wg1
+VPN_KEEPALIVE=25     # Persistent keepalive pushed to clients
+VPN_SOURCE_FILTER=drop	# tab before the comment
+VPN_ADMIN_TOKEN=abc#123
+VPN_REGISTER_MESSAGE="Welcome! Support: help@example.com # not a comment"
+VPN_TEST_PEER_IP='10.0.0.9 # literal'
+VPN_CLIENT_IP_DEMO="line1\nline2"  # comment after quotes
+VPN_IPAM_GATEWAY=
+`
+	got, err := ParseEnvFile(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ParseEnvFile failed: %v", err)
+	}
+
+	want := map[string]string{
+		"VPN_LISTEN_PORT":      "51820",
+		"VPN_API_PORT":         "8443",
+		"VPN_INTERFACE":        "wg1",
+		"VPN_KEEPALIVE":        "25",
+		"VPN_SOURCE_FILTER":    "drop",
+		"VPN_ADMIN_TOKEN":      "abc#123",
+		"VPN_REGISTER_MESSAGE": "Welcome! Support: help@example.com # not a comment",
+		"VPN_TEST_PEER_IP":     "10.0.0.9 # literal",
+		"VPN_CLIENT_IP_DEMO":   "line1\nline2",
+		"VPN_IPAM_GATEWAY":     "",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Unexpected variables:\ngot:  %q\nwant: %q", got, want)
+	}
+}
+
+func TestParseEnvFileErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"missing equals", "VPN_LISTEN_PORT\n", "line 1: expected KEY=VALUE"},
+		{"invalid key", "# ok\nVPN-PORT=1\n", "line 2: expected KEY=VALUE"},
+		{"key starting with digit", "1VPN=1\n", "line 1: expected KEY=VALUE"},
+		{"unterminated quote", `VPN_REGISTER_MESSAGE="hello`, "unterminated"},
+		{"text after quotes", `VPN_REGISTER_MESSAGE="a" b`, "unexpected text"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseEnvFile(strings.NewReader(tt.input))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestLoadEnvFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.env")
+	content := "VPN_LISTEN_PORT=51999\nVPN_INTERFACE=wg-file\n"
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("Failed to write env file: %v", err)
+	}
+
+	// Real environment wins over the file, even when set to an empty value
+	t.Setenv("VPN_INTERFACE", "wg-real")
+	t.Setenv("VPN_LISTEN_PORT", "")
+	os.Unsetenv("VPN_LISTEN_PORT")
+
+	if err := LoadEnvFile(path); err != nil {
+		t.Fatalf("LoadEnvFile failed: %v", err)
+	}
+
+	config := Load()
+	if config.Server.VPNPort != 51999 {
+		t.Errorf("Expected VPN port from file, got %d", config.Server.VPNPort)
+	}
+	if config.Server.InterfaceName != "wg-real" {
+		t.Errorf("Expected existing VPN_INTERFACE to be kept, got %q", config.Server.InterfaceName)
+	}
+
+	if err := LoadEnvFile(filepath.Join(t.TempDir(), "missing.env")); err == nil {
+		t.Error("Expected error for missing env file")
+	}
+}
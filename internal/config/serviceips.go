@@ -0,0 +1,33 @@
+package config
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// ParseServiceIPs parses VPN_SERVICE_IPS: comma-separated addresses of services inside the VPN
+// Each address must lie in cidr, the network clients are allocated from
+func ParseServiceIPs(value, cidr string) ([]string, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+
+	network, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid IPAM CIDR %q", cidr)
+	}
+
+	var ips []string
+	for _, entry := range strings.Split(value, ",") {
+		addr, err := netip.ParseAddr(strings.TrimSpace(entry))
+		if err != nil {
+			return nil, fmt.Errorf("invalid service IP %q", strings.TrimSpace(entry))
+		}
+		if !network.Contains(addr) {
+			return nil, fmt.Errorf("service IP %s is outside IPAM CIDR %s", addr, cidr)
+		}
+		ips = append(ips, addr.String())
+	}
+	return ips, nil
+}
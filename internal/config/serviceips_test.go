@@ -0,0 +1,40 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseServiceIPs(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    []string
+		wantErr string
+	}{
+		{name: "unset", value: ""},
+		{name: "two services", value: "10.0.0.53, 10.0.0.80", want: []string{"10.0.0.53", "10.0.0.80"}},
+		{name: "invalid address", value: "10.0.0.53,dns", wantErr: `invalid service IP "dns"`},
+		{name: "CIDR form", value: "10.0.0.53/32", wantErr: "invalid service IP"},
+		{name: "outside the network", value: "10.1.0.53", wantErr: "outside IPAM CIDR"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseServiceIPs(tt.value, "10.0.0.0/24")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseServiceIPs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
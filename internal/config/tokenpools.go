@@ -0,0 +1,41 @@
+package config
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// TokenPool reserves an address pool for clients registering with an API token
+type TokenPool struct {
+	Token string
+	CIDR  string
+}
+
+// ParseTokenPools parses VPN_TOKEN_POOLS: comma-separated token=CIDR pairs
+// Tokens must be unique; overlapping CIDRs are rejected when the pools are built
+func ParseTokenPools(value string) ([]TokenPool, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+
+	var pools []TokenPool
+	seen := make(map[string]bool)
+	for i, entry := range strings.Split(value, ",") {
+		token, cidr, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		token, cidr = strings.TrimSpace(token), strings.TrimSpace(cidr)
+		// Entries are reported by position so a bad one never echoes a token into the logs
+		if !ok || token == "" || cidr == "" {
+			return nil, fmt.Errorf("token pool %d: expected token=CIDR", i+1)
+		}
+		if seen[token] {
+			return nil, fmt.Errorf("token pool %d: duplicate token", i+1)
+		}
+		if _, err := netip.ParsePrefix(cidr); err != nil {
+			return nil, fmt.Errorf("token pool %d: invalid CIDR %q", i+1, cidr)
+		}
+		seen[token] = true
+		pools = append(pools, TokenPool{Token: token, CIDR: cidr})
+	}
+	return pools, nil
+}
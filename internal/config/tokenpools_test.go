@@ -0,0 +1,48 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseTokenPools(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    []TokenPool
+		wantErr string
+	}{
+		{name: "unset", value: ""},
+		{
+			name:  "two pools",
+			value: "tokenA=10.1.0.0/24, tokenB = 10.2.0.0/24",
+			want:  []TokenPool{{Token: "tokenA", CIDR: "10.1.0.0/24"}, {Token: "tokenB", CIDR: "10.2.0.0/24"}},
+		},
+		{name: "missing CIDR", value: "tokenA=", wantErr: "token pool 1: expected token=CIDR"},
+		{name: "missing separator", value: "tokenA=10.1.0.0/24,tokenB", wantErr: "token pool 2: expected token=CIDR"},
+		{name: "invalid CIDR", value: "tokenA=10.1.0.0", wantErr: "token pool 1: invalid CIDR"},
+		{name: "duplicate token", value: "tokenA=10.1.0.0/24,tokenA=10.2.0.0/24", wantErr: "token pool 2: duplicate token"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseTokenPools(tt.value)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Expected error containing %q, got %v", tt.wantErr, err)
+				}
+				if strings.Contains(err.Error(), "tokenA") {
+					t.Errorf("Error must not echo the token: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseTokenPools failed: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
@@ -1,12 +1,31 @@
 package ipam
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"math"
 	"net"
+	"slices"
 	"sync"
 	"time"
 )
 
+// ErrNoAvailableIPs is returned when every address in the allocation range is taken
+var ErrNoAvailableIPs = errors.New("no available IPs")
+
+// Address families reported in NetworkInfo.Family
+const (
+	FamilyIPv4 = "ipv4"
+	FamilyIPv6 = "ipv6"
+)
+
+// ErrIPAlreadyAllocated is returned when a specifically requested IP is held by someone else
+var ErrIPAlreadyAllocated = errors.New("IP already allocated")
+
+// ErrIPNotAllocated is returned when releasing an IP the allocator never handed out
+var ErrIPNotAllocated = errors.New("IP not allocated")
+
 // UserIPInfo represents the minimal interface needed for IP allocation
 // This allows the allocator to work with any type that provides IP information
 type UserIPInfo interface {
@@ -19,13 +38,28 @@ type Allocator struct {
 	mu      sync.RWMutex
 	cidr    *net.IPNet
 	gateway net.IP
-	startIP net.IP
-	endIP   net.IP
+	// reserved holds addresses never handed to clients (gateway, server IP and service IPs)
+	reserved []string
+	services []string // Service addresses advertised to clients, a subset of reserved
+	startIP  net.IP
+	endIP    net.IP
 
 	// Performance optimizations
 	allocatedIPs  map[string]bool // Track allocated IPs for O(1) lookup
+	tracked       bool            // allocatedIPs has been seeded from the assigned IPs and is authoritative
 	lastAllocated net.IP          // Track last allocated IP for faster sequential allocation
 	stats         *AllocationStats
+
+	// Sticky release: released IPs are held for stickyTTL so reconnects reclaim them
+	stickyTTL time.Duration
+	held      map[string]heldIP // IP -> hold info
+	now       func() time.Time  // Time source (overridable in tests)
+}
+
+// heldIP records a released IP that is temporarily kept out of the free pool
+type heldIP struct {
+	owner      string // Identity of the previous holder (e.g. public key), may be empty
+	releasedAt time.Time
 }
 
 // AllocationStats tracks allocation performance metrics
@@ -42,8 +76,17 @@ type Config struct {
 	CIDR string
 	// Gateway is the server IP (e.g., "10.0.0.1") - excluded from allocation
 	Gateway string
+	// ServerIP is the server's tunnel address, plain or CIDR form (e.g., "10.0.0.10/24")
+	// Excluded from allocation in addition to the gateway; empty = same as gateway
+	ServerIP string
 	// EnableOptimizations enables performance optimizations (default: true)
 	EnableOptimizations bool
+	// StickyTTL holds released IPs out of the free pool for this long so a
+	// reconnecting client gets its previous address back (0 = reuse immediately)
+	StickyTTL time.Duration
+	// ServiceIPs are fixed addresses of services inside the VPN (e.g. DNS, a web portal)
+	// They are reserved like the gateway and advertised to clients
+	ServiceIPs []string
 }
 
 // DefaultConfig returns the standard VPN configuration
@@ -83,24 +126,60 @@ func NewAllocator(config Config) (*Allocator, error) {
 		return nil, fmt.Errorf("gateway %s not in CIDR %s", config.Gateway, config.CIDR)
 	}
 
-	// Calculate allocation range (exclude network, gateway, and broadcast)
-	startIP := make(net.IP, len(cidr.IP))
-	copy(startIP, cidr.IP)
+	reserved := []string{gateway.String()}
+	if config.ServerIP != "" {
+		serverIP := parseAssignedIP(config.ServerIP)
+		if serverIP == nil {
+			return nil, fmt.Errorf("invalid server IP %s", config.ServerIP)
+		}
+		if !cidr.Contains(serverIP) {
+			return nil, fmt.Errorf("server IP %s not in CIDR %s", config.ServerIP, config.CIDR)
+		}
+		if !serverIP.Equal(gateway) {
+			reserved = append(reserved, serverIP.String())
+		}
+	}
 
-	// Start from .2 (skip network .0 and gateway .1)
-	startIP[len(startIP)-1] = 2
+	var services []string
+	for _, service := range config.ServiceIPs {
+		ip := parseAssignedIP(service)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid service IP %s", service)
+		}
+		if !cidr.Contains(ip) {
+			return nil, fmt.Errorf("service IP %s not in CIDR %s", service, config.CIDR)
+		}
+		if slices.Contains(services, ip.String()) {
+			continue
+		}
+		services = append(services, ip.String())
+		if !slices.Contains(reserved, ip.String()) {
+			reserved = append(reserved, ip.String())
+		}
+	}
 
-	// End at .254 (skip broadcast .255)
-	endIP := make(net.IP, len(cidr.IP))
-	copy(endIP, cidr.IP)
-	endIP[len(endIP)-1] = 254
+	// Calculate allocation range: the usable hosts of the CIDR, excluding the network and
+	// broadcast addresses; a gateway at the first host is skipped so the range starts after it
+	startIP, endIP := hostRange(cidr)
+	if startIP.Equal(gateway) {
+		incrementIP(startIP)
+	}
+	if bytes.Compare(startIP, endIP) > 0 {
+		return nil, fmt.Errorf("CIDR %s has no addresses to allocate", config.CIDR)
+	}
 
 	allocator := &Allocator{
-		cidr:    cidr,
-		gateway: gateway,
-		startIP: startIP,
-		endIP:   endIP,
-		stats:   &AllocationStats{},
+		cidr:     cidr,
+		gateway:  gateway,
+		reserved: reserved,
+		services: services,
+		startIP:  startIP,
+		endIP:    endIP,
+		stats:    &AllocationStats{},
+
+		stickyTTL: config.StickyTTL,
+		held:      make(map[string]heldIP),
+		now:       time.Now,
 	}
 
 	// Initialize optimizations if enabled
@@ -108,19 +187,22 @@ func NewAllocator(config Config) (*Allocator, error) {
 		allocator.allocatedIPs = make(map[string]bool)
 		allocator.lastAllocated = make(net.IP, len(startIP))
 		copy(allocator.lastAllocated, startIP)
-		// Mark gateway as allocated
-		allocator.allocatedIPs[gateway.String()] = true
+		// Mark gateway and server IP as allocated
+		allocator.markReserved(allocator.allocatedIPs)
 	}
 
 	return allocator, nil
 }
 
 // AllocateIP finds the next available IP address for a new client
-// Returns the IP in CIDR format (e.g., "10.0.0.5/32")
+// Returns the IP in host CIDR format (e.g., "10.0.0.5/32" or "fd00::5/128")
 func (a *Allocator) AllocateIP(existingUsers []UserIPInfo) (string, error) {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
+	// Expired holds would otherwise pile up when no owner ever comes back for them
+	a.purgeExpiredHolds()
+
 	var allocatedIP string
 	var err error
 
@@ -143,6 +225,137 @@ func (a *Allocator) AllocateIP(existingUsers []UserIPInfo) (string, error) {
 	return allocatedIP, err
 }
 
+// AllocateIPForOwner allocates an IP for the given owner (e.g. client public key)
+// If the owner released an IP within the sticky TTL, that same IP is returned
+func (a *Allocator) AllocateIPForOwner(owner string, existingUsers []UserIPInfo) (string, error) {
+	a.mu.Lock()
+	a.purgeExpiredHolds()
+
+	for ip, hold := range a.held {
+		if owner == "" || hold.owner != owner || isAssigned(ip, existingUsers) {
+			continue
+		}
+
+		// Reclaim the held IP for its previous owner
+		delete(a.held, ip)
+		if a.allocatedIPs != nil {
+			a.allocatedIPs[ip] = true
+		}
+		a.stats.TotalAllocations++
+		a.stats.LastAllocationTime = a.now()
+		a.mu.Unlock()
+		return a.hostCIDR(ip), nil
+	}
+	a.mu.Unlock()
+
+	return a.AllocateIP(existingUsers)
+}
+
+// ReleaseIP returns an IP to the pool, honouring the sticky TTL if configured
+// Accepts plain or CIDR form (e.g. "10.0.0.5" or "10.0.0.5/32")
+func (a *Allocator) ReleaseIP(ip string) error {
+	return a.ReleaseIPForOwner(ip, "")
+}
+
+// ReleaseIPForOwner releases an IP and remembers its owner so that
+// AllocateIPForOwner can hand the same IP back within the sticky TTL
+// Once allocations are tracked, releasing an IP that isn't allocated fails with ErrIPNotAllocated
+func (a *Allocator) ReleaseIPForOwner(ip string, owner string) error {
+	parsed := parseAssignedIP(ip)
+	if parsed == nil {
+		return fmt.Errorf("invalid IP %s", ip)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if !a.isIPInRange(parsed) {
+		return fmt.Errorf("IP %s not in allocation range %s-%s", parsed, a.startIP, a.endIP)
+	}
+	if a.isReserved(parsed) {
+		return fmt.Errorf("IP %s is reserved: %w", parsed, ErrIPNotAllocated)
+	}
+	if a.tracked && !a.allocatedIPs[parsed.String()] {
+		return fmt.Errorf("IP %s: %w", parsed, ErrIPNotAllocated)
+	}
+
+	if a.allocatedIPs != nil {
+		delete(a.allocatedIPs, parsed.String())
+	}
+	if a.lastAllocated != nil && a.lastAllocated.Equal(parsed) {
+		// Step back so lastAllocated names an IP that is still handed out
+		decrementIP(a.lastAllocated)
+	}
+
+	if a.stickyTTL > 0 {
+		a.held[parsed.String()] = heldIP{owner: owner, releasedAt: a.now()}
+	}
+
+	return nil
+}
+
+// markReserved flags the gateway, server IP and service IPs as taken in an allocation map
+func (a *Allocator) markReserved(allocated map[string]bool) {
+	for _, ip := range a.reserved {
+		allocated[ip] = true
+	}
+}
+
+// ServiceIPs returns the service addresses kept out of allocation, in configuration order
+func (a *Allocator) ServiceIPs() []string {
+	return slices.Clone(a.services)
+}
+
+// isReserved reports whether ip is the gateway, server IP or a service IP
+func (a *Allocator) isReserved(ip net.IP) bool {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	for _, reserved := range a.reserved {
+		if reserved == ip.String() {
+			return true
+		}
+	}
+	return false
+}
+
+// isHeld reports whether an IP is still within its sticky hold period
+func (a *Allocator) isHeld(ip string) bool {
+	hold, exists := a.held[ip]
+	return exists && a.now().Sub(hold.releasedAt) < a.stickyTTL
+}
+
+// purgeExpiredHolds returns IPs whose sticky TTL elapsed to the free pool
+func (a *Allocator) purgeExpiredHolds() {
+	for ip, hold := range a.held {
+		if a.now().Sub(hold.releasedAt) >= a.stickyTTL {
+			delete(a.held, ip)
+		}
+	}
+}
+
+// parseAssignedIP parses an IP in plain or CIDR form, returning nil if invalid
+func parseAssignedIP(assignedIP string) net.IP {
+	ip, _, err := net.ParseCIDR(assignedIP)
+	if err != nil {
+		ip = net.ParseIP(assignedIP)
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4
+	}
+	return ip
+}
+
+// isAssigned reports whether any existing user holds the given IP
+func isAssigned(ip string, existingUsers []UserIPInfo) bool {
+	for _, user := range existingUsers {
+		if assigned := parseAssignedIP(user.GetAssignedIP()); assigned != nil && assigned.String() == ip {
+			return true
+		}
+	}
+	return false
+}
+
 // allocateIPOptimized uses tracking for O(1) allocation performance
 func (a *Allocator) allocateIPOptimized(existingUsers []UserIPInfo) (string, error) {
 	// Update our tracking from existing users
@@ -153,7 +366,7 @@ func (a *Allocator) allocateIPOptimized(existingUsers []UserIPInfo) (string, err
 	copy(ip, a.startIP)
 
 	// Calculate max attempts based on actual IP range size
-	maxAttempts := int(a.endIP[len(a.endIP)-1] - a.startIP[len(a.startIP)-1] + 1)
+	maxAttempts := rangeSize(a.startIP, a.endIP)
 	for attempts := 0; attempts < maxAttempts; attempts++ {
 		// Check if we've reached the end
 		if !a.isIPInRange(ip) {
@@ -161,18 +374,18 @@ func (a *Allocator) allocateIPOptimized(existingUsers []UserIPInfo) (string, err
 		}
 
 		// Check if IP is available
-		if !a.allocatedIPs[ip.String()] {
+		if !a.allocatedIPs[ip.String()] && !a.isHeld(ip.String()) {
 			// Found free IP - update tracking and return
 			a.allocatedIPs[ip.String()] = true
 			copy(a.lastAllocated, ip)
-			return fmt.Sprintf("%s/32", ip.String()), nil
+			return a.hostCIDR(ip.String()), nil
 		}
 
 		// Increment to next IP
 		incrementIP(ip)
 	}
 
-	return "", fmt.Errorf("no available IPs in range %s-%s", a.startIP, a.endIP)
+	return "", fmt.Errorf("%w in range %s-%s", ErrNoAvailableIPs, a.startIP, a.endIP)
 }
 
 // allocateIPLinear is the original linear search implementation
@@ -194,8 +407,8 @@ func (a *Allocator) allocateIPLinear(existingUsers []UserIPInfo) (string, error)
 		}
 	}
 
-	// Also mark gateway as allocated
-	allocated[a.gateway.String()] = true
+	// Also mark gateway and server IP as allocated
+	a.markReserved(allocated)
 
 	// Linear search for next free IP
 	ip := make(net.IP, len(a.startIP))
@@ -208,22 +421,22 @@ func (a *Allocator) allocateIPLinear(existingUsers []UserIPInfo) (string, error)
 		}
 
 		// Skip if already allocated
-		if !allocated[ip.String()] {
-			// Found free IP - return in /32 CIDR format for client
-			return fmt.Sprintf("%s/32", ip.String()), nil
+		if !allocated[ip.String()] && !a.isHeld(ip.String()) {
+			// Found free IP - return in host CIDR format for client
+			return a.hostCIDR(ip.String()), nil
 		}
 
 		// Increment to next IP
 		incrementIP(ip)
 	}
 
-	return "", fmt.Errorf("no available IPs in range %s-%s", a.startIP, a.endIP)
+	return "", fmt.Errorf("%w in range %s-%s", ErrNoAvailableIPs, a.startIP, a.endIP)
 }
 
 // updateAllocatedIPs updates the internal tracking from existing users
 func (a *Allocator) updateAllocatedIPs(existingUsers []UserIPInfo) {
 	// Only recreate map if size changed significantly to avoid unnecessary allocations
-	expectedSize := len(existingUsers) + 1 // +1 for gateway
+	expectedSize := len(existingUsers) + len(a.reserved)
 	if len(a.allocatedIPs) == 0 || len(a.allocatedIPs) < expectedSize/2 || len(a.allocatedIPs) > expectedSize*2 {
 		a.allocatedIPs = make(map[string]bool, expectedSize)
 	} else {
@@ -233,8 +446,8 @@ func (a *Allocator) updateAllocatedIPs(existingUsers []UserIPInfo) {
 		}
 	}
 
-	// Always ensure gateway is marked as allocated
-	a.allocatedIPs[a.gateway.String()] = true
+	// Always ensure gateway and server IP are marked as allocated
+	a.markReserved(a.allocatedIPs)
 
 	// Add existing users
 	for _, user := range existingUsers {
@@ -248,9 +461,12 @@ func (a *Allocator) updateAllocatedIPs(existingUsers []UserIPInfo) {
 			}
 		}
 	}
+	a.tracked = true
 }
 
 // IsIPAvailable checks if a specific IP is available for allocation
+// Once allocations are tracked a map lookup rejects handed-out IPs without scanning
+// existingUsers; IPs held by existingUsers or for a previous owner are never available
 func (a *Allocator) IsIPAvailable(targetIP string, existingUsers []UserIPInfo) bool {
 	// Parse target IP
 	ip := net.ParseIP(targetIP)
@@ -258,50 +474,63 @@ func (a *Allocator) IsIPAvailable(targetIP string, existingUsers []UserIPInfo) b
 		return false
 	}
 
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
 	// Check if IP is in our allocation range
 	if !a.isIPInRange(ip) {
 		return false
 	}
 
-	// Check if IP is gateway
-	if ip.Equal(a.gateway) {
+	// Check if IP is the gateway or server IP
+	if a.isReserved(ip) {
 		return false
 	}
 
-	// Use optimized lookup if available
-	if a.allocatedIPs != nil {
-		// Build a temporary map for this check to avoid race conditions
-		allocated := make(map[string]bool)
-		allocated[a.gateway.String()] = true
-
-		for _, user := range existingUsers {
-			if assignedIP := user.GetAssignedIP(); assignedIP != "" {
-				userIP, _, err := net.ParseCIDR(assignedIP)
-				if err != nil {
-					userIP = net.ParseIP(assignedIP)
-				}
-				if userIP != nil {
-					allocated[userIP.String()] = true
-				}
-			}
-		}
-		return !allocated[ip.String()]
+	return a.isUnassigned(ip, existingUsers)
+}
+
+// isUnassigned reports whether no one holds ip, including a sticky hold; callers must hold a.mu
+// Tracked allocations answer from the map first, existingUsers covers IPs the tracking missed
+func (a *Allocator) isUnassigned(ip net.IP, existingUsers []UserIPInfo) bool {
+	if a.isHeld(ip.String()) {
+		return false
 	}
+	if a.tracked && a.allocatedIPs[ip.String()] {
+		return false
+	}
+	return !isAssigned(ip.String(), existingUsers)
+}
 
-	// Fallback to linear search
-	for _, user := range existingUsers {
-		if assignedIP := user.GetAssignedIP(); assignedIP != "" {
-			userIP, _, err := net.ParseCIDR(assignedIP)
-			if err != nil {
-				userIP = net.ParseIP(assignedIP)
-			}
-			if userIP != nil && userIP.Equal(ip) {
-				return false
-			}
-		}
+// AllocateSpecificIP claims requested instead of the next free IP, e.g. to keep a restored
+// peer's address stable; it fails with ErrIPAlreadyAllocated if existingUsers or a hold has it
+// Returns the IP in host CIDR format (e.g., "10.0.0.5/32")
+func (a *Allocator) AllocateSpecificIP(requested string, existingUsers []UserIPInfo) (string, error) {
+	ip := parseAssignedIP(requested)
+	if ip == nil {
+		return "", fmt.Errorf("invalid IP %s", requested)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if !a.isIPInRange(ip) {
+		return "", fmt.Errorf("IP %s not in allocation range %s-%s", ip, a.startIP, a.endIP)
+	}
+	if a.isReserved(ip) {
+		return "", fmt.Errorf("IP %s is reserved", ip)
+	}
+	if !a.isUnassigned(ip, existingUsers) {
+		a.stats.FailedAllocations++
+		return "", fmt.Errorf("%w: %s", ErrIPAlreadyAllocated, ip)
 	}
 
-	return true
+	if a.allocatedIPs != nil {
+		a.allocatedIPs[ip.String()] = true
+	}
+	a.stats.TotalAllocations++
+	a.stats.LastAllocationTime = a.now()
+	return a.hostCIDR(ip.String()), nil
 }
 
 // GetNetworkInfo returns information about the allocation network
@@ -310,9 +539,14 @@ func (a *Allocator) GetNetworkInfo() NetworkInfo {
 	defer a.mu.RUnlock()
 
 	return NetworkInfo{
-		CIDR:    a.cidr.String(),
-		Gateway: a.gateway.String(),
-		Range:   fmt.Sprintf("%s-%s", a.startIP, a.endIP),
+		CIDR:        a.cidr.String(),
+		Family:      a.family(),
+		Gateway:     a.gateway.String(),
+		Range:       fmt.Sprintf("%s-%s", a.startIP, a.endIP),
+		StartIP:     a.startIP.String(),
+		EndIP:       a.endIP.String(),
+		UsableCount: a.capacity(),
+		ServiceIPs:  a.ServiceIPs(),
 	}
 }
 
@@ -333,23 +567,115 @@ func (a *Allocator) ResetStats() {
 	a.stats = &AllocationStats{}
 }
 
+// Contains reports whether ip (plain or CIDR form) belongs to this allocator's network
+func (a *Allocator) Contains(ip string) bool {
+	parsed := parseAssignedIP(ip)
+	return parsed != nil && a.cidr.Contains(parsed)
+}
+
+// Capacity returns how many addresses can be handed to clients
+// IPv6 ranges larger than math.MaxInt32 addresses are reported at that cap
+func (a *Allocator) Capacity() int {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	return a.capacity()
+}
+
+// capacity counts the allocatable addresses; callers must hold a.mu
+func (a *Allocator) capacity() int {
+	capacity := rangeSize(a.startIP, a.endIP)
+	for _, reserved := range a.reserved {
+		if a.isIPInRange(net.ParseIP(reserved)) {
+			capacity--
+		}
+	}
+	return capacity
+}
+
+// family reports whether the allocator hands out IPv4 or IPv6 addresses
+func (a *Allocator) family() string {
+	if len(a.startIP) == net.IPv4len {
+		return FamilyIPv4
+	}
+	return FamilyIPv6
+}
+
+// hostCIDR formats ip as a single-host prefix of the allocator's family
+func (a *Allocator) hostCIDR(ip string) string {
+	if a.family() == FamilyIPv6 {
+		return ip + "/128"
+	}
+	return ip + "/32"
+}
+
+// countAssigned returns how many existing users hold an allocatable address of this allocator
+func (a *Allocator) countAssigned(existingUsers []UserIPInfo) int {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	used := make(map[string]bool)
+	for _, user := range existingUsers {
+		ip := parseAssignedIP(user.GetAssignedIP())
+		if ip != nil && a.isIPInRange(ip) && !a.isReserved(ip) {
+			used[ip.String()] = true
+		}
+	}
+	return len(used)
+}
+
 // NetworkInfo provides network configuration details
 type NetworkInfo struct {
 	CIDR    string // Network CIDR (e.g., "10.0.0.0/24")
+	Family  string // FamilyIPv4 or FamilyIPv6
 	Gateway string // Gateway IP (e.g., "10.0.0.1")
 	Range   string // Allocation range (e.g., "10.0.0.2-10.0.0.254")
+
+	StartIP     string // First address of Range
+	EndIP       string // Last address of Range
+	UsableCount int    // Addresses clients can be given: Range minus reserved addresses
+
+	ServiceIPs []string // Addresses of services inside the VPN (e.g., DNS), excluded from allocation
 }
 
 // isIPInRange checks if an IP is within the allocation range
 func (a *Allocator) isIPInRange(ip net.IP) bool {
-	// Quick bounds check on last octet for performance
-	lastOctet := ip[len(ip)-1]
-	if lastOctet < a.startIP[len(a.startIP)-1] || lastOctet > a.endIP[len(a.endIP)-1] {
+	if len(a.startIP) == net.IPv4len {
+		if ip = ip.To4(); ip == nil {
+			return false
+		}
+	} else if ip = ip.To16(); ip == nil {
 		return false
 	}
+	return bytes.Compare(ip, a.startIP) >= 0 && bytes.Compare(ip, a.endIP) <= 0
+}
+
+// hostRange returns the first and last usable host of cidr
+// The network address is skipped, and for IPv4 the broadcast address too
+func hostRange(cidr *net.IPNet) (net.IP, net.IP) {
+	first := make(net.IP, len(cidr.IP))
+	copy(first, cidr.IP)
+	incrementIP(first)
+
+	last := make(net.IP, len(cidr.IP))
+	for i := range last {
+		last[i] = cidr.IP[i] | ^cidr.Mask[i]
+	}
+	if len(last) == net.IPv4len {
+		decrementIP(last)
+	}
+	return first, last
+}
 
-	return a.cidr.Contains(ip) &&
-		!ip.Equal(a.startIP.Mask(a.cidr.Mask)) // Not network address
+// rangeSize returns how many addresses lie between start and end inclusive, capped at math.MaxInt32
+// Only the low 64 bits are compared, which covers every IPv4 range and IPv6 ranges up to a /64
+func rangeSize(start, end net.IP) int {
+	var from, to uint64
+	for i := max(len(start)-8, 0); i < len(start); i++ {
+		from = from<<8 | uint64(start[i])
+		to = to<<8 | uint64(end[i])
+	}
+	return int(min(to-from, math.MaxInt32-1) + 1)
 }
 
 // incrementIP increments an IP address by 1
@@ -362,6 +688,16 @@ func incrementIP(ip net.IP) {
 	}
 }
 
+// decrementIP decrements an IP address by 1
+func decrementIP(ip net.IP) {
+	for i := len(ip) - 1; i >= 0; i-- {
+		ip[i]--
+		if ip[i] != 0xff {
+			break
+		}
+	}
+}
+
 // SimpleUser is a minimal implementation of UserIPInfo for testing
 type SimpleUser struct {
 	AssignedIP string
@@ -1,7 +1,11 @@
 package ipam
 
 import (
+	"errors"
 	"fmt"
+	"net"
+	"slices"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -53,6 +57,33 @@ func TestNewAllocator(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "server IP in CIDR form",
+			config: Config{
+				CIDR:     "10.0.0.0/24",
+				Gateway:  "10.0.0.1",
+				ServerIP: "10.0.0.10/24",
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid server IP",
+			config: Config{
+				CIDR:     "10.0.0.0/24",
+				Gateway:  "10.0.0.1",
+				ServerIP: "not-an-ip",
+			},
+			wantErr: true,
+		},
+		{
+			name: "server IP outside CIDR",
+			config: Config{
+				CIDR:     "10.0.0.0/24",
+				Gateway:  "10.0.0.1",
+				ServerIP: "10.1.0.1/24",
+			},
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -131,7 +162,7 @@ func TestAllocateIP(t *testing.T) {
 
 func TestAllocateIP_Exhaustion(t *testing.T) {
 	allocator, err := NewAllocator(Config{
-		CIDR:    "10.0.0.0/30", // Only 4 IPs: .0 (network), .1 (gateway), .2, .3
+		CIDR:    "10.0.0.0/29", // 8 IPs: .0 (network), .1 (gateway), .2-.6, .7 (broadcast)
 		Gateway: "10.0.0.1",
 	})
 	if err != nil {
@@ -140,12 +171,15 @@ func TestAllocateIP_Exhaustion(t *testing.T) {
 
 	var users []UserIPInfo
 
-	// Allocate all available IPs (.2 and .3)
-	for i := 0; i < 2; i++ {
+	// Allocate all available IPs (.2 to .6)
+	for i := 0; i < 5; i++ {
 		ip, err := allocator.AllocateIP(users)
 		if err != nil {
 			t.Fatalf("AllocateIP() allocation %d failed: %v", i, err)
 		}
+		if ip == "10.0.0.7/32" {
+			t.Fatal("AllocateIP() handed out the broadcast address")
+		}
 		users = append(users, SimpleUser{AssignedIP: ip})
 	}
 
@@ -156,6 +190,99 @@ func TestAllocateIP_Exhaustion(t *testing.T) {
 	}
 }
 
+func TestServerIPExcluded(t *testing.T) {
+	for _, optimized := range []bool{true, false} {
+		t.Run(fmt.Sprintf("optimized=%v", optimized), func(t *testing.T) {
+			allocator, err := NewAllocator(Config{
+				CIDR:                "10.0.0.0/24",
+				Gateway:             "10.0.0.1",
+				ServerIP:            "10.0.0.3/24",
+				EnableOptimizations: optimized,
+			})
+			if err != nil {
+				t.Fatalf("NewAllocator() failed: %v", err)
+			}
+
+			if allocator.IsIPAvailable("10.0.0.3", nil) {
+				t.Error("Server IP 10.0.0.3 should not be available")
+			}
+
+			var users []UserIPInfo
+			for {
+				ip, err := allocator.AllocateIP(users)
+				if err != nil {
+					break
+				}
+				if ip == "10.0.0.3/32" {
+					t.Fatalf("Allocated server IP %s", ip)
+				}
+				users = append(users, SimpleUser{AssignedIP: ip})
+			}
+
+			// .2-.254 minus the server IP
+			if len(users) != 252 {
+				t.Errorf("Expected 252 allocations, got %d", len(users))
+			}
+		})
+	}
+}
+
+func TestServiceIPsExcluded(t *testing.T) {
+	for _, optimized := range []bool{true, false} {
+		t.Run(fmt.Sprintf("optimized=%v", optimized), func(t *testing.T) {
+			allocator, err := NewAllocator(Config{
+				CIDR:                "10.0.0.0/24",
+				Gateway:             "10.0.0.1",
+				ServiceIPs:          []string{"10.0.0.53", "10.0.0.2", "10.0.0.53"},
+				EnableOptimizations: optimized,
+			})
+			if err != nil {
+				t.Fatalf("NewAllocator() failed: %v", err)
+			}
+
+			if got := allocator.ServiceIPs(); !slices.Equal(got, []string{"10.0.0.53", "10.0.0.2"}) {
+				t.Errorf("ServiceIPs() = %v, want [10.0.0.53 10.0.0.2]", got)
+			}
+			if got := allocator.GetNetworkInfo().ServiceIPs; !slices.Equal(got, allocator.ServiceIPs()) {
+				t.Errorf("Network info advertises %v, want %v", got, allocator.ServiceIPs())
+			}
+			if allocator.IsIPAvailable("10.0.0.53", nil) {
+				t.Error("Service IP 10.0.0.53 should not be available")
+			}
+
+			var users []UserIPInfo
+			for {
+				ip, err := allocator.AllocateIP(users)
+				if err != nil {
+					break
+				}
+				if ip == "10.0.0.2/32" || ip == "10.0.0.53/32" {
+					t.Fatalf("Allocated service IP %s", ip)
+				}
+				users = append(users, SimpleUser{AssignedIP: ip})
+			}
+
+			// .2-.254 minus the two service IPs
+			if len(users) != 251 || allocator.Capacity() != 251 {
+				t.Errorf("Expected 251 allocations and capacity, got %d and %d", len(users), allocator.Capacity())
+			}
+		})
+	}
+
+	t.Run("outside the network", func(t *testing.T) {
+		_, err := NewAllocator(Config{CIDR: "10.0.0.0/24", Gateway: "10.0.0.1", ServiceIPs: []string{"10.1.0.53"}})
+		if err == nil || !strings.Contains(err.Error(), "not in CIDR") {
+			t.Errorf("Expected an out-of-network error, got %v", err)
+		}
+	})
+
+	t.Run("invalid address", func(t *testing.T) {
+		if _, err := NewAllocator(Config{CIDR: "10.0.0.0/24", Gateway: "10.0.0.1", ServiceIPs: []string{"dns"}}); err == nil {
+			t.Error("Expected an error for an invalid service IP")
+		}
+	})
+}
+
 func TestIsIPAvailable(t *testing.T) {
 	allocator, err := NewAllocator(DefaultConfig())
 	if err != nil {
@@ -209,6 +336,9 @@ func TestGetNetworkInfo(t *testing.T) {
 	if info.Range != "10.0.0.2-10.0.0.254" {
 		t.Errorf("GetNetworkInfo().Range = %v, want 10.0.0.2-10.0.0.254", info.Range)
 	}
+	if info.Family != FamilyIPv4 {
+		t.Errorf("GetNetworkInfo().Family = %v, want %v", info.Family, FamilyIPv4)
+	}
 }
 
 func TestConcurrentAllocation(t *testing.T) {
@@ -357,6 +487,33 @@ func BenchmarkAllocateIP(b *testing.B) {
 	}
 }
 
+func BenchmarkIsIPAvailable(b *testing.B) {
+	for _, seeded := range []bool{false, true} {
+		b.Run(fmt.Sprintf("tracked=%v", seeded), func(b *testing.B) {
+			allocator, err := NewAllocator(DefaultConfig())
+			if err != nil {
+				b.Fatalf("NewAllocator() failed: %v", err)
+			}
+
+			var users []UserIPInfo
+			for i := 0; i < 200; i++ {
+				ip, err := allocator.AllocateIP(users)
+				if err != nil {
+					b.Fatalf("AllocateIP() failed: %v", err)
+				}
+				users = append(users, SimpleUser{AssignedIP: ip})
+			}
+			allocator.tracked = seeded
+
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				allocator.IsIPAvailable("10.0.0.250", users)
+			}
+		})
+	}
+}
+
 // TestOptimizedAllocation tests the performance optimizations
 func TestOptimizedAllocation(t *testing.T) {
 	config := DefaultConfig()
@@ -484,6 +641,114 @@ func TestOptimizedIsIPAvailable(t *testing.T) {
 	}
 }
 
+// TestTrackedIsIPAvailableMatchesUserScan checks the tracked lookup against scanning the user list
+func TestTrackedIsIPAvailableMatchesUserScan(t *testing.T) {
+	config := DefaultConfig()
+	config.ServerIP = "10.0.0.10/24"
+
+	tracked, err := NewAllocator(config)
+	if err != nil {
+		t.Fatalf("NewAllocator() failed: %v", err)
+	}
+
+	var users []UserIPInfo
+	for i := 0; i < 60; i++ {
+		ip, err := tracked.AllocateIP(users)
+		if err != nil {
+			t.Fatalf("AllocateIP() failed: %v", err)
+		}
+		users = append(users, SimpleUser{AssignedIP: ip})
+	}
+
+	// Release every third client the way the server does: drop the peer, then the IP
+	var remaining []UserIPInfo
+	for i, user := range users {
+		if i%3 != 0 {
+			remaining = append(remaining, user)
+			continue
+		}
+		if err := tracked.ReleaseIP(user.GetAssignedIP()); err != nil {
+			t.Fatalf("ReleaseIP() failed: %v", err)
+		}
+	}
+	if !tracked.tracked {
+		t.Fatal("Expected allocations to be tracked after AllocateIP")
+	}
+
+	// A fresh allocator has no tracking and answers from the user list
+	scan, err := NewAllocator(config)
+	if err != nil {
+		t.Fatalf("NewAllocator() failed: %v", err)
+	}
+
+	for i := 0; i < 256; i++ {
+		ip := fmt.Sprintf("10.0.0.%d", i)
+		if got, want := tracked.IsIPAvailable(ip, remaining), scan.IsIPAvailable(ip, remaining); got != want {
+			t.Errorf("IsIPAvailable(%s) = %v with tracking, %v from the user list", ip, got, want)
+		}
+	}
+}
+
+// TestIsIPAvailableTrackedMatchesUntracked checks that tracking only speeds up IsIPAvailable, never changes its answer
+func TestIsIPAvailableTrackedMatchesUntracked(t *testing.T) {
+	config := DefaultConfig()
+	config.StickyTTL = time.Minute
+
+	tracked, err := NewAllocator(config)
+	if err != nil {
+		t.Fatalf("NewAllocator() failed: %v", err)
+	}
+	untracked, err := NewAllocator(config)
+	if err != nil {
+		t.Fatalf("NewAllocator() failed: %v", err)
+	}
+
+	var users []UserIPInfo
+	for i := 0; i < 3; i++ {
+		ip, err := tracked.AllocateIP(users)
+		if err != nil {
+			t.Fatalf("AllocateIP() failed: %v", err)
+		}
+		users = append(users, SimpleUser{AssignedIP: ip})
+	}
+	if !tracked.tracked || untracked.tracked {
+		t.Fatal("Expected only the allocator that allocated to track allocations")
+	}
+
+	// Both allocators hold 10.0.0.4 for the peer that released it
+	for _, allocator := range []*Allocator{tracked, untracked} {
+		if err := allocator.ReleaseIPForOwner("10.0.0.4/32", "client-a"); err != nil {
+			t.Fatalf("ReleaseIPForOwner() failed: %v", err)
+		}
+	}
+	remaining := users[:2]
+
+	tests := []struct {
+		name  string
+		ip    string
+		users []UserIPInfo
+		want  bool
+	}{
+		{"free", "10.0.0.50", remaining, true},
+		{"assigned to a user", "10.0.0.2", remaining, false},
+		{"assigned outside the tracking", "10.0.0.60", []UserIPInfo{SimpleUser{AssignedIP: "10.0.0.60/32"}}, false},
+		{"held for its previous owner", "10.0.0.4", remaining, false},
+		{"gateway", "10.0.0.1", remaining, false},
+		{"out of range", "10.0.1.5", remaining, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tracked.IsIPAvailable(tt.ip, tt.users); got != tt.want {
+				t.Errorf("tracked IsIPAvailable(%s) = %v, want %v", tt.ip, got, tt.want)
+			}
+			if got := untracked.IsIPAvailable(tt.ip, tt.users); got != tt.want {
+				t.Errorf("untracked IsIPAvailable(%s) = %v, want %v", tt.ip, got, tt.want)
+			}
+		})
+	}
+}
+
 // TestBackwardCompatibility tests that the allocator works without optimizations
 func TestBackwardCompatibility(t *testing.T) {
 	config := DefaultConfig()
@@ -606,3 +871,461 @@ func TestConcurrentOptimizedAllocation(t *testing.T) {
 
 	t.Logf("All %d concurrent optimized allocations returned consistent result: %s", len(results), expectedIP)
 }
+
+func TestStickyReleaseTTL(t *testing.T) {
+	config := DefaultConfig()
+	config.StickyTTL = time.Minute
+
+	allocator, err := NewAllocator(config)
+	if err != nil {
+		t.Fatalf("NewAllocator() failed: %v", err)
+	}
+
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	allocator.now = func() time.Time { return now }
+
+	first, err := allocator.AllocateIPForOwner("client-a", nil)
+	if err != nil {
+		t.Fatalf("AllocateIPForOwner() failed: %v", err)
+	}
+	if first != "10.0.0.2/32" {
+		t.Fatalf("AllocateIPForOwner() = %v, want 10.0.0.2/32", first)
+	}
+
+	if err := allocator.ReleaseIPForOwner(first, "client-a"); err != nil {
+		t.Fatalf("ReleaseIPForOwner() failed: %v", err)
+	}
+
+	t.Run("held IP not reused within TTL", func(t *testing.T) {
+		now = now.Add(30 * time.Second)
+
+		ip, err := allocator.AllocateIPForOwner("client-b", nil)
+		if err != nil {
+			t.Fatalf("AllocateIPForOwner() failed: %v", err)
+		}
+		if ip == first {
+			t.Errorf("Held IP %s was reused for another client within TTL", ip)
+		}
+		if err := allocator.ReleaseIP(ip); err != nil {
+			t.Fatalf("ReleaseIP() failed: %v", err)
+		}
+	})
+
+	t.Run("previous owner reclaims IP within TTL", func(t *testing.T) {
+		ip, err := allocator.AllocateIPForOwner("client-a", nil)
+		if err != nil {
+			t.Fatalf("AllocateIPForOwner() failed: %v", err)
+		}
+		if ip != first {
+			t.Errorf("Reconnecting client got %s, want previous IP %s", ip, first)
+		}
+		if err := allocator.ReleaseIPForOwner(ip, "client-a"); err != nil {
+			t.Fatalf("ReleaseIPForOwner() failed: %v", err)
+		}
+	})
+
+	t.Run("IP returns to pool after TTL", func(t *testing.T) {
+		now = now.Add(2 * time.Minute)
+
+		ip, err := allocator.AllocateIPForOwner("client-c", nil)
+		if err != nil {
+			t.Fatalf("AllocateIPForOwner() failed: %v", err)
+		}
+		if ip != first {
+			t.Errorf("Expected expired hold %s to be reused, got %s", first, ip)
+		}
+	})
+}
+
+func TestAllocateIPPurgesExpiredHolds(t *testing.T) {
+	config := DefaultConfig()
+	config.StickyTTL = time.Minute
+
+	allocator, err := NewAllocator(config)
+	if err != nil {
+		t.Fatalf("NewAllocator() failed: %v", err)
+	}
+
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	allocator.now = func() time.Time { return now }
+
+	ip, err := allocator.AllocateIP(nil)
+	if err != nil {
+		t.Fatalf("AllocateIP() failed: %v", err)
+	}
+	if err := allocator.ReleaseIPForOwner(ip, "client-a"); err != nil {
+		t.Fatalf("ReleaseIPForOwner() failed: %v", err)
+	}
+
+	now = now.Add(2 * time.Minute)
+	reused, err := allocator.AllocateIP(nil)
+	if err != nil {
+		t.Fatalf("AllocateIP() failed: %v", err)
+	}
+	if reused != ip {
+		t.Errorf("Expected expired hold %s to be reused, got %s", ip, reused)
+	}
+	if len(allocator.held) != 0 {
+		t.Errorf("Expected expired holds to be purged, %d left", len(allocator.held))
+	}
+}
+
+func TestReleaseIPWithoutStickyTTL(t *testing.T) {
+	allocator, err := NewAllocator(DefaultConfig())
+	if err != nil {
+		t.Fatalf("NewAllocator() failed: %v", err)
+	}
+
+	ip, err := allocator.AllocateIP(nil)
+	if err != nil {
+		t.Fatalf("AllocateIP() failed: %v", err)
+	}
+
+	if err := allocator.ReleaseIP(ip); err != nil {
+		t.Fatalf("ReleaseIP() failed: %v", err)
+	}
+
+	reused, err := allocator.AllocateIP(nil)
+	if err != nil {
+		t.Fatalf("AllocateIP() failed: %v", err)
+	}
+	if reused != ip {
+		t.Errorf("Expected released IP %s to be reused immediately, got %s", ip, reused)
+	}
+
+	if err := allocator.ReleaseIP("192.168.1.5"); err == nil {
+		t.Error("Expected error releasing IP outside allocation range")
+	}
+	if err := allocator.ReleaseIP("not-an-ip"); err == nil {
+		t.Error("Expected error releasing invalid IP")
+	}
+}
+
+func TestReleaseIPNotAllocated(t *testing.T) {
+	config := DefaultConfig()
+	config.ServiceIPs = []string{"10.0.0.53"}
+	allocator, err := NewAllocator(config)
+	if err != nil {
+		t.Fatalf("NewAllocator() failed: %v", err)
+	}
+
+	first, err := allocator.AllocateIP(nil)
+	if err != nil {
+		t.Fatalf("AllocateIP() failed: %v", err)
+	}
+	second, err := allocator.AllocateIP([]UserIPInfo{SimpleUser{AssignedIP: first}})
+	if err != nil {
+		t.Fatalf("AllocateIP() failed: %v", err)
+	}
+
+	for _, ip := range []string{"10.0.0.50", "10.0.0.53"} {
+		if err := allocator.ReleaseIP(ip); !errors.Is(err, ErrIPNotAllocated) {
+			t.Errorf("ReleaseIP(%s) = %v, want ErrIPNotAllocated", ip, err)
+		}
+	}
+
+	if err := allocator.ReleaseIP(second); err != nil {
+		t.Fatalf("ReleaseIP() failed: %v", err)
+	}
+	if got := allocator.lastAllocated.String(); got != parseAssignedIP(first).String() {
+		t.Errorf("lastAllocated = %s after releasing the newest IP, want %s", got, first)
+	}
+	if err := allocator.ReleaseIP(second); !errors.Is(err, ErrIPNotAllocated) {
+		t.Errorf("Releasing %s twice = %v, want ErrIPNotAllocated", second, err)
+	}
+	if !allocator.IsIPAvailable(parseAssignedIP(second).String(), nil) {
+		t.Errorf("Expected %s to be available after release", second)
+	}
+}
+
+func TestAllocatorLargeCIDR(t *testing.T) {
+	tests := []struct {
+		name      string
+		cidr      string
+		gateway   string
+		wantRange string
+		capacity  int
+	}{
+		{name: "/16", cidr: "10.8.0.0/16", gateway: "10.8.0.1", wantRange: "10.8.0.2-10.8.255.254", capacity: 65533},
+		{name: "/22", cidr: "10.4.0.0/22", gateway: "10.4.0.1", wantRange: "10.4.0.2-10.4.3.254", capacity: 1021},
+		{name: "/22 gateway at the top", cidr: "10.4.0.0/22", gateway: "10.4.3.254", wantRange: "10.4.0.1-10.4.3.254", capacity: 1021},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			allocator, err := NewAllocator(Config{CIDR: tt.cidr, Gateway: tt.gateway, EnableOptimizations: true})
+			if err != nil {
+				t.Fatalf("NewAllocator() failed: %v", err)
+			}
+			if got := allocator.GetNetworkInfo().Range; got != tt.wantRange {
+				t.Errorf("Range = %s, want %s", got, tt.wantRange)
+			}
+			if got := allocator.Capacity(); got != tt.capacity {
+				t.Errorf("Capacity() = %d, want %d", got, tt.capacity)
+			}
+		})
+	}
+
+	t.Run("allocation crosses octet boundaries", func(t *testing.T) {
+		allocator, err := NewAllocator(Config{CIDR: "10.4.0.0/22", Gateway: "10.4.0.1", EnableOptimizations: true})
+		if err != nil {
+			t.Fatalf("NewAllocator() failed: %v", err)
+		}
+
+		// Every address but the network, gateway and broadcast, spilling into .1.x, .2.x and .3.x
+		var users []UserIPInfo
+		seen := make(map[string]bool)
+		for i := 0; i < 1021; i++ {
+			ip, err := allocator.AllocateIP(users)
+			if err != nil {
+				t.Fatalf("AllocateIP() allocation %d failed: %v", i, err)
+			}
+			if seen[ip] {
+				t.Fatalf("AllocateIP() returned %s twice", ip)
+			}
+			seen[ip] = true
+			users = append(users, SimpleUser{AssignedIP: ip})
+		}
+		for _, ip := range []string{"10.4.1.0/32", "10.4.1.255/32", "10.4.3.254/32"} {
+			if !seen[ip] {
+				t.Errorf("Expected %s to be allocated", ip)
+			}
+		}
+		for _, ip := range []string{"10.4.0.0/32", "10.4.0.1/32", "10.4.3.255/32"} {
+			if seen[ip] {
+				t.Errorf("%s must never be allocated", ip)
+			}
+		}
+		if _, err := allocator.AllocateIP(users); !errors.Is(err, ErrNoAvailableIPs) {
+			t.Errorf("Expected ErrNoAvailableIPs once the /22 is full, got %v", err)
+		}
+	})
+
+	t.Run("range checks span octets", func(t *testing.T) {
+		allocator, err := NewAllocator(Config{CIDR: "10.8.0.0/16", Gateway: "10.8.0.1"})
+		if err != nil {
+			t.Fatalf("NewAllocator() failed: %v", err)
+		}
+		for ip, want := range map[string]bool{
+			"10.8.0.0":     false, // Network
+			"10.8.0.255":   true,
+			"10.8.1.0":     true,
+			"10.8.200.17":  true,
+			"10.8.255.254": true,
+			"10.8.255.255": false, // Broadcast
+			"10.9.0.2":     false,
+		} {
+			if got := allocator.IsIPAvailable(ip, nil); got != want {
+				t.Errorf("IsIPAvailable(%s) = %v, want %v", ip, got, want)
+			}
+		}
+	})
+
+	t.Run("too small", func(t *testing.T) {
+		if _, err := NewAllocator(Config{CIDR: "10.0.0.0/31", Gateway: "10.0.0.1"}); err == nil {
+			t.Error("Expected error for a CIDR with no allocatable addresses")
+		}
+	})
+}
+
+func TestAllocateIPv6(t *testing.T) {
+	for _, optimized := range []bool{true, false} {
+		t.Run(fmt.Sprintf("optimized=%v", optimized), func(t *testing.T) {
+			allocator, err := NewAllocator(Config{CIDR: "fd00::/64", Gateway: "fd00::1", EnableOptimizations: optimized})
+			if err != nil {
+				t.Fatalf("NewAllocator() failed: %v", err)
+			}
+
+			info := allocator.GetNetworkInfo()
+			if info.Family != FamilyIPv6 {
+				t.Errorf("GetNetworkInfo().Family = %v, want %v", info.Family, FamilyIPv6)
+			}
+			if info.Range != "fd00::2-fd00::ffff:ffff:ffff:ffff" {
+				t.Errorf("GetNetworkInfo().Range = %v", info.Range)
+			}
+
+			var users []UserIPInfo
+			for _, want := range []string{"fd00::2/128", "fd00::3/128", "fd00::4/128"} {
+				ip, err := allocator.AllocateIP(users)
+				if err != nil {
+					t.Fatalf("AllocateIP() failed: %v", err)
+				}
+				if ip != want {
+					t.Errorf("AllocateIP() = %v, want %v", ip, want)
+				}
+				users = append(users, SimpleUser{AssignedIP: ip})
+			}
+
+			if allocator.IsIPAvailable("fd00::3", users) {
+				t.Error("Expected fd00::3 to be taken")
+			}
+			if allocator.IsIPAvailable("fd00::1", users) || allocator.IsIPAvailable("fd00::", users) {
+				t.Error("The gateway and all-zero address must not be available")
+			}
+			if allocator.IsIPAvailable("10.0.0.5", users) {
+				t.Error("An IPv4 address must not be available in an IPv6 range")
+			}
+		})
+	}
+
+	t.Run("exhaustion on a /126", func(t *testing.T) {
+		// fd00::0 (all-zero), fd00::1 (gateway), fd00::2, fd00::3; IPv6 has no broadcast
+		allocator, err := NewAllocator(Config{CIDR: "fd00::/126", Gateway: "fd00::1", EnableOptimizations: true})
+		if err != nil {
+			t.Fatalf("NewAllocator() failed: %v", err)
+		}
+		if got := allocator.Capacity(); got != 2 {
+			t.Errorf("Capacity() = %d, want 2", got)
+		}
+
+		var users []UserIPInfo
+		for _, want := range []string{"fd00::2/128", "fd00::3/128"} {
+			ip, err := allocator.AllocateIP(users)
+			if err != nil {
+				t.Fatalf("AllocateIP() failed: %v", err)
+			}
+			if ip != want {
+				t.Errorf("AllocateIP() = %v, want %v", ip, want)
+			}
+			users = append(users, SimpleUser{AssignedIP: ip})
+		}
+
+		if _, err := allocator.AllocateIP(users); !errors.Is(err, ErrNoAvailableIPs) {
+			t.Errorf("Expected ErrNoAvailableIPs, got %v", err)
+		}
+		if err := allocator.ReleaseIP("fd00::3/128"); err != nil {
+			t.Fatalf("ReleaseIP() failed: %v", err)
+		}
+		if ip, err := allocator.AllocateIP(users[:1]); err != nil || ip != "fd00::3/128" {
+			t.Errorf("AllocateIP() after release = %v, %v, want fd00::3/128", ip, err)
+		}
+	})
+
+	t.Run("increment carries across 16-bit groups", func(t *testing.T) {
+		ip := net.ParseIP("fd00::ffff")
+		incrementIP(ip)
+		if ip.String() != "fd00::1:0" {
+			t.Errorf("incrementIP(fd00::ffff) = %s, want fd00::1:0", ip)
+		}
+	})
+}
+
+func TestNetworkInfoFields(t *testing.T) {
+	tests := []struct {
+		cidr    string
+		gateway string
+		start   string
+		end     string
+		usable  int
+	}{
+		{cidr: "10.0.0.0/24", gateway: "10.0.0.1", start: "10.0.0.2", end: "10.0.0.254", usable: 253},
+		{cidr: "10.4.0.0/22", gateway: "10.4.0.1", start: "10.4.0.2", end: "10.4.3.254", usable: 1021},
+		{cidr: "10.8.0.0/16", gateway: "10.8.0.1", start: "10.8.0.2", end: "10.8.255.254", usable: 65533},
+		{cidr: "10.0.0.0/29", gateway: "10.0.0.1", start: "10.0.0.2", end: "10.0.0.6", usable: 5},
+		{cidr: "10.0.0.0/30", gateway: "10.0.0.1", start: "10.0.0.2", end: "10.0.0.2", usable: 1},
+		{cidr: "fd00::/126", gateway: "fd00::1", start: "fd00::2", end: "fd00::3", usable: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cidr, func(t *testing.T) {
+			allocator, err := NewAllocator(Config{CIDR: tt.cidr, Gateway: tt.gateway})
+			if err != nil {
+				t.Fatalf("NewAllocator() failed: %v", err)
+			}
+
+			info := allocator.GetNetworkInfo()
+			if info.StartIP != tt.start || info.EndIP != tt.end {
+				t.Errorf("StartIP-EndIP = %s-%s, want %s-%s", info.StartIP, info.EndIP, tt.start, tt.end)
+			}
+			if info.Range != tt.start+"-"+tt.end {
+				t.Errorf("Range = %s, want it to match StartIP and EndIP", info.Range)
+			}
+			if info.UsableCount != tt.usable {
+				t.Errorf("UsableCount = %d, want %d", info.UsableCount, tt.usable)
+			}
+		})
+	}
+
+	t.Run("reserved addresses are not usable", func(t *testing.T) {
+		allocator, err := NewAllocator(Config{CIDR: "10.0.0.0/24", Gateway: "10.0.0.1", ServerIP: "10.0.0.3/24", ServiceIPs: []string{"10.0.0.53"}})
+		if err != nil {
+			t.Fatalf("NewAllocator() failed: %v", err)
+		}
+		if got := allocator.GetNetworkInfo().UsableCount; got != 251 {
+			t.Errorf("UsableCount = %d, want 251", got)
+		}
+	})
+}
+
+func TestAllocateSpecificIP(t *testing.T) {
+	config := DefaultConfig()
+	config.ServerIP = "10.0.0.3/24"
+	config.StickyTTL = time.Minute
+	allocator, err := NewAllocator(config)
+	if err != nil {
+		t.Fatalf("NewAllocator() failed: %v", err)
+	}
+
+	users := []UserIPInfo{SimpleUser{AssignedIP: "10.0.0.5/32"}}
+	if err := allocator.ReleaseIPForOwner("10.0.0.9/32", "client-b"); err != nil {
+		t.Fatalf("ReleaseIPForOwner() failed: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		requested string
+		want      string
+		wantTaken bool
+		wantErr   bool
+	}{
+		{name: "free IP", requested: "10.0.0.7", want: "10.0.0.7/32"},
+		{name: "CIDR form", requested: "10.0.0.8/32", want: "10.0.0.8/32"},
+		{name: "held by existing user", requested: "10.0.0.5", wantTaken: true},
+		{name: "held for its previous owner", requested: "10.0.0.9", wantTaken: true},
+		{name: "gateway", requested: "10.0.0.1", wantErr: true},
+		{name: "server IP", requested: "10.0.0.3", wantErr: true},
+		{name: "broadcast", requested: "10.0.0.255", wantErr: true},
+		{name: "outside CIDR", requested: "192.168.1.5", wantErr: true},
+		{name: "invalid", requested: "not-an-ip", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := allocator.AllocateSpecificIP(tt.requested, users)
+			switch {
+			case tt.wantTaken:
+				if !errors.Is(err, ErrIPAlreadyAllocated) {
+					t.Errorf("Expected ErrIPAlreadyAllocated, got %v", err)
+				}
+			case tt.wantErr:
+				if err == nil || errors.Is(err, ErrIPAlreadyAllocated) {
+					t.Errorf("Expected a range or reservation error, got %v", err)
+				}
+			case err != nil:
+				t.Errorf("AllocateSpecificIP() failed: %v", err)
+			case got != tt.want:
+				t.Errorf("AllocateSpecificIP() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("tracked claims are remembered", func(t *testing.T) {
+		allocator, err := NewAllocator(DefaultConfig())
+		if err != nil {
+			t.Fatalf("NewAllocator() failed: %v", err)
+		}
+		if _, err := allocator.AllocateIP(nil); err != nil { // Starts tracking
+			t.Fatalf("AllocateIP() failed: %v", err)
+		}
+		users := []UserIPInfo{SimpleUser{AssignedIP: "10.0.0.2/32"}}
+		if _, err := allocator.AllocateSpecificIP("10.0.0.3", users); err != nil {
+			t.Fatalf("AllocateSpecificIP() failed: %v", err)
+		}
+		if allocator.IsIPAvailable("10.0.0.3", users) {
+			t.Error("Expected the claimed IP to be tracked as allocated")
+		}
+		if _, err := allocator.AllocateSpecificIP("10.0.0.3", users); !errors.Is(err, ErrIPAlreadyAllocated) {
+			t.Errorf("Expected a second claim to fail with ErrIPAlreadyAllocated, got %v", err)
+		}
+	})
+}
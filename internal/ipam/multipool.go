@@ -0,0 +1,230 @@
+package ipam
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrUnknownPool is returned when a region hint names no configured pool
+var ErrUnknownPool = errors.New("unknown address pool")
+
+// Pool is a named address range, e.g. one per region
+type Pool struct {
+	Name      string
+	Allocator *Allocator
+}
+
+// PoolUtilization reports how full one pool is
+type PoolUtilization struct {
+	Name     string
+	CIDR     string
+	Used     int
+	Capacity int
+}
+
+// Ratio returns the used fraction of the pool (1 for a pool with no capacity)
+func (u PoolUtilization) Ratio() float64 {
+	if u.Capacity == 0 {
+		return 1
+	}
+	return float64(u.Used) / float64(u.Capacity)
+}
+
+// Utilization aggregates pool usage across a MultiPoolAllocator
+type Utilization struct {
+	Used     int
+	Capacity int
+	Pools    []PoolUtilization
+}
+
+// MultiPoolAllocator allocates client IPs from several non-overlapping pools
+// New clients go to the least-utilized pool unless they ask for a region
+type MultiPoolAllocator struct {
+	pools []Pool
+}
+
+// NewMultiPoolAllocator combines pools; names must be unique and networks must not overlap
+func NewMultiPoolAllocator(pools ...Pool) (*MultiPoolAllocator, error) {
+	if len(pools) == 0 {
+		return nil, fmt.Errorf("at least one pool is required")
+	}
+
+	for i, pool := range pools {
+		if pool.Allocator == nil {
+			return nil, fmt.Errorf("pool %q has no allocator", pool.Name)
+		}
+		for _, other := range pools[:i] {
+			if pool.Name == other.Name {
+				return nil, fmt.Errorf("duplicate pool name %q", pool.Name)
+			}
+			if pool.Allocator.cidr.Contains(other.Allocator.cidr.IP) || other.Allocator.cidr.Contains(pool.Allocator.cidr.IP) {
+				return nil, fmt.Errorf("pool %q (%s) overlaps pool %q (%s)",
+					pool.Name, pool.Allocator.cidr, other.Name, other.Allocator.cidr)
+			}
+		}
+	}
+
+	return &MultiPoolAllocator{pools: append([]Pool(nil), pools...)}, nil
+}
+
+// AllocateIP allocates from the least-utilized pool, falling back to fuller pools if it is exhausted
+func (m *MultiPoolAllocator) AllocateIP(existingUsers []UserIPInfo) (string, error) {
+	usage := m.Utilization(existingUsers).Pools
+
+	// Stable sort keeps configuration order between equally used pools
+	order := make([]int, len(m.pools))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return usage[order[i]].Ratio() < usage[order[j]].Ratio()
+	})
+
+	for _, i := range order {
+		ip, err := m.pools[i].Allocator.AllocateIP(existingUsers)
+		if errors.Is(err, ErrNoAvailableIPs) {
+			continue
+		}
+		return ip, err
+	}
+	return "", fmt.Errorf("%w in any of %d pools", ErrNoAvailableIPs, len(m.pools))
+}
+
+// AllocateIPInRegion allocates from the pool named region, without falling back to other pools
+func (m *MultiPoolAllocator) AllocateIPInRegion(region string, existingUsers []UserIPInfo) (string, error) {
+	for _, pool := range m.pools {
+		if pool.Name == region {
+			return pool.Allocator.AllocateIP(existingUsers)
+		}
+	}
+	return "", fmt.Errorf("%w: %q", ErrUnknownPool, region)
+}
+
+// AllocateIPInRegionForOwner is AllocateIPInRegion, handing back an IP the owner released within the pool's sticky TTL
+func (m *MultiPoolAllocator) AllocateIPInRegionForOwner(region, owner string, existingUsers []UserIPInfo) (string, error) {
+	for _, pool := range m.pools {
+		if pool.Name == region {
+			return pool.Allocator.AllocateIPForOwner(owner, existingUsers)
+		}
+	}
+	return "", fmt.Errorf("%w: %q", ErrUnknownPool, region)
+}
+
+// ReleaseIP returns an IP to the pool whose network contains it
+func (m *MultiPoolAllocator) ReleaseIP(ip string) error {
+	pool, ok := m.owner(ip)
+	if !ok {
+		return fmt.Errorf("IP %s not in any pool", ip)
+	}
+	return pool.Allocator.ReleaseIP(ip)
+}
+
+// ReleaseIPForOwner releases an IP in the pool whose network contains it, holding it for owner
+func (m *MultiPoolAllocator) ReleaseIPForOwner(ip string, owner string) error {
+	pool, ok := m.owner(ip)
+	if !ok {
+		return fmt.Errorf("IP %s not in any pool", ip)
+	}
+	return pool.Allocator.ReleaseIPForOwner(ip, owner)
+}
+
+// AllocateSpecificIP claims requested in the pool whose network contains it
+func (m *MultiPoolAllocator) AllocateSpecificIP(requested string, existingUsers []UserIPInfo) (string, error) {
+	pool, ok := m.owner(requested)
+	if !ok {
+		return "", fmt.Errorf("IP %s not in any pool", requested)
+	}
+	return pool.Allocator.AllocateSpecificIP(requested, existingUsers)
+}
+
+// IsIPAvailable checks availability in the pool whose network contains targetIP
+func (m *MultiPoolAllocator) IsIPAvailable(targetIP string, existingUsers []UserIPInfo) bool {
+	pool, ok := m.owner(targetIP)
+	return ok && pool.Allocator.IsIPAvailable(targetIP, existingUsers)
+}
+
+// GetNetworkInfo describes all pools: CIDRs, families and ranges are comma-separated, the gateway is the first pool's
+// and UsableCount is the total across pools
+func (m *MultiPoolAllocator) GetNetworkInfo() NetworkInfo {
+	var cidrs, families, ranges, starts, ends, services []string
+	usable := 0
+	for _, pool := range m.pools {
+		info := pool.Allocator.GetNetworkInfo()
+		cidrs = append(cidrs, info.CIDR)
+		families = append(families, info.Family)
+		ranges = append(ranges, info.Range)
+		starts = append(starts, info.StartIP)
+		ends = append(ends, info.EndIP)
+		usable += info.UsableCount
+		services = append(services, info.ServiceIPs...)
+	}
+
+	return NetworkInfo{
+		CIDR:        strings.Join(cidrs, ","),
+		Family:      strings.Join(families, ","),
+		Gateway:     m.pools[0].Allocator.GetNetworkInfo().Gateway,
+		Range:       strings.Join(ranges, ","),
+		StartIP:     strings.Join(starts, ","),
+		EndIP:       strings.Join(ends, ","),
+		UsableCount: usable,
+		ServiceIPs:  services,
+	}
+}
+
+// NetworkInfoFor describes the pool whose network contains ip
+func (m *MultiPoolAllocator) NetworkInfoFor(ip string) (NetworkInfo, bool) {
+	pool, ok := m.owner(ip)
+	if !ok {
+		return NetworkInfo{}, false
+	}
+	return pool.Allocator.GetNetworkInfo(), true
+}
+
+// GetStats sums allocation statistics across pools
+func (m *MultiPoolAllocator) GetStats() AllocationStats {
+	var total AllocationStats
+	var weightedTime int64
+	for _, pool := range m.pools {
+		stats := pool.Allocator.GetStats()
+		total.TotalAllocations += stats.TotalAllocations
+		total.FailedAllocations += stats.FailedAllocations
+		if stats.LastAllocationTime.After(total.LastAllocationTime) {
+			total.LastAllocationTime = stats.LastAllocationTime
+		}
+		weightedTime += int64(stats.AverageAllocationTime) * stats.TotalAllocations
+	}
+	if total.TotalAllocations > 0 {
+		total.AverageAllocationTime = time.Duration(weightedTime / total.TotalAllocations)
+	}
+	return total
+}
+
+// Utilization reports per-pool and aggregate usage given the current assignments
+func (m *MultiPoolAllocator) Utilization(existingUsers []UserIPInfo) Utilization {
+	var total Utilization
+	for _, pool := range m.pools {
+		usage := PoolUtilization{
+			Name:     pool.Name,
+			CIDR:     pool.Allocator.GetNetworkInfo().CIDR,
+			Used:     pool.Allocator.countAssigned(existingUsers),
+			Capacity: pool.Allocator.Capacity(),
+		}
+		total.Used += usage.Used
+		total.Capacity += usage.Capacity
+		total.Pools = append(total.Pools, usage)
+	}
+	return total
+}
+
+// owner finds the pool whose network contains ip
+func (m *MultiPoolAllocator) owner(ip string) (Pool, bool) {
+	for _, pool := range m.pools {
+		if pool.Allocator.Contains(ip) {
+			return pool, true
+		}
+	}
+	return Pool{}, false
+}
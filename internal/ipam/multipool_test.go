@@ -0,0 +1,221 @@
+package ipam
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestPools(t *testing.T, cidrs map[string]string) []Pool {
+	t.Helper()
+
+	var pools []Pool
+	for _, name := range []string{"eu", "us", "ap"} {
+		cidr, ok := cidrs[name]
+		if !ok {
+			continue
+		}
+		gateway := strings.TrimSuffix(cidr, "0/24") + "1"
+		allocator, err := NewAllocator(Config{CIDR: cidr, Gateway: gateway, EnableOptimizations: true})
+		if err != nil {
+			t.Fatalf("NewAllocator(%s) failed: %v", cidr, err)
+		}
+		pools = append(pools, Pool{Name: name, Allocator: allocator})
+	}
+	return pools
+}
+
+func TestNewMultiPoolAllocator(t *testing.T) {
+	eu := newTestPools(t, map[string]string{"eu": "10.1.0.0/24"})[0]
+	overlapping, err := NewAllocator(Config{CIDR: "10.1.0.0/16", Gateway: "10.1.0.1"})
+	if err != nil {
+		t.Fatalf("NewAllocator failed: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		pools   []Pool
+		wantErr bool
+	}{
+		{name: "single pool", pools: []Pool{eu}},
+		{name: "no pools", pools: nil, wantErr: true},
+		{name: "nil allocator", pools: []Pool{{Name: "eu"}}, wantErr: true},
+		{name: "duplicate name", pools: []Pool{eu, {Name: "eu", Allocator: newTestPools(t, map[string]string{"us": "10.2.0.0/24"})[0].Allocator}}, wantErr: true},
+		{name: "overlapping networks", pools: []Pool{eu, {Name: "wide", Allocator: overlapping}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewMultiPoolAllocator(tt.pools...)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewMultiPoolAllocator() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMultiPoolAllocatesFromLeastUtilized(t *testing.T) {
+	multi, err := NewMultiPoolAllocator(newTestPools(t, map[string]string{"eu": "10.1.0.0/24", "us": "10.2.0.0/24"})...)
+	if err != nil {
+		t.Fatalf("NewMultiPoolAllocator failed: %v", err)
+	}
+
+	// eu already has three clients, us has one
+	users := []UserIPInfo{
+		SimpleUser{AssignedIP: "10.1.0.2/32"},
+		SimpleUser{AssignedIP: "10.1.0.3/32"},
+		SimpleUser{AssignedIP: "10.1.0.4/32"},
+		SimpleUser{AssignedIP: "10.2.0.2/32"},
+	}
+
+	// The next two allocations even out the pools, then eu's turn comes
+	wantPrefixes := []string{"10.2.0.", "10.2.0.", "10.1.0."}
+	for i, want := range wantPrefixes {
+		ip, err := multi.AllocateIP(users)
+		if err != nil {
+			t.Fatalf("AllocateIP %d failed: %v", i, err)
+		}
+		if !strings.HasPrefix(ip, want) {
+			t.Errorf("Allocation %d: expected pool %s*, got %s", i, want, ip)
+		}
+		users = append(users, SimpleUser{AssignedIP: ip})
+	}
+
+	usage := multi.Utilization(users)
+	if usage.Used != len(users) {
+		t.Errorf("Expected %d used, got %d", len(users), usage.Used)
+	}
+	if usage.Capacity != 2*253 {
+		t.Errorf("Expected capacity %d, got %d", 2*253, usage.Capacity)
+	}
+	if len(usage.Pools) != 2 || usage.Pools[0].Used != 4 || usage.Pools[1].Used != 3 {
+		t.Errorf("Unexpected per-pool usage: %+v", usage.Pools)
+	}
+}
+
+func TestMultiPoolFallsBackWhenPoolExhausted(t *testing.T) {
+	small, err := NewAllocator(Config{CIDR: "10.3.0.0/30", Gateway: "10.3.0.1", EnableOptimizations: true})
+	if err != nil {
+		t.Fatalf("NewAllocator failed: %v", err)
+	}
+	pools := append([]Pool{{Name: "tiny", Allocator: small}}, newTestPools(t, map[string]string{"eu": "10.1.0.0/24"})...)
+	multi, err := NewMultiPoolAllocator(pools...)
+	if err != nil {
+		t.Fatalf("NewMultiPoolAllocator failed: %v", err)
+	}
+
+	var users []UserIPInfo
+	for i := 0; i < 5; i++ {
+		ip, err := multi.AllocateIP(users)
+		if err != nil {
+			t.Fatalf("AllocateIP %d failed: %v", i, err)
+		}
+		users = append(users, SimpleUser{AssignedIP: ip})
+	}
+
+	if usage := multi.Utilization(users); usage.Used != 5 {
+		t.Errorf("Expected 5 allocations across pools, got %+v", usage)
+	}
+}
+
+func TestMultiPoolRegionHint(t *testing.T) {
+	multi, err := NewMultiPoolAllocator(newTestPools(t, map[string]string{"eu": "10.1.0.0/24", "us": "10.2.0.0/24"})...)
+	if err != nil {
+		t.Fatalf("NewMultiPoolAllocator failed: %v", err)
+	}
+
+	ip, err := multi.AllocateIPInRegion("us", nil)
+	if err != nil {
+		t.Fatalf("AllocateIPInRegion failed: %v", err)
+	}
+	if !strings.HasPrefix(ip, "10.2.0.") {
+		t.Errorf("Expected us pool address, got %s", ip)
+	}
+
+	if _, err := multi.AllocateIPInRegion("mars", nil); !errors.Is(err, ErrUnknownPool) {
+		t.Errorf("Expected ErrUnknownPool, got %v", err)
+	}
+}
+
+func TestMultiPoolReleaseRouting(t *testing.T) {
+	pools := newTestPools(t, map[string]string{"eu": "10.1.0.0/24", "us": "10.2.0.0/24"})
+	multi, err := NewMultiPoolAllocator(pools...)
+	if err != nil {
+		t.Fatalf("NewMultiPoolAllocator failed: %v", err)
+	}
+
+	// Allocate directly so the pool's tracking holds the IP
+	usIP, err := pools[1].Allocator.AllocateIP(nil)
+	if err != nil {
+		t.Fatalf("AllocateIP failed: %v", err)
+	}
+	if !pools[1].Allocator.allocatedIPs[strings.TrimSuffix(usIP, "/32")] {
+		t.Fatalf("Expected %s tracked by us pool", usIP)
+	}
+
+	if err := multi.ReleaseIP(usIP); err != nil {
+		t.Fatalf("ReleaseIP(%s) failed: %v", usIP, err)
+	}
+	if pools[1].Allocator.allocatedIPs[strings.TrimSuffix(usIP, "/32")] {
+		t.Errorf("Expected %s released from us pool", usIP)
+	}
+
+	if err := multi.ReleaseIP("192.168.9.9/32"); err == nil {
+		t.Error("Expected error releasing an IP outside every pool")
+	}
+
+	if !multi.IsIPAvailable("10.1.0.50", nil) {
+		t.Error("Expected 10.1.0.50 available in eu pool")
+	}
+	if multi.IsIPAvailable("10.1.0.1", nil) {
+		t.Error("Gateway of eu pool must not be available")
+	}
+
+	info := multi.GetNetworkInfo()
+	if info.CIDR != "10.1.0.0/24,10.2.0.0/24" || info.Gateway != "10.1.0.1" {
+		t.Errorf("Unexpected network info: %+v", info)
+	}
+	if stats := multi.GetStats(); stats.TotalAllocations != 1 {
+		t.Errorf("Expected 1 total allocation, got %d", stats.TotalAllocations)
+	}
+}
+
+func TestMultiPoolStickyOwner(t *testing.T) {
+	pools := newTestPools(t, map[string]string{"eu": "10.1.0.0/24", "us": "10.2.0.0/24"})
+	for _, pool := range pools {
+		pool.Allocator.stickyTTL = time.Minute
+	}
+	multi, err := NewMultiPoolAllocator(pools...)
+	if err != nil {
+		t.Fatalf("NewMultiPoolAllocator failed: %v", err)
+	}
+
+	first, err := multi.AllocateIPInRegionForOwner("us", "client-a", nil)
+	if err != nil {
+		t.Fatalf("AllocateIPInRegionForOwner failed: %v", err)
+	}
+	if err := multi.ReleaseIPForOwner(first, "client-a"); err != nil {
+		t.Fatalf("ReleaseIPForOwner(%s) failed: %v", first, err)
+	}
+
+	other, err := multi.AllocateIPInRegionForOwner("us", "client-b", nil)
+	if err != nil {
+		t.Fatalf("AllocateIPInRegionForOwner failed: %v", err)
+	}
+	if other == first {
+		t.Errorf("Held IP %s was handed to another owner", first)
+	}
+
+	again, err := multi.AllocateIPInRegionForOwner("us", "client-a", nil)
+	if err != nil {
+		t.Fatalf("AllocateIPInRegionForOwner failed: %v", err)
+	}
+	if again != first {
+		t.Errorf("Returning owner got %s, want %s", again, first)
+	}
+
+	if _, err := multi.AllocateIPInRegionForOwner("mars", "client-a", nil); !errors.Is(err, ErrUnknownPool) {
+		t.Errorf("Expected ErrUnknownPool, got %v", err)
+	}
+}
@@ -0,0 +1,89 @@
+package ipam
+
+import "sort"
+
+// Drift describes where the allocator's tracking disagrees with the assigned IPs
+// It appears after crashes between allocation and persistence, or after restoring a stale snapshot
+type Drift struct {
+	Orphaned  []string `json:"orphaned"`  // Tracked as allocated but assigned to no peer
+	Untracked []string `json:"untracked"` // Assigned to a peer but not tracked as allocated
+}
+
+// Empty reports whether the allocator and the assignments agree
+func (d Drift) Empty() bool {
+	return len(d.Orphaned) == 0 && len(d.Untracked) == 0
+}
+
+// Drift compares the allocator's tracked allocations with existingUsers
+// Allocators without tracking (optimizations disabled) derive everything from existingUsers and never drift
+func (a *Allocator) Drift(existingUsers []UserIPInfo) Drift {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	return a.drift(existingUsers)
+}
+
+// Reconcile releases orphaned allocations and tracks untracked ones, returning the drift it repaired
+func (a *Allocator) Reconcile(existingUsers []UserIPInfo) Drift {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	drift := a.drift(existingUsers)
+	for _, ip := range drift.Orphaned {
+		delete(a.allocatedIPs, ip)
+	}
+	for _, ip := range drift.Untracked {
+		a.allocatedIPs[ip] = true
+	}
+	a.tracked = a.allocatedIPs != nil
+	return drift
+}
+
+func (a *Allocator) drift(existingUsers []UserIPInfo) Drift {
+	drift := Drift{Orphaned: []string{}, Untracked: []string{}}
+	if a.allocatedIPs == nil {
+		return drift
+	}
+
+	assigned := make(map[string]bool, len(existingUsers))
+	for _, user := range existingUsers {
+		ip := parseAssignedIP(user.GetAssignedIP())
+		if ip == nil || !a.isIPInRange(ip) || a.isReserved(ip) {
+			continue
+		}
+		assigned[ip.String()] = true
+		if !a.allocatedIPs[ip.String()] {
+			drift.Untracked = append(drift.Untracked, ip.String())
+		}
+	}
+
+	for ip, allocated := range a.allocatedIPs {
+		if allocated && !assigned[ip] && !a.isReserved(parseAssignedIP(ip)) {
+			drift.Orphaned = append(drift.Orphaned, ip)
+		}
+	}
+
+	sort.Strings(drift.Orphaned)
+	sort.Strings(drift.Untracked)
+	return drift
+}
+
+// Drift combines the drift of every pool
+func (m *MultiPoolAllocator) Drift(existingUsers []UserIPInfo) Drift {
+	return m.eachPool(func(a *Allocator) Drift { return a.Drift(existingUsers) })
+}
+
+// Reconcile repairs every pool, returning the combined drift it repaired
+func (m *MultiPoolAllocator) Reconcile(existingUsers []UserIPInfo) Drift {
+	return m.eachPool(func(a *Allocator) Drift { return a.Reconcile(existingUsers) })
+}
+
+func (m *MultiPoolAllocator) eachPool(fn func(a *Allocator) Drift) Drift {
+	total := Drift{Orphaned: []string{}, Untracked: []string{}}
+	for _, pool := range m.pools {
+		drift := fn(pool.Allocator)
+		total.Orphaned = append(total.Orphaned, drift.Orphaned...)
+		total.Untracked = append(total.Untracked, drift.Untracked...)
+	}
+	return total
+}
@@ -0,0 +1,48 @@
+package ipam
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAllocatorDrift(t *testing.T) {
+	allocator, err := NewAllocator(DefaultConfig())
+	if err != nil {
+		t.Fatalf("Failed to create allocator: %v", err)
+	}
+
+	// Simulate a crash: .3 was allocated but never reached the peer store,
+	// and .9 was persisted by a previous process this allocator never saw
+	if _, err := allocator.AllocateIP([]UserIPInfo{SimpleUser{AssignedIP: "10.0.0.2/32"}}); err != nil {
+		t.Fatalf("AllocateIP failed: %v", err)
+	}
+	users := []UserIPInfo{
+		SimpleUser{AssignedIP: "10.0.0.2/32"},
+		SimpleUser{AssignedIP: "10.0.0.9/32"},
+	}
+
+	want := Drift{Orphaned: []string{"10.0.0.3"}, Untracked: []string{"10.0.0.9"}}
+	if got := allocator.Drift(users); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Drift() = %+v, want %+v", got, want)
+	}
+	if got := allocator.Drift(users); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Drift() must not repair: got %+v", got)
+	}
+
+	if got := allocator.Reconcile(users); !reflect.DeepEqual(got, want) {
+		t.Errorf("Reconcile() = %+v, want %+v", got, want)
+	}
+	if got := allocator.Drift(users); !got.Empty() {
+		t.Errorf("Expected no drift after Reconcile, got %+v", got)
+	}
+}
+
+func TestAllocatorDriftWithoutTracking(t *testing.T) {
+	allocator, err := NewAllocator(Config{CIDR: "10.0.0.0/24", Gateway: "10.0.0.1"})
+	if err != nil {
+		t.Fatalf("Failed to create allocator: %v", err)
+	}
+	if drift := allocator.Drift([]UserIPInfo{SimpleUser{AssignedIP: "10.0.0.5/32"}}); !drift.Empty() {
+		t.Errorf("Untracked allocator should never drift, got %+v", drift)
+	}
+}
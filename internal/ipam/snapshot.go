@@ -0,0 +1,130 @@
+package ipam
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"time"
+)
+
+// snapshotVersion is bumped whenever the snapshot format changes incompatibly
+const snapshotVersion = 1
+
+// allocatorSnapshot is the serialized form of an Allocator's state
+type allocatorSnapshot struct {
+	Version       int            `json:"version"`
+	CIDR          string         `json:"cidr"`
+	Gateway       string         `json:"gateway"`
+	StickyTTL     time.Duration  `json:"stickyTTL"`
+	Allocated     []string       `json:"allocated"`
+	LastAllocated string         `json:"lastAllocated,omitempty"`
+	Held          []heldSnapshot `json:"held,omitempty"`
+}
+
+// heldSnapshot is the serialized form of a sticky-held IP
+type heldSnapshot struct {
+	IP         string    `json:"ip"`
+	Owner      string    `json:"owner,omitempty"`
+	ReleasedAt time.Time `json:"releasedAt"`
+}
+
+// Snapshot serializes the allocation state and network config
+// Paired with a PeerStore export this lets operators move a server to a new host
+func (a *Allocator) Snapshot() ([]byte, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	snapshot := allocatorSnapshot{
+		Version:   snapshotVersion,
+		CIDR:      a.cidr.String(),
+		Gateway:   a.gateway.String(),
+		StickyTTL: a.stickyTTL,
+		Allocated: []string{},
+	}
+
+	for ip, allocated := range a.allocatedIPs {
+		if allocated && ip != a.gateway.String() {
+			snapshot.Allocated = append(snapshot.Allocated, ip)
+		}
+	}
+	sort.Strings(snapshot.Allocated)
+
+	if a.lastAllocated != nil {
+		snapshot.LastAllocated = a.lastAllocated.String()
+	}
+
+	for ip, hold := range a.held {
+		snapshot.Held = append(snapshot.Held, heldSnapshot{IP: ip, Owner: hold.owner, ReleasedAt: hold.releasedAt})
+	}
+	sort.Slice(snapshot.Held, func(i, j int) bool { return snapshot.Held[i].IP < snapshot.Held[j].IP })
+
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal allocator snapshot: %w", err)
+	}
+	return data, nil
+}
+
+// Restore replaces the allocation state with a snapshot taken by Snapshot
+// The snapshot's CIDR and gateway must match this allocator's configuration
+func (a *Allocator) Restore(data []byte) error {
+	var snapshot allocatorSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return fmt.Errorf("failed to parse allocator snapshot: %w", err)
+	}
+
+	if snapshot.Version != snapshotVersion {
+		return fmt.Errorf("unsupported allocator snapshot version %d", snapshot.Version)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if snapshot.CIDR != a.cidr.String() {
+		return fmt.Errorf("snapshot CIDR %s does not match allocator CIDR %s", snapshot.CIDR, a.cidr)
+	}
+	if snapshot.Gateway != a.gateway.String() {
+		return fmt.Errorf("snapshot gateway %s does not match allocator gateway %s", snapshot.Gateway, a.gateway)
+	}
+
+	// Validate everything before touching state so a bad snapshot leaves us unchanged
+	allocated := make(map[string]bool, len(snapshot.Allocated)+1)
+	allocated[a.gateway.String()] = true
+	for _, ipStr := range snapshot.Allocated {
+		ip := parseAssignedIP(ipStr)
+		if ip == nil || !a.isIPInRange(ip) {
+			return fmt.Errorf("snapshot allocation %s not in allocation range %s-%s", ipStr, a.startIP, a.endIP)
+		}
+		allocated[ip.String()] = true
+	}
+
+	held := make(map[string]heldIP, len(snapshot.Held))
+	for _, hold := range snapshot.Held {
+		ip := parseAssignedIP(hold.IP)
+		if ip == nil || !a.isIPInRange(ip) {
+			return fmt.Errorf("snapshot held IP %s not in allocation range %s-%s", hold.IP, a.startIP, a.endIP)
+		}
+		held[ip.String()] = heldIP{owner: hold.Owner, releasedAt: hold.ReleasedAt}
+	}
+
+	var lastAllocated net.IP
+	if snapshot.LastAllocated != "" {
+		if lastAllocated = parseAssignedIP(snapshot.LastAllocated); lastAllocated == nil {
+			return fmt.Errorf("invalid last allocated IP %s in snapshot", snapshot.LastAllocated)
+		}
+	}
+
+	if a.allocatedIPs != nil {
+		// A snapshot may predate the current peers, so availability checks scan them until the next reconcile
+		a.allocatedIPs = allocated
+		a.tracked = false
+		if lastAllocated != nil && len(lastAllocated) == len(a.lastAllocated) {
+			copy(a.lastAllocated, lastAllocated)
+		}
+	}
+	a.held = held
+	a.stickyTTL = snapshot.StickyTTL
+
+	return nil
+}
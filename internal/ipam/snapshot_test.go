@@ -0,0 +1,161 @@
+package ipam
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSnapshotRestore(t *testing.T) {
+	config := DefaultConfig()
+	config.StickyTTL = time.Minute
+
+	source, err := NewAllocator(config)
+	if err != nil {
+		t.Fatalf("NewAllocator() failed: %v", err)
+	}
+
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	source.now = func() time.Time { return now }
+
+	var users []UserIPInfo
+	for i := 0; i < 3; i++ {
+		ip, err := source.AllocateIP(users)
+		if err != nil {
+			t.Fatalf("AllocateIP() failed: %v", err)
+		}
+		users = append(users, SimpleUser{AssignedIP: ip})
+	}
+
+	// Release the middle IP so it is held for its owner
+	if err := source.ReleaseIPForOwner("10.0.0.3/32", "client-b"); err != nil {
+		t.Fatalf("ReleaseIPForOwner() failed: %v", err)
+	}
+
+	data, err := source.Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot() failed: %v", err)
+	}
+
+	target, err := NewAllocator(DefaultConfig())
+	if err != nil {
+		t.Fatalf("NewAllocator() failed: %v", err)
+	}
+	target.now = source.now
+
+	if err := target.Restore(data); err != nil {
+		t.Fatalf("Restore() failed: %v", err)
+	}
+
+	t.Run("snapshot is stable", func(t *testing.T) {
+		again, err := target.Snapshot()
+		if err != nil {
+			t.Fatalf("Snapshot() failed: %v", err)
+		}
+		if string(again) != string(data) {
+			t.Errorf("Round-trip snapshot differs:\n got %s\nwant %s", again, data)
+		}
+	})
+
+	t.Run("allocations preserved", func(t *testing.T) {
+		for _, ip := range []string{"10.0.0.2", "10.0.0.4"} {
+			if !target.allocatedIPs[ip] {
+				t.Errorf("Expected %s to remain allocated after restore", ip)
+			}
+		}
+		if target.allocatedIPs["10.0.0.3"] {
+			t.Error("Released IP should not be allocated after restore")
+		}
+	})
+
+	t.Run("sticky hold preserved", func(t *testing.T) {
+		remaining := []UserIPInfo{users[0], users[2]}
+
+		ip, err := target.AllocateIPForOwner("client-c", remaining)
+		if err != nil {
+			t.Fatalf("AllocateIPForOwner() failed: %v", err)
+		}
+		if ip == "10.0.0.3/32" {
+			t.Error("Held IP was handed to another client after restore")
+		}
+
+		ip, err = target.AllocateIPForOwner("client-b", remaining)
+		if err != nil {
+			t.Fatalf("AllocateIPForOwner() failed: %v", err)
+		}
+		if ip != "10.0.0.3/32" {
+			t.Errorf("Previous owner got %s after restore, want 10.0.0.3/32", ip)
+		}
+	})
+}
+
+func TestRestoreValidation(t *testing.T) {
+	source, err := NewAllocator(DefaultConfig())
+	if err != nil {
+		t.Fatalf("NewAllocator() failed: %v", err)
+	}
+	data, err := source.Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot() failed: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		config  Config
+		mutate  func(*allocatorSnapshot)
+		wantErr string
+	}{
+		{
+			name:    "CIDR mismatch",
+			config:  ConfigFromNetwork("10.1.0.0/24", "10.1.0.1"),
+			wantErr: "CIDR",
+		},
+		{
+			name:    "gateway mismatch",
+			config:  ConfigFromNetwork("10.0.0.0/24", "10.0.0.254"),
+			wantErr: "gateway",
+		},
+		{
+			name:    "allocation out of range",
+			config:  DefaultConfig(),
+			mutate:  func(s *allocatorSnapshot) { s.Allocated = []string{"192.168.1.5"} },
+			wantErr: "not in allocation range",
+		},
+		{
+			name:    "unknown version",
+			config:  DefaultConfig(),
+			mutate:  func(s *allocatorSnapshot) { s.Version = 99 },
+			wantErr: "unsupported",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload := data
+			if tt.mutate != nil {
+				var snapshot allocatorSnapshot
+				if err := json.Unmarshal(data, &snapshot); err != nil {
+					t.Fatalf("Failed to decode snapshot: %v", err)
+				}
+				tt.mutate(&snapshot)
+				payload, _ = json.Marshal(snapshot)
+			}
+
+			target, err := NewAllocator(tt.config)
+			if err != nil {
+				t.Fatalf("NewAllocator() failed: %v", err)
+			}
+			err = target.Restore(payload)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Restore() error = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	t.Run("invalid JSON", func(t *testing.T) {
+		if err := source.Restore([]byte("not json")); err == nil {
+			t.Error("Expected error restoring invalid JSON")
+		}
+	})
+}
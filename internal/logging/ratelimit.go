@@ -0,0 +1,58 @@
+package logging
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultInterval is how often a repeated message is logged when no interval is set
+const DefaultInterval = 30 * time.Second
+
+// RateLimiter lets a message through at most once per interval per key
+// Used on hot error paths so a failure storm produces one line per interval instead of thousands
+// The zero value is ready to use with DefaultInterval
+type RateLimiter struct {
+	Interval time.Duration
+
+	mu         sync.Mutex
+	last       map[string]time.Time
+	suppressed map[string]int
+	now        func() time.Time // Clock (overridable in tests)
+}
+
+// NewRateLimiter creates a limiter allowing each key once per interval
+func NewRateLimiter(interval time.Duration) *RateLimiter {
+	return &RateLimiter{Interval: interval}
+}
+
+// Allow reports whether a message with key should be logged now
+// When it should, suppressed is the number of repeats dropped since it was last logged
+func (r *RateLimiter) Allow(key string) (suppressed int, ok bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.last == nil {
+		r.last = make(map[string]time.Time)
+		r.suppressed = make(map[string]int)
+	}
+
+	now := time.Now()
+	if r.now != nil {
+		now = r.now()
+	}
+
+	interval := r.Interval
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+
+	if last, seen := r.last[key]; seen && now.Sub(last) < interval {
+		r.suppressed[key]++
+		return 0, false
+	}
+
+	suppressed = r.suppressed[key]
+	r.last[key] = now
+	delete(r.suppressed, key)
+	return suppressed, true
+}
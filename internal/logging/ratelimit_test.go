@@ -0,0 +1,54 @@
+package logging
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	limiter := NewRateLimiter(10 * time.Second)
+	limiter.now = func() time.Time { return now }
+
+	if _, ok := limiter.Allow("ipc"); !ok {
+		t.Fatal("First message should be allowed")
+	}
+
+	// Repeats within the window are suppressed
+	for i := 0; i < 3; i++ {
+		now = now.Add(time.Second)
+		if _, ok := limiter.Allow("ipc"); ok {
+			t.Fatalf("Repeat %d within the window should be suppressed", i)
+		}
+	}
+
+	// Other keys are limited independently
+	if _, ok := limiter.Allow("stats"); !ok {
+		t.Error("A different key should be allowed")
+	}
+
+	// Once the window passes the message is allowed again with the suppressed count
+	now = now.Add(10 * time.Second)
+	suppressed, ok := limiter.Allow("ipc")
+	if !ok {
+		t.Fatal("Message should be allowed after the window")
+	}
+	if suppressed != 3 {
+		t.Errorf("Expected 3 suppressed repeats, got %d", suppressed)
+	}
+
+	now = now.Add(time.Second)
+	if _, ok := limiter.Allow("ipc"); ok {
+		t.Error("The window should restart after an allowed message")
+	}
+}
+
+func TestRateLimiterZeroValue(t *testing.T) {
+	var limiter RateLimiter
+	if _, ok := limiter.Allow("key"); !ok {
+		t.Fatal("First message should be allowed")
+	}
+	if _, ok := limiter.Allow("key"); ok {
+		t.Error("Zero value should limit repeats with DefaultInterval")
+	}
+}
@@ -0,0 +1,60 @@
+package vpnserver
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// canonicalAllowedIP parses an allowed IP in plain or CIDR form into its masked prefix
+// "10.0.0.2" becomes 10.0.0.2/32 and "10.0.0.5/24" becomes 10.0.0.0/24
+func canonicalAllowedIP(ip string) (netip.Prefix, error) {
+	ip = strings.TrimSpace(ip)
+	if prefix, err := netip.ParsePrefix(ip); err == nil {
+		return prefix.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// NormalizeAllowedIPs canonicalizes allowed IPs to masked CIDR form, drops duplicates and
+// removes entries covered by a broader one (10.0.0.0/24 subsumes 10.0.0.5/32)
+// Surviving entries keep their original order
+func NormalizeAllowedIPs(allowedIPs []string) ([]string, error) {
+	prefixes := make([]netip.Prefix, 0, len(allowedIPs))
+	for _, allowedIP := range allowedIPs {
+		prefix, err := canonicalAllowedIP(allowedIP)
+		if err != nil {
+			return nil, fmt.Errorf("invalid allowed IP %q: %w", allowedIP, err)
+		}
+		prefixes = append(prefixes, prefix)
+	}
+
+	normalized := make([]string, 0, len(prefixes))
+	for i, prefix := range prefixes {
+		if !subsumed(prefix, i, prefixes) {
+			normalized = append(normalized, prefix.String())
+		}
+	}
+	return normalized, nil
+}
+
+// subsumed reports whether prefixes[i] is redundant: covered by a broader entry, or
+// repeating an earlier one
+func subsumed(prefix netip.Prefix, i int, prefixes []netip.Prefix) bool {
+	for j, other := range prefixes {
+		switch {
+		case j == i || other.Addr().BitLen() != prefix.Addr().BitLen():
+		case other == prefix:
+			if j < i {
+				return true
+			}
+		case other.Bits() < prefix.Bits() && other.Contains(prefix.Addr()):
+			return true
+		}
+	}
+	return false
+}
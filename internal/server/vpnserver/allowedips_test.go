@@ -0,0 +1,46 @@
+package vpnserver
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestNormalizeAllowedIPs(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   []string
+		want    []string
+		wantErr bool
+	}{
+		{name: "already canonical", input: []string{"10.0.0.2/32", "192.168.1.0/24"}, want: []string{"10.0.0.2/32", "192.168.1.0/24"}},
+		{name: "plain address", input: []string{"10.0.0.2"}, want: []string{"10.0.0.2/32"}},
+		{name: "plain IPv6 address", input: []string{"fd00::2"}, want: []string{"fd00::2/128"}},
+		{name: "host bits masked", input: []string{"192.168.1.7/24"}, want: []string{"192.168.1.0/24"}},
+		{name: "surrounding spaces", input: []string{" 10.0.0.2/32 "}, want: []string{"10.0.0.2/32"}},
+		{name: "duplicates", input: []string{"10.0.0.2", "10.0.0.2/32", "10.0.0.2/32"}, want: []string{"10.0.0.2/32"}},
+		{name: "subnet subsumes host", input: []string{"10.0.0.5/32", "10.0.0.0/24"}, want: []string{"10.0.0.0/24"}},
+		{name: "host after subnet", input: []string{"10.0.0.0/24", "10.0.0.5"}, want: []string{"10.0.0.0/24"}},
+		{name: "nested subnets", input: []string{"10.1.2.0/24", "10.0.0.0/8", "10.1.0.0/16"}, want: []string{"10.0.0.0/8"}},
+		{name: "disjoint entries keep order", input: []string{"10.0.1.0/24", "10.0.0.2/32", "172.16.0.0/12"}, want: []string{"10.0.1.0/24", "10.0.0.2/32", "172.16.0.0/12"}},
+		{name: "families never subsume each other", input: []string{"0.0.0.0/0", "::/0"}, want: []string{"0.0.0.0/0", "::/0"}},
+		{name: "invalid entry", input: []string{"10.0.0.2/32", "not-an-ip"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NormalizeAllowedIPs(tt.input)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expected an error, got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("NormalizeAllowedIPs(%v) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
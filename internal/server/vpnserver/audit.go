@@ -0,0 +1,102 @@
+package vpnserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/november1306/go-vpn/internal/wireguard/keys"
+)
+
+// AuditAction is the kind of IP assignment change recorded in the allocation audit log
+type AuditAction string
+
+const (
+	AuditAllocate AuditAction = "allocate"
+	AuditRelease  AuditAction = "release"
+)
+
+// AuditRecord is one line of the allocation audit log
+type AuditRecord struct {
+	Time   time.Time   `json:"time"`
+	Action AuditAction `json:"action"`
+	Peer   string      `json:"peer"` // Short ID of the peer's public key
+	IP     string      `json:"ip"`   // Allowed IPs, comma separated
+}
+
+// AllocationAudit writes IP assignment decisions as JSON Lines, separate from the general log
+type AllocationAudit struct {
+	mu     sync.Mutex
+	w      io.Writer
+	closer io.Closer // Set when the audit owns its destination file
+	now    func() time.Time
+}
+
+// NewAllocationAudit writes audit records to w
+func NewAllocationAudit(w io.Writer) *AllocationAudit {
+	return &AllocationAudit{w: w, now: time.Now}
+}
+
+// OpenAllocationAudit opens an audit log at dest: "stderr" or a file path, appended to
+func OpenAllocationAudit(dest string) (*AllocationAudit, error) {
+	if dest == "stderr" {
+		return NewAllocationAudit(os.Stderr), nil
+	}
+
+	file, err := os.OpenFile(dest, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open allocation audit log: %w", err)
+	}
+	audit := NewAllocationAudit(file)
+	audit.closer = file
+	return audit, nil
+}
+
+// Record appends one audit record
+func (a *AllocationAudit) Record(action AuditAction, publicKey, ip string) error {
+	line, err := json.Marshal(AuditRecord{
+		Time:   a.now().UTC(),
+		Action: action,
+		Peer:   keys.ShortID(publicKey),
+		IP:     ip,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit record: %w", err)
+	}
+	line = append(line, '\n')
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, err := a.w.Write(line); err != nil {
+		return fmt.Errorf("failed to write audit record: %w", err)
+	}
+	return nil
+}
+
+// Close closes the destination file, if the audit opened one
+func (a *AllocationAudit) Close() error {
+	if a.closer == nil {
+		return nil
+	}
+	return a.closer.Close()
+}
+
+// SetAllocationAudit records RegisterClient allocations and RemoveClient releases to audit (nil disables)
+func (s *VPNServer) SetAllocationAudit(audit *AllocationAudit) {
+	s.audit.Store(audit)
+}
+
+// recordAllocation appends to the audit log if one is set; failures never affect the peer change
+func (s *VPNServer) recordAllocation(action AuditAction, publicKey, ip string) {
+	audit := s.audit.Load()
+	if audit == nil {
+		return
+	}
+	if err := audit.Record(action, publicKey, ip); err != nil {
+		slog.Warn("Failed to record allocation audit", "action", action, "peer", keys.ShortID(publicKey), "error", err)
+	}
+}
@@ -0,0 +1,113 @@
+package vpnserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/november1306/go-vpn/internal/wireguard/keys"
+)
+
+func TestAllocationAuditRecordFormat(t *testing.T) {
+	var buf bytes.Buffer
+	audit := NewAllocationAudit(&buf)
+	audit.now = func() time.Time { return time.Date(2025, 1, 2, 3, 4, 5, 0, time.FixedZone("CET", 3600)) }
+
+	if err := audit.Record(AuditAllocate, "peer-public-key", "10.0.0.2/32"); err != nil {
+		t.Fatalf("Record failed: %v", err)
+	}
+	if err := audit.Record(AuditRelease, "peer-public-key", "10.0.0.2/32"); err != nil {
+		t.Fatalf("Record failed: %v", err)
+	}
+
+	shortID := keys.ShortID("peer-public-key")
+	want := `{"time":"2025-01-02T02:04:05Z","action":"allocate","peer":"` + shortID + `","ip":"10.0.0.2/32"}` + "\n" +
+		`{"time":"2025-01-02T02:04:05Z","action":"release","peer":"` + shortID + `","ip":"10.0.0.2/32"}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("Unexpected audit output:\ngot:  %s\nwant: %s", got, want)
+	}
+
+	if strings.Contains(buf.String(), "peer-public-key") {
+		t.Error("Audit log should not contain the full public key")
+	}
+}
+
+func TestOpenAllocationAuditAppends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "allocations.jsonl")
+
+	for i := 0; i < 2; i++ {
+		audit, err := OpenAllocationAudit(path)
+		if err != nil {
+			t.Fatalf("OpenAllocationAudit failed: %v", err)
+		}
+		if err := audit.Record(AuditAllocate, "peer", "10.0.0.2/32"); err != nil {
+			t.Fatalf("Record failed: %v", err)
+		}
+		if err := audit.Close(); err != nil {
+			t.Fatalf("Close failed: %v", err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read audit log: %v", err)
+	}
+	if lines := strings.Count(string(data), "\n"); lines != 2 {
+		t.Errorf("Expected 2 records across reopens, got %d", lines)
+	}
+}
+
+func TestRegisterAndRemoveAreAudited(t *testing.T) {
+	backend := newFakeBackend()
+	server := NewVPNServerWithPeerStore(backend, NewInMemoryPeerStore())
+
+	ctx := context.Background()
+	if err := server.Start(ctx, newTestServerConfig(t)); err != nil {
+		t.Fatalf("Failed to start VPN server: %v", err)
+	}
+	defer server.Stop(ctx)
+
+	allocator := &fakeAllocator{ip: "10.0.0.9/32"}
+	server.SetAllocator(allocator)
+
+	var buf bytes.Buffer
+	server.SetAllocationAudit(NewAllocationAudit(&buf))
+
+	_, pubKey, _ := keys.GenerateKeyPair()
+	if _, err := server.RegisterClient(pubKey); err != nil {
+		t.Fatalf("RegisterClient failed: %v", err)
+	}
+	if err := server.RemoveClient(pubKey); err != nil {
+		t.Fatalf("RemoveClient failed: %v", err)
+	}
+
+	// A rolled-back registration never allocated anything, so it is not audited
+	allocator.ip = "fd00::9/128"
+	_, otherKey, _ := keys.GenerateKeyPair()
+	if _, err := server.RegisterClient(otherKey); err == nil {
+		t.Fatal("Expected RegisterClient to fail for mismatched family")
+	}
+
+	var records []AuditRecord
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var record AuditRecord
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("Invalid audit line %q: %v", line, err)
+		}
+		records = append(records, record)
+	}
+
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 audit records, got %d: %s", len(records), buf.String())
+	}
+	for i, action := range []AuditAction{AuditAllocate, AuditRelease} {
+		if records[i].Action != action || records[i].Peer != keys.ShortID(pubKey) || records[i].IP != "10.0.0.9/32" {
+			t.Errorf("Record %d: unexpected %+v", i, records[i])
+		}
+	}
+}
@@ -2,6 +2,7 @@ package vpnserver
 
 import (
 	"context"
+	"time"
 )
 
 // PeerInfo contains information about a connected peer
@@ -9,9 +10,15 @@ type PeerInfo struct {
 	PublicKey  string
 	AllowedIPs []string
 	Endpoint   string
-	LastSeen   int64 // Unix timestamp
-	RxBytes    int64
-	TxBytes    int64
+	// EndpointChangedAt is when the peer last roamed to a new endpoint (Unix timestamp, 0 if never)
+	EndpointChangedAt int64
+	LastSeen          int64  // Unix timestamp
+	RxBytes           uint64 // UAPI counters are unsigned
+	TxBytes           uint64
+	// SourceViolations counts packets from a source other than the peer's assigned IP (source filtering only)
+	SourceViolations int64
+	// Active is set when the last handshake is within the server's PeerActiveWindow
+	Active bool
 }
 
 // ServerConfig contains configuration for the VPN server
@@ -26,8 +33,32 @@ type ServerConfig struct {
 	// Listen port for WireGuard UDP traffic
 	ListenPort int
 
+	// Local address clients should reach the device on (empty = any address)
+	// wireguard-go's bind always listens on every address, so this only sets the advertised
+	// endpoint host; replies leave from the address a packet arrived on (sticky sockets on
+	// Linux), and Fwmark can pin their route on multi-homed hosts
+	ListenAddr string
+
 	// Server IP within the VPN network (e.g., "10.0.0.1/24")
 	ServerIP string
+
+	// Firewall mark applied to outgoing WireGuard packets for policy routing (0 = disabled)
+	Fwmark int
+
+	// Maximum number of allowed IPs a single peer may have (0 = DefaultMaxAllowedIPsPerPeer)
+	MaxAllowedIPsPerPeer int
+
+	// Allocations a registration may try when they collide with other writers (0 = DefaultAllocationAttempts)
+	AllocationAttempts int
+
+	// Inspect decrypted packets for sources other than the peer's assigned IP (off by default)
+	SourceFilter SourceFilterMode
+
+	// Maximum last-handshake age for a peer to count as active (0 = DefaultPeerActiveWindow)
+	PeerActiveWindow time.Duration
+
+	// What to do when a new peer cannot be saved to the peer store (PersistMemory by default)
+	PersistPolicy PersistPolicy
 }
 
 // WireGuardBackend defines the interface for different WireGuard implementations
@@ -54,3 +85,23 @@ type WireGuardBackend interface {
 	// IsRunning returns whether the backend is currently running
 	IsRunning() bool
 }
+
+// PeerCounter is implemented by backends that can count their peers without building PeerInfo
+// Status and metrics poll the count often, so this avoids querying the device each time
+type PeerCounter interface {
+	// PeerCount returns the number of peers on the device
+	PeerCount() int
+}
+
+// Device IPC operations, used as keys of IPCErrorReporter counts
+const (
+	IPCOpSet = "set" // Applying configuration (IpcSet)
+	IPCOpGet = "get" // Querying device state (IpcGet)
+)
+
+// IPCErrorReporter is implemented by backends that configure their device over UAPI
+// Failures that only show up in logs otherwise let operators alert on a wedged device
+type IPCErrorReporter interface {
+	// IPCErrors returns failed device operations counted by IPCOpSet and IPCOpGet
+	IPCErrors() map[string]int64
+}
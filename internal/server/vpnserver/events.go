@@ -0,0 +1,95 @@
+package vpnserver
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/november1306/go-vpn/internal/logging"
+	"github.com/november1306/go-vpn/internal/wireguard/keys"
+)
+
+// PeerEventType identifies a peer lifecycle change
+type PeerEventType string
+
+const (
+	PeerAdded    PeerEventType = "added"
+	PeerRemoved  PeerEventType = "removed"
+	PeerDisabled PeerEventType = "disabled"
+	PeerEnabled  PeerEventType = "enabled"
+)
+
+// peerEventBuffer is how many events a subscriber may fall behind before events are dropped
+const peerEventBuffer = 64
+
+// PeerEvent describes a change to a registered peer
+type PeerEvent struct {
+	Type      PeerEventType `json:"type"`
+	PublicKey string        `json:"publicKey"`
+	IP        string        `json:"ip"` // Peer's allowed IPs, comma separated
+	At        time.Time     `json:"at"`
+}
+
+// eventBus fans peer events out to subscribers without ever blocking the publisher
+type eventBus struct {
+	mu          sync.Mutex
+	subscribers []chan PeerEvent
+
+	dropLog logging.RateLimiter // One warning per interval while a subscriber stays behind
+}
+
+// subscribe registers a new buffered subscriber channel
+func (b *eventBus) subscribe() chan PeerEvent {
+	ch := make(chan PeerEvent, peerEventBuffer)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscribers = append(b.subscribers, ch)
+	return ch
+}
+
+// unsubscribe removes and closes a subscriber channel
+func (b *eventBus) unsubscribe(ch <-chan PeerEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for i, sub := range b.subscribers {
+		if sub == ch {
+			b.subscribers = append(b.subscribers[:i], b.subscribers[i+1:]...)
+			close(sub)
+			return
+		}
+	}
+}
+
+// publish delivers an event to every subscriber, dropping it for those whose buffer is full
+func (b *eventBus) publish(event PeerEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, sub := range b.subscribers {
+		select {
+		case sub <- event:
+		default:
+			if suppressed, ok := b.dropLog.Allow("slow-subscriber"); ok {
+				slog.Warn("Dropping peer event for slow subscriber", "type", event.Type, "peer", keys.ShortID(event.PublicKey), "suppressed", suppressed)
+			}
+		}
+	}
+}
+
+// Subscribe returns a channel that receives peer add, remove, disable and enable events
+// Delivery is best effort: events are dropped if the subscriber falls behind
+func (s *VPNServer) Subscribe() <-chan PeerEvent {
+	return s.events.subscribe()
+}
+
+// Unsubscribe stops delivery to a channel returned by Subscribe and closes it
+func (s *VPNServer) Unsubscribe(ch <-chan PeerEvent) {
+	s.events.unsubscribe(ch)
+}
+
+// emit publishes a peer event stamped with the current time
+func (s *VPNServer) emit(eventType PeerEventType, publicKey, ip string) {
+	s.events.publish(PeerEvent{Type: eventType, PublicKey: publicKey, IP: ip, At: time.Now()})
+}
@@ -0,0 +1,108 @@
+package vpnserver
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/november1306/go-vpn/internal/wireguard/keys"
+)
+
+func receiveEvent(t *testing.T, events <-chan PeerEvent) PeerEvent {
+	t.Helper()
+	select {
+	case event := <-events:
+		return event
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for peer event")
+		return PeerEvent{}
+	}
+}
+
+func TestPeerEvents(t *testing.T) {
+	backend := newFakeBackend()
+	server := NewVPNServerWithPeerStore(backend, NewInMemoryPeerStore())
+
+	ctx := context.Background()
+	if err := server.Start(ctx, newTestServerConfig(t)); err != nil {
+		t.Fatalf("Failed to start VPN server: %v", err)
+	}
+	defer server.Stop(ctx)
+
+	first := server.Subscribe()
+	second := server.Subscribe()
+
+	_, pubKey, _ := keys.GenerateKeyPair()
+
+	t.Run("add", func(t *testing.T) {
+		if err := server.AddClient(pubKey, "10.0.0.2"); err != nil {
+			t.Fatalf("AddClient failed: %v", err)
+		}
+		for _, events := range []<-chan PeerEvent{first, second} {
+			event := receiveEvent(t, events)
+			if event.Type != PeerAdded || event.PublicKey != pubKey || event.IP != "10.0.0.2/32" {
+				t.Errorf("Unexpected add event: %+v", event)
+			}
+			if event.At.IsZero() {
+				t.Error("Expected event timestamp")
+			}
+		}
+	})
+
+	t.Run("disable and enable", func(t *testing.T) {
+		if err := server.SetPeerEnabled(pubKey, false); err != nil {
+			t.Fatalf("SetPeerEnabled(false) failed: %v", err)
+		}
+		if event := receiveEvent(t, first); event.Type != PeerDisabled || event.PublicKey != pubKey {
+			t.Errorf("Unexpected disable event: %+v", event)
+		}
+
+		if err := server.SetPeerEnabled(pubKey, true); err != nil {
+			t.Fatalf("SetPeerEnabled(true) failed: %v", err)
+		}
+		if event := receiveEvent(t, first); event.Type != PeerEnabled || event.IP != "10.0.0.2/32" {
+			t.Errorf("Unexpected enable event: %+v", event)
+		}
+	})
+
+	t.Run("unsubscribe closes channel", func(t *testing.T) {
+		server.Unsubscribe(second)
+		for range second {
+			// Drain events buffered before unsubscribing
+		}
+	})
+
+	t.Run("remove", func(t *testing.T) {
+		if err := server.RemoveClient(pubKey); err != nil {
+			t.Fatalf("RemoveClient failed: %v", err)
+		}
+		event := receiveEvent(t, first)
+		if event.Type != PeerRemoved || event.PublicKey != pubKey || event.IP != "10.0.0.2/32" {
+			t.Errorf("Unexpected remove event: %+v", event)
+		}
+	})
+}
+
+func TestPeerEventsSlowSubscriber(t *testing.T) {
+	var bus eventBus
+	slow := bus.subscribe()
+
+	// Publishing past the buffer must not block
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < peerEventBuffer*2; i++ {
+			bus.publish(PeerEvent{Type: PeerAdded})
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("publish blocked on a full subscriber")
+	}
+
+	if len(slow) != peerEventBuffer {
+		t.Errorf("Expected %d buffered events, got %d", peerEventBuffer, len(slow))
+	}
+}
@@ -39,7 +39,7 @@ func ExampleVPNServer() {
 	// Get server info for clients
 	serverInfo, _ := server.GetServerInfo()
 	fmt.Printf("Server public key: %s\n", serverInfo.PublicKey)
-	fmt.Printf("Clients should connect to: %s\n", serverInfo.Endpoint)
+	fmt.Printf("Clients should connect to: %s\n", serverInfo.Endpoint())
 
 	// Simulate client registration - generate client key
 	_, clientPubKey, _ := keys.GenerateKeyPair()
@@ -0,0 +1,154 @@
+package vpnserver
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/november1306/go-vpn/internal/wireguard/keys"
+)
+
+// fakeBackend is an in-memory WireGuardBackend for tests that don't need a TUN device
+type fakeBackend struct {
+	mu      sync.Mutex
+	running bool
+	peers   map[string][]string
+
+	addPeerHook func() // Called before AddPeer takes effect, if set
+	startHook   func() // Called before Start takes effect, if set
+	starts      int    // Number of Start calls that reached the backend
+
+	addPeerFailures int // Remaining AddPeer calls to reject, simulating a device that is not ready
+	addPeerCalls    int // Number of AddPeer calls that reached the backend
+
+	lastSeen map[string]int64 // Handshake times reported by GetPeers (Unix seconds)
+}
+
+func newFakeBackend() *fakeBackend {
+	return &fakeBackend{peers: make(map[string][]string)}
+}
+
+func (fb *fakeBackend) Start(ctx context.Context, config ServerConfig) error {
+	if fb.startHook != nil {
+		fb.startHook()
+	}
+
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+
+	fb.starts++
+
+	if fb.running {
+		return fmt.Errorf("backend already running")
+	}
+	fb.running = true
+	return nil
+}
+
+func (fb *fakeBackend) Stop(ctx context.Context) error {
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+
+	fb.running = false
+	fb.peers = make(map[string][]string)
+	return nil
+}
+
+func (fb *fakeBackend) AddPeer(publicKey string, allowedIPs []string) error {
+	if fb.addPeerHook != nil {
+		fb.addPeerHook()
+	}
+
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+
+	fb.addPeerCalls++
+	if !fb.running {
+		return fmt.Errorf("backend not running")
+	}
+	if fb.addPeerFailures > 0 {
+		fb.addPeerFailures--
+		return fmt.Errorf("device not ready")
+	}
+	fb.peers[publicKey] = allowedIPs
+	return nil
+}
+
+func (fb *fakeBackend) RemovePeer(publicKey string) error {
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+
+	if !fb.running {
+		return fmt.Errorf("backend not running")
+	}
+	delete(fb.peers, publicKey)
+	return nil
+}
+
+func (fb *fakeBackend) GetPeers() ([]PeerInfo, error) {
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+
+	if !fb.running {
+		return nil, fmt.Errorf("backend not running")
+	}
+
+	peers := make([]PeerInfo, 0, len(fb.peers))
+	for publicKey, allowedIPs := range fb.peers {
+		peers = append(peers, PeerInfo{PublicKey: publicKey, AllowedIPs: allowedIPs, LastSeen: fb.lastSeen[publicKey]})
+	}
+	return peers, nil
+}
+
+func (fb *fakeBackend) PeerCount() int {
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+
+	if !fb.running {
+		return 0
+	}
+	return len(fb.peers)
+}
+
+func (fb *fakeBackend) IsRunning() bool {
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+
+	return fb.running
+}
+
+// newTestServerConfig returns a valid server configuration for tests
+func newTestServerConfig(t *testing.T) ServerConfig {
+	t.Helper()
+
+	serverPrivKey, _, err := keys.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("Failed to generate server key: %v", err)
+	}
+
+	return ServerConfig{
+		InterfaceName: "wg-fake",
+		PrivateKey:    serverPrivKey,
+		ListenPort:    51820,
+		ServerIP:      "10.0.0.1/24",
+	}
+}
+
+// startFakeServer starts a VPNServer backed by a fakeBackend and a temp data dir
+func startFakeServer(t *testing.T, config ServerConfig) (*VPNServer, *fakeBackend) {
+	t.Helper()
+
+	backend := newFakeBackend()
+	server, err := NewVPNServer(backend, t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create VPN server: %v", err)
+	}
+
+	if err := server.Start(context.Background(), config); err != nil {
+		t.Fatalf("Failed to start VPN server: %v", err)
+	}
+	t.Cleanup(func() { server.Stop(context.Background()) })
+
+	return server, backend
+}
@@ -48,7 +48,7 @@ func TestVPNServerClientIntegration(t *testing.T) {
 	}
 
 	config := ServerConfig{
-		InterfaceName: "wg-test-integration",
+		InterfaceName: "wg-test-integ",
 		PrivateKey:    serverPrivKey,
 		ListenPort:    51825,
 		ServerIP:      "10.98.0.1/24",
@@ -293,7 +293,7 @@ func TestHTTPAPIIntegration(t *testing.T) {
 		// Return success response
 		response := RegisterResponse{
 			ServerPublicKey: serverInfo.PublicKey,
-			ServerEndpoint:  serverInfo.Endpoint,
+			ServerEndpoint:  serverInfo.Endpoint(),
 			ClientIP:        clientIP + "/32",
 			Message:         "Registration successful - VPN tunnel established",
 			Timestamp:       time.Now().UTC().Format(time.RFC3339),
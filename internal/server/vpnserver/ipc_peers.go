@@ -0,0 +1,123 @@
+package vpnserver
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ipcPeer holds the per-peer fields we read back from a UAPI get
+type ipcPeer struct {
+	Endpoint string
+	RxBytes  uint64
+	TxBytes  uint64
+
+	LastHandshake int64 // Unix seconds; 0 if the peer never completed a handshake
+}
+
+// parseIpcPeers parses `IpcGet` output into peers keyed by base64 public key
+// Device-level keys before the first public_key line are ignored
+func parseIpcPeers(ipc string) map[string]ipcPeer {
+	peers := make(map[string]ipcPeer)
+
+	var current string
+	scanner := bufio.NewScanner(strings.NewReader(ipc))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), "=")
+		if !ok {
+			continue
+		}
+
+		switch key {
+		case "public_key":
+			keyBytes, err := hex.DecodeString(value)
+			if err != nil || len(keyBytes) != 32 {
+				current = ""
+				continue
+			}
+			current = base64.StdEncoding.EncodeToString(keyBytes)
+			peers[current] = ipcPeer{}
+		case "endpoint":
+			if current != "" {
+				peer := peers[current]
+				peer.Endpoint = value
+				peers[current] = peer
+			}
+		case "rx_bytes", "tx_bytes":
+			// Counters are unsigned; parsing as int64 would reject or wrap values past 2^63
+			n, err := strconv.ParseUint(value, 10, 64)
+			if current == "" || err != nil {
+				continue
+			}
+			peer := peers[current]
+			if key == "rx_bytes" {
+				peer.RxBytes = n
+			} else {
+				peer.TxBytes = n
+			}
+			peers[current] = peer
+		case "last_handshake_time_sec":
+			sec, err := strconv.ParseInt(value, 10, 64)
+			if current == "" || err != nil || sec < 0 {
+				continue
+			}
+			peer := peers[current]
+			peer.LastHandshake = sec
+			peers[current] = peer
+		}
+	}
+
+	return peers
+}
+
+// trackedEndpoint is the last endpoint seen for a peer and when it last changed
+type trackedEndpoint struct {
+	endpoint  string
+	changedAt time.Time
+}
+
+// endpointTracker detects peer roaming by comparing successive IpcGet snapshots
+type endpointTracker struct {
+	endpoints map[string]trackedEndpoint
+	now       func() time.Time
+}
+
+func newEndpointTracker() *endpointTracker {
+	return &endpointTracker{
+		endpoints: make(map[string]trackedEndpoint),
+		now:       time.Now,
+	}
+}
+
+// observe records a snapshot, timestamping peers whose endpoint moved
+// The first endpoint learned for a peer is not a roam and leaves changedAt zero
+func (et *endpointTracker) observe(peers map[string]ipcPeer) {
+	for publicKey, peer := range peers {
+		if peer.Endpoint == "" {
+			continue
+		}
+
+		previous, seen := et.endpoints[publicKey]
+		switch {
+		case !seen || previous.endpoint == "":
+			et.endpoints[publicKey] = trackedEndpoint{endpoint: peer.Endpoint, changedAt: previous.changedAt}
+		case previous.endpoint != peer.Endpoint:
+			et.endpoints[publicKey] = trackedEndpoint{endpoint: peer.Endpoint, changedAt: et.now()}
+		}
+	}
+
+	// Forget peers that are no longer on the device
+	for publicKey := range et.endpoints {
+		if _, exists := peers[publicKey]; !exists {
+			delete(et.endpoints, publicKey)
+		}
+	}
+}
+
+// changedAt returns when the peer last roamed, or zero if it never has
+func (et *endpointTracker) changedAt(publicKey string) time.Time {
+	return et.endpoints[publicKey].changedAt
+}
@@ -0,0 +1,152 @@
+package vpnserver
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/november1306/go-vpn/internal/wireguard/keys"
+)
+
+// ipcSnapshot renders a minimal IpcGet response for the given peers
+func ipcSnapshot(t *testing.T, endpoints map[string]string) string {
+	t.Helper()
+
+	ipc := "private_key=0000000000000000000000000000000000000000000000000000000000000000\nlisten_port=51820\n"
+	for publicKey, endpoint := range endpoints {
+		keyBytes, err := base64.StdEncoding.DecodeString(publicKey)
+		if err != nil {
+			t.Fatalf("Invalid test key: %v", err)
+		}
+		ipc += fmt.Sprintf("public_key=%s\n", hex.EncodeToString(keyBytes))
+		if endpoint != "" {
+			ipc += fmt.Sprintf("endpoint=%s\n", endpoint)
+		}
+		ipc += "allowed_ip=10.0.0.2/32\n"
+	}
+	return ipc + "errno=0\n\n"
+}
+
+func TestParseIpcPeers(t *testing.T) {
+	_, peerA, _ := keys.GenerateKeyPair()
+	_, peerB, _ := keys.GenerateKeyPair()
+
+	peers := parseIpcPeers(ipcSnapshot(t, map[string]string{
+		peerA: "203.0.113.5:41000",
+		peerB: "",
+	}))
+
+	if len(peers) != 2 {
+		t.Fatalf("Expected 2 peers, got %d: %v", len(peers), peers)
+	}
+	if peers[peerA].Endpoint != "203.0.113.5:41000" {
+		t.Errorf("Peer A endpoint = %q, want 203.0.113.5:41000", peers[peerA].Endpoint)
+	}
+	if peers[peerB].Endpoint != "" {
+		t.Errorf("Peer B endpoint = %q, want empty", peers[peerB].Endpoint)
+	}
+}
+
+func TestParseIpcPeersTransfer(t *testing.T) {
+	_, peerKey, _ := keys.GenerateKeyPair()
+	keyBytes, _ := base64.StdEncoding.DecodeString(peerKey)
+
+	// Near-max counters would be negative or rejected if parsed as int64
+	ipc := fmt.Sprintf("public_key=%s\nrx_bytes=18446744073709551610\ntx_bytes=9223372036854775808\nerrno=0\n\n",
+		hex.EncodeToString(keyBytes))
+
+	peer := parseIpcPeers(ipc)[peerKey]
+	if peer.RxBytes != math.MaxUint64-5 {
+		t.Errorf("RxBytes = %d, want %d", peer.RxBytes, uint64(math.MaxUint64-5))
+	}
+	if peer.TxBytes != 1<<63 {
+		t.Errorf("TxBytes = %d, want %d", peer.TxBytes, uint64(1<<63))
+	}
+
+	// Out-of-range values are ignored rather than wrapped
+	ipc = fmt.Sprintf("public_key=%s\nrx_bytes=18446744073709551616\n", hex.EncodeToString(keyBytes))
+	if peer := parseIpcPeers(ipc)[peerKey]; peer.RxBytes != 0 {
+		t.Errorf("Overflowing counter should be ignored, got %d", peer.RxBytes)
+	}
+}
+
+func TestParseIpcPeersStats(t *testing.T) {
+	_, peerA, _ := keys.GenerateKeyPair()
+	_, peerB, _ := keys.GenerateKeyPair()
+	hexKey := func(publicKey string) string {
+		keyBytes, _ := base64.StdEncoding.DecodeString(publicKey)
+		return hex.EncodeToString(keyBytes)
+	}
+
+	ipc := "private_key=0000000000000000000000000000000000000000000000000000000000000000\n" +
+		"listen_port=51820\n" +
+		"public_key=" + hexKey(peerA) + "\n" +
+		"endpoint=198.51.100.7:51000\n" +
+		"last_handshake_time_sec=1700000000\n" +
+		"last_handshake_time_nsec=250000000\n" +
+		"tx_bytes=2048\n" +
+		"rx_bytes=4096\n" +
+		"persistent_keepalive_interval=25\n" +
+		"allowed_ip=10.0.0.2/32\n" +
+		"public_key=" + hexKey(peerB) + "\n" +
+		"last_handshake_time_sec=0\n" +
+		"tx_bytes=0\n" +
+		"rx_bytes=0\n" +
+		"allowed_ip=10.0.0.3/32\n" +
+		"errno=0\n\n"
+
+	peers := parseIpcPeers(ipc)
+	want := map[string]ipcPeer{
+		peerA: {Endpoint: "198.51.100.7:51000", RxBytes: 4096, TxBytes: 2048, LastHandshake: 1700000000},
+		peerB: {},
+	}
+	if len(peers) != len(want) {
+		t.Fatalf("Expected %d peers, got %d: %v", len(want), len(peers), peers)
+	}
+	for publicKey, expected := range want {
+		if got := peers[publicKey]; got != expected {
+			t.Errorf("Peer %s = %+v, want %+v", keys.ShortID(publicKey), got, expected)
+		}
+	}
+}
+
+func TestEndpointTracker(t *testing.T) {
+	_, peer, _ := keys.GenerateKeyPair()
+
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	tracker := newEndpointTracker()
+	tracker.now = func() time.Time { return now }
+
+	steps := []struct {
+		name        string
+		endpoint    string
+		advance     time.Duration
+		wantChanged time.Time
+	}{
+		{name: "no handshake yet", endpoint: ""},
+		{name: "first endpoint is not a roam", endpoint: "203.0.113.5:41000", advance: time.Minute},
+		{name: "same endpoint", endpoint: "203.0.113.5:41000", advance: time.Minute},
+		{name: "roamed to new endpoint", endpoint: "198.51.100.7:52000", advance: time.Minute, wantChanged: now.Add(3 * time.Minute)},
+		{name: "stable after roam", endpoint: "198.51.100.7:52000", advance: time.Minute, wantChanged: now.Add(3 * time.Minute)},
+		{name: "roamed again", endpoint: "203.0.113.5:41001", advance: time.Minute, wantChanged: now.Add(5 * time.Minute)},
+	}
+
+	for _, step := range steps {
+		now = now.Add(step.advance)
+		tracker.observe(parseIpcPeers(ipcSnapshot(t, map[string]string{peer: step.endpoint})))
+
+		if got := tracker.changedAt(peer); !got.Equal(step.wantChanged) {
+			t.Errorf("%s: changedAt = %v, want %v", step.name, got, step.wantChanged)
+		}
+	}
+
+	t.Run("removed peer is forgotten", func(t *testing.T) {
+		tracker.observe(parseIpcPeers(ipcSnapshot(t, nil)))
+		if got := tracker.changedAt(peer); !got.IsZero() {
+			t.Errorf("Expected removed peer to be forgotten, got %v", got)
+		}
+	})
+}
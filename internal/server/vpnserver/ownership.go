@@ -0,0 +1,60 @@
+package vpnserver
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/november1306/go-vpn/internal/wireguard/keys"
+)
+
+// ErrProofReused is returned when a key ownership proof has already been accepted
+var ErrProofReused = errors.New("key ownership proof already used")
+
+// proofCache remembers accepted proofs until they expire so a captured request can't be replayed
+type proofCache struct {
+	mu   sync.Mutex
+	seen map[string]time.Time // Proof -> time it stops being valid
+}
+
+// claim records proof as used, reporting false if it was already claimed
+func (c *proofCache) claim(proof string, expires, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.seen == nil {
+		c.seen = make(map[string]time.Time)
+	}
+	for p, exp := range c.seen {
+		if now.After(exp) {
+			delete(c.seen, p)
+		}
+	}
+	if _, used := c.seen[proof]; used {
+		return false
+	}
+	c.seen[proof] = expires
+	return true
+}
+
+// VerifyKeyOwnership checks that a request about publicKey was made by the holder of its private key
+// See keys.ProveOwnership; each proof is accepted once
+func (s *VPNServer) VerifyKeyOwnership(publicKey, proof string, timestamp int64, action string, fields ...string) error {
+	s.mu.RLock()
+	running := s.running
+	serverPrivateKey := s.config.PrivateKey
+	s.mu.RUnlock()
+
+	if !running {
+		return ErrServerNotRunning
+	}
+
+	now := time.Now()
+	if err := keys.VerifyOwnership(serverPrivateKey, publicKey, proof, timestamp, now, action, fields...); err != nil {
+		return err
+	}
+	if !s.usedProofs.claim(proof, time.Unix(timestamp, 0).Add(keys.ProofMaxAge), now) {
+		return ErrProofReused
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package vpnserver
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/november1306/go-vpn/internal/wireguard/keys"
+)
+
+func TestVerifyKeyOwnership(t *testing.T) {
+	config := newTestServerConfig(t)
+	serverPubKey, err := keys.PublicKeyFromPrivate(config.PrivateKey)
+	if err != nil {
+		t.Fatalf("Failed to derive server public key: %v", err)
+	}
+	server, _ := startFakeServer(t, config)
+
+	clientPriv, clientPub, _ := keys.GenerateKeyPair()
+	_, otherPub, _ := keys.GenerateKeyPair()
+
+	prove := func() (string, int64) {
+		t.Helper()
+		timestamp := time.Now().Unix()
+		proof, err := keys.ProveOwnership(clientPriv, serverPubKey, timestamp, keys.ProofUnregister, clientPub)
+		if err != nil {
+			t.Fatalf("ProveOwnership failed: %v", err)
+		}
+		return proof, timestamp
+	}
+
+	proof, timestamp := prove()
+	if err := server.VerifyKeyOwnership(otherPub, proof, timestamp, keys.ProofUnregister, clientPub); !errors.Is(err, keys.ErrInvalidProof) {
+		t.Errorf("Proof for another key: expected ErrInvalidProof, got %v", err)
+	}
+	if err := server.VerifyKeyOwnership(clientPub, proof, timestamp, keys.ProofUnregister, clientPub); err != nil {
+		t.Fatalf("Valid proof rejected: %v", err)
+	}
+	if err := server.VerifyKeyOwnership(clientPub, proof, timestamp, keys.ProofUnregister, clientPub); !errors.Is(err, ErrProofReused) {
+		t.Errorf("Replayed proof: expected ErrProofReused, got %v", err)
+	}
+
+	server.Stop(context.Background())
+	proof, timestamp = prove()
+	if err := server.VerifyKeyOwnership(clientPub, proof, timestamp, keys.ProofUnregister, clientPub); !errors.Is(err, ErrServerNotRunning) {
+		t.Errorf("Stopped server: expected ErrServerNotRunning, got %v", err)
+	}
+}
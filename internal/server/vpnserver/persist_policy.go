@@ -0,0 +1,62 @@
+package vpnserver
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/november1306/go-vpn/internal/wireguard/keys"
+)
+
+// PersistPolicy decides what happens to a new peer the peer store fails to save,
+// e.g. because the disk filled up or the data directory became read-only
+type PersistPolicy string
+
+const (
+	PersistMemory PersistPolicy = ""       // Keep the peer in memory only and flag the store as unsaved (default)
+	PersistStrict PersistPolicy = "strict" // Fail the registration and roll back the device peer
+)
+
+// ErrPeerNotPersisted is returned under PersistStrict when a new peer could not be saved
+var ErrPeerNotPersisted = errors.New("peer could not be persisted")
+
+// ParsePersistPolicy validates a policy name from configuration ("memory" or "strict")
+func ParsePersistPolicy(value string) (PersistPolicy, error) {
+	switch value {
+	case "", "memory":
+		return PersistMemory, nil
+	case string(PersistStrict):
+		return PersistStrict, nil
+	default:
+		return PersistMemory, fmt.Errorf("invalid persist policy %q (want memory or strict)", value)
+	}
+}
+
+// persistNewPeer saves a peer already added to the backend, applying the configured policy on failure
+// Callers must hold s.mu
+func (s *VPNServer) persistNewPeer(publicKey string, allowedIPs []string) error {
+	previous, existed := s.peerStore.GetPeer(publicKey)
+
+	err := s.peerStore.AddPeer(publicKey, strings.Join(allowedIPs, ","))
+	if err == nil {
+		return nil
+	}
+
+	if s.config.PersistPolicy != PersistStrict {
+		slog.Warn("Failed to persist peer configuration; keeping it in memory only", "peer", keys.ShortID(publicKey), "error", err)
+		return nil
+	}
+
+	// Put the device and store back as they were, so the peer exists nowhere rather than only in memory
+	s.peerStore.restorePeer(publicKey, previous)
+	// AddPeer appends allowed IPs, so a replaced peer is removed before its old entry is re-added
+	rollbackErr := s.backend.RemovePeer(publicKey)
+	if rollbackErr == nil && existed {
+		rollbackErr = s.backend.AddPeer(publicKey, strings.Split(previous.AllowedIPs, ","))
+	}
+	if rollbackErr != nil {
+		slog.Error("Failed to roll back unpersisted peer", "peer", keys.ShortID(publicKey), "error", rollbackErr)
+	}
+	return fmt.Errorf("%w: %v", ErrPeerNotPersisted, err)
+}
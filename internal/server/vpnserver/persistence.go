@@ -2,18 +2,63 @@ package vpnserver
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
 	"sync"
+	"syscall"
 	"time"
+
+	"github.com/november1306/go-vpn/internal/ipam"
+	"github.com/november1306/go-vpn/internal/wireguard/keys"
 )
 
+// ErrPeerNotFound is returned when an operation targets an unregistered peer
+var ErrPeerNotFound = errors.New("peer not found")
+
+// ErrPeerExists is returned when a public key is already registered
+var ErrPeerExists = errors.New("peer already registered")
+
 // PeerConfig represents a persisted peer configuration
 type PeerConfig struct {
 	PublicKey    string    `json:"publicKey"`
 	AllowedIPs   string    `json:"allowedIPs"`
 	RegisteredAt time.Time `json:"registeredAt"`
+	// Disabled peers keep their registration and IP but are not loaded on the device
+	Disabled bool `json:"disabled,omitempty"`
+
+	// Operator annotations; never sent to the WireGuard device
+	Label string `json:"label,omitempty"`
+	Notes string `json:"notes,omitempty"`
+}
+
+const (
+	// MaxPeerLabelLength caps PeerConfig.Label in bytes
+	MaxPeerLabelLength = 64
+
+	// MaxPeerNotesLength caps PeerConfig.Notes in bytes
+	MaxPeerNotesLength = 1024
+)
+
+// ErrPeerMetadataTooLong is returned when a label or notes exceed their length limit
+var ErrPeerMetadataTooLong = errors.New("peer metadata too long")
+
+// PeerMetadata is a partial update of a peer's annotations; nil fields are left unchanged
+type PeerMetadata struct {
+	Label *string `json:"label"`
+	Notes *string `json:"notes"`
+}
+
+// GetAssignedIP implements ipam.UserIPInfo so stored peers can drive IP allocation
+// Returns the first allowed IP, which is the client's assigned VPN address
+func (pc *PeerConfig) GetAssignedIP() string {
+	assigned, _, _ := strings.Cut(pc.AllowedIPs, ",")
+	return assigned
 }
 
 // PeerStore manages persistent storage of WireGuard peer configurations
@@ -21,11 +66,42 @@ type PeerConfig struct {
 type PeerStore struct {
 	mu       sync.RWMutex
 	peers    map[string]*PeerConfig
-	filePath string
+	filePath string // Empty for in-memory stores
+
+	// quarantined holds peers dropped at load because they claimed another peer's allowed IP
+	quarantined map[string]*PeerConfig
+
+	unsaved bool // The last save failed, so memory holds changes the file lacks
+}
+
+// CorruptPolicy decides what opening a peer store does with a peers.json that can't be parsed
+type CorruptPolicy string
+
+const (
+	CorruptRecover CorruptPolicy = ""       // Move the file aside as peers.json.corrupt.<timestamp> and start empty (default)
+	CorruptStrict  CorruptPolicy = "strict" // Fail to open the store, leaving the file for the operator to repair
+)
+
+// ParseCorruptPolicy validates a policy name from configuration ("recover" or "strict")
+func ParseCorruptPolicy(value string) (CorruptPolicy, error) {
+	switch value {
+	case "", "recover":
+		return CorruptRecover, nil
+	case string(CorruptStrict):
+		return CorruptStrict, nil
+	default:
+		return CorruptRecover, fmt.Errorf("invalid corrupt peer store policy %q (want recover or strict)", value)
+	}
 }
 
 // NewPeerStore creates a new peer store with the specified storage file
+// A corrupt file is backed up and replaced by an empty store; see NewPeerStoreWithPolicy
 func NewPeerStore(dataDir string) (*PeerStore, error) {
+	return NewPeerStoreWithPolicy(dataDir, CorruptRecover)
+}
+
+// NewPeerStoreWithPolicy creates a peer store, handling an unparseable storage file per policy
+func NewPeerStoreWithPolicy(dataDir string, policy CorruptPolicy) (*PeerStore, error) {
 	if err := os.MkdirAll(dataDir, 0700); err != nil {
 		return nil, fmt.Errorf("failed to create data directory: %w", err)
 	}
@@ -38,13 +114,26 @@ func NewPeerStore(dataDir string) (*PeerStore, error) {
 	}
 
 	// Load existing peers
-	if err := store.load(); err != nil {
+	err := store.load()
+	var corrupt *corruptFileError
+	if errors.As(err, &corrupt) && policy != CorruptStrict {
+		err = store.recoverCorrupt(corrupt)
+	}
+	if err != nil {
 		return nil, fmt.Errorf("failed to load peer store: %w", err)
 	}
 
 	return store, nil
 }
 
+// NewInMemoryPeerStore creates a peer store that is never written to disk
+// Useful for tests and deployments where peers re-register after restart
+func NewInMemoryPeerStore() *PeerStore {
+	return &PeerStore{
+		peers: make(map[string]*PeerConfig),
+	}
+}
+
 // AddPeer adds a peer configuration to persistent storage
 func (ps *PeerStore) AddPeer(publicKey, allowedIPs string) error {
 	ps.mu.Lock()
@@ -68,6 +157,79 @@ func (ps *PeerStore) RemovePeer(publicKey string) error {
 	return ps.save()
 }
 
+// SetPeerDisabled flags a stored peer as disabled or enabled
+func (ps *PeerStore) SetPeerDisabled(publicKey string, disabled bool) error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	peer, exists := ps.peers[publicKey]
+	if !exists {
+		return ErrPeerNotFound
+	}
+
+	// Replace rather than mutate so callers holding the old pointer don't race
+	updated := *peer
+	updated.Disabled = disabled
+	ps.peers[publicKey] = &updated
+
+	return ps.save()
+}
+
+// UpdatePeerMetadata applies a label/notes update to a stored peer and returns the result
+// Only the store changes: the live device config is not touched
+func (ps *PeerStore) UpdatePeerMetadata(publicKey string, update PeerMetadata) (*PeerConfig, error) {
+	if update.Label != nil && len(*update.Label) > MaxPeerLabelLength {
+		return nil, fmt.Errorf("%w: label exceeds %d bytes", ErrPeerMetadataTooLong, MaxPeerLabelLength)
+	}
+	if update.Notes != nil && len(*update.Notes) > MaxPeerNotesLength {
+		return nil, fmt.Errorf("%w: notes exceed %d bytes", ErrPeerMetadataTooLong, MaxPeerNotesLength)
+	}
+
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	peer, exists := ps.peers[publicKey]
+	if !exists {
+		return nil, ErrPeerNotFound
+	}
+
+	updated := *peer
+	if update.Label != nil {
+		updated.Label = *update.Label
+	}
+	if update.Notes != nil {
+		updated.Notes = *update.Notes
+	}
+	ps.peers[publicKey] = &updated
+
+	if err := ps.save(); err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+// ReplacePeerKey moves a stored peer to a new public key in a single write
+// Allowed IPs, registration time, disabled state and annotations carry over
+func (ps *PeerStore) ReplacePeerKey(oldPublicKey, newPublicKey string) error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	peer, exists := ps.peers[oldPublicKey]
+	if !exists {
+		return ErrPeerNotFound
+	}
+	if _, taken := ps.peers[newPublicKey]; taken {
+		return ErrPeerExists
+	}
+
+	updated := *peer
+	updated.PublicKey = newPublicKey
+	delete(ps.peers, oldPublicKey)
+	ps.peers[newPublicKey] = &updated
+
+	return ps.save()
+}
+
 // GetPeer retrieves a peer configuration
 func (ps *PeerStore) GetPeer(publicKey string) (*PeerConfig, bool) {
 	ps.mu.RLock()
@@ -77,6 +239,26 @@ func (ps *PeerStore) GetPeer(publicKey string) (*PeerConfig, bool) {
 	return peer, exists
 }
 
+// restorePeer puts back an entry as it was before a failed save, without saving (nil removes it)
+func (ps *PeerStore) restorePeer(publicKey string, previous *PeerConfig) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	if previous == nil {
+		delete(ps.peers, publicKey)
+		return
+	}
+	ps.peers[publicKey] = previous
+}
+
+// Unsaved reports whether the last save failed, leaving peer changes in memory only
+// It clears once a later save succeeds
+func (ps *PeerStore) Unsaved() bool {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+	return ps.unsaved
+}
+
 // ListPeers returns all registered peers
 func (ps *PeerStore) ListPeers() map[string]*PeerConfig {
 	ps.mu.RLock()
@@ -92,6 +274,10 @@ func (ps *PeerStore) ListPeers() map[string]*PeerConfig {
 
 // load reads peer configurations from disk
 func (ps *PeerStore) load() error {
+	if ps.filePath == "" {
+		return nil // In-memory store
+	}
+
 	if _, err := os.Stat(ps.filePath); os.IsNotExist(err) {
 		// File doesn't exist yet, that's okay
 		return nil
@@ -109,34 +295,303 @@ func (ps *PeerStore) load() error {
 
 	var peers map[string]*PeerConfig
 	if err := json.Unmarshal(data, &peers); err != nil {
-		return fmt.Errorf("failed to parse peer store file: %w", err)
+		return &corruptFileError{err: err}
+	}
+
+	// A hand-edited file can give two peers the same IP, which would corrupt routing on restore
+	quarantined := quarantineDuplicateIPs(peers)
+	if len(quarantined) > 0 {
+		if err := ps.saveQuarantine(quarantined); err != nil {
+			return err
+		}
+		for publicKey, peer := range quarantined {
+			slog.Warn("Quarantined peer with duplicate allowed IP",
+				"peer", keys.ShortID(publicKey), "allowedIPs", peer.AllowedIPs, "file", ps.quarantinePath())
+		}
 	}
 
 	ps.peers = peers
+	ps.quarantined = quarantined
+	return nil
+}
+
+// corruptFileError reports a peer store file that exists but isn't valid JSON
+type corruptFileError struct {
+	err error
+}
+
+func (e *corruptFileError) Error() string {
+	return fmt.Sprintf("failed to parse peer store file: %v", e.err)
+}
+
+func (e *corruptFileError) Unwrap() error {
+	return e.err
+}
+
+// recoverCorrupt moves an unparseable peer store file aside so the server can start empty
+// Peers listed in the backup are gone until they re-register or the operator repairs and restores the file
+func (ps *PeerStore) recoverCorrupt(corrupt *corruptFileError) error {
+	backupPath := fmt.Sprintf("%s.corrupt.%s", ps.filePath, time.Now().UTC().Format("20060102T150405Z"))
+	if err := renameWithRetry(ps.filePath, backupPath); err != nil {
+		return fmt.Errorf("%w (backing it up also failed: %v)", corrupt, err)
+	}
+
+	slog.Error("Peer store file is corrupt; moved it aside and started with no peers - clients must re-register",
+		"file", ps.filePath, "backup", backupPath, "error", corrupt.err)
+	ps.peers = make(map[string]*PeerConfig)
+	return nil
+}
+
+// quarantineDuplicateIPs removes peers whose allowed IPs are already claimed by another peer
+// The earliest registration keeps the IP; later claimants are removed from peers and returned
+func quarantineDuplicateIPs(peers map[string]*PeerConfig) map[string]*PeerConfig {
+	publicKeys := make([]string, 0, len(peers))
+	for publicKey := range peers {
+		publicKeys = append(publicKeys, publicKey)
+	}
+	sort.Slice(publicKeys, func(i, j int) bool {
+		a, b := peers[publicKeys[i]], peers[publicKeys[j]]
+		if !a.RegisteredAt.Equal(b.RegisteredAt) {
+			return a.RegisteredAt.Before(b.RegisteredAt)
+		}
+		return publicKeys[i] < publicKeys[j]
+	})
+
+	quarantined := make(map[string]*PeerConfig)
+	claimed := make(map[string]bool)
+	for _, publicKey := range publicKeys {
+		ips := normalizedAllowedIPs(peers[publicKey].AllowedIPs)
+
+		conflict := false
+		for _, ip := range ips {
+			conflict = conflict || claimed[ip]
+		}
+		if conflict {
+			quarantined[publicKey] = peers[publicKey]
+			delete(peers, publicKey)
+			continue
+		}
+		for _, ip := range ips {
+			claimed[ip] = true
+		}
+	}
+	return quarantined
+}
+
+// normalizedAllowedIPs splits a persisted allowed IPs list into canonical prefixes
+// "10.0.0.2" and "10.0.0.2/32" compare equal
+func normalizedAllowedIPs(allowedIPs string) []string {
+	var ips []string
+	for _, ip := range strings.Split(allowedIPs, ",") {
+		ip = strings.TrimSpace(ip)
+		if ip == "" {
+			continue
+		}
+		if prefix, err := canonicalAllowedIP(ip); err == nil {
+			ip = prefix.String()
+		}
+		ips = append(ips, ip)
+	}
+	return ips
+}
+
+// claimedBy returns the peer other than publicKey whose allowed IPs include ip, if any
+func (ps *PeerStore) claimedBy(ip, publicKey string) (string, bool) {
+	target := normalizedAllowedIPs(ip)
+	if len(target) == 0 {
+		return "", false
+	}
+
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+
+	for owner, peer := range ps.peers {
+		if owner == publicKey {
+			continue
+		}
+		for _, allowed := range normalizedAllowedIPs(peer.AllowedIPs) {
+			if allowed == target[0] {
+				return owner, true
+			}
+		}
+	}
+	return "", false
+}
+
+// Quarantined returns peers dropped at load because of duplicate allowed IPs
+func (ps *PeerStore) Quarantined() map[string]*PeerConfig {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+
+	result := make(map[string]*PeerConfig, len(ps.quarantined))
+	for k, v := range ps.quarantined {
+		result[k] = v
+	}
+	return result
+}
+
+// quarantinePath is where quarantined peers are kept for the operator to resolve
+func (ps *PeerStore) quarantinePath() string {
+	return filepath.Join(filepath.Dir(ps.filePath), "peers.quarantine.json")
+}
+
+// saveQuarantine adds peers to the quarantine file, keeping entries from earlier loads
+// Written before peers.json is next saved, so the conflicting entries are never lost
+func (ps *PeerStore) saveQuarantine(peers map[string]*PeerConfig) error {
+	existing := make(map[string]*PeerConfig)
+	if data, err := os.ReadFile(ps.quarantinePath()); err == nil && len(data) > 0 {
+		if err := json.Unmarshal(data, &existing); err != nil {
+			return fmt.Errorf("failed to parse peer quarantine file: %w", err)
+		}
+	}
+	for publicKey, peer := range peers {
+		existing[publicKey] = peer
+	}
+
+	data, err := json.MarshalIndent(existing, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal peer quarantine: %w", err)
+	}
+	if err := writeFileSync(ps.quarantinePath(), data, 0600); err != nil {
+		return fmt.Errorf("failed to write peer quarantine file: %w", err)
+	}
 	return nil
 }
 
 // save writes peer configurations to disk
 func (ps *PeerStore) save() error {
+	if ps.filePath == "" {
+		return nil // In-memory store
+	}
+
+	err := ps.writeFile()
+	ps.unsaved = err != nil
+	return err
+}
+
+// writeFile atomically replaces the peer store file with the current peers
+func (ps *PeerStore) writeFile() error {
 	data, err := json.MarshalIndent(ps.peers, "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to marshal peer store: %w", err)
 	}
 
 	// Write to temporary file first, then rename (atomic operation)
+	// O_TRUNC makes this retry-safe if a previous attempt left a stale temp file
 	tempPath := ps.filePath + ".tmp"
-	if err := os.WriteFile(tempPath, data, 0600); err != nil {
+	if err := writeFileSync(tempPath, data, 0600); err != nil {
+		os.Remove(tempPath) // Clean up temp file
 		return fmt.Errorf("failed to write temporary peer store file: %w", err)
 	}
 
-	if err := os.Rename(tempPath, ps.filePath); err != nil {
+	if err := renameWithRetry(tempPath, ps.filePath); err != nil {
 		os.Remove(tempPath) // Clean up temp file
 		return fmt.Errorf("failed to replace peer store file: %w", err)
 	}
 
+	// Sync the directory so the rename itself survives a power loss
+	if err := syncDir(filepath.Dir(ps.filePath)); err != nil {
+		return fmt.Errorf("failed to sync peer store directory: %w", err)
+	}
+
 	return nil
 }
 
+// writeFileSync writes data to a file and flushes it to stable storage before closing
+func writeFileSync(path string, data []byte, perm os.FileMode) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+const (
+	// renameAttempts bounds retries of a rename blocked by another process holding the file
+	renameAttempts = 5
+
+	// errSharingViolation is Windows' ERROR_SHARING_VIOLATION
+	errSharingViolation syscall.Errno = 32
+)
+
+var (
+	// renameFile is os.Rename, swappable in tests
+	renameFile = os.Rename
+
+	// renameRetryDelay is the first backoff between rename attempts; it doubles each retry
+	renameRetryDelay = 10 * time.Millisecond
+)
+
+// renameWithRetry renames oldPath to newPath, retrying briefly on transient lock errors
+// On Windows, antivirus scanners and backup tools can hold the target open for a moment
+func renameWithRetry(oldPath, newPath string) error {
+	delay := renameRetryDelay
+	var err error
+	for attempt := 1; attempt <= renameAttempts; attempt++ {
+		err = renameFile(oldPath, newPath)
+		if err == nil || !isTransientRenameError(err) {
+			return err
+		}
+		if attempt < renameAttempts {
+			time.Sleep(delay)
+			delay *= 2
+		}
+	}
+	return fmt.Errorf("gave up after %d attempts: %w", renameAttempts, err)
+}
+
+// isTransientRenameError reports whether a rename failed only because the file is briefly locked
+func isTransientRenameError(err error) bool {
+	var errno syscall.Errno
+	if !errors.As(err, &errno) {
+		return false
+	}
+	if errno == syscall.EBUSY {
+		return true
+	}
+	// 32 is EPIPE on Unix, so only treat it as a sharing violation on Windows
+	return runtime.GOOS == "windows" && errno == errSharingViolation
+}
+
+// syncDir flushes directory metadata (e.g. a completed rename) to stable storage
+func syncDir(dir string) error {
+	if runtime.GOOS == "windows" {
+		// Directories cannot be opened for sync on Windows; NTFS journals renames
+		return nil
+	}
+
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
+
+// AssignedIPs returns the stored peers as allocation inputs for the IP allocator
+func (ps *PeerStore) AssignedIPs() []ipam.UserIPInfo {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+
+	users := make([]ipam.UserIPInfo, 0, len(ps.peers))
+	for _, peer := range ps.peers {
+		users = append(users, peer)
+	}
+	return users
+}
+
 // Count returns the number of registered peers
 func (ps *PeerStore) Count() int {
 	ps.mu.RLock()
@@ -0,0 +1,386 @@
+package vpnserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/november1306/go-vpn/internal/ipam"
+	"github.com/november1306/go-vpn/internal/wireguard/keys"
+)
+
+func TestPeerStoreSave(t *testing.T) {
+	t.Run("save produces readable file", func(t *testing.T) {
+		dataDir := t.TempDir()
+		store, err := NewPeerStore(dataDir)
+		if err != nil {
+			t.Fatalf("NewPeerStore failed: %v", err)
+		}
+
+		if err := store.AddPeer("peer-key-1", "10.0.0.2/32"); err != nil {
+			t.Fatalf("AddPeer failed: %v", err)
+		}
+
+		data, err := os.ReadFile(filepath.Join(dataDir, "peers.json"))
+		if err != nil {
+			t.Fatalf("Failed to read peer store file: %v", err)
+		}
+
+		var peers map[string]*PeerConfig
+		if err := json.Unmarshal(data, &peers); err != nil {
+			t.Fatalf("Peer store file is not valid JSON: %v", err)
+		}
+		if peers["peer-key-1"] == nil || peers["peer-key-1"].AllowedIPs != "10.0.0.2/32" {
+			t.Errorf("Unexpected persisted peers: %v", peers)
+		}
+
+		// No temp file should remain after a successful save
+		if _, err := os.Stat(filepath.Join(dataDir, "peers.json.tmp")); !os.IsNotExist(err) {
+			t.Error("Temporary file should be removed after save")
+		}
+	})
+
+	t.Run("save overwrites stale temp file", func(t *testing.T) {
+		dataDir := t.TempDir()
+		store, err := NewPeerStore(dataDir)
+		if err != nil {
+			t.Fatalf("NewPeerStore failed: %v", err)
+		}
+
+		// Simulate a previous interrupted save
+		stale := filepath.Join(dataDir, "peers.json.tmp")
+		if err := os.WriteFile(stale, []byte("garbage from a crashed save that is longer than the new content"), 0600); err != nil {
+			t.Fatalf("Failed to write stale temp file: %v", err)
+		}
+
+		if err := store.AddPeer("peer-key-2", "10.0.0.3/32"); err != nil {
+			t.Fatalf("AddPeer failed: %v", err)
+		}
+
+		reloaded, err := NewPeerStore(dataDir)
+		if err != nil {
+			t.Fatalf("Failed to reload peer store: %v", err)
+		}
+		if reloaded.Count() != 1 {
+			t.Errorf("Expected 1 peer after reload, got %d", reloaded.Count())
+		}
+	})
+}
+
+func TestServerWithoutPersistence(t *testing.T) {
+	// Anything written relative to the working directory (the default data dir) lands here
+	dir := t.TempDir()
+	t.Chdir(dir)
+
+	backend := newFakeBackend()
+	server := NewVPNServerWithPeerStore(backend, NewInMemoryPeerStore())
+	allocator, err := ipam.NewAllocator(ipam.DefaultConfig())
+	if err != nil {
+		t.Fatalf("Failed to create allocator: %v", err)
+	}
+	server.SetAllocator(allocator)
+
+	ctx := context.Background()
+	config := newTestServerConfig(t)
+	config.PersistPolicy = PersistStrict // Nothing to fail when nothing is saved
+	if err := server.Start(ctx, config); err != nil {
+		t.Fatalf("Failed to start VPN server: %v", err)
+	}
+	defer server.Stop(ctx)
+
+	_, pubKey, _ := keys.GenerateKeyPair()
+	if _, err := server.RegisterClient(pubKey); err != nil {
+		t.Fatalf("RegisterClient failed: %v", err)
+	}
+	if err := server.SetPeerEnabled(pubKey, false); err != nil {
+		t.Fatalf("SetPeerEnabled failed: %v", err)
+	}
+	if _, ok := server.PeerStore().GetPeer(pubKey); !ok {
+		t.Error("Expected the peer in the in-memory store")
+	}
+	if err := server.RemoveClient(pubKey); err != nil {
+		t.Fatalf("RemoveClient failed: %v", err)
+	}
+	if server.PeerStore().Unsaved() {
+		t.Error("An in-memory store has nothing unsaved")
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ReadDir failed: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("Expected no files written without persistence, found %v", entries)
+	}
+}
+
+func TestPeerStoreQuarantinesDuplicateIPs(t *testing.T) {
+	dataDir := t.TempDir()
+	registered := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	stored := map[string]*PeerConfig{
+		"peer-original":  {PublicKey: "peer-original", AllowedIPs: "10.0.0.2/32", RegisteredAt: registered},
+		"peer-duplicate": {PublicKey: "peer-duplicate", AllowedIPs: "10.0.0.2", RegisteredAt: registered.Add(time.Hour)},
+		"peer-other":     {PublicKey: "peer-other", AllowedIPs: "10.0.0.3/32", RegisteredAt: registered.Add(time.Hour)},
+	}
+	data, err := json.Marshal(stored)
+	if err != nil {
+		t.Fatalf("Failed to marshal peers: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dataDir, "peers.json"), data, 0600); err != nil {
+		t.Fatalf("Failed to write peer store file: %v", err)
+	}
+
+	store, err := NewPeerStore(dataDir)
+	if err != nil {
+		t.Fatalf("NewPeerStore failed: %v", err)
+	}
+
+	if store.Count() != 2 {
+		t.Errorf("Expected 2 loaded peers, got %d", store.Count())
+	}
+	if _, exists := store.GetPeer("peer-duplicate"); exists {
+		t.Error("Later registration with a duplicate IP should not be loaded")
+	}
+	if _, exists := store.GetPeer("peer-original"); !exists {
+		t.Error("Earliest registration should keep its IP")
+	}
+
+	quarantined := store.Quarantined()
+	if len(quarantined) != 1 || quarantined["peer-duplicate"] == nil {
+		t.Fatalf("Expected peer-duplicate quarantined, got %v", quarantined)
+	}
+
+	data, err = os.ReadFile(filepath.Join(dataDir, "peers.quarantine.json"))
+	if err != nil {
+		t.Fatalf("Failed to read quarantine file: %v", err)
+	}
+	var onDisk map[string]*PeerConfig
+	if err := json.Unmarshal(data, &onDisk); err != nil {
+		t.Fatalf("Quarantine file is not valid JSON: %v", err)
+	}
+	if onDisk["peer-duplicate"] == nil || onDisk["peer-duplicate"].AllowedIPs != "10.0.0.2" {
+		t.Errorf("Unexpected quarantine file contents: %v", onDisk)
+	}
+
+	// Only the surviving peers reach the backend on restore
+	backend := newFakeBackend()
+	backend.running = true
+	server := NewVPNServerWithPeerStore(backend, store)
+	if err := server.restorePersistedPeers(context.Background()); err != nil {
+		t.Fatalf("restorePersistedPeers failed: %v", err)
+	}
+	if _, exists := backend.peers["peer-duplicate"]; exists {
+		t.Error("Quarantined peer should not be restored")
+	}
+	if len(backend.peers) != 2 {
+		t.Errorf("Expected 2 restored peers, got %d", len(backend.peers))
+	}
+}
+
+func TestPeerStoreCorruptFile(t *testing.T) {
+	writeCorrupt := func(t *testing.T) string {
+		t.Helper()
+		dataDir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(dataDir, "peers.json"), []byte(`{"peer-a": {"publicKey": `), 0600); err != nil {
+			t.Fatalf("Failed to write peer store file: %v", err)
+		}
+		return dataDir
+	}
+
+	t.Run("recover backs up and starts empty", func(t *testing.T) {
+		dataDir := writeCorrupt(t)
+
+		store, err := NewPeerStoreWithPolicy(dataDir, CorruptRecover)
+		if err != nil {
+			t.Fatalf("Expected recovery from a corrupt file, got %v", err)
+		}
+		if store.Count() != 0 {
+			t.Errorf("Expected empty store, got %d peers", store.Count())
+		}
+
+		backups, _ := filepath.Glob(filepath.Join(dataDir, "peers.json.corrupt.*"))
+		if len(backups) != 1 {
+			t.Fatalf("Expected one backup of the corrupt file, got %v", backups)
+		}
+		if data, err := os.ReadFile(backups[0]); err != nil || string(data) != `{"peer-a": {"publicKey": ` {
+			t.Errorf("Backup should hold the original contents, got %q (%v)", data, err)
+		}
+		if _, err := os.Stat(filepath.Join(dataDir, "peers.json")); !os.IsNotExist(err) {
+			t.Errorf("Corrupt file should be moved aside, stat error %v", err)
+		}
+
+		// The recovered store saves normally
+		if err := store.AddPeer("peer-b", "10.0.0.2/32"); err != nil {
+			t.Fatalf("AddPeer after recovery failed: %v", err)
+		}
+		if reopened, err := NewPeerStore(dataDir); err != nil || reopened.Count() != 1 {
+			t.Errorf("Expected reopened store with 1 peer, got %v", err)
+		}
+	})
+
+	t.Run("strict refuses to open", func(t *testing.T) {
+		dataDir := writeCorrupt(t)
+
+		if _, err := NewPeerStoreWithPolicy(dataDir, CorruptStrict); err == nil {
+			t.Fatal("Expected strict policy to fail on a corrupt file")
+		}
+		if backups, _ := filepath.Glob(filepath.Join(dataDir, "peers.json.corrupt.*")); len(backups) != 0 {
+			t.Errorf("Strict policy should leave the file in place, got backups %v", backups)
+		}
+	})
+
+	t.Run("empty file is not corrupt", func(t *testing.T) {
+		dataDir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(dataDir, "peers.json"), nil, 0600); err != nil {
+			t.Fatalf("Failed to write peer store file: %v", err)
+		}
+		if _, err := NewPeerStoreWithPolicy(dataDir, CorruptStrict); err != nil {
+			t.Errorf("Empty file should load as an empty store, got %v", err)
+		}
+	})
+}
+
+func TestParseCorruptPolicy(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    CorruptPolicy
+		wantErr bool
+	}{
+		{"", CorruptRecover, false},
+		{"recover", CorruptRecover, false},
+		{"strict", CorruptStrict, false},
+		{"ignore", CorruptRecover, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseCorruptPolicy(tt.value)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("ParseCorruptPolicy(%q) = %q, %v; want %q, error %v", tt.value, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestUpdatePeerMetadata(t *testing.T) {
+	dataDir := t.TempDir()
+	store, err := NewPeerStore(dataDir)
+	if err != nil {
+		t.Fatalf("NewPeerStore failed: %v", err)
+	}
+	if err := store.AddPeer("peer-key-1", "10.0.0.2/32"); err != nil {
+		t.Fatalf("AddPeer failed: %v", err)
+	}
+
+	label := "office printer"
+	if _, err := store.UpdatePeerMetadata("peer-key-1", PeerMetadata{Label: &label}); err != nil {
+		t.Fatalf("UpdatePeerMetadata failed: %v", err)
+	}
+
+	reloaded, err := NewPeerStore(dataDir)
+	if err != nil {
+		t.Fatalf("Failed to reload peer store: %v", err)
+	}
+	if peer, _ := reloaded.GetPeer("peer-key-1"); peer.Label != label || peer.AllowedIPs != "10.0.0.2/32" {
+		t.Errorf("Unexpected peer after reload: %+v", peer)
+	}
+
+	if _, err := store.UpdatePeerMetadata("unknown", PeerMetadata{Label: &label}); !errors.Is(err, ErrPeerNotFound) {
+		t.Errorf("Expected ErrPeerNotFound, got %v", err)
+	}
+}
+
+func TestWriteFileSync(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "synced.json")
+
+	if err := writeFileSync(path, []byte(`{"ok":true}`), 0600); err != nil {
+		t.Fatalf("writeFileSync failed: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read written file: %v", err)
+	}
+	if string(data) != `{"ok":true}` {
+		t.Errorf("Unexpected file content: %s", data)
+	}
+}
+
+func TestSyncDir(t *testing.T) {
+	if err := syncDir(t.TempDir()); err != nil {
+		t.Errorf("syncDir failed on existing directory: %v", err)
+	}
+
+	if err := syncDir(filepath.Join(t.TempDir(), "missing")); err == nil && os.PathSeparator == '/' {
+		t.Error("Expected error syncing a missing directory")
+	}
+}
+
+func TestRenameWithRetry(t *testing.T) {
+	// stubRename fails with err for the first failures calls, then renames for real
+	stubRename := func(t *testing.T, failures int, err error) *int {
+		t.Helper()
+		calls := 0
+		originalRename, originalDelay := renameFile, renameRetryDelay
+		renameFile = func(oldPath, newPath string) error {
+			calls++
+			if calls <= failures {
+				return &os.LinkError{Op: "rename", Old: oldPath, New: newPath, Err: err}
+			}
+			return os.Rename(oldPath, newPath)
+		}
+		renameRetryDelay = time.Millisecond
+		t.Cleanup(func() {
+			renameFile, renameRetryDelay = originalRename, originalDelay
+		})
+		return &calls
+	}
+
+	t.Run("transient lock eventually succeeds", func(t *testing.T) {
+		calls := stubRename(t, 2, syscall.EBUSY)
+
+		store, err := NewPeerStore(t.TempDir())
+		if err != nil {
+			t.Fatalf("Failed to create peer store: %v", err)
+		}
+		if err := store.AddPeer("peer-key", "10.0.0.2/32"); err != nil {
+			t.Fatalf("AddPeer should succeed after retries: %v", err)
+		}
+		if *calls != 3 {
+			t.Errorf("Expected 3 rename attempts, got %d", *calls)
+		}
+		if _, err := os.Stat(store.filePath); err != nil {
+			t.Errorf("Peer store file missing after save: %v", err)
+		}
+	})
+
+	t.Run("gives up after bounded attempts", func(t *testing.T) {
+		calls := stubRename(t, renameAttempts, syscall.EBUSY)
+
+		dir := t.TempDir()
+		oldPath := filepath.Join(dir, "old")
+		os.WriteFile(oldPath, []byte("x"), 0600)
+
+		err := renameWithRetry(oldPath, filepath.Join(dir, "new"))
+		if !errors.Is(err, syscall.EBUSY) {
+			t.Errorf("Expected EBUSY after retries, got %v", err)
+		}
+		if *calls != renameAttempts {
+			t.Errorf("Expected %d attempts, got %d", renameAttempts, *calls)
+		}
+	})
+
+	t.Run("permanent error is not retried", func(t *testing.T) {
+		calls := stubRename(t, renameAttempts, syscall.ENOENT)
+
+		if err := renameWithRetry("missing", "target"); !errors.Is(err, syscall.ENOENT) {
+			t.Errorf("Expected ENOENT, got %v", err)
+		}
+		if *calls != 1 {
+			t.Errorf("Expected a single attempt, got %d", *calls)
+		}
+	})
+}
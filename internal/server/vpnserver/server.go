@@ -2,16 +2,128 @@ package vpnserver
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
+	"net"
+	"net/netip"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/november1306/go-vpn/internal/ipam"
 	"github.com/november1306/go-vpn/internal/wireguard/keys"
 )
 
 const (
 	// MaxTCPUDPPort is the maximum valid TCP/UDP port number
 	MaxTCPUDPPort = 65535
+
+	// DefaultMaxAllowedIPsPerPeer is the allowed-IPs cap used when none is configured
+	DefaultMaxAllowedIPsPerPeer = 16
+
+	// DefaultAllocationAttempts is how often a registration allocates again after a collision when none is configured
+	DefaultAllocationAttempts = 3
+
+	// DefaultPeerActiveWindow is the active threshold used when none is configured
+	// Sessions in use rekey every two minutes, so an older handshake means the peer went idle
+	DefaultPeerActiveWindow = 3 * time.Minute
+)
+
+// defaultRestoreBackoff is the wait before each retry of peers that failed to restore at startup
+var defaultRestoreBackoff = []time.Duration{250 * time.Millisecond, 500 * time.Millisecond, time.Second, 2 * time.Second, 4 * time.Second}
+
+// ErrServerNotRunning is returned when an operation needs a started server
+var ErrServerNotRunning = errors.New("VPN server not running")
+
+// ErrServerShuttingDown is returned for peer changes attempted after Stop has begun
+// It wraps ErrServerNotRunning so callers treating both alike need no changes
+var ErrServerShuttingDown = fmt.Errorf("%w: shutting down", ErrServerNotRunning)
+
+// ErrAlreadyRunning is returned by Start when the server or backend is already up
+var ErrAlreadyRunning = errors.New("already running")
+
+// ErrAlreadyStarting is returned when another Start call is still bringing the server up
+var ErrAlreadyStarting = errors.New("already starting")
+
+// ErrTooManyAllowedIPs is returned when a peer requests more allowed IPs than permitted
+var ErrTooManyAllowedIPs = errors.New("too many allowed IPs for peer")
+
+// ErrServerPublicKey is returned when a peer submits the server's own public key
+// Adding it would make the device treat itself as a peer
+var ErrServerPublicKey = errors.New("public key belongs to the server")
+
+// ErrAllowedIPFamilyMismatch is returned when a peer's allowed IP is not in the server network's address family
+var ErrAllowedIPFamilyMismatch = errors.New("allowed IP family does not match server network")
+
+// Allocator hands out client tunnel IPs
+// *ipam.Allocator is the default implementation; others (e.g. an external IPAM) can be swapped in
+type Allocator interface {
+	// AllocateIP returns a free IP in CIDR form, skipping the IPs held by existingUsers
+	AllocateIP(existingUsers []ipam.UserIPInfo) (string, error)
+
+	// ReleaseIP returns an IP to the pool
+	ReleaseIP(ip string) error
+
+	// IsIPAvailable reports whether targetIP is in range and not held by existingUsers
+	IsIPAvailable(targetIP string, existingUsers []ipam.UserIPInfo) bool
+
+	// GetNetworkInfo describes the network IPs are allocated from
+	GetNetworkInfo() ipam.NetworkInfo
+
+	// GetStats returns allocation counters
+	GetStats() ipam.AllocationStats
+}
+
+// OwnerAllocator is an Allocator that holds a released IP for its previous owner (see ipam.Config.StickyTTL)
+// The server uses the peer's public key as owner, so a peer re-registering within the TTL gets its IP back
+type OwnerAllocator interface {
+	Allocator
+	AllocateIPForOwner(owner string, existingUsers []ipam.UserIPInfo) (string, error)
+	ReleaseIPForOwner(ip string, owner string) error
+}
+
+var _ OwnerAllocator = (*ipam.Allocator)(nil)
+
+// ErrAllocationConflict is returned by an Allocator whose allocation lost a race with a
+// concurrent writer (e.g. a database-backed pool); registration allocates again
+var ErrAllocationConflict = errors.New("allocation conflict")
+
+// ErrAllocationContention is returned when every registration attempt collided with another writer
+var ErrAllocationContention = errors.New("allocation contention")
+
+// IPAMReconciler is implemented by allocators that track allocations and can drift from the peer store
+type IPAMReconciler interface {
+	// Drift reports disagreements with existingUsers without changing anything
+	Drift(existingUsers []ipam.UserIPInfo) ipam.Drift
+
+	// Reconcile repairs the disagreements and returns what it repaired
+	Reconcile(existingUsers []ipam.UserIPInfo) ipam.Drift
+}
+
+// SpecificAllocator is implemented by allocators that can claim a particular IP
+// Restored peers claim the IPs they held so later allocations never hand them out again
+type SpecificAllocator interface {
+	// AllocateSpecificIP claims requested, failing with ipam.ErrIPAlreadyAllocated if it is taken
+	AllocateSpecificIP(requested string, existingUsers []ipam.UserIPInfo) (string, error)
+}
+
+// ErrReconcileUnsupported is returned when the configured allocator cannot report drift
+var ErrReconcileUnsupported = errors.New("allocator does not support reconciliation")
+
+var (
+	_ Allocator = (*ipam.Allocator)(nil)
+	_ Allocator = (*ipam.MultiPoolAllocator)(nil)
+
+	_ IPAMReconciler = (*ipam.Allocator)(nil)
+	_ IPAMReconciler = (*ipam.MultiPoolAllocator)(nil)
+
+	_ SpecificAllocator = (*ipam.Allocator)(nil)
+	_ SpecificAllocator = (*ipam.MultiPoolAllocator)(nil)
 )
 
 // VPNServer manages the WireGuard VPN server with pluggable backends
@@ -21,7 +133,26 @@ type VPNServer struct {
 	backend   WireGuardBackend
 	config    ServerConfig
 	running   bool
+	starting  bool       // A Start call owns the backend; s.mu is released while it works
+	publicKey string     // Derived from config.PrivateKey at Start; never accepted as a peer key
 	peerStore *PeerStore // Persistent peer storage for restart resilience
+
+	// Set as soon as Stop is called, before it waits for in-flight peer changes,
+	// so no new change can land in the peer store after shutdown begins
+	shuttingDown atomic.Bool
+
+	// IP allocation for client registration
+	registerMu sync.Mutex        // Serializes allocate+add so concurrent registrations don't collide
+	allocator  Allocator         // Optional - required for RegisterClient
+	tokenPools map[string]string // API token -> allocator pool (optional, see SetTokenPools)
+
+	events eventBus // Peer lifecycle notifications for in-process observers
+
+	restoreBackoff []time.Duration // Retry delays for peer restore (nil = defaultRestoreBackoff)
+
+	audit atomic.Pointer[AllocationAudit] // Allocation audit log (optional); atomic so RemoveClient needs no extra lock
+
+	usedProofs proofCache // Key ownership proofs already accepted (see VerifyKeyOwnership)
 }
 
 // NewVPNServer creates a new VPN server with the specified backend
@@ -38,6 +169,15 @@ func NewVPNServer(backend WireGuardBackend, dataDir string) (*VPNServer, error)
 	}, nil
 }
 
+// NewVPNServerWithPeerStore creates a VPN server using an existing peer store
+// Use NewInMemoryPeerStore() for servers that should not persist peers
+func NewVPNServerWithPeerStore(backend WireGuardBackend, peerStore *PeerStore) *VPNServer {
+	return &VPNServer{
+		backend:   backend,
+		peerStore: peerStore,
+	}
+}
+
 // NewUserspaceVPNServer creates a VPN server with userspace backend (convenience constructor)
 func NewUserspaceVPNServer(dataDir string) (*VPNServer, error) {
 	return NewVPNServer(NewUserspaceBackend(), dataDir)
@@ -45,19 +185,45 @@ func NewUserspaceVPNServer(dataDir string) (*VPNServer, error) {
 
 // Start initializes and starts the VPN server
 func (s *VPNServer) Start(ctx context.Context, config ServerConfig) error {
+	// Claim the start under the lock, then release it so status readers
+	// aren't blocked behind device creation; s.starting keeps other
+	// Start and Stop calls away from the backend until this one finishes
 	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	if s.running {
-		return fmt.Errorf("VPN server already running")
+	switch {
+	case s.running:
+		s.mu.Unlock()
+		return fmt.Errorf("VPN server %w", ErrAlreadyRunning)
+	case s.starting:
+		s.mu.Unlock()
+		return fmt.Errorf("VPN server %w", ErrAlreadyStarting)
 	}
+	s.starting = true
+	s.mu.Unlock()
+
+	started := false
+	var publicKey string
+	defer func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.starting = false
+		if started {
+			s.config = config
+			s.publicKey = publicKey
+			s.running = true
+		}
+	}()
 
 	slog.Info("Starting VPN server", "interface", config.InterfaceName, "serverIP", config.ServerIP, "port", config.ListenPort)
 
 	// Validate configuration
-	if err := s.validateConfig(config); err != nil {
+	if err := ValidateServerConfig(config); err != nil {
 		return fmt.Errorf("invalid configuration: %w", err)
 	}
+	key, err := s.derivePublicKey(config.PrivateKey)
+	if err != nil {
+		return fmt.Errorf("invalid configuration: failed to derive public key: %w", err)
+	}
+	publicKey = key
 
 	// Start the backend
 	if err := s.backend.Start(ctx, config); err != nil {
@@ -65,13 +231,14 @@ func (s *VPNServer) Start(ctx context.Context, config ServerConfig) error {
 	}
 
 	// Restore persisted peers (WireGuard best practice: survive restarts)
-	if err := s.restorePersistedPeers(); err != nil {
-		slog.Warn("Failed to restore persisted peers", "error", err)
-		// Don't fail startup, just log warning
+	// Peer changes are rejected until running is set, so nothing races the restore
+	// Startup completes only after the restore succeeds or its retries run out
+	if err := s.restorePersistedPeers(ctx); err != nil {
+		slog.Error("Persisted peers not restored; affected clients cannot connect until they re-register or the server restarts", "error", err)
+		// Don't fail startup: the rest of the peers and the API still work
 	}
 
-	s.config = config
-	s.running = true
+	started = true
 
 	slog.Info("VPN server started successfully",
 		"interface", config.InterfaceName,
@@ -82,9 +249,16 @@ func (s *VPNServer) Start(ctx context.Context, config ServerConfig) error {
 
 // Stop gracefully shuts down the VPN server
 func (s *VPNServer) Stop(ctx context.Context) error {
+	s.shuttingDown.Store(true)
+	defer s.shuttingDown.Store(false) // Runs after unlock; a stopped server rejects changes anyway
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	if s.starting {
+		return fmt.Errorf("cannot stop VPN server: %w", ErrAlreadyStarting)
+	}
+
 	if !s.running {
 		return nil // Already stopped
 	}
@@ -102,49 +276,478 @@ func (s *VPNServer) Stop(ctx context.Context) error {
 	return nil
 }
 
+// SetAllocator configures the IP allocator used by RegisterClient
+func (s *VPNServer) SetAllocator(allocator Allocator) {
+	s.registerMu.Lock()
+	defer s.registerMu.Unlock()
+
+	s.allocator = allocator
+}
+
+// NetworkInfo describes the client address pool, if an allocator is configured
+func (s *VPNServer) NetworkInfo() (ipam.NetworkInfo, bool) {
+	s.registerMu.Lock()
+	defer s.registerMu.Unlock()
+
+	if s.allocator == nil {
+		return ipam.NetworkInfo{}, false
+	}
+	return s.allocator.GetNetworkInfo(), true
+}
+
+// ReconcileIPAM compares the allocator with the peer store, the source of truth
+// With fix set, orphaned allocations are released and untracked assignments are tracked
+func (s *VPNServer) ReconcileIPAM(fix bool) (ipam.Drift, error) {
+	// Holding registerMu keeps registrations from racing the comparison
+	s.registerMu.Lock()
+	defer s.registerMu.Unlock()
+
+	if s.allocator == nil {
+		return ipam.Drift{}, fmt.Errorf("no IP allocator configured")
+	}
+	reconciler, ok := s.allocator.(IPAMReconciler)
+	if !ok {
+		return ipam.Drift{}, ErrReconcileUnsupported
+	}
+
+	assigned := s.peerStore.AssignedIPs()
+	if !fix {
+		return reconciler.Drift(assigned), nil
+	}
+
+	drift := reconciler.Reconcile(assigned)
+	if !drift.Empty() {
+		slog.Info("Reconciled IP allocator with peer store", "orphaned", len(drift.Orphaned), "untracked", len(drift.Untracked))
+	}
+	return drift, nil
+}
+
+// RegisterClient allocates a VPN IP for a client and adds it as a peer
+// Returns the assigned IP in CIDR format (e.g., "10.0.0.2/32")
+func (s *VPNServer) RegisterClient(publicKey string) (string, error) {
+	registration, err := s.RegisterClientWithToken(publicKey, "")
+	return registration.ClientIP, err
+}
+
+// Registration is what a successful registration applied, so callers needn't read it back
+type Registration struct {
+	ClientIP   string           // Assigned address in CIDR form (e.g., "10.0.0.2/32")
+	AllowedIPs []string         // Allowed IPs configured on the device for the peer
+	Network    ipam.NetworkInfo // Network the address was allocated from
+}
+
+// RegisterClientWithToken is RegisterClient drawing from the pool mapped to the caller's API token
+// Unknown and empty tokens use DefaultPool; see SetTokenPools
+func (s *VPNServer) RegisterClientWithToken(publicKey, token string) (Registration, error) {
+	if !s.IsRunning() {
+		return Registration{}, ErrServerNotRunning
+	}
+
+	// Checked before allocating so a rejected key doesn't churn the pool
+	if err := s.checkPeerKey(publicKey); err != nil {
+		return Registration{}, err
+	}
+
+	s.registerMu.Lock()
+	defer s.registerMu.Unlock()
+
+	if s.allocator == nil {
+		return Registration{}, fmt.Errorf("no IP allocator configured")
+	}
+
+	// A known key gets its stored IP back instead of orphaning it for a fresh one,
+	// and goes back on the device in case a failed restore left it off
+	if registration, ok := s.storedRegistration(publicKey); ok {
+		if err := s.reapplyPeer(publicKey, registration.AllowedIPs); err != nil {
+			return Registration{}, err
+		}
+		return registration, nil
+	}
+
+	// The peer store is the source of truth for which IPs are taken; an allocator whose view
+	// lags it (or that reports a conflict itself) gets another attempt within the budget
+	attempts := s.allocationAttempts()
+	var collision error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		clientIP, err := s.allocateForToken(token, publicKey)
+		if errors.Is(err, ErrAllocationConflict) {
+			collision = err
+			continue
+		}
+		if err != nil {
+			return Registration{}, fmt.Errorf("failed to allocate client IP: %w", err)
+		}
+
+		// The IP belongs to the peer holding it, so it isn't released back to the pool
+		if owner, taken := s.peerStore.claimedBy(clientIP, publicKey); taken {
+			collision = fmt.Errorf("%s already assigned to peer %s", clientIP, keys.ShortID(owner))
+			slog.Warn("Allocated IP collided with an existing peer", "peer", keys.ShortID(publicKey), "attempt", attempt, "error", collision)
+			continue
+		}
+
+		allowedIPs := []string{clientIP}
+		if err := s.AddClientWithAllowedIPs(publicKey, allowedIPs); err != nil {
+			s.releaseForOwner(publicKey, clientIP) // Return the IP to the pool
+			return Registration{}, err
+		}
+
+		s.recordAllocation(AuditAllocate, publicKey, clientIP)
+		return Registration{
+			ClientIP:   clientIP,
+			AllowedIPs: allowedIPs,
+			Network:    s.networkFor(clientIP),
+		}, nil
+	}
+
+	return Registration{}, fmt.Errorf("%w after %d attempts: %v", ErrAllocationContention, attempts, collision)
+}
+
+// storedRegistration returns the registration a known peer already holds while its IP is still usable
+// The stored peer is left untouched, so its metadata survives and a disabled peer stays off the device
+// Callers must hold s.registerMu
+func (s *VPNServer) storedRegistration(publicKey string) (Registration, bool) {
+	peer, exists := s.peerStore.GetPeer(publicKey)
+	if !exists {
+		return Registration{}, false
+	}
+
+	clientIP := peer.GetAssignedIP()
+	if !s.inPool(clientIP) {
+		slog.Info("Stored IP of re-registering peer is outside the pool, allocating a new one", "peer", keys.ShortID(publicKey), "ip", clientIP)
+		return Registration{}, false
+	}
+	if owner, taken := s.peerStore.claimedBy(clientIP, publicKey); taken {
+		slog.Warn("Stored IP of re-registering peer is held by another peer, allocating a new one", "peer", keys.ShortID(publicKey), "ip", clientIP, "owner", keys.ShortID(owner))
+		return Registration{}, false
+	}
+
+	return Registration{
+		ClientIP:   clientIP,
+		AllowedIPs: normalizedAllowedIPs(peer.AllowedIPs),
+		Network:    s.networkFor(clientIP),
+	}, true
+}
+
+// reapplyPeer adds a stored, enabled peer to the device again; the device treats a known peer as an update
+// Callers must hold s.registerMu
+func (s *VPNServer) reapplyPeer(publicKey string, allowedIPs []string) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if err := s.acceptingPeerChanges(); err != nil {
+		return err
+	}
+
+	peer, exists := s.peerStore.GetPeer(publicKey)
+	if !exists || peer.Disabled {
+		return nil
+	}
+	if err := s.backend.AddPeer(publicKey, allowedIPs); err != nil {
+		return fmt.Errorf("failed to re-apply client peer: %w", err)
+	}
+	return nil
+}
+
+// inPool reports whether ip (plain or CIDR form) lies in a network the allocator hands out
+// Callers must hold s.registerMu
+func (s *VPNServer) inPool(ip string) bool {
+	if locator, ok := s.allocator.(networkLocator); ok {
+		_, found := locator.NetworkInfoFor(ip)
+		return found
+	}
+
+	addr, err := netip.ParseAddr(ip)
+	if prefix, perr := netip.ParsePrefix(ip); perr == nil {
+		addr, err = prefix.Addr(), nil
+	}
+	if err != nil {
+		return false
+	}
+	network, err := netip.ParsePrefix(s.allocator.GetNetworkInfo().CIDR)
+	return err == nil && network.Contains(addr.Unmap())
+}
+
+// networkLocator is implemented by allocators spanning several networks, such as *ipam.MultiPoolAllocator
+type networkLocator interface {
+	NetworkInfoFor(ip string) (ipam.NetworkInfo, bool)
+}
+
+// networkFor describes the network clientIP was allocated from
+// Callers must hold s.registerMu
+func (s *VPNServer) networkFor(clientIP string) ipam.NetworkInfo {
+	if locator, ok := s.allocator.(networkLocator); ok {
+		if info, found := locator.NetworkInfoFor(clientIP); found {
+			return info
+		}
+	}
+	return s.allocator.GetNetworkInfo()
+}
+
+// PeerStore returns the server's peer store
+func (s *VPNServer) PeerStore() *PeerStore {
+	return s.peerStore
+}
+
 // AddClient adds a new VPN client as a peer
 // This is the core functionality that gets called when a client registers
 func (s *VPNServer) AddClient(publicKey string, clientIP string) error {
+	// Client gets their assigned IP as their allowed IP range
+	// This means they can only send traffic from this specific IP
+	hostPrefix := "/32"
+	if addr, err := netip.ParseAddr(clientIP); err == nil && addr.Is6() {
+		hostPrefix = "/128"
+	}
+	return s.AddClientWithAllowedIPs(publicKey, []string{clientIP + hostPrefix})
+}
+
+// AddClientWithAllowedIPs adds a VPN client peer that may route the given CIDR blocks
+// The number of allowed IPs is capped to protect the device config and routing table
+func (s *VPNServer) AddClientWithAllowedIPs(publicKey string, allowedIPs []string) error {
+	if s.shuttingDown.Load() { // Fail fast instead of queueing behind Stop
+		return ErrServerShuttingDown
+	}
+
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	if !s.running {
-		return fmt.Errorf("VPN server not running")
+	if err := s.acceptingPeerChanges(); err != nil {
+		return err
 	}
 
-	slog.Info("Adding VPN client", "clientIP", clientIP)
+	if publicKey == s.publicKey {
+		return ErrServerPublicKey
+	}
 
-	// Client gets their assigned IP as their allowed IP range
-	// This means they can only send traffic from this specific IP
-	allowedIPs := []string{clientIP + "/32"}
+	if len(allowedIPs) == 0 {
+		return fmt.Errorf("at least one allowed IP is required")
+	}
+
+	// Duplicates and covered entries would otherwise count against the limit and be stored twice
+	allowedIPs, err := NormalizeAllowedIPs(allowedIPs)
+	if err != nil {
+		return err
+	}
+
+	if limit := s.maxAllowedIPsPerPeer(); len(allowedIPs) > limit {
+		return fmt.Errorf("%w: %d exceeds limit of %d", ErrTooManyAllowedIPs, len(allowedIPs), limit)
+	}
+
+	if err := s.checkAllowedIPFamilies(allowedIPs); err != nil {
+		return err
+	}
+
+	slog.Info("Adding VPN client", "peer", keys.ShortID(publicKey), "allowedIPs", allowedIPs)
 
 	if err := s.backend.AddPeer(publicKey, allowedIPs); err != nil {
 		return fmt.Errorf("failed to add client peer: %w", err)
 	}
 
 	// Persist peer configuration (survive server restarts)
-	if err := s.peerStore.AddPeer(publicKey, clientIP+"/32"); err != nil {
-		slog.Warn("Failed to persist peer configuration", "error", err)
-		// Don't fail the registration, just log warning
+	if err := s.persistNewPeer(publicKey, allowedIPs); err != nil {
+		return err
+	}
+
+	slog.Info("VPN client added successfully", "peer", keys.ShortID(publicKey), "allowedIPs", allowedIPs)
+	s.emit(PeerAdded, publicKey, strings.Join(allowedIPs, ","))
+	return nil
+}
+
+// checkAllowedIPFamilies rejects allowed IPs whose family differs from the server network
+// A mismatched family would be accepted by WireGuard but never routed
+func (s *VPNServer) checkAllowedIPFamilies(allowedIPs []string) error {
+	serverAddr, err := parseAddrOrPrefix(s.config.ServerIP)
+	if err != nil {
+		// Nothing to compare against; the backend reports bad server addresses
+		return nil
+	}
+
+	for _, allowedIP := range allowedIPs {
+		prefix, err := netip.ParsePrefix(allowedIP)
+		if err != nil {
+			return fmt.Errorf("invalid allowed IP %q: %w", allowedIP, err)
+		}
+		if prefix.Addr().Is4() != serverAddr.Is4() {
+			return fmt.Errorf("%w: %s is %s, server network %s is %s",
+				ErrAllowedIPFamilyMismatch, allowedIP, addrFamily(prefix.Addr()), s.config.ServerIP, addrFamily(serverAddr))
+		}
+	}
+	return nil
+}
+
+// parseAddrOrPrefix parses either a bare address or a CIDR and returns the address
+func parseAddrOrPrefix(value string) (netip.Addr, error) {
+	if prefix, err := netip.ParsePrefix(value); err == nil {
+		return prefix.Addr(), nil
+	}
+	return netip.ParseAddr(value)
+}
+
+// addrFamily names the address family for error messages
+func addrFamily(addr netip.Addr) string {
+	if addr.Is4() {
+		return "IPv4"
+	}
+	return "IPv6"
+}
+
+// SetPeerEnabled suspends or resumes a registered peer without losing its registration
+// Disabling removes the peer from the live device; enabling re-adds it with its stored allowed IPs
+func (s *VPNServer) SetPeerEnabled(publicKey string, enabled bool) error {
+	s.registerMu.Lock() // Keep a concurrent re-registration from re-adding the peer mid-toggle
+	defer s.registerMu.Unlock()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if err := s.acceptingPeerChanges(); err != nil {
+		return err
+	}
+
+	peer, exists := s.peerStore.GetPeer(publicKey)
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrPeerNotFound, keys.ShortID(publicKey))
+	}
+
+	if peer.Disabled != enabled {
+		return nil // Already in the requested state
 	}
 
-	slog.Info("VPN client added successfully", "clientIP", clientIP)
+	if enabled {
+		if err := s.backend.AddPeer(publicKey, strings.Split(peer.AllowedIPs, ",")); err != nil {
+			return fmt.Errorf("failed to enable peer: %w", err)
+		}
+	} else {
+		if err := s.backend.RemovePeer(publicKey); err != nil {
+			return fmt.Errorf("failed to disable peer: %w", err)
+		}
+	}
+
+	if err := s.peerStore.SetPeerDisabled(publicKey, !enabled); err != nil {
+		return fmt.Errorf("failed to persist peer state: %w", err)
+	}
+
+	slog.Info("VPN client state changed", "peer", keys.ShortID(publicKey), "enabled", enabled)
+	if enabled {
+		s.emit(PeerEnabled, publicKey, peer.AllowedIPs)
+	} else {
+		s.emit(PeerDisabled, publicKey, peer.AllowedIPs)
+	}
 	return nil
 }
 
-// RemoveClient removes a VPN client peer
+// ReplacePeerKey swaps a registered peer's public key while keeping its allowed IPs
+// The new key is added before the old one is removed, so a failure leaves the old key working
+func (s *VPNServer) ReplacePeerKey(oldPublicKey, newPublicKey string) (string, error) {
+	s.registerMu.Lock() // Keep registrations from claiming the new key mid-swap
+	defer s.registerMu.Unlock()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if err := s.acceptingPeerChanges(); err != nil {
+		return "", err
+	}
+
+	peer, exists := s.peerStore.GetPeer(oldPublicKey)
+	if !exists {
+		return "", fmt.Errorf("%w: %s", ErrPeerNotFound, keys.ShortID(oldPublicKey))
+	}
+	if _, taken := s.peerStore.GetPeer(newPublicKey); taken {
+		return "", fmt.Errorf("%w: %s", ErrPeerExists, keys.ShortID(newPublicKey))
+	}
+	if newPublicKey == s.publicKey {
+		return "", ErrServerPublicKey
+	}
+
+	// Disabled peers aren't on the device; only the stored registration moves
+	if !peer.Disabled {
+		if err := s.backend.AddPeer(newPublicKey, strings.Split(peer.AllowedIPs, ",")); err != nil {
+			return "", fmt.Errorf("failed to add replacement peer: %w", err)
+		}
+		if err := s.backend.RemovePeer(oldPublicKey); err != nil {
+			s.backend.RemovePeer(newPublicKey) // Roll back so the old key keeps its IPs
+			s.backend.AddPeer(oldPublicKey, strings.Split(peer.AllowedIPs, ","))
+			return "", fmt.Errorf("failed to remove replaced peer: %w", err)
+		}
+	}
+
+	if err := s.peerStore.ReplacePeerKey(oldPublicKey, newPublicKey); err != nil {
+		slog.Warn("Failed to persist peer key replacement", "error", err)
+		// The device already uses the new key, so don't fail the swap
+	}
+
+	slog.Info("VPN client key replaced", "old", keys.ShortID(oldPublicKey), "new", keys.ShortID(newPublicKey), "allowedIPs", peer.AllowedIPs)
+	s.emit(PeerRemoved, oldPublicKey, peer.AllowedIPs)
+	s.emit(PeerAdded, newPublicKey, peer.AllowedIPs)
+	return peer.AllowedIPs, nil
+}
+
+// allocationAttempts returns the configured registration attempt budget or the default
+func (s *VPNServer) allocationAttempts() int {
+	if s.config.AllocationAttempts > 0 {
+		return s.config.AllocationAttempts
+	}
+	return DefaultAllocationAttempts
+}
+
+// maxAllowedIPsPerPeer returns the configured allowed-IPs cap or the default
+func (s *VPNServer) maxAllowedIPsPerPeer() int {
+	if s.config.MaxAllowedIPsPerPeer > 0 {
+		return s.config.MaxAllowedIPsPerPeer
+	}
+	return DefaultMaxAllowedIPsPerPeer
+}
+
+// peerActiveWindow returns the configured active threshold, or the default
+func (s *VPNServer) peerActiveWindow() time.Duration {
+	if s.config.PeerActiveWindow > 0 {
+		return s.config.PeerActiveWindow
+	}
+	return DefaultPeerActiveWindow
+}
+
+// isPeerActive reports whether a handshake at lastSeen (Unix seconds, 0 = never) is within window of now
+func isPeerActive(lastSeen int64, now time.Time, window time.Duration) bool {
+	return lastSeen > 0 && now.Sub(time.Unix(lastSeen, 0)) <= window
+}
+
+// RemoveClient removes a VPN client peer and returns its IP to the pool
+// Returns ErrPeerNotFound if publicKey isn't registered
 func (s *VPNServer) RemoveClient(publicKey string) error {
+	assignedIP, err := s.removeClient(publicKey)
+	if err != nil {
+		return err
+	}
+	// Released after s.mu is dropped: registration takes registerMu before s.mu
+	if assignedIP != "" {
+		s.releaseIP(publicKey, assignedIP)
+	}
+	return nil
+}
+
+// removeClient removes the peer and returns the IP it was assigned, if any
+func (s *VPNServer) removeClient(publicKey string) (string, error) {
+	if s.shuttingDown.Load() { // Fail fast instead of queueing behind Stop
+		return "", ErrServerShuttingDown
+	}
+
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	if !s.running {
-		return fmt.Errorf("VPN server not running")
+	if err := s.acceptingPeerChanges(); err != nil {
+		return "", err
 	}
 
-	slog.Info("Removing VPN client")
+	slog.Info("Removing VPN client", "peer", keys.ShortID(publicKey))
+
+	peer, exists := s.peerStore.GetPeer(publicKey)
+	if !exists {
+		return "", fmt.Errorf("%w: %s", ErrPeerNotFound, keys.ShortID(publicKey))
+	}
+	removedIPs, assignedIP := peer.AllowedIPs, peer.GetAssignedIP() // Captured for the removal event and the allocator
 
 	if err := s.backend.RemovePeer(publicKey); err != nil {
-		return fmt.Errorf("failed to remove client peer: %w", err)
+		return "", fmt.Errorf("failed to remove client peer: %w", err)
 	}
 
 	// Remove from persistent storage
@@ -153,7 +756,49 @@ func (s *VPNServer) RemoveClient(publicKey string) error {
 		// Don't fail the removal, just log warning
 	}
 
-	slog.Info("VPN client removed successfully")
+	slog.Info("VPN client removed successfully", "peer", keys.ShortID(publicKey))
+	s.recordAllocation(AuditRelease, publicKey, removedIPs)
+	s.emit(PeerRemoved, publicKey, removedIPs)
+	return assignedIP, nil
+}
+
+// releaseIP returns a removed peer's IP to the allocator so the pool doesn't leak addresses
+// Peers added with a manual IP were never allocated, so a refusal is only logged
+func (s *VPNServer) releaseIP(publicKey, ip string) {
+	s.registerMu.Lock()
+	defer s.registerMu.Unlock()
+
+	if s.allocator == nil {
+		return
+	}
+	if err := s.releaseForOwner(publicKey, ip); err != nil {
+		slog.Debug("Removed peer's IP not returned to the pool", "peer", keys.ShortID(publicKey), "ip", ip, "error", err)
+	}
+}
+
+// releaseForOwner returns ip to the allocator, held for publicKey when the allocator supports it
+// Callers must hold s.registerMu
+func (s *VPNServer) releaseForOwner(publicKey, ip string) error {
+	if owners, ok := s.allocator.(ownerReleaser); ok {
+		return owners.ReleaseIPForOwner(ip, publicKey)
+	}
+	return s.allocator.ReleaseIP(ip)
+}
+
+// ownerReleaser is implemented by allocators that hold released IPs, such as OwnerAllocator and OwnerPoolAllocator
+type ownerReleaser interface {
+	ReleaseIPForOwner(ip string, owner string) error
+}
+
+// acceptingPeerChanges reports why peers cannot be changed right now, if at all
+// Callers must hold s.mu
+func (s *VPNServer) acceptingPeerChanges() error {
+	if s.shuttingDown.Load() {
+		return ErrServerShuttingDown
+	}
+	if !s.running {
+		return ErrServerNotRunning
+	}
 	return nil
 }
 
@@ -166,7 +811,44 @@ func (s *VPNServer) GetConnectedClients() ([]PeerInfo, error) {
 		return nil, fmt.Errorf("VPN server not running")
 	}
 
-	return s.backend.GetPeers()
+	peers, err := s.backend.GetPeers()
+	if err != nil {
+		return nil, err
+	}
+
+	now, window := time.Now(), s.peerActiveWindow()
+	for i := range peers {
+		peers[i].Active = isPeerActive(peers[i].LastSeen, now, window)
+	}
+	return peers, nil
+}
+
+// PeerCount returns the number of peers on the backend, or 0 when the server isn't running
+// Prefer it over GetConnectedClients when only the count is needed
+func (s *VPNServer) PeerCount() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if !s.running {
+		return 0
+	}
+	if counter, ok := s.backend.(PeerCounter); ok {
+		return counter.PeerCount()
+	}
+	peers, err := s.backend.GetPeers()
+	if err != nil {
+		return 0
+	}
+	return len(peers)
+}
+
+// IPCErrors returns the backend's failed device operations by type
+// Returns nil when the backend doesn't talk to its device over UAPI
+func (s *VPNServer) IPCErrors() map[string]int64 {
+	if reporter, ok := s.backend.(IPCErrorReporter); ok {
+		return reporter.IPCErrors()
+	}
+	return nil
 }
 
 // IsRunning returns whether the VPN server is currently running
@@ -185,13 +867,32 @@ func (s *VPNServer) GetConfig() ServerConfig {
 	return s.config
 }
 
-// GetServerInfo returns basic server information for clients
+// ServerInfo is the connection information clients need
 type ServerInfo struct {
 	PublicKey string
-	Endpoint  string // IP:Port where clients should connect
+	Host      string // Address clients should connect to; empty when only the port is known
+	Port      int    // WireGuard UDP port
 	ServerIP  string // Server IP within VPN network
 }
 
+// Endpoint formats the WireGuard endpoint clients connect to ("host:port", or ":port" without a host)
+func (i ServerInfo) Endpoint() string {
+	port := strconv.Itoa(i.Port)
+	if i.Host == "" {
+		return ":" + port
+	}
+	return net.JoinHostPort(i.Host, port)
+}
+
+// MarshalJSON adds the formatted endpoint, which /api/status clients read
+func (i ServerInfo) MarshalJSON() ([]byte, error) {
+	type fields ServerInfo // Drops the methods so encoding doesn't recurse
+	return json.Marshal(struct {
+		fields
+		Endpoint string
+	}{fields(i), i.Endpoint()})
+}
+
 // GetServerInfo returns connection information that clients need
 func (s *VPNServer) GetServerInfo() (ServerInfo, error) {
 	s.mu.RLock()
@@ -201,43 +902,30 @@ func (s *VPNServer) GetServerInfo() (ServerInfo, error) {
 		return ServerInfo{}, fmt.Errorf("VPN server not running")
 	}
 
-	// Extract public key from private key for client connection info
-	// This would typically be computed once at startup and cached
-	publicKey, err := s.derivePublicKey(s.config.PrivateKey)
-	if err != nil {
-		return ServerInfo{}, fmt.Errorf("failed to derive public key: %w", err)
-	}
-
 	return ServerInfo{
-		PublicKey: publicKey,
-		Endpoint:  fmt.Sprintf(":%d", s.config.ListenPort), // Client needs to know port
+		PublicKey: s.publicKey,
+		Host:      s.endpointHost(),
+		Port:      s.config.ListenPort,
 		ServerIP:  s.config.ServerIP,
 	}, nil
 }
 
-// validateConfig validates the server configuration
-func (s *VPNServer) validateConfig(config ServerConfig) error {
-	if config.InterfaceName == "" {
-		return fmt.Errorf("interface name is required")
-	}
-
-	if config.PrivateKey == "" {
-		return fmt.Errorf("private key is required")
-	}
-
-	// Validate private key format for security
-	if err := keys.ValidatePrivateKey(config.PrivateKey); err != nil {
-		return fmt.Errorf("invalid private key: %w", err)
+// endpointHost is the address advertised to clients, known only when ListenAddr names one
+func (s *VPNServer) endpointHost() string {
+	if addr, err := netip.ParseAddr(s.config.ListenAddr); err == nil && !addr.IsUnspecified() {
+		return addr.String()
 	}
+	return ""
+}
 
-	if config.ListenPort <= 0 || config.ListenPort > MaxTCPUDPPort {
-		return fmt.Errorf("invalid listen port: %d", config.ListenPort)
-	}
+// checkPeerKey rejects the server's own public key as a peer key
+func (s *VPNServer) checkPeerKey(publicKey string) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 
-	if config.ServerIP == "" {
-		return fmt.Errorf("server IP is required")
+	if publicKey == s.publicKey {
+		return ErrServerPublicKey
 	}
-
 	return nil
 }
 
@@ -248,7 +936,9 @@ func (s *VPNServer) derivePublicKey(privateKey string) (string, error) {
 
 // restorePersistedPeers restores peer configurations after server restart
 // This ensures WireGuard best practice: registered peers survive restarts
-func (s *VPNServer) restorePersistedPeers() error {
+// A device that is not fully ready can reject peers, so failures are retried with backoff;
+// the error lists the peers still missing once the retries are exhausted
+func (s *VPNServer) restorePersistedPeers(ctx context.Context) error {
 	peers := s.peerStore.ListPeers()
 	if len(peers) == 0 {
 		slog.Info("No persisted peers to restore")
@@ -256,18 +946,93 @@ func (s *VPNServer) restorePersistedPeers() error {
 	}
 
 	slog.Info("Restoring persisted peers", "count", len(peers))
-	restored := 0
+	s.claimRestoredIPs(peers)
 
+	pending := make(map[string]*PeerConfig, len(peers))
+	skipped := 0
 	for publicKey, peerConfig := range peers {
-		allowedIPs := []string{peerConfig.AllowedIPs}
-		if err := s.backend.AddPeer(publicKey, allowedIPs); err != nil {
-			slog.Warn("Failed to restore peer", "publicKey", publicKey, "error", err)
+		if peerConfig.Disabled {
+			skipped++
 			continue
 		}
-		restored++
-		slog.Debug("Restored peer", "publicKey", publicKey, "allowedIPs", peerConfig.AllowedIPs)
+		pending[publicKey] = peerConfig
+	}
+
+	backoff := s.restoreBackoff
+	if backoff == nil {
+		backoff = defaultRestoreBackoff
+	}
+
+	for attempt := 0; ; attempt++ {
+		s.restorePending(pending)
+		if len(pending) == 0 || attempt == len(backoff) {
+			break
+		}
+
+		slog.Warn("Retrying peer restore", "failed", len(pending), "retry", attempt+1, "of", len(backoff), "delay", backoff[attempt])
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("peer restore cancelled with %d peers missing: %w", len(pending), ctx.Err())
+		case <-time.After(backoff[attempt]):
+		}
+	}
+
+	restored := len(peers) - skipped - len(pending)
+	if len(pending) > 0 {
+		missing := make([]string, 0, len(pending))
+		for publicKey := range pending {
+			missing = append(missing, keys.ShortID(publicKey))
+		}
+		sort.Strings(missing)
+		return fmt.Errorf("gave up restoring %d of %d peers after %d retries: %s",
+			len(pending), len(peers)-skipped, len(backoff), strings.Join(missing, ", "))
 	}
 
-	slog.Info("Peer restoration complete", "restored", restored, "total", len(peers))
+	slog.Info("Peer restoration complete", "restored", restored, "disabled", skipped, "total", len(peers))
 	return nil
 }
+
+// claimRestoredIPs marks the IPs of persisted peers as allocated so they keep stable addresses
+// Disabled peers keep their IP too. Peers outside the pool (e.g. after a range change) are only logged
+func (s *VPNServer) claimRestoredIPs(peers map[string]*PeerConfig) {
+	s.registerMu.Lock()
+	defer s.registerMu.Unlock()
+
+	allocator, ok := s.allocator.(SpecificAllocator)
+	if !ok {
+		return
+	}
+
+	publicKeys := make([]string, 0, len(peers))
+	for publicKey := range peers {
+		publicKeys = append(publicKeys, publicKey)
+	}
+	sort.Strings(publicKeys) // Deterministic winner if two peers claim one IP
+
+	claimed := make([]ipam.UserIPInfo, 0, len(peers))
+	for _, publicKey := range publicKeys {
+		peer := peers[publicKey]
+		if _, err := allocator.AllocateSpecificIP(peer.GetAssignedIP(), claimed); err != nil {
+			slog.Warn("Restored peer's IP not claimed in the allocator", "peer", keys.ShortID(publicKey), "ip", peer.GetAssignedIP(), "error", err)
+			continue
+		}
+		claimed = append(claimed, peer)
+	}
+}
+
+// restorePending adds each pending peer to the backend, removing the ones that succeed
+func (s *VPNServer) restorePending(pending map[string]*PeerConfig) {
+	for publicKey, peerConfig := range pending {
+		// Multiple allowed IPs are persisted comma-separated, possibly by older versions that didn't normalize
+		allowedIPs, err := NormalizeAllowedIPs(strings.Split(peerConfig.AllowedIPs, ","))
+		if err != nil {
+			allowedIPs = strings.Split(peerConfig.AllowedIPs, ",") // Let the backend report it
+		}
+		if err := s.backend.AddPeer(publicKey, allowedIPs); err != nil {
+			slog.Warn("Failed to restore peer", "peer", keys.ShortID(publicKey), "error", err)
+			continue
+		}
+		delete(pending, publicKey)
+		slog.Debug("Restored peer", "peer", keys.ShortID(publicKey), "allowedIPs", peerConfig.AllowedIPs)
+	}
+}
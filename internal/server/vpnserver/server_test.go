@@ -2,10 +2,18 @@ package vpnserver
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"slices"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/november1306/go-vpn/internal/ipam"
 	"github.com/november1306/go-vpn/internal/wireguard/keys"
 )
 
@@ -216,6 +224,12 @@ func TestVPNServerPeerManagement(t *testing.T) {
 			t.Errorf("Expected 0 peers after removing all, got %d", len(peers))
 		}
 	})
+
+	t.Run("RemoveUnknownClient", func(t *testing.T) {
+		if err := server.RemoveClient(clientPubKey1); !errors.Is(err, ErrPeerNotFound) {
+			t.Errorf("Expected ErrPeerNotFound for a removed peer, got %v", err)
+		}
+	})
 }
 
 func TestVPNServerErrorCases(t *testing.T) {
@@ -318,3 +332,1290 @@ func isTUNError(err error) bool {
 		strings.Contains(errStr, "Unable to load library") ||
 		strings.Contains(errStr, "failed to create TUN interface")
 }
+
+func TestAddClientAllowedIPsLimit(t *testing.T) {
+	config := newTestServerConfig(t)
+	config.MaxAllowedIPsPerPeer = 3
+	server, backend := startFakeServer(t, config)
+
+	allowedIPs := func(n int) []string {
+		ips := make([]string, n)
+		for i := range ips {
+			ips[i] = fmt.Sprintf("10.0.%d.0/24", i+1)
+		}
+		return ips
+	}
+
+	t.Run("at limit", func(t *testing.T) {
+		_, pubKey, _ := keys.GenerateKeyPair()
+		if err := server.AddClientWithAllowedIPs(pubKey, allowedIPs(3)); err != nil {
+			t.Fatalf("Expected peer with max allowed IPs to be accepted: %v", err)
+		}
+		if len(backend.peers[pubKey]) != 3 {
+			t.Errorf("Expected 3 allowed IPs on backend, got %v", backend.peers[pubKey])
+		}
+	})
+
+	t.Run("one over limit", func(t *testing.T) {
+		_, pubKey, _ := keys.GenerateKeyPair()
+		err := server.AddClientWithAllowedIPs(pubKey, allowedIPs(4))
+		if !errors.Is(err, ErrTooManyAllowedIPs) {
+			t.Fatalf("Expected ErrTooManyAllowedIPs, got %v", err)
+		}
+		if _, exists := backend.peers[pubKey]; exists {
+			t.Error("Rejected peer should not be added to backend")
+		}
+	})
+
+	t.Run("duplicates don't count against the limit", func(t *testing.T) {
+		_, pubKey, _ := keys.GenerateKeyPair()
+		requested := []string{"10.0.9.2", "10.0.9.2/32", "10.0.8.0/24", "10.0.8.5/32", "10.0.7.0/24"}
+		if err := server.AddClientWithAllowedIPs(pubKey, requested); err != nil {
+			t.Fatalf("Expected normalized allowed IPs within the limit to be accepted: %v", err)
+		}
+
+		want := []string{"10.0.9.2/32", "10.0.8.0/24", "10.0.7.0/24"}
+		if applied := backend.peers[pubKey]; !slices.Equal(applied, want) {
+			t.Errorf("Expected backend allowed IPs %v, got %v", want, applied)
+		}
+		if stored, _ := server.PeerStore().GetPeer(pubKey); stored.AllowedIPs != strings.Join(want, ",") {
+			t.Errorf("Expected stored allowed IPs %v, got %s", want, stored.AllowedIPs)
+		}
+	})
+
+	t.Run("default limit", func(t *testing.T) {
+		defaultServer, _ := startFakeServer(t, newTestServerConfig(t))
+
+		_, pubKey, _ := keys.GenerateKeyPair()
+		if err := defaultServer.AddClientWithAllowedIPs(pubKey, allowedIPs(DefaultMaxAllowedIPsPerPeer)); err != nil {
+			t.Errorf("Expected %d allowed IPs to be accepted: %v", DefaultMaxAllowedIPsPerPeer, err)
+		}
+
+		err := defaultServer.AddClientWithAllowedIPs(pubKey, allowedIPs(DefaultMaxAllowedIPsPerPeer+1))
+		if !errors.Is(err, ErrTooManyAllowedIPs) {
+			t.Errorf("Expected ErrTooManyAllowedIPs over default limit, got %v", err)
+		}
+	})
+
+	t.Run("persisted allowed IPs restore", func(t *testing.T) {
+		_, pubKey, _ := keys.GenerateKeyPair()
+		if err := server.AddClientWithAllowedIPs(pubKey, []string{"10.0.0.5/32", "192.168.50.0/24"}); err != nil {
+			t.Fatalf("AddClientWithAllowedIPs failed: %v", err)
+		}
+
+		ctx := context.Background()
+		server.Stop(ctx)
+		if err := server.Start(ctx, config); err != nil {
+			t.Fatalf("Failed to restart server: %v", err)
+		}
+
+		restored := backend.peers[pubKey]
+		if len(restored) != 2 || restored[0] != "10.0.0.5/32" || restored[1] != "192.168.50.0/24" {
+			t.Errorf("Expected both allowed IPs restored, got %v", restored)
+		}
+	})
+}
+
+func TestAddClientAllowedIPFamily(t *testing.T) {
+	server, backend := startFakeServer(t, newTestServerConfig(t))
+
+	tests := []struct {
+		name       string
+		allowedIPs []string
+		wantErr    error
+	}{
+		{name: "IPv4 host", allowedIPs: []string{"10.0.0.2/32"}},
+		{name: "IPv4 subnet", allowedIPs: []string{"192.168.10.0/24"}},
+		{name: "IPv6 host", allowedIPs: []string{"fd00::2/128"}, wantErr: ErrAllowedIPFamilyMismatch},
+		{name: "mixed families", allowedIPs: []string{"10.0.0.3/32", "fd00::3/128"}, wantErr: ErrAllowedIPFamilyMismatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, pubKey, _ := keys.GenerateKeyPair()
+			err := server.AddClientWithAllowedIPs(pubKey, tt.allowedIPs)
+
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Fatalf("Expected allowed IPs %v to be accepted: %v", tt.allowedIPs, err)
+				}
+				return
+			}
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Expected %v, got %v", tt.wantErr, err)
+			}
+			if _, exists := backend.peers[pubKey]; exists {
+				t.Error("Rejected peer should not be added to backend")
+			}
+		})
+	}
+
+	t.Run("IPv6 server rejects IPv4 client", func(t *testing.T) {
+		config := newTestServerConfig(t)
+		config.ServerIP = "fd00::1/64"
+		v6Server, _ := startFakeServer(t, config)
+
+		_, pubKey, _ := keys.GenerateKeyPair()
+		if err := v6Server.AddClient(pubKey, "fd00::2"); err != nil {
+			t.Errorf("Expected IPv6 client on IPv6 server to be accepted: %v", err)
+		}
+
+		_, pubKey, _ = keys.GenerateKeyPair()
+		if err := v6Server.AddClient(pubKey, "10.0.0.2"); !errors.Is(err, ErrAllowedIPFamilyMismatch) {
+			t.Errorf("Expected ErrAllowedIPFamilyMismatch, got %v", err)
+		}
+	})
+}
+
+func TestSetPeerEnabled(t *testing.T) {
+	config := newTestServerConfig(t)
+	dataDir := t.TempDir()
+	backend := newFakeBackend()
+
+	server, err := NewVPNServer(backend, dataDir)
+	if err != nil {
+		t.Fatalf("Failed to create VPN server: %v", err)
+	}
+
+	ctx := context.Background()
+	if err := server.Start(ctx, config); err != nil {
+		t.Fatalf("Failed to start VPN server: %v", err)
+	}
+	defer server.Stop(ctx)
+
+	_, pubKey, _ := keys.GenerateKeyPair()
+	if err := server.AddClient(pubKey, "10.0.0.2"); err != nil {
+		t.Fatalf("AddClient failed: %v", err)
+	}
+
+	t.Run("disable removes from backend but keeps registration", func(t *testing.T) {
+		if err := server.SetPeerEnabled(pubKey, false); err != nil {
+			t.Fatalf("SetPeerEnabled(false) failed: %v", err)
+		}
+		if _, exists := backend.peers[pubKey]; exists {
+			t.Error("Disabled peer should be removed from backend")
+		}
+
+		peer, exists := server.PeerStore().GetPeer(pubKey)
+		if !exists {
+			t.Fatal("Disabled peer should remain in peer store")
+		}
+		if !peer.Disabled || peer.AllowedIPs != "10.0.0.2/32" {
+			t.Errorf("Unexpected stored peer after disable: %+v", peer)
+		}
+	})
+
+	t.Run("disable is idempotent", func(t *testing.T) {
+		if err := server.SetPeerEnabled(pubKey, false); err != nil {
+			t.Errorf("Disabling an already disabled peer failed: %v", err)
+		}
+	})
+
+	t.Run("disabled peer not restored on restart", func(t *testing.T) {
+		server.Stop(ctx)
+		if err := server.Start(ctx, config); err != nil {
+			t.Fatalf("Failed to restart server: %v", err)
+		}
+		if _, exists := backend.peers[pubKey]; exists {
+			t.Error("Disabled peer should not be restored on restart")
+		}
+		if peer, exists := server.PeerStore().GetPeer(pubKey); !exists || !peer.Disabled {
+			t.Error("Disabled flag should survive restart")
+		}
+	})
+
+	t.Run("enable re-adds with stored allowed IPs", func(t *testing.T) {
+		if err := server.SetPeerEnabled(pubKey, true); err != nil {
+			t.Fatalf("SetPeerEnabled(true) failed: %v", err)
+		}
+		allowedIPs := backend.peers[pubKey]
+		if len(allowedIPs) != 1 || allowedIPs[0] != "10.0.0.2/32" {
+			t.Errorf("Expected re-enabled peer with [10.0.0.2/32], got %v", allowedIPs)
+		}
+		if peer, _ := server.PeerStore().GetPeer(pubKey); peer.Disabled {
+			t.Error("Peer should no longer be flagged disabled")
+		}
+	})
+
+	t.Run("unknown peer", func(t *testing.T) {
+		_, unknown, _ := keys.GenerateKeyPair()
+		if err := server.SetPeerEnabled(unknown, false); !errors.Is(err, ErrPeerNotFound) {
+			t.Errorf("Expected ErrPeerNotFound, got %v", err)
+		}
+	})
+}
+
+func TestSetPeerEnabledDuringReRegistration(t *testing.T) {
+	backend := newFakeBackend()
+	server := NewVPNServerWithPeerStore(backend, NewInMemoryPeerStore())
+
+	ctx := context.Background()
+	if err := server.Start(ctx, newTestServerConfig(t)); err != nil {
+		t.Fatalf("Failed to start VPN server: %v", err)
+	}
+	defer server.Stop(ctx)
+	server.SetAllocator(&fakeAllocator{ip: "10.9.0.2/32"})
+
+	_, pubKey, _ := keys.GenerateKeyPair()
+	if _, err := server.RegisterClientWithToken(pubKey, ""); err != nil {
+		t.Fatalf("RegisterClientWithToken failed: %v", err)
+	}
+
+	// Hold the re-registration inside the backend while an admin disables the peer
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	var once sync.Once
+	backend.addPeerHook = func() {
+		once.Do(func() {
+			close(entered)
+			<-release
+		})
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		server.RegisterClientWithToken(pubKey, "")
+	}()
+	<-entered
+
+	disabled := make(chan error, 1)
+	go func() { disabled <- server.SetPeerEnabled(pubKey, false) }()
+
+	select {
+	case err := <-disabled:
+		close(release)
+		t.Fatalf("SetPeerEnabled returned during a re-registration: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	wg.Wait()
+	if err := <-disabled; err != nil {
+		t.Fatalf("SetPeerEnabled failed: %v", err)
+	}
+
+	if _, onDevice := backend.peers[pubKey]; onDevice {
+		t.Error("Disabled peer was left on the device by the re-registration")
+	}
+	if peer, _ := server.PeerStore().GetPeer(pubKey); !peer.Disabled {
+		t.Error("Expected peer to be stored as disabled")
+	}
+}
+
+func TestReplacePeerKey(t *testing.T) {
+	backend := newFakeBackend()
+	server := NewVPNServerWithPeerStore(backend, NewInMemoryPeerStore())
+
+	ctx := context.Background()
+	if err := server.Start(ctx, newTestServerConfig(t)); err != nil {
+		t.Fatalf("Failed to start VPN server: %v", err)
+	}
+	defer server.Stop(ctx)
+
+	_, oldKey, _ := keys.GenerateKeyPair()
+	_, newKey, _ := keys.GenerateKeyPair()
+	_, otherKey, _ := keys.GenerateKeyPair()
+	if err := server.AddClient(oldKey, "10.0.0.2"); err != nil {
+		t.Fatalf("AddClient failed: %v", err)
+	}
+	if err := server.AddClient(otherKey, "10.0.0.3"); err != nil {
+		t.Fatalf("AddClient failed: %v", err)
+	}
+
+	t.Run("new key already registered", func(t *testing.T) {
+		if _, err := server.ReplacePeerKey(oldKey, otherKey); !errors.Is(err, ErrPeerExists) {
+			t.Errorf("Expected ErrPeerExists, got %v", err)
+		}
+		if _, exists := backend.peers[oldKey]; !exists {
+			t.Error("Old key should be untouched after a rejected swap")
+		}
+	})
+
+	t.Run("swap keeps allowed IPs", func(t *testing.T) {
+		allowedIPs, err := server.ReplacePeerKey(oldKey, newKey)
+		if err != nil {
+			t.Fatalf("ReplacePeerKey failed: %v", err)
+		}
+		if allowedIPs != "10.0.0.2/32" {
+			t.Errorf("Expected allowed IPs 10.0.0.2/32, got %s", allowedIPs)
+		}
+		if _, exists := backend.peers[oldKey]; exists {
+			t.Error("Old key should be removed from backend")
+		}
+		if ips := backend.peers[newKey]; len(ips) != 1 || ips[0] != "10.0.0.2/32" {
+			t.Errorf("Expected new key with [10.0.0.2/32], got %v", ips)
+		}
+		if _, exists := server.PeerStore().GetPeer(oldKey); exists {
+			t.Error("Old key should be removed from peer store")
+		}
+		if peer, exists := server.PeerStore().GetPeer(newKey); !exists || peer.PublicKey != newKey || peer.AllowedIPs != "10.0.0.2/32" {
+			t.Errorf("Unexpected stored peer for new key: %+v", peer)
+		}
+	})
+
+	t.Run("unknown peer", func(t *testing.T) {
+		_, unknown, _ := keys.GenerateKeyPair()
+		_, replacement, _ := keys.GenerateKeyPair()
+		if _, err := server.ReplacePeerKey(unknown, replacement); !errors.Is(err, ErrPeerNotFound) {
+			t.Errorf("Expected ErrPeerNotFound, got %v", err)
+		}
+	})
+
+	t.Run("disabled peer stays off the device", func(t *testing.T) {
+		if err := server.SetPeerEnabled(otherKey, false); err != nil {
+			t.Fatalf("SetPeerEnabled failed: %v", err)
+		}
+		_, replacement, _ := keys.GenerateKeyPair()
+		if _, err := server.ReplacePeerKey(otherKey, replacement); err != nil {
+			t.Fatalf("ReplacePeerKey failed: %v", err)
+		}
+		if _, exists := backend.peers[replacement]; exists {
+			t.Error("Disabled peer should not be added to backend under its new key")
+		}
+		if peer, exists := server.PeerStore().GetPeer(replacement); !exists || !peer.Disabled {
+			t.Error("Disabled flag should carry over to the new key")
+		}
+	})
+}
+
+// fakeAllocator hands out a fixed IP and records releases
+type fakeAllocator struct {
+	ip       string
+	err      error
+	released []string
+}
+
+func (f *fakeAllocator) AllocateIP(existingUsers []ipam.UserIPInfo) (string, error) {
+	return f.ip, f.err
+}
+
+func (f *fakeAllocator) ReleaseIP(ip string) error {
+	f.released = append(f.released, ip)
+	return nil
+}
+
+func (f *fakeAllocator) IsIPAvailable(targetIP string, existingUsers []ipam.UserIPInfo) bool {
+	return targetIP != f.ip
+}
+
+func (f *fakeAllocator) GetNetworkInfo() ipam.NetworkInfo {
+	return ipam.NetworkInfo{CIDR: "10.9.0.0/16", Gateway: "10.0.0.1"}
+}
+
+func (f *fakeAllocator) GetStats() ipam.AllocationStats {
+	return ipam.AllocationStats{}
+}
+
+func TestRegisterClientWithCustomAllocator(t *testing.T) {
+	backend := newFakeBackend()
+	server := NewVPNServerWithPeerStore(backend, NewInMemoryPeerStore())
+
+	ctx := context.Background()
+	if err := server.Start(ctx, newTestServerConfig(t)); err != nil {
+		t.Fatalf("Failed to start VPN server: %v", err)
+	}
+	defer server.Stop(ctx)
+
+	allocator := &fakeAllocator{ip: "10.9.9.9/32"}
+	server.SetAllocator(allocator)
+
+	t.Run("uses injected allocator", func(t *testing.T) {
+		_, pubKey, _ := keys.GenerateKeyPair()
+		clientIP, err := server.RegisterClient(pubKey)
+		if err != nil {
+			t.Fatalf("RegisterClient failed: %v", err)
+		}
+		if clientIP != "10.9.9.9/32" {
+			t.Errorf("Expected IP from fake allocator, got %s", clientIP)
+		}
+		if ips := backend.peers[pubKey]; len(ips) != 1 || ips[0] != "10.9.9.9/32" {
+			t.Errorf("Expected backend peer with [10.9.9.9/32], got %v", ips)
+		}
+	})
+
+	t.Run("registration matches what the backend applied", func(t *testing.T) {
+		_, pubKey, _ := keys.GenerateKeyPair()
+		allocator.ip = "10.9.9.10/32"
+		registration, err := server.RegisterClientWithToken(pubKey, "")
+		if err != nil {
+			t.Fatalf("RegisterClientWithToken failed: %v", err)
+		}
+		if registration.ClientIP != "10.9.9.10/32" {
+			t.Errorf("Expected client IP 10.9.9.10/32, got %s", registration.ClientIP)
+		}
+		if applied := backend.peers[pubKey]; !slices.Equal(registration.AllowedIPs, applied) {
+			t.Errorf("Registration allowed IPs %v differ from backend %v", registration.AllowedIPs, applied)
+		}
+		if !reflect.DeepEqual(registration.Network, allocator.GetNetworkInfo()) {
+			t.Errorf("Expected allocator network %+v, got %+v", allocator.GetNetworkInfo(), registration.Network)
+		}
+	})
+
+	t.Run("network info comes from allocator", func(t *testing.T) {
+		info, ok := server.NetworkInfo()
+		if !ok || info.CIDR != "10.9.0.0/16" {
+			t.Errorf("Unexpected network info %+v (ok=%v)", info, ok)
+		}
+	})
+
+	t.Run("failed add releases IP", func(t *testing.T) {
+		// An IPv6 address on the IPv4 server network makes AddClientWithAllowedIPs fail
+		allocator.ip = "fd00::9/128"
+		_, pubKey, _ := keys.GenerateKeyPair()
+		if _, err := server.RegisterClient(pubKey); err == nil {
+			t.Fatal("Expected RegisterClient to fail for mismatched family")
+		}
+		if len(allocator.released) != 1 || allocator.released[0] != "fd00::9/128" {
+			t.Errorf("Expected the IP to be released, got %v", allocator.released)
+		}
+	})
+
+	t.Run("remove releases IP", func(t *testing.T) {
+		allocator.ip = "10.9.9.11/32"
+		allocator.released = nil
+		_, pubKey, _ := keys.GenerateKeyPair()
+		if _, err := server.RegisterClient(pubKey); err != nil {
+			t.Fatalf("RegisterClient failed: %v", err)
+		}
+		if err := server.RemoveClient(pubKey); err != nil {
+			t.Fatalf("RemoveClient failed: %v", err)
+		}
+		if len(allocator.released) != 1 || allocator.released[0] != "10.9.9.11/32" {
+			t.Errorf("Expected the removed peer's IP to be released, got %v", allocator.released)
+		}
+	})
+
+	t.Run("allocation error", func(t *testing.T) {
+		allocator.err = ipam.ErrNoAvailableIPs
+		_, pubKey, _ := keys.GenerateKeyPair()
+		if _, err := server.RegisterClient(pubKey); !errors.Is(err, ipam.ErrNoAvailableIPs) {
+			t.Errorf("Expected ErrNoAvailableIPs, got %v", err)
+		}
+	})
+}
+
+func TestReRegisterReusesStoredIP(t *testing.T) {
+	backend := newFakeBackend()
+	server := NewVPNServerWithPeerStore(backend, NewInMemoryPeerStore())
+
+	ctx := context.Background()
+	if err := server.Start(ctx, newTestServerConfig(t)); err != nil {
+		t.Fatalf("Failed to start VPN server: %v", err)
+	}
+	defer server.Stop(ctx)
+
+	allocator := &fakeAllocator{ip: "10.9.0.2/32"}
+	server.SetAllocator(allocator)
+
+	_, pubKey, _ := keys.GenerateKeyPair()
+	first, err := server.RegisterClientWithToken(pubKey, "")
+	if err != nil {
+		t.Fatalf("RegisterClientWithToken failed: %v", err)
+	}
+
+	t.Run("same key gets stored IP", func(t *testing.T) {
+		allocator.ip = "10.9.0.3/32"
+		again, err := server.RegisterClientWithToken(pubKey, "")
+		if err != nil {
+			t.Fatalf("Re-registration failed: %v", err)
+		}
+		if !reflect.DeepEqual(again, first) {
+			t.Errorf("Expected stored registration %+v, got %+v", first, again)
+		}
+		if ips := backend.peers[pubKey]; !slices.Equal(ips, []string{"10.9.0.2/32"}) {
+			t.Errorf("Expected backend peer to keep [10.9.0.2/32], got %v", ips)
+		}
+	})
+
+	t.Run("disabled peer stays off the device", func(t *testing.T) {
+		if err := server.SetPeerEnabled(pubKey, false); err != nil {
+			t.Fatalf("SetPeerEnabled failed: %v", err)
+		}
+		defer server.SetPeerEnabled(pubKey, true)
+
+		if _, err := server.RegisterClientWithToken(pubKey, ""); err != nil {
+			t.Fatalf("Re-registration failed: %v", err)
+		}
+		if _, onDevice := backend.peers[pubKey]; onDevice {
+			t.Error("Re-registering a disabled peer must not put it back on the device")
+		}
+	})
+
+	t.Run("new key gets fresh IP", func(t *testing.T) {
+		_, otherKey, _ := keys.GenerateKeyPair()
+		allocator.ip = "10.9.0.4/32"
+		registration, err := server.RegisterClientWithToken(otherKey, "")
+		if err != nil {
+			t.Fatalf("RegisterClientWithToken failed: %v", err)
+		}
+		if registration.ClientIP != "10.9.0.4/32" {
+			t.Errorf("Expected fresh IP 10.9.0.4/32, got %s", registration.ClientIP)
+		}
+	})
+
+	t.Run("stored IP outside pool is replaced", func(t *testing.T) {
+		_, movedKey, _ := keys.GenerateKeyPair()
+		if err := server.PeerStore().AddPeer(movedKey, "192.168.50.2/32"); err != nil {
+			t.Fatalf("Failed to store peer: %v", err)
+		}
+		allocator.ip = "10.9.0.5/32"
+		registration, err := server.RegisterClientWithToken(movedKey, "")
+		if err != nil {
+			t.Fatalf("RegisterClientWithToken failed: %v", err)
+		}
+		if registration.ClientIP != "10.9.0.5/32" {
+			t.Errorf("Expected fresh IP 10.9.0.5/32, got %s", registration.ClientIP)
+		}
+	})
+}
+
+func TestReRegisterAfterFailedRestore(t *testing.T) {
+	store := NewInMemoryPeerStore()
+	_, pubKey, _ := keys.GenerateKeyPair()
+	if err := store.AddPeer(pubKey, "10.9.0.2/32"); err != nil {
+		t.Fatalf("AddPeer failed: %v", err)
+	}
+
+	backend := newFakeBackend()
+	backend.addPeerFailures = 100 // Restore gives up and leaves the peer off the device
+	server := NewVPNServerWithPeerStore(backend, store)
+	server.restoreBackoff = []time.Duration{time.Millisecond}
+
+	ctx := context.Background()
+	if err := server.Start(ctx, newTestServerConfig(t)); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer server.Stop(ctx)
+	server.SetAllocator(&fakeAllocator{ip: "10.9.0.3/32"})
+
+	if _, onDevice := backend.peers[pubKey]; onDevice {
+		t.Fatal("Expected the failed restore to leave the peer off the device")
+	}
+	backend.addPeerFailures = 0 // The device has recovered
+
+	registration, err := server.RegisterClientWithToken(pubKey, "")
+	if err != nil {
+		t.Fatalf("Re-registration failed: %v", err)
+	}
+	if registration.ClientIP != "10.9.0.2/32" {
+		t.Errorf("Expected stored IP 10.9.0.2/32, got %s", registration.ClientIP)
+	}
+	if ips, onDevice := backend.peers[pubKey]; !onDevice || !slices.Equal(ips, []string{"10.9.0.2/32"}) {
+		t.Errorf("Expected re-registration to put the peer back with [10.9.0.2/32], got %v", ips)
+	}
+}
+
+// staleAllocator hands out every IP twice, as an allocator whose view lags the peer store would,
+// and reports a conflict on every fourth call
+type staleAllocator struct {
+	fakeAllocator
+	mu    sync.Mutex
+	calls int
+	next  int
+}
+
+func (f *staleAllocator) AllocateIP(existingUsers []ipam.UserIPInfo) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.calls++
+	if f.calls%4 == 0 {
+		return "", ErrAllocationConflict
+	}
+	ip := fmt.Sprintf("10.0.0.%d/32", 2+f.next/2)
+	f.next++
+	return ip, nil
+}
+
+func TestRegisterClientRetriesCollisions(t *testing.T) {
+	config := newTestServerConfig(t)
+	config.AllocationAttempts = 3
+	server, backend := startFakeServer(t, config)
+
+	allocator := &staleAllocator{}
+	server.SetAllocator(allocator)
+
+	const clients = 20
+	results := make(chan string, clients)
+	errs := make(chan error, clients)
+	var wg sync.WaitGroup
+	for i := 0; i < clients; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, pubKey, _ := keys.GenerateKeyPair()
+			clientIP, err := server.RegisterClient(pubKey)
+			if err != nil {
+				errs <- err
+				return
+			}
+			results <- clientIP
+		}()
+	}
+	wg.Wait()
+	close(results)
+	close(errs)
+
+	for err := range errs {
+		t.Errorf("RegisterClient failed within the retry budget: %v", err)
+	}
+
+	seen := make(map[string]bool)
+	for clientIP := range results {
+		if seen[clientIP] {
+			t.Errorf("IP %s assigned twice", clientIP)
+		}
+		seen[clientIP] = true
+	}
+	if len(seen) != clients || len(backend.peers) != clients {
+		t.Errorf("Expected %d unique IPs and peers, got %d IPs and %d peers", clients, len(seen), len(backend.peers))
+	}
+	if allocator.calls <= clients {
+		t.Errorf("Expected collisions to force extra allocations, got %d calls for %d clients", allocator.calls, clients)
+	}
+}
+
+func TestRegisterClientContentionExhausted(t *testing.T) {
+	config := newTestServerConfig(t)
+	config.AllocationAttempts = 2
+	server, backend := startFakeServer(t, config)
+
+	// Always hands out the IP the first client holds
+	allocator := &fakeAllocator{ip: "10.0.0.5/32"}
+	server.SetAllocator(allocator)
+
+	_, holder, _ := keys.GenerateKeyPair()
+	if _, err := server.RegisterClient(holder); err != nil {
+		t.Fatalf("RegisterClient failed: %v", err)
+	}
+
+	_, pubKey, _ := keys.GenerateKeyPair()
+	_, err := server.RegisterClient(pubKey)
+	if !errors.Is(err, ErrAllocationContention) {
+		t.Fatalf("Expected ErrAllocationContention, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "2 attempts") {
+		t.Errorf("Expected the attempt budget in the error, got %v", err)
+	}
+	if _, added := backend.peers[pubKey]; added {
+		t.Error("Peer should not be added after exhausting the retry budget")
+	}
+	if len(allocator.released) != 0 {
+		t.Errorf("The holder's IP must not be released, got %v", allocator.released)
+	}
+
+	t.Run("pool exhaustion is not retried", func(t *testing.T) {
+		allocator.err = ipam.ErrNoAvailableIPs
+		if _, err := server.RegisterClient(pubKey); !errors.Is(err, ipam.ErrNoAvailableIPs) || errors.Is(err, ErrAllocationContention) {
+			t.Errorf("Expected ErrNoAvailableIPs, got %v", err)
+		}
+	})
+}
+
+func TestRejectsServerPublicKey(t *testing.T) {
+	server, backend := startFakeServer(t, newTestServerConfig(t))
+	allocator := &fakeAllocator{ip: "10.0.0.5/32"}
+	server.SetAllocator(allocator)
+
+	info, err := server.GetServerInfo()
+	if err != nil {
+		t.Fatalf("GetServerInfo failed: %v", err)
+	}
+	serverKey := info.PublicKey
+
+	t.Run("register", func(t *testing.T) {
+		if _, err := server.RegisterClient(serverKey); !errors.Is(err, ErrServerPublicKey) {
+			t.Errorf("Expected ErrServerPublicKey, got %v", err)
+		}
+		if len(allocator.released) != 0 {
+			t.Errorf("Expected rejection before allocating, got released %v", allocator.released)
+		}
+	})
+
+	t.Run("add client", func(t *testing.T) {
+		if err := server.AddClient(serverKey, "10.0.0.6"); !errors.Is(err, ErrServerPublicKey) {
+			t.Errorf("Expected ErrServerPublicKey, got %v", err)
+		}
+	})
+
+	t.Run("replace key", func(t *testing.T) {
+		_, pubKey, _ := keys.GenerateKeyPair()
+		if err := server.AddClient(pubKey, "10.0.0.7"); err != nil {
+			t.Fatalf("AddClient failed: %v", err)
+		}
+		if _, err := server.ReplacePeerKey(pubKey, serverKey); !errors.Is(err, ErrServerPublicKey) {
+			t.Errorf("Expected ErrServerPublicKey, got %v", err)
+		}
+	})
+
+	if _, added := backend.peers[serverKey]; added {
+		t.Error("Server public key must not be added as a peer")
+	}
+}
+
+func TestPeerCount(t *testing.T) {
+	server, _ := startFakeServer(t, newTestServerConfig(t))
+
+	assertCount := func(t *testing.T, want int) {
+		t.Helper()
+		peers, err := server.GetConnectedClients()
+		if err != nil {
+			t.Fatalf("GetConnectedClients failed: %v", err)
+		}
+		if got := server.PeerCount(); got != len(peers) || got != want {
+			t.Errorf("PeerCount() = %d, want %d (GetConnectedClients has %d)", got, want, len(peers))
+		}
+	}
+
+	assertCount(t, 0)
+
+	var added []string
+	for i := 2; i <= 4; i++ {
+		_, pubKey, _ := keys.GenerateKeyPair()
+		if err := server.AddClient(pubKey, fmt.Sprintf("10.0.0.%d", i)); err != nil {
+			t.Fatalf("AddClient failed: %v", err)
+		}
+		added = append(added, pubKey)
+	}
+	assertCount(t, 3)
+
+	if err := server.RemoveClient(added[0]); err != nil {
+		t.Fatalf("RemoveClient failed: %v", err)
+	}
+	assertCount(t, 2)
+
+	server.Stop(context.Background())
+	if got := server.PeerCount(); got != 0 {
+		t.Errorf("PeerCount() = %d after stop, want 0", got)
+	}
+}
+
+func TestStopRejectsPeerChanges(t *testing.T) {
+	t.Run("in-flight add completes, later add is rejected", func(t *testing.T) {
+		backend := newFakeBackend()
+		server, err := NewVPNServer(backend, t.TempDir())
+		if err != nil {
+			t.Fatalf("Failed to create VPN server: %v", err)
+		}
+		ctx := context.Background()
+		if err := server.Start(ctx, newTestServerConfig(t)); err != nil {
+			t.Fatalf("Failed to start VPN server: %v", err)
+		}
+
+		// Hold the first add inside the backend until Stop is waiting on it
+		entered := make(chan struct{})
+		release := make(chan struct{})
+		backend.addPeerHook = func() {
+			close(entered)
+			<-release
+		}
+
+		_, inFlightKey, _ := keys.GenerateKeyPair()
+		addDone := make(chan error, 1)
+		go func() { addDone <- server.AddClient(inFlightKey, "10.0.0.2") }()
+		<-entered
+
+		stopDone := make(chan error, 1)
+		go func() { stopDone <- server.Stop(ctx) }()
+		for !server.shuttingDown.Load() {
+			time.Sleep(time.Millisecond)
+		}
+
+		_, lateKey, _ := keys.GenerateKeyPair()
+		if err := server.AddClient(lateKey, "10.0.0.3"); !errors.Is(err, ErrServerShuttingDown) {
+			t.Errorf("Expected ErrServerShuttingDown for add during stop, got %v", err)
+		}
+		if err := server.RemoveClient(inFlightKey); !errors.Is(err, ErrServerShuttingDown) {
+			t.Errorf("Expected ErrServerShuttingDown for remove during stop, got %v", err)
+		}
+
+		close(release)
+		if err := <-addDone; err != nil {
+			t.Errorf("In-flight add should complete, got %v", err)
+		}
+		if err := <-stopDone; err != nil {
+			t.Fatalf("Stop failed: %v", err)
+		}
+
+		if _, exists := server.PeerStore().GetPeer(inFlightKey); !exists {
+			t.Error("Completed add should be persisted")
+		}
+		if _, exists := server.PeerStore().GetPeer(lateKey); exists {
+			t.Error("Rejected add should not be persisted")
+		}
+		if err := server.AddClient(lateKey, "10.0.0.3"); !errors.Is(err, ErrServerNotRunning) {
+			t.Errorf("Expected ErrServerNotRunning after stop, got %v", err)
+		}
+	})
+
+	t.Run("concurrent adds are applied fully or not at all", func(t *testing.T) {
+		server, backend := startFakeServer(t, newTestServerConfig(t))
+
+		const clients = 50
+		pubKeys := make([]string, clients)
+		for i := range pubKeys {
+			_, pubKeys[i], _ = keys.GenerateKeyPair()
+		}
+
+		errs := make([]error, clients)
+		var wg sync.WaitGroup
+		for i := range pubKeys {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				errs[i] = server.AddClient(pubKeys[i], fmt.Sprintf("10.0.0.%d", i+2))
+			}(i)
+		}
+		if err := server.Stop(context.Background()); err != nil {
+			t.Fatalf("Stop failed: %v", err)
+		}
+		wg.Wait()
+
+		if backend.IsRunning() {
+			t.Error("Backend should be stopped")
+		}
+		for i, pubKey := range pubKeys {
+			_, persisted := server.PeerStore().GetPeer(pubKey)
+			switch {
+			case errs[i] == nil && !persisted:
+				t.Errorf("Client %d: add succeeded but peer not persisted", i)
+			case errs[i] != nil && persisted:
+				t.Errorf("Client %d: add failed (%v) but peer persisted", i, errs[i])
+			case errs[i] != nil && !errors.Is(errs[i], ErrServerNotRunning):
+				t.Errorf("Client %d: unexpected error %v", i, errs[i])
+			}
+		}
+	})
+}
+
+func TestIsPeerActive(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	window := 2 * time.Minute
+
+	tests := []struct {
+		name     string
+		lastSeen int64
+		want     bool
+	}{
+		{name: "never handshaked", lastSeen: 0, want: false},
+		{name: "just now", lastSeen: now.Unix(), want: true},
+		{name: "just inside window", lastSeen: now.Add(-window + time.Second).Unix(), want: true},
+		{name: "exactly at window", lastSeen: now.Add(-window).Unix(), want: true},
+		{name: "just outside window", lastSeen: now.Add(-window - time.Second).Unix(), want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isPeerActive(tt.lastSeen, now, window); got != tt.want {
+				t.Errorf("isPeerActive(%d) = %v, want %v", tt.lastSeen, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetConnectedClientsActiveWindow(t *testing.T) {
+	config := newTestServerConfig(t)
+	config.PeerActiveWindow = time.Minute
+	server, backend := startFakeServer(t, config)
+
+	_, insideKey, _ := keys.GenerateKeyPair()
+	_, outsideKey, _ := keys.GenerateKeyPair()
+	for i, pubKey := range []string{insideKey, outsideKey} {
+		if err := server.AddClient(pubKey, fmt.Sprintf("10.0.0.%d", i+2)); err != nil {
+			t.Fatalf("AddClient failed: %v", err)
+		}
+	}
+	backend.lastSeen = map[string]int64{
+		insideKey:  time.Now().Add(-50 * time.Second).Unix(),
+		outsideKey: time.Now().Add(-70 * time.Second).Unix(),
+	}
+
+	peers, err := server.GetConnectedClients()
+	if err != nil {
+		t.Fatalf("GetConnectedClients failed: %v", err)
+	}
+
+	active := map[string]bool{}
+	for _, peer := range peers {
+		active[peer.PublicKey] = peer.Active
+	}
+	if !active[insideKey] {
+		t.Error("Peer inside the configured window should be active")
+	}
+	if active[outsideKey] {
+		t.Error("Peer outside the configured window should be inactive")
+	}
+
+	t.Run("default window", func(t *testing.T) {
+		server, _ := startFakeServer(t, newTestServerConfig(t))
+		if got := server.peerActiveWindow(); got != DefaultPeerActiveWindow {
+			t.Errorf("Expected default window %s, got %s", DefaultPeerActiveWindow, got)
+		}
+	})
+
+	t.Run("negative window rejected", func(t *testing.T) {
+		badConfig := newTestServerConfig(t)
+		badConfig.PeerActiveWindow = -time.Second
+		server, err := NewVPNServer(newFakeBackend(), t.TempDir())
+		if err != nil {
+			t.Fatalf("Failed to create VPN server: %v", err)
+		}
+		if err := server.Start(context.Background(), badConfig); err == nil {
+			server.Stop(context.Background())
+			t.Error("Expected Start to reject a negative active window")
+		}
+	})
+}
+
+func TestConcurrentStart(t *testing.T) {
+	backend := newFakeBackend()
+	server, err := NewVPNServer(backend, t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create VPN server: %v", err)
+	}
+	config := newTestServerConfig(t)
+	ctx := context.Background()
+
+	// Hold the winning start inside the backend until every other caller has returned
+	release := make(chan struct{})
+	backend.startHook = func() { <-release }
+
+	const callers = 8
+	results := make(chan error, callers)
+	var wg sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results <- server.Start(ctx, config)
+		}()
+	}
+
+	// All but the winner fail fast with ErrAlreadyStarting
+	var errs []error
+	for len(errs) < callers-1 {
+		err := <-results
+		if err == nil {
+			t.Fatal("A start succeeded while the backend was still starting")
+		}
+		errs = append(errs, err)
+	}
+
+	if err := server.Stop(ctx); !errors.Is(err, ErrAlreadyStarting) {
+		t.Errorf("Expected Stop during start to return ErrAlreadyStarting, got %v", err)
+	}
+
+	close(release)
+	wg.Wait()
+	close(results)
+	if err := <-results; err != nil {
+		t.Fatalf("Winning start failed: %v", err)
+	}
+	defer server.Stop(ctx)
+
+	for _, err := range errs {
+		if !errors.Is(err, ErrAlreadyStarting) {
+			t.Errorf("Expected ErrAlreadyStarting, got %v", err)
+		}
+	}
+	if backend.starts != 1 {
+		t.Errorf("Expected exactly one backend start, got %d", backend.starts)
+	}
+	if !server.IsRunning() {
+		t.Error("Server should be running after the winning start")
+	}
+
+	if err := server.Start(ctx, config); !errors.Is(err, ErrAlreadyRunning) {
+		t.Errorf("Expected ErrAlreadyRunning once started, got %v", err)
+	}
+}
+
+func TestRestoreClaimsPeerIPs(t *testing.T) {
+	store := NewInMemoryPeerStore()
+	for _, ip := range []string{"10.0.0.2/32", "10.0.0.3/32", "10.9.9.9/32"} {
+		_, pubKey, _ := keys.GenerateKeyPair()
+		if err := store.AddPeer(pubKey, ip); err != nil {
+			t.Fatalf("AddPeer failed: %v", err)
+		}
+	}
+
+	allocator, err := ipam.NewAllocator(ipam.DefaultConfig())
+	if err != nil {
+		t.Fatalf("NewAllocator failed: %v", err)
+	}
+	server := NewVPNServerWithPeerStore(newFakeBackend(), store)
+	server.SetAllocator(allocator)
+
+	ctx := context.Background()
+	if err := server.Start(ctx, newTestServerConfig(t)); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer server.Stop(ctx)
+
+	// The peer outside the pool is still restored, just not claimed
+	if got := allocator.GetStats().TotalAllocations; got != 2 {
+		t.Errorf("Expected the 2 in-pool peers to claim their IPs, got %d allocations", got)
+	}
+	if _, err := allocator.AllocateSpecificIP("10.0.0.3", store.AssignedIPs()); !errors.Is(err, ipam.ErrIPAlreadyAllocated) {
+		t.Errorf("Expected a restored peer's IP to be taken, got %v", err)
+	}
+	if peers, _ := server.GetConnectedClients(); len(peers) != 3 {
+		t.Errorf("Expected all 3 peers restored, got %d", len(peers))
+	}
+}
+
+func TestStickyIPAcrossReRegistration(t *testing.T) {
+	config := ipam.DefaultConfig()
+	config.StickyTTL = time.Hour
+	allocator, err := ipam.NewAllocator(config)
+	if err != nil {
+		t.Fatalf("NewAllocator failed: %v", err)
+	}
+	server := NewVPNServerWithPeerStore(newFakeBackend(), NewInMemoryPeerStore())
+	server.SetAllocator(allocator)
+
+	ctx := context.Background()
+	if err := server.Start(ctx, newTestServerConfig(t)); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer server.Stop(ctx)
+
+	_, pubKey, _ := keys.GenerateKeyPair()
+	first, err := server.RegisterClientWithToken(pubKey, "")
+	if err != nil {
+		t.Fatalf("RegisterClientWithToken failed: %v", err)
+	}
+	if err := server.RemoveClient(pubKey); err != nil {
+		t.Fatalf("RemoveClient failed: %v", err)
+	}
+
+	_, otherKey, _ := keys.GenerateKeyPair()
+	other, err := server.RegisterClientWithToken(otherKey, "")
+	if err != nil {
+		t.Fatalf("RegisterClientWithToken failed: %v", err)
+	}
+	if other.ClientIP == first.ClientIP {
+		t.Errorf("Held IP %s was handed to another peer", first.ClientIP)
+	}
+
+	again, err := server.RegisterClientWithToken(pubKey, "")
+	if err != nil {
+		t.Fatalf("Re-registration failed: %v", err)
+	}
+	if again.ClientIP != first.ClientIP {
+		t.Errorf("Expected re-registering peer to get %s back, got %s", first.ClientIP, again.ClientIP)
+	}
+}
+
+func TestRestorePersistedPeersRetries(t *testing.T) {
+	newServer := func(t *testing.T, failures int, backoff []time.Duration) (*VPNServer, *fakeBackend) {
+		t.Helper()
+		store := NewInMemoryPeerStore()
+		for _, ip := range []string{"10.0.0.2/32", "10.0.0.3/32"} {
+			_, pubKey, _ := keys.GenerateKeyPair()
+			if err := store.AddPeer(pubKey, ip); err != nil {
+				t.Fatalf("AddPeer failed: %v", err)
+			}
+		}
+
+		backend := newFakeBackend()
+		backend.addPeerFailures = failures
+		server := NewVPNServerWithPeerStore(backend, store)
+		server.restoreBackoff = backoff
+		return server, backend
+	}
+
+	t.Run("succeeds once the device is ready", func(t *testing.T) {
+		server, backend := newServer(t, 3, []time.Duration{time.Millisecond, time.Millisecond, time.Millisecond})
+
+		ctx := context.Background()
+		if err := server.Start(ctx, newTestServerConfig(t)); err != nil {
+			t.Fatalf("Start failed: %v", err)
+		}
+		defer server.Stop(ctx)
+
+		if len(backend.peers) != 2 {
+			t.Errorf("Expected both peers restored after retries, got %d", len(backend.peers))
+		}
+		if backend.addPeerCalls != 5 {
+			t.Errorf("Expected 3 failed and 2 successful AddPeer calls, got %d", backend.addPeerCalls)
+		}
+	})
+
+	t.Run("gives up after the last retry", func(t *testing.T) {
+		server, backend := newServer(t, 100, []time.Duration{time.Millisecond, time.Millisecond})
+		backend.running = true
+
+		err := server.restorePersistedPeers(context.Background())
+		if err == nil || !strings.Contains(err.Error(), "gave up restoring 2 of 2 peers after 2 retries") {
+			t.Errorf("Expected give-up error, got %v", err)
+		}
+		if backend.addPeerCalls != 6 {
+			t.Errorf("Expected 3 attempts for each of 2 peers, got %d calls", backend.addPeerCalls)
+		}
+	})
+
+	t.Run("startup completes when retries are exhausted", func(t *testing.T) {
+		server, backend := newServer(t, 100, []time.Duration{time.Millisecond})
+
+		ctx := context.Background()
+		if err := server.Start(ctx, newTestServerConfig(t)); err != nil {
+			t.Fatalf("Start failed: %v", err)
+		}
+		defer server.Stop(ctx)
+
+		if !server.IsRunning() || len(backend.peers) != 0 {
+			t.Errorf("Expected a running server with no restored peers, got running=%v peers=%d", server.IsRunning(), len(backend.peers))
+		}
+	})
+
+	t.Run("cancelled context stops retrying", func(t *testing.T) {
+		server, backend := newServer(t, 100, []time.Duration{time.Hour})
+		backend.running = true
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if err := server.restorePersistedPeers(ctx); !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected context.Canceled, got %v", err)
+		}
+	})
+}
+
+func TestAddClientPersistPolicy(t *testing.T) {
+	// A directory in place of the temp file makes every save fail, even when running as root
+	breakSaves := func(t *testing.T, server *VPNServer) {
+		t.Helper()
+		if err := os.Mkdir(server.peerStore.filePath+".tmp", 0700); err != nil {
+			t.Fatalf("Failed to block peer store saves: %v", err)
+		}
+	}
+
+	t.Run("memory keeps the peer and flags the store", func(t *testing.T) {
+		server, backend := startFakeServer(t, newTestServerConfig(t))
+		breakSaves(t, server)
+
+		_, pubKey, _ := keys.GenerateKeyPair()
+		if err := server.AddClient(pubKey, "10.0.0.2"); err != nil {
+			t.Fatalf("Expected registration to succeed in memory, got %v", err)
+		}
+		if _, exists := backend.peers[pubKey]; !exists {
+			t.Error("Expected device peer to be kept")
+		}
+		if _, exists := server.PeerStore().GetPeer(pubKey); !exists {
+			t.Error("Expected peer to be kept in the store's memory")
+		}
+		if !server.PeerStore().Unsaved() {
+			t.Error("Expected store to be flagged as unsaved")
+		}
+	})
+
+	t.Run("strict fails and rolls back the device peer", func(t *testing.T) {
+		config := newTestServerConfig(t)
+		config.PersistPolicy = PersistStrict
+		server, backend := startFakeServer(t, config)
+		breakSaves(t, server)
+
+		_, pubKey, _ := keys.GenerateKeyPair()
+		if err := server.AddClient(pubKey, "10.0.0.2"); !errors.Is(err, ErrPeerNotPersisted) {
+			t.Fatalf("Expected ErrPeerNotPersisted, got %v", err)
+		}
+		if _, exists := backend.peers[pubKey]; exists {
+			t.Error("Expected device peer to be rolled back")
+		}
+		if _, exists := server.PeerStore().GetPeer(pubKey); exists {
+			t.Error("Expected peer to be removed from the store's memory")
+		}
+	})
+
+	t.Run("unsaved flag clears after a successful save", func(t *testing.T) {
+		server, _ := startFakeServer(t, newTestServerConfig(t))
+		breakSaves(t, server)
+
+		_, firstKey, _ := keys.GenerateKeyPair()
+		if err := server.AddClient(firstKey, "10.0.0.2"); err != nil {
+			t.Fatalf("AddClient failed: %v", err)
+		}
+		os.Remove(server.peerStore.filePath + ".tmp")
+
+		_, secondKey, _ := keys.GenerateKeyPair()
+		if err := server.AddClient(secondKey, "10.0.0.3"); err != nil {
+			t.Fatalf("AddClient failed: %v", err)
+		}
+		if server.PeerStore().Unsaved() {
+			t.Error("Expected unsaved flag to clear once the store saved")
+		}
+	})
+}
+
+func TestGetServerInfoListenAddr(t *testing.T) {
+	tests := []struct {
+		listenAddr string
+		wantHost   string
+		want       string
+	}{
+		{"", "", ":51820"},
+		{"0.0.0.0", "", ":51820"},
+		{"127.0.0.1", "127.0.0.1", "127.0.0.1:51820"},
+		{"::1", "::1", "[::1]:51820"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.listenAddr, func(t *testing.T) {
+			config := newTestServerConfig(t)
+			config.ListenAddr = tt.listenAddr
+			server, _ := startFakeServer(t, config)
+
+			info, err := server.GetServerInfo()
+			if err != nil {
+				t.Fatalf("GetServerInfo failed: %v", err)
+			}
+			if info.Host != tt.wantHost || info.Port != 51820 || info.ServerIP != config.ServerIP {
+				t.Errorf("Unexpected server info %+v", info)
+			}
+			if info.Endpoint() != tt.want {
+				t.Errorf("Expected endpoint %q, got %q", tt.want, info.Endpoint())
+			}
+		})
+	}
+}
+
+func TestServerInfoEndpoint(t *testing.T) {
+	tests := []struct {
+		name string
+		info ServerInfo
+		want string
+	}{
+		{"port only", ServerInfo{Port: 51820}, ":51820"},
+		{"IPv4 host", ServerInfo{Host: "203.0.113.1", Port: 51820}, "203.0.113.1:51820"},
+		{"IPv6 host", ServerInfo{Host: "2001:db8::1", Port: 443}, "[2001:db8::1]:443"},
+		{"hostname", ServerInfo{Host: "vpn.example.com", Port: 51820}, "vpn.example.com:51820"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.info.Endpoint(); got != tt.want {
+				t.Errorf("Endpoint() = %q, want %q", got, tt.want)
+			}
+
+			// /api/status clients read the formatted endpoint alongside the parts
+			data, err := json.Marshal(tt.info)
+			if err != nil {
+				t.Fatalf("Marshal failed: %v", err)
+			}
+			var decoded struct {
+				Endpoint string
+				Host     string
+				Port     int
+			}
+			if err := json.Unmarshal(data, &decoded); err != nil {
+				t.Fatalf("Unmarshal failed: %v", err)
+			}
+			if decoded.Endpoint != tt.want || decoded.Host != tt.info.Host || decoded.Port != tt.info.Port {
+				t.Errorf("Unexpected JSON %s", data)
+			}
+		})
+	}
+}
@@ -0,0 +1,188 @@
+package vpnserver
+
+import (
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"sync"
+
+	"golang.zx2c4.com/wireguard/tun"
+)
+
+// SourceFilterMode controls inspection of decrypted packets for unexpected source IPs
+type SourceFilterMode string
+
+const (
+	SourceFilterOff   SourceFilterMode = ""      // No inspection (default)
+	SourceFilterCount SourceFilterMode = "count" // Count packets from unexpected sources but deliver them
+	SourceFilterDrop  SourceFilterMode = "drop"  // Count and drop packets from unexpected sources
+)
+
+// ParseSourceFilterMode validates a mode name from configuration ("off", "count" or "drop")
+func ParseSourceFilterMode(value string) (SourceFilterMode, error) {
+	switch value {
+	case "", "off":
+		return SourceFilterOff, nil
+	case string(SourceFilterCount):
+		return SourceFilterCount, nil
+	case string(SourceFilterDrop):
+		return SourceFilterDrop, nil
+	default:
+		return SourceFilterOff, fmt.Errorf("invalid source filter mode %q (want off, count or drop)", value)
+	}
+}
+
+// peerSources is what the filter knows about one peer
+type peerSources struct {
+	assigned netip.Addr     // The peer's own tunnel address
+	allowed  []netip.Prefix // Everything WireGuard lets the peer send from
+}
+
+// sourceFilter checks that decrypted packets come from the sending peer's assigned IP
+// WireGuard already limits a peer to its allowed IPs; this is a stricter, optional check
+// that catches peers using routed ranges or spoofing within them
+type sourceFilter struct {
+	mode SourceFilterMode
+
+	mu         sync.RWMutex
+	peers      map[string]peerSources // publicKey -> sources
+	violations map[string]int64       // publicKey -> packets with unexpected source
+	unmatched  int64                  // Packets not attributable to any known peer
+}
+
+// newSourceFilter creates a filter in the given mode
+func newSourceFilter(mode SourceFilterMode) *sourceFilter {
+	return &sourceFilter{
+		mode:       mode,
+		peers:      make(map[string]peerSources),
+		violations: make(map[string]int64),
+	}
+}
+
+// setPeer records a peer's allowed IPs; the first one is its assigned address
+func (f *sourceFilter) setPeer(publicKey string, allowedIPs []string) error {
+	sources := peerSources{}
+	for i, allowedIP := range allowedIPs {
+		prefix, err := netip.ParsePrefix(allowedIP)
+		if err != nil {
+			return fmt.Errorf("invalid allowed IP %q: %w", allowedIP, err)
+		}
+		if i == 0 {
+			sources.assigned = prefix.Addr()
+		}
+		sources.allowed = append(sources.allowed, prefix.Masked())
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.peers[publicKey] = sources
+	return nil
+}
+
+// removePeer forgets a peer and its violation count
+func (f *sourceFilter) removePeer(publicKey string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.peers, publicKey)
+	delete(f.violations, publicKey)
+}
+
+// violationCount returns the unexpected-source packet count for a peer
+func (f *sourceFilter) violationCount(publicKey string) int64 {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.violations[publicKey]
+}
+
+// allow inspects one decrypted IP packet and reports whether it should be delivered
+func (f *sourceFilter) allow(packet []byte) bool {
+	src, ok := packetSource(packet)
+	if !ok {
+		return true // Not an IP packet we understand; leave it to the kernel
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	publicKey, sources, found := f.owner(src)
+	switch {
+	case !found:
+		f.unmatched++
+	case src != sources.assigned:
+		f.violations[publicKey]++
+	default:
+		return true
+	}
+
+	return f.mode != SourceFilterDrop
+}
+
+// owner finds the peer whose allowed IPs contain src, preferring the most specific prefix
+// This mirrors WireGuard's crypto-routing, so it identifies the peer that sent the packet
+func (f *sourceFilter) owner(src netip.Addr) (string, peerSources, bool) {
+	var (
+		bestKey     string
+		bestSources peerSources
+		bestBits    = -1
+	)
+	for publicKey, sources := range f.peers {
+		for _, prefix := range sources.allowed {
+			if prefix.Contains(src) && prefix.Bits() > bestBits {
+				bestKey, bestSources, bestBits = publicKey, sources, prefix.Bits()
+			}
+		}
+	}
+	return bestKey, bestSources, bestBits >= 0
+}
+
+// packetSource extracts the source address of an IPv4 or IPv6 packet
+func packetSource(packet []byte) (netip.Addr, bool) {
+	if len(packet) == 0 {
+		return netip.Addr{}, false
+	}
+	switch packet[0] >> 4 {
+	case 4:
+		if len(packet) < 20 {
+			return netip.Addr{}, false
+		}
+		return netip.AddrFrom4([4]byte(packet[12:16])), true
+	case 6:
+		if len(packet) < 40 {
+			return netip.Addr{}, false
+		}
+		return netip.AddrFrom16([16]byte(packet[8:24])), true
+	default:
+		return netip.Addr{}, false
+	}
+}
+
+// filteredTUN applies a sourceFilter to packets WireGuard writes to the TUN device
+type filteredTUN struct {
+	tun.Device
+	filter *sourceFilter
+}
+
+// Write delivers the packets that pass the filter; dropped packets are reported as written
+func (t *filteredTUN) Write(bufs [][]byte, offset int) (int, error) {
+	kept := bufs[:0:0]
+	for _, buf := range bufs {
+		if offset < len(buf) && !t.filter.allow(buf[offset:]) {
+			continue
+		}
+		kept = append(kept, buf)
+	}
+
+	if len(kept) == 0 {
+		return len(bufs), nil
+	}
+	if _, err := t.Device.Write(kept, offset); err != nil {
+		return 0, err
+	}
+	return len(bufs), nil
+}
+
+// wrap returns a TUN wrapper that installs the filter
+func (f *sourceFilter) wrap(device tun.Device) tun.Device {
+	slog.Info("Source IP filtering enabled", "mode", f.mode)
+	return &filteredTUN{Device: device, filter: f}
+}
@@ -0,0 +1,191 @@
+package vpnserver
+
+import (
+	"net/netip"
+	"testing"
+
+	"golang.zx2c4.com/wireguard/tun"
+)
+
+// ipv4Packet builds a minimal IPv4 header with the given source address
+func ipv4Packet(src string) []byte {
+	packet := make([]byte, 20)
+	packet[0] = 0x45
+	addr := netip.MustParseAddr(src).As4()
+	copy(packet[12:16], addr[:])
+	return packet
+}
+
+// ipv6Packet builds a minimal IPv6 header with the given source address
+func ipv6Packet(src string) []byte {
+	packet := make([]byte, 40)
+	packet[0] = 0x60
+	addr := netip.MustParseAddr(src).As16()
+	copy(packet[8:24], addr[:])
+	return packet
+}
+
+func TestPacketSource(t *testing.T) {
+	tests := []struct {
+		name   string
+		packet []byte
+		want   string
+		wantOK bool
+	}{
+		{name: "ipv4", packet: ipv4Packet("10.0.0.2"), want: "10.0.0.2", wantOK: true},
+		{name: "ipv6", packet: ipv6Packet("fd00::2"), want: "fd00::2", wantOK: true},
+		{name: "truncated ipv4", packet: ipv4Packet("10.0.0.2")[:12]},
+		{name: "truncated ipv6", packet: ipv6Packet("fd00::2")[:20]},
+		{name: "empty", packet: nil},
+		{name: "not ip", packet: []byte{0x00, 0x01}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src, ok := packetSource(tt.packet)
+			if ok != tt.wantOK {
+				t.Fatalf("packetSource() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if ok && src.String() != tt.want {
+				t.Errorf("packetSource() = %s, want %s", src, tt.want)
+			}
+		})
+	}
+}
+
+func TestSourceFilterAllow(t *testing.T) {
+	newFilter := func(t *testing.T, mode SourceFilterMode) *sourceFilter {
+		t.Helper()
+		filter := newSourceFilter(mode)
+		if err := filter.setPeer("peerA", []string{"10.0.0.2/32", "192.168.50.0/24"}); err != nil {
+			t.Fatalf("setPeer failed: %v", err)
+		}
+		if err := filter.setPeer("peerB", []string{"10.0.0.3/32"}); err != nil {
+			t.Fatalf("setPeer failed: %v", err)
+		}
+		return filter
+	}
+
+	t.Run("assigned source passes", func(t *testing.T) {
+		filter := newFilter(t, SourceFilterDrop)
+		if !filter.allow(ipv4Packet("10.0.0.2")) || !filter.allow(ipv4Packet("10.0.0.3")) {
+			t.Error("Packets from assigned IPs should pass")
+		}
+		if filter.violationCount("peerA") != 0 || filter.violationCount("peerB") != 0 {
+			t.Error("Expected no violations for assigned sources")
+		}
+	})
+
+	t.Run("count mode delivers unexpected source", func(t *testing.T) {
+		filter := newFilter(t, SourceFilterCount)
+		if !filter.allow(ipv4Packet("192.168.50.7")) {
+			t.Error("Count mode should still deliver the packet")
+		}
+		if got := filter.violationCount("peerA"); got != 1 {
+			t.Errorf("Expected 1 violation for peerA, got %d", got)
+		}
+	})
+
+	t.Run("drop mode drops unexpected source", func(t *testing.T) {
+		filter := newFilter(t, SourceFilterDrop)
+		if filter.allow(ipv4Packet("192.168.50.7")) {
+			t.Error("Drop mode should drop the packet")
+		}
+		if got := filter.violationCount("peerA"); got != 1 {
+			t.Errorf("Expected 1 violation for peerA, got %d", got)
+		}
+		if got := filter.violationCount("peerB"); got != 0 {
+			t.Errorf("Violation attributed to wrong peer: peerB has %d", got)
+		}
+	})
+
+	t.Run("unattributed source", func(t *testing.T) {
+		filter := newFilter(t, SourceFilterDrop)
+		if filter.allow(ipv4Packet("172.16.0.1")) {
+			t.Error("Drop mode should drop packets from unknown sources")
+		}
+		if filter.unmatched != 1 {
+			t.Errorf("Expected 1 unmatched packet, got %d", filter.unmatched)
+		}
+	})
+
+	t.Run("non-IP passes", func(t *testing.T) {
+		filter := newFilter(t, SourceFilterDrop)
+		if !filter.allow([]byte{0x00}) {
+			t.Error("Unparseable packets should be left to the kernel")
+		}
+	})
+
+	t.Run("remove peer clears count", func(t *testing.T) {
+		filter := newFilter(t, SourceFilterCount)
+		filter.allow(ipv4Packet("192.168.50.7"))
+		filter.removePeer("peerA")
+		if got := filter.violationCount("peerA"); got != 0 {
+			t.Errorf("Expected count cleared after removal, got %d", got)
+		}
+	})
+
+	t.Run("ipv6", func(t *testing.T) {
+		filter := newSourceFilter(SourceFilterDrop)
+		filter.setPeer("peerC", []string{"fd00::2/128", "fd00:1::/64"})
+		if !filter.allow(ipv6Packet("fd00::2")) {
+			t.Error("Assigned IPv6 source should pass")
+		}
+		if filter.allow(ipv6Packet("fd00:1::9")) {
+			t.Error("Routed IPv6 source should be dropped")
+		}
+	})
+}
+
+// recordingTUN captures packets written by the filter
+type recordingTUN struct {
+	tun.Device
+	written [][]byte
+}
+
+func (r *recordingTUN) Write(bufs [][]byte, offset int) (int, error) {
+	for _, buf := range bufs {
+		r.written = append(r.written, buf[offset:])
+	}
+	return len(bufs), nil
+}
+
+func TestFilteredTUNWrite(t *testing.T) {
+	filter := newSourceFilter(SourceFilterDrop)
+	filter.setPeer("peerA", []string{"10.0.0.2/32", "192.168.50.0/24"})
+
+	inner := &recordingTUN{}
+	device := filter.wrap(inner)
+
+	const offset = 16
+	withOffset := func(packet []byte) []byte {
+		return append(make([]byte, offset), packet...)
+	}
+	bufs := [][]byte{
+		withOffset(ipv4Packet("10.0.0.2")),
+		withOffset(ipv4Packet("192.168.50.7")),
+		withOffset(ipv4Packet("10.0.0.2")),
+	}
+
+	n, err := device.Write(bufs, offset)
+	if err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if n != len(bufs) {
+		t.Errorf("Expected all %d buffers reported written, got %d", len(bufs), n)
+	}
+	if len(inner.written) != 2 {
+		t.Errorf("Expected 2 packets delivered, got %d", len(inner.written))
+	}
+}
+
+func TestParseSourceFilterMode(t *testing.T) {
+	for value, want := range map[string]SourceFilterMode{"": SourceFilterOff, "off": SourceFilterOff, "count": SourceFilterCount, "drop": SourceFilterDrop} {
+		if got, err := ParseSourceFilterMode(value); err != nil || got != want {
+			t.Errorf("ParseSourceFilterMode(%q) = %q, %v; want %q", value, got, err, want)
+		}
+	}
+	if _, err := ParseSourceFilterMode("block"); err == nil {
+		t.Error("Expected error for unknown mode")
+	}
+}
@@ -0,0 +1,71 @@
+package vpnserver
+
+import (
+	"crypto/subtle"
+	"fmt"
+
+	"github.com/november1306/go-vpn/internal/ipam"
+)
+
+// DefaultPool is the allocator pool used for registrations without a mapped API token
+const DefaultPool = "default"
+
+// PoolAllocator is an Allocator that can allocate from one of several named pools
+type PoolAllocator interface {
+	Allocator
+	AllocateIPInRegion(region string, existingUsers []ipam.UserIPInfo) (string, error)
+}
+
+// OwnerPoolAllocator is a PoolAllocator whose pools hold a released IP for its previous owner
+type OwnerPoolAllocator interface {
+	PoolAllocator
+	AllocateIPInRegionForOwner(region, owner string, existingUsers []ipam.UserIPInfo) (string, error)
+	ReleaseIPForOwner(ip string, owner string) error
+}
+
+var _ OwnerPoolAllocator = (*ipam.MultiPoolAllocator)(nil)
+
+// SetTokenPools maps API tokens to the allocator pool their registrations draw from
+// The allocator must then be a PoolAllocator with a DefaultPool for all other registrations
+func (s *VPNServer) SetTokenPools(pools map[string]string) {
+	s.registerMu.Lock()
+	defer s.registerMu.Unlock()
+
+	s.tokenPools = pools
+}
+
+// poolForToken returns the pool mapped to token, or DefaultPool for unknown and empty tokens
+// Every mapping is compared in constant time so response timing doesn't reveal valid tokens
+// Callers must hold s.registerMu
+func (s *VPNServer) poolForToken(token string) string {
+	pool := DefaultPool
+	for candidate, name := range s.tokenPools {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(candidate)) == 1 {
+			pool = name
+		}
+	}
+	return pool
+}
+
+// allocateForToken picks an IP from the caller's pool, or from anywhere when no tokens are mapped
+// Allocators that hold released IPs give publicKey back the IP it released within their TTL
+// Callers must hold s.registerMu
+func (s *VPNServer) allocateForToken(token, publicKey string) (string, error) {
+	assigned := s.peerStore.AssignedIPs()
+	if len(s.tokenPools) == 0 {
+		if owners, ok := s.allocator.(OwnerAllocator); ok {
+			return owners.AllocateIPForOwner(publicKey, assigned)
+		}
+		return s.allocator.AllocateIP(assigned)
+	}
+
+	region := s.poolForToken(token)
+	if owners, ok := s.allocator.(OwnerPoolAllocator); ok {
+		return owners.AllocateIPInRegionForOwner(region, publicKey, assigned)
+	}
+	pools, ok := s.allocator.(PoolAllocator)
+	if !ok {
+		return "", fmt.Errorf("token pools need an allocator with named pools, got %T", s.allocator)
+	}
+	return pools.AllocateIPInRegion(region, assigned)
+}
@@ -0,0 +1,82 @@
+package vpnserver
+
+import (
+	"context"
+	"net/netip"
+	"testing"
+
+	"github.com/november1306/go-vpn/internal/ipam"
+	"github.com/november1306/go-vpn/internal/wireguard/keys"
+)
+
+func TestRegisterClientWithToken(t *testing.T) {
+	newPool := func(t *testing.T, name, cidr, gateway string) ipam.Pool {
+		t.Helper()
+		allocator, err := ipam.NewAllocator(ipam.ConfigFromNetwork(cidr, gateway))
+		if err != nil {
+			t.Fatalf("Failed to create %s allocator: %v", name, err)
+		}
+		return ipam.Pool{Name: name, Allocator: allocator}
+	}
+
+	allocator, err := ipam.NewMultiPoolAllocator(
+		newPool(t, DefaultPool, "10.0.0.0/24", "10.0.0.1"),
+		newPool(t, "tenant-a", "10.1.0.0/24", "10.1.0.1"),
+		newPool(t, "tenant-b", "10.2.0.0/24", "10.2.0.1"),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create pools: %v", err)
+	}
+
+	server := NewVPNServerWithPeerStore(newFakeBackend(), NewInMemoryPeerStore())
+	ctx := context.Background()
+	if err := server.Start(ctx, newTestServerConfig(t)); err != nil {
+		t.Fatalf("Failed to start VPN server: %v", err)
+	}
+	defer server.Stop(ctx)
+
+	server.SetAllocator(allocator)
+	server.SetTokenPools(map[string]string{"token-a": "tenant-a", "token-b": "tenant-b"})
+
+	tests := []struct {
+		name  string
+		token string
+		want  string
+	}{
+		{"first token", "token-a", "10.1.0.0/24"},
+		{"second token", "token-b", "10.2.0.0/24"},
+		{"first token again", "token-a", "10.1.0.0/24"},
+		{"unknown token", "token-c", "10.0.0.0/24"},
+		{"token prefix", "token-", "10.0.0.0/24"},
+		{"no token", "", "10.0.0.0/24"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, pubKey, _ := keys.GenerateKeyPair()
+			registration, err := server.RegisterClientWithToken(pubKey, tt.token)
+			if err != nil {
+				t.Fatalf("RegisterClientWithToken failed: %v", err)
+			}
+
+			prefix := netip.MustParsePrefix(tt.want)
+			if !prefix.Contains(netip.MustParsePrefix(registration.ClientIP).Addr()) {
+				t.Errorf("Expected an IP in %s, got %s", tt.want, registration.ClientIP)
+			}
+			if registration.Network.CIDR != tt.want {
+				t.Errorf("Expected the registration to report network %s, got %s", tt.want, registration.Network.CIDR)
+			}
+		})
+	}
+}
+
+func TestRegisterClientWithTokenNeedsPools(t *testing.T) {
+	server, _ := startFakeServer(t, newTestServerConfig(t))
+	server.SetAllocator(&fakeAllocator{ip: "10.0.0.9/32"})
+	server.SetTokenPools(map[string]string{"token-a": "tenant-a"})
+
+	_, pubKey, _ := keys.GenerateKeyPair()
+	if _, err := server.RegisterClientWithToken(pubKey, "token-a"); err == nil {
+		t.Error("Expected an error when the allocator has no named pools")
+	}
+}
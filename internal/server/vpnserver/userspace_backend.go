@@ -6,25 +6,48 @@ import (
 	"encoding/hex"
 	"fmt"
 	"log/slog"
+	"net"
+	"strings"
 	"sync"
+	"sync/atomic"
 
+	"github.com/november1306/go-vpn/internal/logging"
 	"github.com/november1306/go-vpn/internal/wireguard"
+	"github.com/november1306/go-vpn/internal/wireguard/keys"
 )
 
+// ipcDevice is the UAPI surface of a WireGuard device (replaced by a fake in tests)
+type ipcDevice interface {
+	IpcSet(config string) error
+	IpcGet() (string, error)
+}
+
 // UserspaceBackend implements WireGuardBackend using wireguard-go userspace implementation
 // This provides cross-platform support and easy deployment, suitable for MVP and up to ~500 users
 type UserspaceBackend struct {
 	mu      sync.RWMutex
 	device  *wireguard.WireGuardDevice
+	ipc     ipcDevice // The device's UAPI; set and cleared together with device
 	config  ServerConfig
 	running bool
 	peers   map[string][]string // publicKey -> allowedIPs mapping for tracking
+
+	endpoints *endpointTracker // Roaming detection across GetPeers calls
+	filter    *sourceFilter    // Optional ingress source checks (nil when disabled)
+
+	ipcLog       logging.RateLimiter // Keeps repeated device query failures from flooding the log
+	ipcSetErrors atomic.Int64        // Failed IpcSet calls since creation, kept across restarts
+	ipcGetErrors atomic.Int64        // Failed IpcGet calls since creation, kept across restarts
+
+	interfaces wireguard.InterfaceLister // Interface listing for the name collision check (overridable in tests)
 }
 
 // NewUserspaceBackend creates a new userspace WireGuard backend
 func NewUserspaceBackend() *UserspaceBackend {
 	return &UserspaceBackend{
-		peers: make(map[string][]string),
+		peers:      make(map[string][]string),
+		endpoints:  newEndpointTracker(),
+		interfaces: net.Interfaces,
 	}
 }
 
@@ -34,35 +57,58 @@ func (ub *UserspaceBackend) Start(ctx context.Context, config ServerConfig) erro
 	defer ub.mu.Unlock()
 
 	if ub.running {
-		return fmt.Errorf("backend already running")
+		return fmt.Errorf("backend %w", ErrAlreadyRunning)
 	}
 
 	slog.Info("Starting userspace WireGuard backend", "interface", config.InterfaceName, "port", config.ListenPort)
 
+	// Another server or client on this host may already own the name
+	if err := wireguard.CheckInterfaceFree(config.InterfaceName, ub.interfaces); err != nil {
+		return fmt.Errorf("%w; choose a different interface name (VPN_INTERFACE)", err)
+	}
+	if config.ListenAddr != "" {
+		slog.Info("WireGuard listens on all addresses; ListenAddr only sets the advertised endpoint", "listenAddr", config.ListenAddr)
+	}
+
+	// Source filtering sits between WireGuard and the TUN, so it has to be installed at creation
+	var wrap wireguard.TUNWrapper
+	var filter *sourceFilter
+	if config.SourceFilter != SourceFilterOff {
+		filter = newSourceFilter(config.SourceFilter)
+		wrap = filter.wrap
+	}
+
+	// Oversized packets pass the handshake and then stall, so flag a too-small uplink early
+	if check, err := wireguard.CheckRouteMTU(wireguard.DefaultMTU, wireguard.DefaultRouteProbe); err == nil && check.TooLarge() {
+		slog.Warn("Tunnel MTU exceeds what the default route can carry; clients may stall after connecting",
+			"mtu", check.TunnelMTU, "interface", check.Interface, "linkMTU", check.LinkMTU,
+			"suggestedClientMTU", check.SafeMTU())
+	}
+
 	// Create WireGuard device using existing foundation
-	device, err := wireguard.NewWireGuardDevice(config.InterfaceName)
+	device, err := wireguard.NewWireGuardDeviceWrapped(config.InterfaceName, wireguard.DefaultMTU, wrap)
 	if err != nil {
 		return fmt.Errorf("failed to create WireGuard device: %w", err)
 	}
 
 	// Set device before configuring so IPC calls work
-	ub.device = device
+	ub.device, ub.ipc = device, device
 
 	// Configure the device with server settings
 	if err := ub.configureDevice(config); err != nil {
-		device.Stop()   // Clean up on error
-		ub.device = nil // Reset on error
+		device.Stop()                // Clean up on error
+		ub.device, ub.ipc = nil, nil // Reset on error
 		return fmt.Errorf("failed to configure device: %w", err)
 	}
 
 	// Start the device
 	if err := device.Start(); err != nil {
-		device.Stop() // Clean up on error
+		device.Stop()                // Clean up on error
+		ub.device, ub.ipc = nil, nil // Reset on error
 		return fmt.Errorf("failed to start device: %w", err)
 	}
-
-	ub.device = device
 	ub.config = config
+	ub.filter = filter
 	ub.running = true
 
 	slog.Info("Userspace WireGuard backend started successfully", "interface", config.InterfaceName)
@@ -85,11 +131,13 @@ func (ub *UserspaceBackend) Stop(ctx context.Context) error {
 			slog.Error("Error stopping WireGuard device", "error", err)
 			// Continue with cleanup even if stop fails
 		}
-		ub.device = nil
+		ub.device, ub.ipc = nil, nil
 	}
 
 	ub.running = false
 	ub.peers = make(map[string][]string) // Clear peer tracking
+	ub.endpoints = newEndpointTracker()
+	ub.filter = nil
 
 	slog.Info("Userspace WireGuard backend stopped")
 	return nil
@@ -104,7 +152,7 @@ func (ub *UserspaceBackend) AddPeer(publicKey string, allowedIPs []string) error
 		return fmt.Errorf("backend not running")
 	}
 
-	slog.Info("Adding peer to userspace backend", "allowedIPs", allowedIPs)
+	slog.Info("Adding peer to userspace backend", "peer", keys.ShortID(publicKey), "allowedIPs", allowedIPs)
 
 	// Convert base64 public key to hex for WireGuard IPC
 	hexPublicKey, err := ub.base64ToHex(publicKey)
@@ -128,11 +176,89 @@ func (ub *UserspaceBackend) AddPeer(publicKey string, allowedIPs []string) error
 
 	// Track peer for management
 	ub.peers[publicKey] = allowedIPs
+	if ub.filter != nil {
+		if err := ub.filter.setPeer(publicKey, allowedIPs); err != nil {
+			slog.Warn("Failed to register peer with source filter", "peer", keys.ShortID(publicKey), "error", err)
+		}
+	}
 
 	slog.Info("Peer added successfully", "peerCount", len(ub.peers))
 	return nil
 }
 
+// ReplaceConfig swaps the device's whole peer set for peers in one UAPI transaction
+// Much faster than AddPeer per peer for bulk changes; disabled peers are left off the device
+func (ub *UserspaceBackend) ReplaceConfig(peers []PeerConfig) error {
+	ub.mu.Lock()
+	defer ub.mu.Unlock()
+
+	if !ub.running {
+		return fmt.Errorf("backend not running")
+	}
+
+	ipcConfig, tracked, err := ub.buildReplaceIPC(peers)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("Replacing userspace backend peer set", "peerCount", len(tracked))
+	if err := ub.applyIPCConfig(ipcConfig); err != nil {
+		return fmt.Errorf("failed to replace peers via IPC: %w", err)
+	}
+
+	// The device now holds exactly the new set, so swap tracking in one step to match
+	if ub.filter != nil {
+		for publicKey := range ub.peers {
+			if _, kept := tracked[publicKey]; !kept {
+				ub.filter.removePeer(publicKey)
+			}
+		}
+		for publicKey, allowedIPs := range tracked {
+			if err := ub.filter.setPeer(publicKey, allowedIPs); err != nil {
+				slog.Warn("Failed to register peer with source filter", "peer", keys.ShortID(publicKey), "error", err)
+			}
+		}
+	}
+	ub.peers = tracked
+
+	return nil
+}
+
+// buildReplaceIPC builds a replace_peers transaction and the tracking map it results in
+// Every key is converted before anything is applied, so a bad peer leaves the device untouched
+func (ub *UserspaceBackend) buildReplaceIPC(peers []PeerConfig) (string, map[string][]string, error) {
+	var ipc strings.Builder
+	ipc.WriteString("replace_peers=true\n")
+
+	tracked := make(map[string][]string, len(peers))
+	for _, peer := range peers {
+		if peer.Disabled {
+			continue
+		}
+
+		hexPublicKey, err := ub.base64ToHex(peer.PublicKey)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid public key for peer %s: %w", keys.ShortID(peer.PublicKey), err)
+		}
+
+		var allowedIPs []string
+		for _, ip := range strings.Split(peer.AllowedIPs, ",") {
+			if ip = strings.TrimSpace(ip); ip != "" {
+				allowedIPs = append(allowedIPs, ip)
+			}
+		}
+
+		fmt.Fprintf(&ipc, "public_key=%s\n", hexPublicKey)
+		for _, ip := range allowedIPs {
+			fmt.Fprintf(&ipc, "allowed_ip=%s\n", ip)
+		}
+		tracked[peer.PublicKey] = allowedIPs
+	}
+	ipc.WriteString("\n")
+
+	return ipc.String(), tracked, nil
+}
+
 // RemovePeer removes a peer from the WireGuard device
 func (ub *UserspaceBackend) RemovePeer(publicKey string) error {
 	ub.mu.Lock()
@@ -142,7 +268,7 @@ func (ub *UserspaceBackend) RemovePeer(publicKey string) error {
 		return fmt.Errorf("backend not running")
 	}
 
-	slog.Info("Removing peer from userspace backend")
+	slog.Info("Removing peer from userspace backend", "peer", keys.ShortID(publicKey))
 
 	// Convert base64 public key to hex for WireGuard IPC
 	hexPublicKey, err := ub.base64ToHex(publicKey)
@@ -161,6 +287,9 @@ func (ub *UserspaceBackend) RemovePeer(publicKey string) error {
 
 	// Remove from tracking
 	delete(ub.peers, publicKey)
+	if ub.filter != nil {
+		ub.filter.removePeer(publicKey)
+	}
 
 	slog.Info("Peer removed successfully", "peerCount", len(ub.peers))
 	return nil
@@ -168,31 +297,60 @@ func (ub *UserspaceBackend) RemovePeer(publicKey string) error {
 
 // GetPeers returns information about all connected peers
 func (ub *UserspaceBackend) GetPeers() ([]PeerInfo, error) {
-	ub.mu.RLock()
-	defer ub.mu.RUnlock()
+	// Write lock: reading the device updates endpoint tracking
+	ub.mu.Lock()
+	defer ub.mu.Unlock()
 
 	if !ub.running {
 		return nil, fmt.Errorf("backend not running")
 	}
 
-	// For userspace implementation, we'll return basic info from our tracking
-	// More detailed stats would require parsing IPC get responses
+	// Endpoints, transfer and handshakes come from the device; a failed query still returns tracked peers
+	ipcPeers := map[string]ipcPeer{}
+	if ipc, err := ub.ipc.IpcGet(); err != nil {
+		ub.ipcGetErrors.Add(1)
+		if suppressed, ok := ub.ipcLog.Allow("ipc-get"); ok {
+			slog.Warn("Failed to query WireGuard device", "error", err, "suppressed", suppressed)
+		}
+	} else {
+		ipcPeers = parseIpcPeers(ipc)
+		ub.endpoints.observe(ipcPeers)
+	}
+
 	peers := make([]PeerInfo, 0, len(ub.peers))
 
 	for publicKey, allowedIPs := range ub.peers {
-		peers = append(peers, PeerInfo{
+		info := PeerInfo{
 			PublicKey:  publicKey,
 			AllowedIPs: allowedIPs,
-			Endpoint:   "", // Would need IPC query for endpoint
-			LastSeen:   0,  // Would need IPC query for handshake time
-			RxBytes:    0,  // Would need IPC query for transfer stats
-			TxBytes:    0,  // Would need IPC query for transfer stats
-		})
+			Endpoint:   ipcPeers[publicKey].Endpoint,
+			LastSeen:   ipcPeers[publicKey].LastHandshake,
+			RxBytes:    ipcPeers[publicKey].RxBytes,
+			TxBytes:    ipcPeers[publicKey].TxBytes,
+		}
+		if changedAt := ub.endpoints.changedAt(publicKey); !changedAt.IsZero() {
+			info.EndpointChangedAt = changedAt.Unix()
+		}
+		if ub.filter != nil {
+			info.SourceViolations = ub.filter.violationCount(publicKey)
+		}
+		peers = append(peers, info)
 	}
 
 	return peers, nil
 }
 
+// PeerCount returns the number of tracked peers without querying the device
+func (ub *UserspaceBackend) PeerCount() int {
+	ub.mu.RLock()
+	defer ub.mu.RUnlock()
+
+	if !ub.running {
+		return 0
+	}
+	return len(ub.peers)
+}
+
 // IsRunning returns whether the backend is currently running
 func (ub *UserspaceBackend) IsRunning() bool {
 	ub.mu.RLock()
@@ -203,17 +361,11 @@ func (ub *UserspaceBackend) IsRunning() bool {
 
 // configureDevice configures the WireGuard device with server settings
 func (ub *UserspaceBackend) configureDevice(config ServerConfig) error {
-	// Convert base64 private key to hex for WireGuard IPC
-	hexPrivateKey, err := ub.base64ToHex(config.PrivateKey)
+	ipcConfig, err := ub.buildDeviceIPC(config)
 	if err != nil {
-		return fmt.Errorf("invalid private key format: %w", err)
+		return err
 	}
 
-	// Build IPC configuration for server setup
-	// UAPI format: private_key=<hex_key>\nlisten_port=<port>\n\n
-	// Note: Private key is passed directly to WireGuard IPC, not logged
-	ipcConfig := fmt.Sprintf("private_key=%s\nlisten_port=%d\n\n", hexPrivateKey, config.ListenPort)
-
 	if err := ub.applyIPCConfig(ipcConfig); err != nil {
 		return fmt.Errorf("failed to apply IPC config: %w", err)
 	}
@@ -223,15 +375,48 @@ func (ub *UserspaceBackend) configureDevice(config ServerConfig) error {
 	return ub.configureServerIP(config.ServerIP)
 }
 
+// buildDeviceIPC builds the device-level UAPI configuration for the server
+func (ub *UserspaceBackend) buildDeviceIPC(config ServerConfig) (string, error) {
+	// Convert base64 private key to hex for WireGuard IPC
+	hexPrivateKey, err := ub.base64ToHex(config.PrivateKey)
+	if err != nil {
+		return "", fmt.Errorf("invalid private key format: %w", err)
+	}
+
+	// Build IPC configuration for server setup
+	// UAPI format: private_key=<hex_key>\nlisten_port=<port>\n[fwmark=<mark>\n]\n
+	// Note: Private key is passed directly to WireGuard IPC, not logged
+	ipcConfig := fmt.Sprintf("private_key=%s\nlisten_port=%d\n", hexPrivateKey, config.ListenPort)
+
+	// fwmark tags outgoing encrypted packets so operators can policy-route them
+	if config.Fwmark != 0 {
+		ipcConfig += fmt.Sprintf("fwmark=%d\n", config.Fwmark)
+	}
+
+	return ipcConfig + "\n", nil
+}
+
 // applyIPCConfig applies configuration to the device via IPC
 func (ub *UserspaceBackend) applyIPCConfig(config string) error {
-	if ub.device == nil {
+	if ub.ipc == nil {
 		return fmt.Errorf("device not initialized")
 	}
 
 	// SECURITY: Do not log IPC config as it contains private key material
 	// Use the exposed IPC method from our WireGuardDevice wrapper
-	return ub.device.IpcSet(config)
+	if err := ub.ipc.IpcSet(config); err != nil {
+		ub.ipcSetErrors.Add(1)
+		return err
+	}
+	return nil
+}
+
+// IPCErrors returns failed device operations by type since the backend was created
+func (ub *UserspaceBackend) IPCErrors() map[string]int64 {
+	return map[string]int64{
+		IPCOpSet: ub.ipcSetErrors.Load(),
+		IPCOpGet: ub.ipcGetErrors.Load(),
+	}
 }
 
 // configureServerIP configures the server IP address on the WireGuard interface
@@ -1,10 +1,16 @@
 package vpnserver
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/hex"
+	"errors"
+	"net"
+	"reflect"
+	"strings"
 	"testing"
 
+	"github.com/november1306/go-vpn/internal/wireguard"
 	"github.com/november1306/go-vpn/internal/wireguard/keys"
 )
 
@@ -220,6 +226,49 @@ func TestWireGuardIPCFormat(t *testing.T) {
 	})
 }
 
+func TestBuildDeviceIPCFwmark(t *testing.T) {
+	backend := NewUserspaceBackend()
+
+	serverPrivKey, _, err := keys.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("Failed to generate keys: %v", err)
+	}
+
+	config := ServerConfig{
+		InterfaceName: "wg-test",
+		PrivateKey:    serverPrivKey,
+		ListenPort:    51820,
+		ServerIP:      "10.0.0.1/24",
+	}
+
+	t.Run("fwmark disabled by default", func(t *testing.T) {
+		ipc, err := backend.buildDeviceIPC(config)
+		if err != nil {
+			t.Fatalf("buildDeviceIPC failed: %v", err)
+		}
+		if contains(ipc, "fwmark=") {
+			t.Errorf("IPC config should not contain fwmark when unset: %q", ipc)
+		}
+		if !contains(ipc, "listen_port=51820\n") {
+			t.Errorf("IPC config should contain listen port: %q", ipc)
+		}
+	})
+
+	t.Run("fwmark emitted when set", func(t *testing.T) {
+		config.Fwmark = 0x1234
+		ipc, err := backend.buildDeviceIPC(config)
+		if err != nil {
+			t.Fatalf("buildDeviceIPC failed: %v", err)
+		}
+		if !contains(ipc, "fwmark=4660\n") {
+			t.Errorf("IPC config should contain fwmark line: %q", ipc)
+		}
+		if ipc[len(ipc)-2:] != "\n\n" {
+			t.Error("IPC config should end with double newline")
+		}
+	})
+}
+
 // Helper function to check if string contains substring
 func contains(s, substr string) bool {
 	return len(s) >= len(substr) && (s == substr || (len(s) > len(substr) &&
@@ -249,3 +298,111 @@ func toLower(s string) string {
 	}
 	return string(result)
 }
+
+func TestBuildReplaceIPC(t *testing.T) {
+	backend := NewUserspaceBackend()
+
+	_, keyA, _ := keys.GenerateKeyPair()
+	_, keyB, _ := keys.GenerateKeyPair()
+	_, keyDisabled, _ := keys.GenerateKeyPair()
+	hexA, _ := backend.base64ToHex(keyA)
+	hexB, _ := backend.base64ToHex(keyB)
+	hexDisabled, _ := backend.base64ToHex(keyDisabled)
+
+	ipc, tracked, err := backend.buildReplaceIPC([]PeerConfig{
+		{PublicKey: keyA, AllowedIPs: "10.0.0.2/32"},
+		{PublicKey: keyB, AllowedIPs: "10.0.0.3/32, 192.168.50.0/24"},
+		{PublicKey: keyDisabled, AllowedIPs: "10.0.0.4/32", Disabled: true},
+	})
+	if err != nil {
+		t.Fatalf("buildReplaceIPC failed: %v", err)
+	}
+
+	want := "replace_peers=true\n" +
+		"public_key=" + hexA + "\nallowed_ip=10.0.0.2/32\n" +
+		"public_key=" + hexB + "\nallowed_ip=10.0.0.3/32\nallowed_ip=192.168.50.0/24\n\n"
+	if ipc != want {
+		t.Errorf("Unexpected IPC:\n got: %q\nwant: %q", ipc, want)
+	}
+	if contains(ipc, hexDisabled) {
+		t.Error("Disabled peers must not be loaded on the device")
+	}
+
+	if len(tracked) != 2 || len(tracked[keyB]) != 2 || tracked[keyA][0] != "10.0.0.2/32" {
+		t.Errorf("Unexpected tracking map %v", tracked)
+	}
+
+	t.Run("invalid key", func(t *testing.T) {
+		if _, _, err := backend.buildReplaceIPC([]PeerConfig{{PublicKey: "bogus", AllowedIPs: "10.0.0.2/32"}}); err == nil {
+			t.Error("Expected error for invalid public key")
+		}
+	})
+
+	t.Run("empty set clears all peers", func(t *testing.T) {
+		ipc, tracked, err := backend.buildReplaceIPC(nil)
+		if err != nil || ipc != "replace_peers=true\n\n" || len(tracked) != 0 {
+			t.Errorf("Got %q, %v, %v", ipc, tracked, err)
+		}
+	})
+}
+
+func TestReplaceConfigNotRunning(t *testing.T) {
+	if err := NewUserspaceBackend().ReplaceConfig(nil); err == nil {
+		t.Error("Expected error when backend is not running")
+	}
+}
+
+func TestUserspaceBackendInterfaceCollision(t *testing.T) {
+	backend := NewUserspaceBackend()
+	backend.interfaces = func() ([]net.Interface, error) {
+		return []net.Interface{{Name: "wg-collide"}}, nil
+	}
+
+	config := ServerConfig{InterfaceName: "wg-collide", ListenPort: 51820}
+	err := backend.Start(context.Background(), config)
+	if !errors.Is(err, wireguard.ErrInterfaceExists) {
+		t.Fatalf("Expected ErrInterfaceExists, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "VPN_INTERFACE") {
+		t.Errorf("Expected guidance to choose another name, got %v", err)
+	}
+	if backend.IsRunning() {
+		t.Error("Backend should not be running after a collision")
+	}
+}
+
+// failingDevice is a WireGuard device whose every UAPI call fails
+type failingDevice struct{}
+
+func (failingDevice) IpcSet(string) error     { return errors.New("device wedged") }
+func (failingDevice) IpcGet() (string, error) { return "", errors.New("device wedged") }
+
+func TestUserspaceBackendCountsIPCErrors(t *testing.T) {
+	backend := NewUserspaceBackend()
+	backend.ipc = failingDevice{}
+	backend.running = true
+
+	_, pubKey, _ := keys.GenerateKeyPair()
+	if err := backend.AddPeer(pubKey, []string{"10.0.0.2/32"}); err == nil {
+		t.Fatal("Expected AddPeer to fail on a failing device")
+	}
+	if err := backend.ReplaceConfig(nil); err == nil {
+		t.Fatal("Expected ReplaceConfig to fail on a failing device")
+	}
+	if _, err := backend.GetPeers(); err != nil {
+		t.Fatalf("GetPeers should still return tracked peers, got %v", err)
+	}
+
+	want := map[string]int64{IPCOpSet: 2, IPCOpGet: 1}
+	if got := backend.IPCErrors(); !reflect.DeepEqual(got, want) {
+		t.Errorf("IPCErrors() = %v, want %v", got, want)
+	}
+
+	server := NewVPNServerWithPeerStore(backend, NewInMemoryPeerStore())
+	if got := server.IPCErrors(); !reflect.DeepEqual(got, want) {
+		t.Errorf("VPNServer.IPCErrors() = %v, want %v", got, want)
+	}
+	if got := NewVPNServerWithPeerStore(newFakeBackend(), NewInMemoryPeerStore()).IPCErrors(); got != nil {
+		t.Errorf("Expected nil for a backend without IPC, got %v", got)
+	}
+}
@@ -0,0 +1,192 @@
+package vpnserver
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+
+	"github.com/november1306/go-vpn/internal/wireguard"
+	"github.com/november1306/go-vpn/internal/wireguard/keys"
+)
+
+var (
+	// ErrFieldRequired is the cause of a FieldError for an unset required field
+	ErrFieldRequired = errors.New("value is required")
+
+	// ErrServerIPNotHost is the cause of a FieldError when ServerIP is its network's network or broadcast address
+	ErrServerIPNotHost = errors.New("not a usable host address in its network")
+
+	// ErrListenAddrNotLocal is the cause of a FieldError when ListenAddr is not assigned to any interface
+	ErrListenAddrNotLocal = errors.New("not assigned to any local interface")
+
+	// ErrServerIPMappedFamily is the cause of a FieldError when ServerIP is an IPv4-mapped IPv6 prefix,
+	// which would make the server's address family ambiguous for allowed-IP checks
+	ErrServerIPMappedFamily = errors.New("IPv4-mapped IPv6 address; use the IPv4 form")
+)
+
+// FieldError reports one invalid ServerConfig field
+type FieldError struct {
+	Field string // ServerConfig field name, e.g. "ListenPort"
+	Err   error
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Field, e.Err)
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// ServerConfigError aggregates every invalid field found by ValidateServerConfig
+type ServerConfigError struct {
+	Fields []*FieldError
+}
+
+func (e *ServerConfigError) Error() string {
+	messages := make([]string, len(e.Fields))
+	for i, field := range e.Fields {
+		messages[i] = field.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Unwrap exposes the field errors so errors.Is and errors.As reach their causes
+func (e *ServerConfigError) Unwrap() []error {
+	errs := make([]error, len(e.Fields))
+	for i, field := range e.Fields {
+		errs[i] = field
+	}
+	return errs
+}
+
+// ValidateServerConfig checks every field of config and reports all problems at once
+// It returns nil or a *ServerConfigError; VPNServer.Start rejects configs that fail it
+func ValidateServerConfig(config ServerConfig) error {
+	var fields []*FieldError
+	invalid := func(field string, err error) {
+		fields = append(fields, &FieldError{Field: field, Err: err})
+	}
+
+	if config.InterfaceName == "" {
+		invalid("InterfaceName", ErrFieldRequired)
+	} else if err := wireguard.ValidateInterfaceName(config.InterfaceName); err != nil {
+		invalid("InterfaceName", err)
+	}
+
+	// Key errors never include the key itself, so they are safe to surface
+	if config.PrivateKey == "" {
+		invalid("PrivateKey", ErrFieldRequired)
+	} else if err := keys.ValidatePrivateKey(config.PrivateKey); err != nil {
+		invalid("PrivateKey", err)
+	}
+
+	if config.ListenPort <= 0 || config.ListenPort > MaxTCPUDPPort {
+		invalid("ListenPort", fmt.Errorf("%d is outside 1-%d", config.ListenPort, MaxTCPUDPPort))
+	}
+
+	if err := validateListenAddr(config.ListenAddr); err != nil {
+		invalid("ListenAddr", err)
+	}
+
+	if err := validateServerIP(config.ServerIP); err != nil {
+		invalid("ServerIP", err)
+	}
+
+	if config.Fwmark < 0 {
+		invalid("Fwmark", fmt.Errorf("%d is negative", config.Fwmark))
+	}
+
+	if config.AllocationAttempts < 0 {
+		invalid("AllocationAttempts", fmt.Errorf("%d is negative", config.AllocationAttempts))
+	}
+	if config.MaxAllowedIPsPerPeer < 0 {
+		invalid("MaxAllowedIPsPerPeer", fmt.Errorf("%d is negative", config.MaxAllowedIPsPerPeer))
+	}
+
+	if config.PeerActiveWindow < 0 {
+		invalid("PeerActiveWindow", fmt.Errorf("%s is negative", config.PeerActiveWindow))
+	}
+
+	if _, err := ParseSourceFilterMode(string(config.SourceFilter)); err != nil {
+		invalid("SourceFilter", err)
+	}
+
+	if _, err := ParsePersistPolicy(string(config.PersistPolicy)); err != nil {
+		invalid("PersistPolicy", err)
+	}
+
+	if len(fields) > 0 {
+		return &ServerConfigError{Fields: fields}
+	}
+	return nil
+}
+
+// validateListenAddr requires an empty address or an IP assigned to one of this host's interfaces
+func validateListenAddr(listenAddr string) error {
+	if listenAddr == "" {
+		return nil
+	}
+
+	addr, err := netip.ParseAddr(listenAddr)
+	if err != nil {
+		return fmt.Errorf("expected an IP address: %w", err)
+	}
+	if addr.IsUnspecified() {
+		return nil
+	}
+
+	ifaceAddrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return fmt.Errorf("failed to list interface addresses: %w", err)
+	}
+	for _, ifaceAddr := range ifaceAddrs {
+		ipNet, ok := ifaceAddr.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		if local, ok := netip.AddrFromSlice(ipNet.IP); ok && local.Unmap() == addr.Unmap() {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrListenAddrNotLocal, listenAddr)
+}
+
+// validateServerIP requires a CIDR whose address is a usable host of its own network
+func validateServerIP(serverIP string) error {
+	if serverIP == "" {
+		return ErrFieldRequired
+	}
+
+	prefix, err := netip.ParsePrefix(serverIP)
+	if err != nil {
+		return fmt.Errorf("expected a CIDR such as 10.0.0.1/24: %w", err)
+	}
+
+	addr := prefix.Addr()
+	if addr.Is4In6() {
+		return fmt.Errorf("%w: %s", ErrServerIPMappedFamily, serverIP)
+	}
+
+	// Single-address and point-to-point networks have no network/broadcast addresses to avoid
+	hostBits := addr.BitLen() - prefix.Bits()
+	if hostBits < 2 {
+		return nil
+	}
+	if addr == prefix.Masked().Addr() || (addr.Is4() && addr == lastAddr(prefix)) {
+		return fmt.Errorf("%w: %s", ErrServerIPNotHost, serverIP)
+	}
+	return nil
+}
+
+// lastAddr returns the highest address in prefix (the IPv4 broadcast address)
+func lastAddr(prefix netip.Prefix) netip.Addr {
+	bytes := prefix.Masked().Addr().AsSlice()
+	for i := prefix.Bits(); i < len(bytes)*8; i++ {
+		bytes[i/8] |= 1 << (7 - i%8)
+	}
+	addr, _ := netip.AddrFromSlice(bytes)
+	return addr
+}
@@ -0,0 +1,103 @@
+package vpnserver
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// invalidFields lists the fields named by a ValidateServerConfig error, in order
+func invalidFields(t *testing.T, err error) []string {
+	t.Helper()
+	if err == nil {
+		return nil
+	}
+
+	var configErr *ServerConfigError
+	if !errors.As(err, &configErr) {
+		t.Fatalf("Expected *ServerConfigError, got %T: %v", err, err)
+	}
+	var fields []string
+	for _, field := range configErr.Fields {
+		fields = append(fields, field.Field)
+	}
+	return fields
+}
+
+func TestValidateServerConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*ServerConfig)
+		fields []string
+		cause  error // Checked with errors.Is when set
+	}{
+		{name: "valid", modify: func(c *ServerConfig) {}},
+		{name: "valid IPv6", modify: func(c *ServerConfig) { c.ServerIP = "fd00::1/64" }},
+		{name: "valid point-to-point", modify: func(c *ServerConfig) { c.ServerIP = "10.0.0.0/31" }},
+		{name: "missing interface name", modify: func(c *ServerConfig) { c.InterfaceName = "" }, fields: []string{"InterfaceName"}, cause: ErrFieldRequired},
+		{name: "missing private key", modify: func(c *ServerConfig) { c.PrivateKey = "" }, fields: []string{"PrivateKey"}, cause: ErrFieldRequired},
+		{name: "malformed private key", modify: func(c *ServerConfig) { c.PrivateKey = "not-a-key" }, fields: []string{"PrivateKey"}},
+		{name: "zero listen port", modify: func(c *ServerConfig) { c.ListenPort = 0 }, fields: []string{"ListenPort"}},
+		{name: "listen port too high", modify: func(c *ServerConfig) { c.ListenPort = MaxTCPUDPPort + 1 }, fields: []string{"ListenPort"}},
+		{name: "loopback listen address", modify: func(c *ServerConfig) { c.ListenAddr = "127.0.0.1" }},
+		{name: "unspecified listen address", modify: func(c *ServerConfig) { c.ListenAddr = "0.0.0.0" }},
+		{name: "malformed listen address", modify: func(c *ServerConfig) { c.ListenAddr = "not-an-ip" }, fields: []string{"ListenAddr"}},
+		{name: "listen address with port", modify: func(c *ServerConfig) { c.ListenAddr = "127.0.0.1:51820" }, fields: []string{"ListenAddr"}},
+		{name: "listen address not on this host", modify: func(c *ServerConfig) { c.ListenAddr = "192.0.2.55" }, fields: []string{"ListenAddr"}, cause: ErrListenAddrNotLocal},
+		{name: "missing server IP", modify: func(c *ServerConfig) { c.ServerIP = "" }, fields: []string{"ServerIP"}, cause: ErrFieldRequired},
+		{name: "server IP without prefix", modify: func(c *ServerConfig) { c.ServerIP = "10.0.0.1" }, fields: []string{"ServerIP"}},
+		{name: "IPv4 prefix too long", modify: func(c *ServerConfig) { c.ServerIP = "10.0.0.1/33" }, fields: []string{"ServerIP"}},
+		{name: "IPv4-mapped server IP", modify: func(c *ServerConfig) { c.ServerIP = "::ffff:10.0.0.1/120" }, fields: []string{"ServerIP"}, cause: ErrServerIPMappedFamily},
+		{name: "server IP is network address", modify: func(c *ServerConfig) { c.ServerIP = "10.0.0.0/24" }, fields: []string{"ServerIP"}, cause: ErrServerIPNotHost},
+		{name: "server IP is broadcast address", modify: func(c *ServerConfig) { c.ServerIP = "10.0.0.255/24" }, fields: []string{"ServerIP"}, cause: ErrServerIPNotHost},
+		{name: "IPv6 server IP is subnet address", modify: func(c *ServerConfig) { c.ServerIP = "fd00::/64" }, fields: []string{"ServerIP"}, cause: ErrServerIPNotHost},
+		{name: "negative fwmark", modify: func(c *ServerConfig) { c.Fwmark = -1 }, fields: []string{"Fwmark"}},
+		{name: "negative max allowed IPs", modify: func(c *ServerConfig) { c.MaxAllowedIPsPerPeer = -1 }, fields: []string{"MaxAllowedIPsPerPeer"}},
+		{name: "negative allocation attempts", modify: func(c *ServerConfig) { c.AllocationAttempts = -1 }, fields: []string{"AllocationAttempts"}},
+		{name: "negative active window", modify: func(c *ServerConfig) { c.PeerActiveWindow = -time.Second }, fields: []string{"PeerActiveWindow"}},
+		{name: "unknown source filter", modify: func(c *ServerConfig) { c.SourceFilter = "block" }, fields: []string{"SourceFilter"}},
+		{
+			name: "several fields at once",
+			modify: func(c *ServerConfig) {
+				c.InterfaceName = ""
+				c.ListenPort = -1
+				c.ServerIP = "10.0.0.0/24"
+				c.SourceFilter = "block"
+			},
+			fields: []string{"InterfaceName", "ListenPort", "ServerIP", "SourceFilter"},
+			cause:  ErrServerIPNotHost,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := newTestServerConfig(t)
+			tt.modify(&config)
+
+			err := ValidateServerConfig(config)
+			if got := invalidFields(t, err); !reflect.DeepEqual(got, tt.fields) {
+				t.Errorf("Expected invalid fields %v, got %v (%v)", tt.fields, got, err)
+			}
+			if tt.cause != nil && !errors.Is(err, tt.cause) {
+				t.Errorf("Expected error to wrap %v, got %v", tt.cause, err)
+			}
+		})
+	}
+}
+
+func TestStartRejectsInvalidConfig(t *testing.T) {
+	config := newTestServerConfig(t)
+	config.ServerIP = "10.0.0.255/24"
+
+	backend := newFakeBackend()
+	server := NewVPNServerWithPeerStore(backend, NewInMemoryPeerStore())
+	err := server.Start(context.Background(), config)
+	if !errors.Is(err, ErrServerIPNotHost) {
+		t.Fatalf("Expected ErrServerIPNotHost, got %v", err)
+	}
+	if backend.starts != 0 {
+		t.Error("Backend should not start with an invalid config")
+	}
+}
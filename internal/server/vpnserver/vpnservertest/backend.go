@@ -0,0 +1,118 @@
+// Package vpnservertest provides test doubles for exercising the VPN server
+// without a TUN device, in the spirit of net/http/httptest.
+package vpnservertest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/november1306/go-vpn/internal/server/vpnserver"
+)
+
+// Backend is an in-memory vpnserver.WireGuardBackend that records peers
+type Backend struct {
+	mu      sync.RWMutex
+	running bool
+	peers   map[string][]string
+}
+
+// NewBackend creates a stopped in-memory backend
+func NewBackend() *Backend {
+	return &Backend{
+		peers: make(map[string][]string),
+	}
+}
+
+// Start marks the backend as running
+func (b *Backend) Start(ctx context.Context, config vpnserver.ServerConfig) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.running {
+		return fmt.Errorf("backend already running")
+	}
+	b.running = true
+	return nil
+}
+
+// Stop marks the backend as stopped and clears its peers
+func (b *Backend) Stop(ctx context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.running = false
+	b.peers = make(map[string][]string)
+	return nil
+}
+
+// AddPeer records a peer
+func (b *Backend) AddPeer(publicKey string, allowedIPs []string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.running {
+		return fmt.Errorf("backend not running")
+	}
+	b.peers[publicKey] = append([]string(nil), allowedIPs...)
+	return nil
+}
+
+// RemovePeer forgets a peer
+func (b *Backend) RemovePeer(publicKey string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.running {
+		return fmt.Errorf("backend not running")
+	}
+	delete(b.peers, publicKey)
+	return nil
+}
+
+// GetPeers returns the recorded peers
+func (b *Backend) GetPeers() ([]vpnserver.PeerInfo, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if !b.running {
+		return nil, fmt.Errorf("backend not running")
+	}
+
+	peers := make([]vpnserver.PeerInfo, 0, len(b.peers))
+	for publicKey, allowedIPs := range b.peers {
+		peers = append(peers, vpnserver.PeerInfo{
+			PublicKey:  publicKey,
+			AllowedIPs: allowedIPs,
+		})
+	}
+	return peers, nil
+}
+
+// PeerCount returns the number of recorded peers
+func (b *Backend) PeerCount() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if !b.running {
+		return 0
+	}
+	return len(b.peers)
+}
+
+// IsRunning returns whether the backend has been started
+func (b *Backend) IsRunning() bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return b.running
+}
+
+// Peer returns the allowed IPs recorded for a peer
+func (b *Backend) Peer(publicKey string) ([]string, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	allowedIPs, exists := b.peers[publicKey]
+	return allowedIPs, exists
+}
@@ -0,0 +1,71 @@
+// Package tcpshim carries WireGuard's UDP packets over a TCP stream for networks that block UDP
+//
+// Each packet is sent as a frame: a 2-byte big-endian length followed by the packet.
+// WireGuard still does all encryption; the shim only changes how packets travel.
+package tcpshim
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// MaxPacketSize is the largest packet a frame can carry (the limit of the 2-byte length)
+const MaxPacketSize = 65535
+
+// frameHeaderSize is the length prefix in front of every packet
+const frameHeaderSize = 2
+
+var (
+	// ErrEmptyPacket is returned when writing a zero-length packet, which WireGuard never sends
+	ErrEmptyPacket = errors.New("empty packet")
+
+	// ErrPacketTooLarge is returned when a packet does not fit in a frame or the read buffer
+	ErrPacketTooLarge = errors.New("packet too large")
+)
+
+// WriteFrame writes packet to w as a single length-prefixed frame
+func WriteFrame(w io.Writer, packet []byte) error {
+	if len(packet) == 0 {
+		return ErrEmptyPacket
+	}
+	if len(packet) > MaxPacketSize {
+		return fmt.Errorf("%w: %d bytes", ErrPacketTooLarge, len(packet))
+	}
+
+	// One write per frame so a header never goes out without its packet
+	frame := make([]byte, frameHeaderSize+len(packet))
+	binary.BigEndian.PutUint16(frame, uint16(len(packet)))
+	copy(frame[frameHeaderSize:], packet)
+
+	if _, err := w.Write(frame); err != nil {
+		return fmt.Errorf("failed to write frame: %w", err)
+	}
+	return nil
+}
+
+// ReadFrame reads the next frame from r into buf and returns the packet length
+// io.EOF means the stream ended cleanly between frames; a stream cut mid-frame is io.ErrUnexpectedEOF
+func ReadFrame(r io.Reader, buf []byte) (int, error) {
+	var header [frameHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, err
+	}
+
+	size := int(binary.BigEndian.Uint16(header[:]))
+	if size == 0 {
+		return 0, ErrEmptyPacket
+	}
+	if size > len(buf) {
+		return 0, fmt.Errorf("%w: %d bytes exceeds %d byte buffer", ErrPacketTooLarge, size, len(buf))
+	}
+
+	if _, err := io.ReadFull(r, buf[:size]); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, err
+	}
+	return size, nil
+}
@@ -0,0 +1,101 @@
+package tcpshim
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestFrameRoundTrip(t *testing.T) {
+	packets := [][]byte{
+		[]byte("handshake initiation"),
+		{0x01},
+		bytes.Repeat([]byte{0xab}, 1420),
+		bytes.Repeat([]byte{0xcd}, MaxPacketSize),
+	}
+
+	var stream bytes.Buffer
+	for _, packet := range packets {
+		if err := WriteFrame(&stream, packet); err != nil {
+			t.Fatalf("WriteFrame(%d bytes) failed: %v", len(packet), err)
+		}
+	}
+
+	buf := make([]byte, MaxPacketSize)
+	for i, want := range packets {
+		n, err := ReadFrame(&stream, buf)
+		if err != nil {
+			t.Fatalf("ReadFrame %d failed: %v", i, err)
+		}
+		if !bytes.Equal(buf[:n], want) {
+			t.Errorf("Frame %d: got %d bytes, want %d", i, n, len(want))
+		}
+	}
+
+	if _, err := ReadFrame(&stream, buf); err != io.EOF {
+		t.Errorf("Expected io.EOF at end of stream, got %v", err)
+	}
+}
+
+func TestWriteFrameHeader(t *testing.T) {
+	var stream bytes.Buffer
+	if err := WriteFrame(&stream, bytes.Repeat([]byte{0xff}, 0x0102)); err != nil {
+		t.Fatalf("WriteFrame failed: %v", err)
+	}
+
+	header := stream.Bytes()[:frameHeaderSize]
+	if header[0] != 0x01 || header[1] != 0x02 {
+		t.Errorf("Expected big-endian length 01 02, got % x", header)
+	}
+	if stream.Len() != frameHeaderSize+0x0102 {
+		t.Errorf("Expected %d bytes on the wire, got %d", frameHeaderSize+0x0102, stream.Len())
+	}
+}
+
+func TestWriteFrameErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		packet []byte
+		want   error
+	}{
+		{"empty packet", nil, ErrEmptyPacket},
+		{"oversized packet", make([]byte, MaxPacketSize+1), ErrPacketTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stream bytes.Buffer
+			if err := WriteFrame(&stream, tt.packet); !errors.Is(err, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, err)
+			}
+			if stream.Len() != 0 {
+				t.Errorf("Expected nothing written, got %d bytes", stream.Len())
+			}
+		})
+	}
+}
+
+func TestReadFrameErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		stream  []byte
+		bufSize int
+		want    error
+	}{
+		{"truncated header", []byte{0x00}, 16, io.ErrUnexpectedEOF},
+		{"truncated packet", []byte{0x00, 0x04, 'a', 'b'}, 16, io.ErrUnexpectedEOF},
+		{"header without packet", []byte{0x00, 0x04}, 16, io.ErrUnexpectedEOF},
+		{"zero length", []byte{0x00, 0x00}, 16, ErrEmptyPacket},
+		{"larger than buffer", []byte{0x00, 0x20, 'a'}, 16, ErrPacketTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := make([]byte, tt.bufSize)
+			if _, err := ReadFrame(bytes.NewReader(tt.stream), buf); !errors.Is(err, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
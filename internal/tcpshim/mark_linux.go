@@ -0,0 +1,20 @@
+package tcpshim
+
+import "syscall"
+
+// markControl sets SO_MARK on dialed sockets so policy routing can exempt them from the tunnel
+func markControl(fwmark int) func(network, address string, c syscall.RawConn) error {
+	if fwmark == 0 {
+		return nil
+	}
+
+	return func(network, address string, c syscall.RawConn) error {
+		var sockErr error
+		if err := c.Control(func(fd uintptr) {
+			sockErr = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_MARK, fwmark)
+		}); err != nil {
+			return err
+		}
+		return sockErr
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package tcpshim
+
+import "syscall"
+
+// markControl is a no-op: fwmark-based policy routing only exists on Linux
+func markControl(fwmark int) func(network, address string, c syscall.RawConn) error {
+	return nil
+}
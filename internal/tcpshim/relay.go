@@ -0,0 +1,260 @@
+package tcpshim
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+)
+
+// dialTimeout bounds how long the client waits for the server's TCP listener
+const dialTimeout = 10 * time.Second
+
+// relay copies packets between a TCP stream and a UDP socket until either direction fails
+// closeAll must close both sockets so the surviving direction unblocks
+func relay(stream net.Conn, recv func([]byte) (int, error), send func([]byte) (int, error), closeAll func()) {
+	done := make(chan struct{}, 2)
+
+	// UDP -> TCP
+	go func() {
+		defer func() { done <- struct{}{} }()
+		buf := make([]byte, MaxPacketSize)
+		for {
+			n, err := recv(buf)
+			if err != nil {
+				return
+			}
+			if n == 0 {
+				continue
+			}
+			if err := WriteFrame(stream, buf[:n]); err != nil {
+				return
+			}
+		}
+	}()
+
+	// TCP -> UDP
+	go func() {
+		defer func() { done <- struct{}{} }()
+		reader := bufio.NewReader(stream)
+		buf := make([]byte, MaxPacketSize)
+		for {
+			n, err := ReadFrame(reader, buf)
+			if err != nil {
+				return
+			}
+			if _, err := send(buf[:n]); err != nil {
+				return
+			}
+		}
+	}()
+
+	<-done
+	closeAll()
+	<-done
+}
+
+// Server accepts TCP connections and relays each one to the local WireGuard UDP port
+// Every connection gets its own UDP socket, so WireGuard sees each client as a separate endpoint
+type Server struct {
+	listener net.Listener
+	target   *net.UDPAddr
+
+	mu     sync.Mutex
+	conns  map[net.Conn]struct{}
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// Listen opens a TCP listener on addr that relays to the WireGuard port at target
+func Listen(addr, target string) (*Server, error) {
+	targetAddr, err := net.ResolveUDPAddr("udp", target)
+	if err != nil {
+		return nil, fmt.Errorf("invalid WireGuard address %q: %w", target, err)
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for TCP transport: %w", err)
+	}
+
+	return &Server{
+		listener: listener,
+		target:   targetAddr,
+		conns:    make(map[net.Conn]struct{}),
+	}, nil
+}
+
+// Addr returns the TCP address the server is listening on
+func (s *Server) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+// Serve accepts connections until Close is called, then returns nil
+func (s *Server) Serve() error {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return nil
+			}
+			if errors.Is(err, net.ErrClosed) {
+				return err
+			}
+			slog.Warn("TCP transport accept failed", "error", err)
+			continue
+		}
+
+		if !s.track(conn) {
+			conn.Close()
+			return nil
+		}
+		s.wg.Add(1)
+		go s.handle(conn)
+	}
+}
+
+// Close stops accepting, drops active connections and waits for their relays to finish
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+
+	err := s.listener.Close()
+	s.wg.Wait()
+	return err
+}
+
+// track registers an active connection, refusing it if the server is closing
+func (s *Server) track(conn net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return false
+	}
+	s.conns[conn] = struct{}{}
+	return true
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+	}()
+
+	packets, err := net.DialUDP("udp", nil, s.target)
+	if err != nil {
+		slog.Warn("TCP transport failed to reach WireGuard", "remote", conn.RemoteAddr(), "error", err)
+		conn.Close()
+		return
+	}
+
+	slog.Debug("TCP transport connection opened", "remote", conn.RemoteAddr())
+	relay(conn, packets.Read, packets.Write, func() {
+		conn.Close()
+		packets.Close()
+	})
+	slog.Debug("TCP transport connection closed", "remote", conn.RemoteAddr())
+}
+
+// Client exposes a local UDP endpoint for WireGuard and forwards its packets to a Server over TCP
+// It does not reconnect; Done reports when the stream is gone so the caller can tear down the tunnel
+type Client struct {
+	stream  net.Conn
+	packets *net.UDPConn
+
+	mu   sync.Mutex
+	peer *net.UDPAddr // WireGuard's socket, learned from its first packet
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+// Dial connects to the Server at serverAddr and opens the local UDP endpoint
+// A non-zero fwmark is set on the TCP socket so it bypasses a full tunnel's routing (Linux only)
+func Dial(serverAddr string, fwmark int) (*Client, error) {
+	dialer := net.Dialer{Timeout: dialTimeout, Control: markControl(fwmark)}
+	stream, err := dialer.Dial("tcp", serverAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", serverAddr, err)
+	}
+
+	packets, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		stream.Close()
+		return nil, fmt.Errorf("failed to open local UDP endpoint: %w", err)
+	}
+
+	c := &Client{
+		stream:  stream,
+		packets: packets,
+		done:    make(chan struct{}),
+	}
+	go func() {
+		relay(stream, c.recv, c.send, c.closeSockets)
+		close(c.done)
+	}()
+	return c, nil
+}
+
+// LocalAddr is the endpoint WireGuard should use for the server peer
+func (c *Client) LocalAddr() string {
+	return c.packets.LocalAddr().String()
+}
+
+// Done is closed once the relay stops, e.g. because the server closed the connection
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// Close shuts down both sockets and waits for the relay to stop
+func (c *Client) Close() error {
+	c.closeSockets()
+	<-c.done
+	return nil
+}
+
+func (c *Client) closeSockets() {
+	c.closeOnce.Do(func() {
+		c.stream.Close()
+		c.packets.Close()
+	})
+}
+
+// recv reads a packet from WireGuard, remembering where to send replies
+func (c *Client) recv(buf []byte) (int, error) {
+	n, addr, err := c.packets.ReadFromUDP(buf)
+	if err != nil {
+		return 0, err
+	}
+
+	c.mu.Lock()
+	c.peer = addr
+	c.mu.Unlock()
+	return n, nil
+}
+
+// send delivers a packet from the server to WireGuard
+// Packets arriving before WireGuard has sent anything have nowhere to go and are dropped
+func (c *Client) send(packet []byte) (int, error) {
+	c.mu.Lock()
+	peer := c.peer
+	c.mu.Unlock()
+
+	if peer == nil {
+		return len(packet), nil
+	}
+	return c.packets.WriteToUDP(packet, peer)
+}
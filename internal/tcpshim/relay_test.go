@@ -0,0 +1,83 @@
+package tcpshim
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+)
+
+// startEchoUDP stands in for the server's WireGuard port, replying to each packet with a prefix
+func startEchoUDP(t *testing.T) *net.UDPConn {
+	t.Helper()
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("Failed to listen on UDP: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buf := make([]byte, MaxPacketSize)
+		for {
+			n, addr, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			conn.WriteToUDP(append([]byte("echo:"), buf[:n]...), addr)
+		}
+	}()
+	return conn
+}
+
+func TestRelayRoundTrip(t *testing.T) {
+	wireguard := startEchoUDP(t)
+
+	server, err := Listen("127.0.0.1:0", wireguard.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	served := make(chan error, 1)
+	go func() { served <- server.Serve() }()
+
+	client, err := Dial(server.Addr().String(), 0)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer client.Close()
+
+	// The local UDP socket plays the client's WireGuard device
+	local, err := net.Dial("udp", client.LocalAddr())
+	if err != nil {
+		t.Fatalf("Failed to dial local endpoint: %v", err)
+	}
+	defer local.Close()
+
+	for _, packet := range [][]byte{[]byte("first"), bytes.Repeat([]byte{0x42}, 1420)} {
+		if _, err := local.Write(packet); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+
+		local.SetReadDeadline(time.Now().Add(5 * time.Second))
+		buf := make([]byte, MaxPacketSize)
+		n, err := local.Read(buf)
+		if err != nil {
+			t.Fatalf("Read failed: %v", err)
+		}
+		if want := append([]byte("echo:"), packet...); !bytes.Equal(buf[:n], want) {
+			t.Errorf("Got %d bytes back, want %d", n, len(want))
+		}
+	}
+
+	// Closing the server drops the stream, which the client reports via Done
+	if err := server.Close(); err != nil {
+		t.Errorf("Close failed: %v", err)
+	}
+	if err := <-served; err != nil {
+		t.Errorf("Serve returned %v after Close", err)
+	}
+	select {
+	case <-client.Done():
+	case <-time.After(5 * time.Second):
+		t.Error("Client relay did not stop after the server closed")
+	}
+}
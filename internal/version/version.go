@@ -1,3 +1,34 @@
 package version
 
+import "fmt"
+
 const Version string = "0.0.12"
+
+// Build metadata, set at link time:
+//
+//	go build -ldflags "-X github.com/november1306/go-vpn/internal/version.Commit=$(git rev-parse --short HEAD)
+//	  -X github.com/november1306/go-vpn/internal/version.BuildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+var (
+	Commit    = "unknown"
+	BuildDate = "unknown"
+)
+
+// Info is the machine-readable build description
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"buildDate"`
+}
+
+// Get returns the version and build metadata of the running binary
+func Get() Info {
+	return Info{
+		Version:   Version,
+		Commit:    Commit,
+		BuildDate: BuildDate,
+	}
+}
+
+func (i Info) String() string {
+	return fmt.Sprintf("%s (commit %s, built %s)", i.Version, i.Commit, i.BuildDate)
+}
@@ -17,13 +17,37 @@ type WireGuardDevice struct {
 	tun    tun.Device
 }
 
+// DefaultMTU leaves room for WireGuard overhead on a 1500-byte link
+const DefaultMTU = 1420
+
 // NewWireGuardDevice creates a new WireGuard device with basic configuration
 func NewWireGuardDevice(interfaceName string) (*WireGuardDevice, error) {
+	return NewWireGuardDeviceWithMTU(interfaceName, DefaultMTU)
+}
+
+// NewWireGuardDeviceWithMTU creates a new WireGuard device with the given TUN MTU
+func NewWireGuardDeviceWithMTU(interfaceName string, mtu int) (*WireGuardDevice, error) {
+	return NewWireGuardDeviceWrapped(interfaceName, mtu, nil)
+}
+
+// TUNWrapper wraps the TUN device so callers can inspect packets between WireGuard and the kernel
+type TUNWrapper func(tun.Device) tun.Device
+
+// NewWireGuardDeviceWrapped creates a WireGuard device whose TUN is passed through wrap (nil = unwrapped)
+func NewWireGuardDeviceWrapped(interfaceName string, mtu int, wrap TUNWrapper) (*WireGuardDevice, error) {
+	// Catch bad names before the TUN driver returns a cryptic error
+	if err := ValidateInterfaceName(interfaceName); err != nil {
+		return nil, err
+	}
+
 	// Create TUN interface
-	tunDevice, err := tun.CreateTUN(interfaceName, 1420)
+	tunDevice, err := tun.CreateTUN(interfaceName, mtu)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create TUN interface: %w", err)
 	}
+	if wrap != nil {
+		tunDevice = wrap(tunDevice)
+	}
 
 	// Create logger for device
 	logger := device.NewLogger(
@@ -32,6 +56,9 @@ func NewWireGuardDevice(interfaceName string) (*WireGuardDevice, error) {
 	)
 
 	// Create WireGuard device
+	// The default bind sizes UDP socket buffers itself (7 MiB, forced past
+	// rmem_max/wmem_max on Linux when privileged) and exposes no option to
+	// tune them, so buffer size is not configurable here
 	wgDevice := device.NewDevice(tunDevice, conn.NewDefaultBind(), logger)
 
 	return &WireGuardDevice{
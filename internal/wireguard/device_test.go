@@ -32,13 +32,9 @@ func TestGenerateKeyPair(t *testing.T) {
 func TestNewWireGuardDevice(t *testing.T) {
 	t.Run("handles empty interface name", func(t *testing.T) {
 		_, err := NewWireGuardDevice("")
-		// Should attempt to create device with empty name and handle TUN creation error
-		if err == nil {
-			t.Log("Device creation succeeded unexpectedly")
-		}
-		// Our function should wrap TUN creation errors properly
-		if err != nil && !strings.Contains(err.Error(), "failed to create TUN interface") {
-			t.Errorf("Expected our error message format, got: %v", err)
+		// Should be rejected before attempting TUN creation
+		if err == nil || !strings.Contains(err.Error(), "invalid interface name") {
+			t.Errorf("Expected invalid interface name error, got: %v", err)
 		}
 	})
 
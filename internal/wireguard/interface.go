@@ -0,0 +1,108 @@
+package wireguard
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"runtime"
+	"strings"
+)
+
+// ErrInterfaceExists is returned when the requested interface name is already taken on this host
+var ErrInterfaceExists = errors.New("interface already exists")
+
+// InterfaceLister returns the system's network interfaces (net.Interfaces outside tests)
+type InterfaceLister func() ([]net.Interface, error)
+
+// CheckInterfaceFree returns ErrInterfaceExists when an interface called name is already present
+// A second server or client using the same name would otherwise fail deep inside TUN creation
+func CheckInterfaceFree(name string, list InterfaceLister) error {
+	if name == "utun" {
+		return nil // macOS picks a free utun number itself
+	}
+
+	ifaces, err := list()
+	if err != nil {
+		return fmt.Errorf("failed to list interfaces: %w", err)
+	}
+	for _, iface := range ifaces {
+		if iface.Name == name {
+			return fmt.Errorf("%w: %s is in use by another VPN instance or program", ErrInterfaceExists, name)
+		}
+	}
+	return nil
+}
+
+const (
+	// maxLinuxInterfaceName is IFNAMSIZ minus the trailing NUL
+	maxLinuxInterfaceName = 15
+
+	// maxWindowsInterfaceName keeps adapter names well under the Wintun limit
+	maxWindowsInterfaceName = 127
+)
+
+// ValidateInterfaceName checks that name can be used as a TUN interface on this platform
+func ValidateInterfaceName(name string) error {
+	return validateInterfaceName(name, runtime.GOOS)
+}
+
+// validateInterfaceName applies the naming rules for the given GOOS
+func validateInterfaceName(name, goos string) error {
+	if name == "" {
+		return fmt.Errorf("invalid interface name: name is empty")
+	}
+
+	switch goos {
+	case "darwin":
+		// macOS only allows utun devices; "utun" lets the kernel pick the number
+		if name != "utun" && !(strings.HasPrefix(name, "utun") && isDigits(name[len("utun"):])) {
+			return fmt.Errorf("invalid interface name %q: must be \"utun\" or \"utun<N>\" on macOS", name)
+		}
+		return nil
+
+	case "windows":
+		if len(name) > maxWindowsInterfaceName {
+			return fmt.Errorf("invalid interface name %q: longer than %d characters", name, maxWindowsInterfaceName)
+		}
+		for _, r := range name {
+			if !isInterfaceNameChar(r) && r != ' ' {
+				return fmt.Errorf("invalid interface name %q: use letters, digits, spaces, '-', '_' or '.'", name)
+			}
+		}
+		return nil
+
+	default:
+		if len(name) > maxLinuxInterfaceName {
+			return fmt.Errorf("invalid interface name %q: %d characters exceeds the %d character limit; try a shorter name like \"wg0\"",
+				name, len(name), maxLinuxInterfaceName)
+		}
+		if name == "." || name == ".." {
+			return fmt.Errorf("invalid interface name %q: reserved name", name)
+		}
+		for _, r := range name {
+			if !isInterfaceNameChar(r) {
+				return fmt.Errorf("invalid interface name %q: use only letters, digits, '-', '_' or '.'", name)
+			}
+		}
+		return nil
+	}
+}
+
+// isInterfaceNameChar reports whether r is portable in interface names
+func isInterfaceNameChar(r rune) bool {
+	return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') ||
+		r == '-' || r == '_' || r == '.'
+}
+
+// isDigits reports whether s is a non-empty run of ASCII digits
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
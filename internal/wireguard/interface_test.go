@@ -0,0 +1,83 @@
+package wireguard
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestValidateInterfaceName(t *testing.T) {
+	tests := []struct {
+		name    string
+		iface   string
+		goos    string
+		wantErr string
+	}{
+		{name: "linux valid", iface: "wg-go-vpn", goos: "linux"},
+		{name: "linux at limit", iface: "wg-abcdefghijkl", goos: "linux"},
+		{name: "linux too long", iface: "wg-abcdefghijklm", goos: "linux", wantErr: "exceeds the 15 character limit"},
+		{name: "linux empty", iface: "", goos: "linux", wantErr: "name is empty"},
+		{name: "linux slash", iface: "wg/0", goos: "linux", wantErr: "use only letters"},
+		{name: "linux space", iface: "wg 0", goos: "linux", wantErr: "use only letters"},
+		{name: "linux reserved", iface: "..", goos: "linux", wantErr: "reserved name"},
+		{name: "darwin utun", iface: "utun", goos: "darwin"},
+		{name: "darwin numbered", iface: "utun7", goos: "darwin"},
+		{name: "darwin other name", iface: "wg0", goos: "darwin", wantErr: "utun"},
+		{name: "darwin bad suffix", iface: "utunx", goos: "darwin", wantErr: "utun"},
+		{name: "windows spaces", iface: "Go VPN", goos: "windows"},
+		{name: "windows illegal char", iface: "wg\\0", goos: "windows", wantErr: "use letters"},
+		{name: "windows too long", iface: strings.Repeat("a", 128), goos: "windows", wantErr: "longer than"},
+		{name: "windows empty", iface: "", goos: "windows", wantErr: "name is empty"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateInterfaceName(tt.iface, tt.goos)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Expected %q to be valid on %s: %v", tt.iface, tt.goos, err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestCheckInterfaceFree(t *testing.T) {
+	present := func() ([]net.Interface, error) {
+		return []net.Interface{{Name: "lo"}, {Name: "wg0"}}, nil
+	}
+
+	tests := []struct {
+		name    string
+		iface   string
+		list    InterfaceLister
+		wantErr error
+	}{
+		{name: "name free", iface: "wg1", list: present},
+		{name: "name taken", iface: "wg0", list: present, wantErr: ErrInterfaceExists},
+		{name: "macOS utun is never checked", iface: "utun", list: func() ([]net.Interface, error) {
+			return []net.Interface{{Name: "utun"}}, nil
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckInterfaceFree(tt.iface, tt.list)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("CheckInterfaceFree(%q) = %v, want %v", tt.iface, err, tt.wantErr)
+			}
+		})
+	}
+
+	t.Run("listing failure", func(t *testing.T) {
+		err := CheckInterfaceFree("wg0", func() ([]net.Interface, error) { return nil, errors.New("netlink down") })
+		if err == nil || errors.Is(err, ErrInterfaceExists) {
+			t.Errorf("Expected a listing error, got %v", err)
+		}
+	})
+}
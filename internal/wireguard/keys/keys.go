@@ -2,12 +2,37 @@ package keys
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/base64"
+	"errors"
 	"fmt"
+	"strings"
+	"unicode"
 
 	"golang.org/x/crypto/curve25519"
 )
 
+// ErrLowOrderKey is returned when key derivation yields the all-zero (low-order) point
+// Such a key would give every peer the same all-zero shared secret, so it must never be used
+var ErrLowOrderKey = errors.New("key derivation produced a low-order point")
+
+// basePoint is the Curve25519 generator (overridable in tests to exercise low-order handling)
+var basePoint = curve25519.Basepoint
+
+// derivePublicKey multiplies the private scalar by the base point, rejecting all-zero output
+// x/crypto already refuses low-order results; the explicit check keeps the guarantee local
+func derivePublicKey(privateKeyBytes []byte) ([]byte, error) {
+	publicKeyBytes, err := curve25519.X25519(privateKeyBytes, basePoint)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrLowOrderKey, err)
+	}
+	if subtle.ConstantTimeCompare(publicKeyBytes, make([]byte, curve25519.PointSize)) == 1 {
+		return nil, ErrLowOrderKey
+	}
+	return publicKeyBytes, nil
+}
+
 // GenerateKeyPair generates a WireGuard-compatible private/public key pair.
 // Returns base64-encoded private and public keys suitable for WireGuard configuration.
 func GenerateKeyPair() (privateKey string, publicKey string, err error) {
@@ -24,7 +49,7 @@ func GenerateKeyPair() (privateKey string, publicKey string, err error) {
 	privateKeyBytes[31] |= 64
 
 	// Generate public key from private key using Curve25519
-	publicKeyBytes, err := curve25519.X25519(privateKeyBytes, curve25519.Basepoint)
+	publicKeyBytes, err := derivePublicKey(privateKeyBytes)
 	if err != nil {
 		return "", "", fmt.Errorf("failed to generate public key: %w", err)
 	}
@@ -37,7 +62,13 @@ func GenerateKeyPair() (privateKey string, publicKey string, err error) {
 }
 
 // ValidatePrivateKey validates that a base64-encoded private key is properly formatted
+// Surrounding whitespace is ignored; callers should use strings.TrimSpace on the key they store
 func ValidatePrivateKey(privateKey string) error {
+	privateKey, err := trimKey(privateKey, "private")
+	if err != nil {
+		return err
+	}
+
 	keyBytes, err := base64.StdEncoding.DecodeString(privateKey)
 	if err != nil {
 		return fmt.Errorf("invalid base64 encoding: %w", err)
@@ -51,7 +82,13 @@ func ValidatePrivateKey(privateKey string) error {
 }
 
 // ValidatePublicKey validates that a base64-encoded public key is properly formatted
+// Surrounding whitespace is ignored; callers should use strings.TrimSpace on the key they store
 func ValidatePublicKey(publicKey string) error {
+	publicKey, err := trimKey(publicKey, "public")
+	if err != nil {
+		return err
+	}
+
 	keyBytes, err := base64.StdEncoding.DecodeString(publicKey)
 	if err != nil {
 		return fmt.Errorf("invalid base64 encoding: %w", err)
@@ -64,6 +101,21 @@ func ValidatePublicKey(publicKey string) error {
 	return nil
 }
 
+// trimKey strips surrounding whitespace and rejects empty or internally-spaced keys
+// Embedded newlines in particular would break the line-based WireGuard UAPI format
+func trimKey(key, kind string) (string, error) {
+	trimmed := strings.TrimSpace(key)
+	if trimmed == "" {
+		return "", fmt.Errorf("%s key is empty", kind)
+	}
+
+	if strings.IndexFunc(trimmed, unicode.IsSpace) != -1 {
+		return "", fmt.Errorf("%s key must not contain whitespace or newlines", kind)
+	}
+
+	return trimmed, nil
+}
+
 // PublicKeyFromPrivate derives the public key from a given private key
 func PublicKeyFromPrivate(privateKey string) (string, error) {
 	privateKeyBytes, err := base64.StdEncoding.DecodeString(privateKey)
@@ -76,10 +128,17 @@ func PublicKeyFromPrivate(privateKey string) (string, error) {
 	}
 
 	// Generate public key from private key
-	publicKeyBytes, err := curve25519.X25519(privateKeyBytes, curve25519.Basepoint)
+	publicKeyBytes, err := derivePublicKey(privateKeyBytes)
 	if err != nil {
 		return "", fmt.Errorf("failed to derive public key: %w", err)
 	}
 
 	return base64.StdEncoding.EncodeToString(publicKeyBytes), nil
 }
+
+// ShortID returns a stable, non-reversible short identifier for a key, suitable for logs
+// It hashes the input so it never panics on short or invalid keys and doesn't leak the key itself
+func ShortID(publicKey string) string {
+	sum := sha256.Sum256([]byte(publicKey))
+	return base64.RawURLEncoding.EncodeToString(sum[:])[:8]
+}
@@ -2,6 +2,7 @@ package keys
 
 import (
 	"encoding/base64"
+	"errors"
 	"strings"
 	"testing"
 )
@@ -153,6 +154,50 @@ func TestValidatePublicKey(t *testing.T) {
 	})
 }
 
+func TestValidateKeyWhitespace(t *testing.T) {
+	privateKey, publicKey, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair() failed: %v", err)
+	}
+
+	validators := map[string]struct {
+		validate func(string) error
+		key      string
+	}{
+		"private": {ValidatePrivateKey, privateKey},
+		"public":  {ValidatePublicKey, publicKey},
+	}
+
+	for kind, v := range validators {
+		t.Run(kind+" whitespace only", func(t *testing.T) {
+			err := v.validate("   \t ")
+			if err == nil || !strings.Contains(err.Error(), kind+" key is empty") {
+				t.Errorf("expected empty key error, got %v", err)
+			}
+		})
+
+		t.Run(kind+" leading and trailing spaces", func(t *testing.T) {
+			if err := v.validate("  " + v.key + "\n"); err != nil {
+				t.Errorf("expected surrounding whitespace to be ignored, got %v", err)
+			}
+		})
+
+		t.Run(kind+" embedded newline", func(t *testing.T) {
+			err := v.validate(v.key[:20] + "\n" + v.key[20:])
+			if err == nil || !strings.Contains(err.Error(), "must not contain whitespace") {
+				t.Errorf("expected embedded newline error, got %v", err)
+			}
+		})
+
+		t.Run(kind+" internal space", func(t *testing.T) {
+			err := v.validate(v.key[:10] + " " + v.key[10:])
+			if err == nil || !strings.Contains(err.Error(), "must not contain whitespace") {
+				t.Errorf("expected internal space error, got %v", err)
+			}
+		})
+	}
+}
+
 func TestPublicKeyFromPrivate(t *testing.T) {
 	t.Run("derives correct public key", func(t *testing.T) {
 		privateKey, expectedPublicKey, err := GenerateKeyPair()
@@ -212,6 +257,27 @@ func TestPublicKeyFromPrivate(t *testing.T) {
 	})
 }
 
+func TestPublicKeyFromPrivateLowOrder(t *testing.T) {
+	// With the real generator every clamped scalar yields a valid point, so swap in
+	// the order-4 point u=1 and a scalar that is a multiple of its order
+	original := basePoint
+	defer func() { basePoint = original }()
+	lowOrderPoint := make([]byte, 32)
+	lowOrderPoint[0] = 1
+	basePoint = lowOrderPoint
+
+	crafted := make([]byte, 32)
+	crafted[31] = 64 // 2^254 after clamping
+	_, err := PublicKeyFromPrivate(base64.StdEncoding.EncodeToString(crafted))
+	if !errors.Is(err, ErrLowOrderKey) {
+		t.Fatalf("Expected ErrLowOrderKey, got %v", err)
+	}
+
+	if _, _, err := GenerateKeyPair(); !errors.Is(err, ErrLowOrderKey) {
+		t.Errorf("Expected GenerateKeyPair to reject low-order output, got %v", err)
+	}
+}
+
 func TestWireGuardCompatibility(t *testing.T) {
 	t.Run("key format matches WireGuard expectations", func(t *testing.T) {
 		privateKey, publicKey, err := GenerateKeyPair()
@@ -275,3 +341,38 @@ func BenchmarkPublicKeyFromPrivate(b *testing.B) {
 		}
 	}
 }
+
+func TestShortID(t *testing.T) {
+	_, publicKey, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair() failed: %v", err)
+	}
+
+	t.Run("stable and short", func(t *testing.T) {
+		id := ShortID(publicKey)
+		if len(id) != 8 {
+			t.Errorf("ShortID() length = %d, want 8", len(id))
+		}
+		if ShortID(publicKey) != id {
+			t.Error("ShortID() should be stable for the same key")
+		}
+		if strings.Contains(publicKey, id) {
+			t.Error("ShortID() should not expose a substring of the key")
+		}
+	})
+
+	t.Run("distinct keys give distinct IDs", func(t *testing.T) {
+		_, otherKey, _ := GenerateKeyPair()
+		if ShortID(publicKey) == ShortID(otherKey) {
+			t.Error("ShortID() collided for different keys")
+		}
+	})
+
+	t.Run("short and invalid input does not panic", func(t *testing.T) {
+		for _, input := range []string{"", "abc", "not base64!!", "\n"} {
+			if id := ShortID(input); len(id) != 8 {
+				t.Errorf("ShortID(%q) length = %d, want 8", input, len(id))
+			}
+		}
+	})
+}
@@ -0,0 +1,94 @@
+package keys
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/curve25519"
+)
+
+// Actions a key ownership proof can authorize; a proof for one is never valid for another
+const (
+	ProofReplaceKey = "replace-key"
+	ProofUnregister = "unregister"
+)
+
+// ProofMaxAge is how far a proof's timestamp may be from the verifier's clock
+const ProofMaxAge = 5 * time.Minute
+
+var (
+	// ErrInvalidProof is returned when a proof wasn't made with the claimed key
+	ErrInvalidProof = errors.New("invalid key ownership proof")
+
+	// ErrProofExpired is returned when a proof's timestamp is outside ProofMaxAge
+	ErrProofExpired = errors.New("key ownership proof expired")
+)
+
+// proofLabel separates ownership proofs from any other use of the shared secret
+const proofLabel = "go-vpn key ownership v1"
+
+// sharedSecret computes the X25519 secret between privateKey and peerPublicKey
+// Both sides of a key pair exchange arrive at the same value
+func sharedSecret(privateKey, peerPublicKey string) ([]byte, error) {
+	privateKeyBytes, err := base64.StdEncoding.DecodeString(strings.TrimSpace(privateKey))
+	if err != nil || len(privateKeyBytes) != curve25519.ScalarSize {
+		return nil, fmt.Errorf("invalid private key")
+	}
+	publicKeyBytes, err := base64.StdEncoding.DecodeString(strings.TrimSpace(peerPublicKey))
+	if err != nil || len(publicKeyBytes) != curve25519.PointSize {
+		return nil, fmt.Errorf("invalid public key")
+	}
+
+	secret, err := curve25519.X25519(privateKeyBytes, publicKeyBytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrLowOrderKey, err)
+	}
+	return secret, nil
+}
+
+// proofMAC authenticates action, fields and timestamp with the shared secret
+func proofMAC(secret []byte, timestamp int64, action string, fields []string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	for _, part := range append([]string{proofLabel, action, strconv.FormatInt(timestamp, 10)}, fields...) {
+		mac.Write([]byte(part))
+		mac.Write([]byte{0})
+	}
+	return mac.Sum(nil)
+}
+
+// ProveOwnership shows the server that a request about a peer comes from the holder of its private key
+// The proof is a MAC keyed by the X25519 secret privateKey shares with serverPublicKey, so only
+// the server can check it and it reveals nothing that would sign a different request
+func ProveOwnership(privateKey, serverPublicKey string, timestamp int64, action string, fields ...string) (string, error) {
+	secret, err := sharedSecret(privateKey, serverPublicKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to derive proof key: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(proofMAC(secret, timestamp, action, fields)), nil
+}
+
+// VerifyOwnership checks a ProveOwnership proof made by the holder of clientPublicKey
+func VerifyOwnership(serverPrivateKey, clientPublicKey, proof string, timestamp int64, now time.Time, action string, fields ...string) error {
+	if age := now.Sub(time.Unix(timestamp, 0)); age > ProofMaxAge || age < -ProofMaxAge {
+		return ErrProofExpired
+	}
+
+	got, err := base64.StdEncoding.DecodeString(proof)
+	if err != nil {
+		return ErrInvalidProof
+	}
+	secret, err := sharedSecret(serverPrivateKey, clientPublicKey)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidProof, err)
+	}
+	if !hmac.Equal(got, proofMAC(secret, timestamp, action, fields)) {
+		return ErrInvalidProof
+	}
+	return nil
+}
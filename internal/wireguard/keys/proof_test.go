@@ -0,0 +1,62 @@
+package keys
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestOwnershipProof(t *testing.T) {
+	serverPriv, serverPub, _ := GenerateKeyPair()
+	clientPriv, clientPub, _ := GenerateKeyPair()
+	_, otherPub, _ := GenerateKeyPair()
+	_, newPub, _ := GenerateKeyPair()
+
+	now := time.Unix(1700000000, 0)
+	proof, err := ProveOwnership(clientPriv, serverPub, now.Unix(), ProofReplaceKey, clientPub, newPub)
+	if err != nil {
+		t.Fatalf("ProveOwnership failed: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		clientPub string
+		proof     string
+		timestamp int64
+		action    string
+		fields    []string
+		want      error
+	}{
+		{"valid", clientPub, proof, now.Unix(), ProofReplaceKey, []string{clientPub, newPub}, nil},
+		{"other key", otherPub, proof, now.Unix(), ProofReplaceKey, []string{clientPub, newPub}, ErrInvalidProof},
+		{"other action", clientPub, proof, now.Unix(), ProofUnregister, []string{clientPub, newPub}, ErrInvalidProof},
+		{"other new key", clientPub, proof, now.Unix(), ProofReplaceKey, []string{clientPub, otherPub}, ErrInvalidProof},
+		{"timestamp changed", clientPub, proof, now.Unix() + 1, ProofReplaceKey, []string{clientPub, newPub}, ErrInvalidProof},
+		{"not base64", clientPub, "!!", now.Unix(), ProofReplaceKey, []string{clientPub, newPub}, ErrInvalidProof},
+		{"empty", clientPub, "", now.Unix(), ProofReplaceKey, []string{clientPub, newPub}, ErrInvalidProof},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := VerifyOwnership(serverPriv, tt.clientPub, tt.proof, tt.timestamp, now.Add(time.Minute), tt.action, tt.fields...)
+			if !errors.Is(err, tt.want) || (tt.want == nil && err != nil) {
+				t.Errorf("VerifyOwnership() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	t.Run("expired", func(t *testing.T) {
+		for _, skew := range []time.Duration{ProofMaxAge + time.Second, -ProofMaxAge - time.Second} {
+			err := VerifyOwnership(serverPriv, clientPub, proof, now.Unix(), now.Add(skew), ProofReplaceKey, clientPub, newPub)
+			if !errors.Is(err, ErrProofExpired) {
+				t.Errorf("Clock skew %s: expected ErrProofExpired, got %v", skew, err)
+			}
+		}
+	})
+
+	t.Run("invalid server key", func(t *testing.T) {
+		if _, err := ProveOwnership(clientPriv, "not-a-key", now.Unix(), ProofUnregister, clientPub); err == nil {
+			t.Error("Expected an error for an invalid server public key")
+		}
+	})
+}
@@ -0,0 +1,99 @@
+package wireguard
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+)
+
+const (
+	// OverheadIPv4 is the per-packet cost of WireGuard over IPv4: 20 IP + 8 UDP + 32 WireGuard
+	OverheadIPv4 = 60
+
+	// OverheadIPv6 is the per-packet cost of WireGuard over IPv6: 40 IP + 8 UDP + 32 WireGuard
+	OverheadIPv6 = 80
+
+	// MinMTU is the smallest tunnel MTU worth configuring (the IPv4 minimum reassembly size)
+	MinMTU = 576
+)
+
+// Overhead returns the encapsulation overhead when the outer packets are IPv6 or IPv4
+func Overhead(ipv6 bool) int {
+	if ipv6 {
+		return OverheadIPv6
+	}
+	return OverheadIPv4
+}
+
+// MaxTunnelMTU returns the largest tunnel MTU whose encrypted packets fit a link of linkMTU
+func MaxTunnelMTU(linkMTU int, ipv6 bool) int {
+	return linkMTU - Overhead(ipv6)
+}
+
+// MTUCheck compares a tunnel MTU with the link its encrypted packets leave through
+type MTUCheck struct {
+	Interface string // Link carrying traffic to the peer
+	LinkMTU   int
+	IPv6      bool // Outer packets are IPv6
+	TunnelMTU int
+}
+
+// SafeMTU is the largest tunnel MTU the link can carry without fragmenting
+func (c MTUCheck) SafeMTU() int {
+	return MaxTunnelMTU(c.LinkMTU, c.IPv6)
+}
+
+// TooLarge reports whether encrypted packets at TunnelMTU exceed the link MTU
+// Handshakes still fit, so such tunnels come up and then stall on full-size packets
+func (c MTUCheck) TooLarge() bool {
+	return c.TunnelMTU > c.SafeMTU()
+}
+
+// CheckRouteMTU checks tunnelMTU against the interface the system routes remote through
+func CheckRouteMTU(tunnelMTU int, remote netip.Addr) (MTUCheck, error) {
+	name, linkMTU, err := routeInterface(remote)
+	if err != nil {
+		return MTUCheck{}, err
+	}
+	return MTUCheck{
+		Interface: name,
+		LinkMTU:   linkMTU,
+		IPv6:      !remote.Unmap().Is4(),
+		TunnelMTU: tunnelMTU,
+	}, nil
+}
+
+// DefaultRouteProbe is an address routed like any internet host (TEST-NET-1, never contacted)
+var DefaultRouteProbe = netip.MustParseAddr("192.0.2.1")
+
+// routeInterface finds the interface and MTU used to reach remote
+// Connecting a UDP socket only selects a route and source address; no packet is sent
+func routeInterface(remote netip.Addr) (string, int, error) {
+	conn, err := net.DialUDP("udp", nil, net.UDPAddrFromAddrPort(netip.AddrPortFrom(remote.Unmap(), 9)))
+	if err != nil {
+		return "", 0, fmt.Errorf("no route to %s: %w", remote, err)
+	}
+	local := conn.LocalAddr().(*net.UDPAddr).AddrPort().Addr().Unmap()
+	conn.Close()
+
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to list interfaces: %w", err)
+	}
+	for _, iface := range ifaces {
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			ipNet, ok := addr.(*net.IPNet)
+			if !ok {
+				continue
+			}
+			if ip, ok := netip.AddrFromSlice(ipNet.IP); ok && ip.Unmap() == local {
+				return iface.Name, iface.MTU, nil
+			}
+		}
+	}
+	return "", 0, fmt.Errorf("no interface has source address %s", local)
+}
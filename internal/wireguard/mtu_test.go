@@ -0,0 +1,65 @@
+package wireguard
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestMaxTunnelMTU(t *testing.T) {
+	tests := []struct {
+		name    string
+		linkMTU int
+		ipv6    bool
+		want    int
+	}{
+		{"ethernet over IPv4", 1500, false, 1440},
+		{"ethernet over IPv6", 1500, true, 1420},
+		{"PPPoE over IPv4", 1492, false, 1432},
+		{"PPPoE over IPv6", 1492, true, 1412},
+		{"IPv6 minimum link", 1280, true, 1200},
+		{"nested tunnel", 1420, false, 1360},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MaxTunnelMTU(tt.linkMTU, tt.ipv6); got != tt.want {
+				t.Errorf("MaxTunnelMTU(%d, %v) = %d, want %d", tt.linkMTU, tt.ipv6, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMTUCheckTooLarge(t *testing.T) {
+	tests := []struct {
+		name  string
+		check MTUCheck
+		want  bool
+	}{
+		{"default MTU on ethernet IPv6", MTUCheck{LinkMTU: 1500, IPv6: true, TunnelMTU: DefaultMTU}, false},
+		{"default MTU on ethernet IPv4", MTUCheck{LinkMTU: 1500, TunnelMTU: DefaultMTU}, false},
+		{"default MTU on PPPoE IPv6", MTUCheck{LinkMTU: 1492, IPv6: true, TunnelMTU: DefaultMTU}, true},
+		{"default MTU on PPPoE IPv4", MTUCheck{LinkMTU: 1492, TunnelMTU: DefaultMTU}, false},
+		{"default MTU inside another tunnel", MTUCheck{LinkMTU: 1420, TunnelMTU: DefaultMTU}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.check.TooLarge(); got != tt.want {
+				t.Errorf("TooLarge() = %v, want %v (safe MTU %d)", got, tt.want, tt.check.SafeMTU())
+			}
+		})
+	}
+}
+
+func TestCheckRouteMTULoopback(t *testing.T) {
+	check, err := CheckRouteMTU(DefaultMTU, netip.MustParseAddr("127.0.0.1"))
+	if err != nil {
+		t.Skipf("Loopback route unavailable: %v", err)
+	}
+	if check.LinkMTU <= 0 || check.Interface == "" {
+		t.Errorf("Expected loopback interface and MTU, got %+v", check)
+	}
+	if check.IPv6 {
+		t.Error("Expected IPv4 outer packets for an IPv4 remote")
+	}
+}